@@ -4,16 +4,20 @@ import (
 	"errors"
 )
 
+// AtlasNode is one segment of the skyline kept by Atlas.
 type AtlasNode struct {
 	x, y, width int16
 }
 
+// Atlas packs rectangles into a fixed size area with the skyline bottom-left algorithm.
+// FontStash uses it for glyphs and vg.ImageAtlas uses it for small images.
 type Atlas struct {
 	width, height int
 	nodes         []AtlasNode
 }
 
-func newAtlas(width, height, nnode int) *Atlas {
+// NewAtlas creates an empty atlas. nnode is the initial capacity of the skyline.
+func NewAtlas(width, height, nnode int) *Atlas {
 	atlas := &Atlas{
 		width:  width,
 		height: height,
@@ -86,7 +90,9 @@ func (atlas *Atlas) removeNode(idx int) {
 	atlas.nodes = append(atlas.nodes[:idx], atlas.nodes[idx+1:]...)
 }
 
-func (atlas *Atlas) addRect(rw, rh int) (bestX, bestY int, err error) {
+// AddRect finds a place for a rw x rh rectangle and returns its top-left corner.
+// It returns an error when the atlas has no room for the rectangle.
+func (atlas *Atlas) AddRect(rw, rh int) (bestX, bestY int, err error) {
 	bestH := atlas.height
 	bestW := atlas.width
 	bestI := -1
@@ -113,7 +119,26 @@ func (atlas *Atlas) addRect(rw, rh int) (bestX, bestY int, err error) {
 	return
 }
 
-func (atlas *Atlas) reset(width, height int) {
+// Size returns the size of the atlas.
+func (atlas *Atlas) Size() (int, int) {
+	return atlas.width, atlas.height
+}
+
+// Usage returns the ratio of the area under the skyline to the whole atlas, from 0 to 1.
+// Gaps below the skyline are counted as used.
+func (atlas *Atlas) Usage() float32 {
+	if atlas.width == 0 || atlas.height == 0 {
+		return 0
+	}
+	used := 0
+	for _, node := range atlas.nodes {
+		used += int(node.width) * int(node.y)
+	}
+	return float32(used) / float32(atlas.width*atlas.height)
+}
+
+// Reset removes all rectangles and resizes the atlas.
+func (atlas *Atlas) Reset(width, height int) {
 	atlas.width = width
 	atlas.height = height
 	if len(atlas.nodes) != 1 {
@@ -0,0 +1,32 @@
+package font
+
+import (
+	"image"
+	"image/png"
+	"io"
+)
+
+// AtlasImage returns a copy of the glyph atlas, with the coverages or the signed
+// distance fields of the glyphs. LCD glyphs are three times as wide as drawn.
+func (stash *FontStash) AtlasImage() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, stash.params.width, stash.params.height))
+	copy(img.Pix, stash.textureData)
+	return img
+}
+
+// ColorAtlasImage returns a copy of the atlas of color glyphs, nil if no color
+// glyph was rasterized yet.
+func (stash *FontStash) ColorAtlasImage() *image.RGBA {
+	if stash.color == nil {
+		return nil
+	}
+	img := image.NewRGBA(image.Rect(0, 0, FONS_COLOR_ATLAS_SIZE, FONS_COLOR_ATLAS_SIZE))
+	copy(img.Pix, stash.color.data)
+	return img
+}
+
+// WriteAtlasPNG writes the glyph atlas as a PNG image, which shows what the
+// glyph cache holds.
+func (stash *FontStash) WriteAtlasPNG(w io.Writer) error {
+	return png.Encode(w, stash.AtlasImage())
+}
@@ -0,0 +1,712 @@
+package font
+
+import (
+	"sort"
+)
+
+// FONSDirection is the base direction of paragraphs.
+type FONSDirection int
+
+const (
+	DIRECTION_AUTO FONSDirection = iota // direction of the first strong character, left to right without one
+	DIRECTION_LTR
+	DIRECTION_RTL
+)
+
+// bidiClass is a bidirectional character type of UAX #9.
+type bidiClass uint8
+
+const (
+	bidiL bidiClass = iota
+	bidiR
+	bidiAL
+	bidiEN
+	bidiES
+	bidiET
+	bidiAN
+	bidiCS
+	bidiNSM
+	bidiBN
+	bidiB
+	bidiS
+	bidiWS
+	bidiON
+	bidiLRE
+	bidiLRO
+	bidiRLE
+	bidiRLO
+	bidiPDF
+	bidiLRI
+	bidiRLI
+	bidiFSI
+	bidiPDI
+)
+
+const bidiMaxDepth = 125
+
+// bidiClasses are the ranges of runes which are not bidiL.
+var bidiClasses = []struct {
+	first, last rune
+	class       bidiClass
+}{
+	{0x0000, 0x0008, bidiBN}, {0x0009, 0x0009, bidiS}, {0x000A, 0x000A, bidiB}, {0x000B, 0x000B, bidiS},
+	{0x000C, 0x000C, bidiWS}, {0x000D, 0x000D, bidiB}, {0x000E, 0x001B, bidiBN}, {0x001C, 0x001E, bidiB},
+	{0x001F, 0x001F, bidiS}, {0x0020, 0x0020, bidiWS}, {0x0021, 0x0022, bidiON}, {0x0023, 0x0025, bidiET},
+	{0x0026, 0x002A, bidiON}, {0x002B, 0x002B, bidiES}, {0x002C, 0x002C, bidiCS}, {0x002D, 0x002D, bidiES},
+	{0x002E, 0x002F, bidiCS}, {0x0030, 0x0039, bidiEN}, {0x003A, 0x003A, bidiCS}, {0x003B, 0x0040, bidiON},
+	{0x005B, 0x0060, bidiON}, {0x007B, 0x007E, bidiON}, {0x007F, 0x0084, bidiBN}, {0x0085, 0x0085, bidiB},
+	{0x0086, 0x009F, bidiBN}, {0x00A0, 0x00A0, bidiCS}, {0x00A1, 0x00A1, bidiON}, {0x00A2, 0x00A5, bidiET},
+	{0x00A6, 0x00A9, bidiON}, {0x00AB, 0x00AC, bidiON}, {0x00AD, 0x00AD, bidiBN}, {0x00AE, 0x00AF, bidiON},
+	{0x00B0, 0x00B1, bidiET}, {0x00B2, 0x00B3, bidiEN}, {0x00B4, 0x00B4, bidiON}, {0x00B6, 0x00B8, bidiON},
+	{0x00B9, 0x00B9, bidiEN}, {0x00BB, 0x00BF, bidiON}, {0x00D7, 0x00D7, bidiON}, {0x00F7, 0x00F7, bidiON},
+	{0x02B9, 0x02BA, bidiON}, {0x02C2, 0x02CF, bidiON}, {0x02D2, 0x02DF, bidiON}, {0x02E5, 0x02ED, bidiON},
+	{0x02EF, 0x02FF, bidiON}, {0x0300, 0x036F, bidiNSM}, {0x0374, 0x0375, bidiON}, {0x037E, 0x037E, bidiON},
+	{0x0384, 0x0385, bidiON}, {0x0387, 0x0387, bidiON}, {0x03F6, 0x03F6, bidiON}, {0x0483, 0x0489, bidiNSM},
+	{0x058A, 0x058A, bidiON}, {0x058D, 0x058E, bidiON}, {0x058F, 0x058F, bidiET}, {0x0590, 0x0590, bidiR},
+	{0x0591, 0x05BD, bidiNSM}, {0x05BE, 0x05BE, bidiR}, {0x05BF, 0x05BF, bidiNSM}, {0x05C0, 0x05C0, bidiR},
+	{0x05C1, 0x05C2, bidiNSM}, {0x05C3, 0x05C3, bidiR}, {0x05C4, 0x05C5, bidiNSM}, {0x05C6, 0x05C6, bidiR},
+	{0x05C7, 0x05C7, bidiNSM}, {0x05C8, 0x05FF, bidiR}, {0x0600, 0x0605, bidiAN}, {0x0606, 0x0607, bidiON},
+	{0x0608, 0x0608, bidiAL}, {0x0609, 0x060A, bidiET}, {0x060B, 0x060B, bidiAL}, {0x060C, 0x060C, bidiCS},
+	{0x060D, 0x060D, bidiAL}, {0x060E, 0x060F, bidiON}, {0x0610, 0x061A, bidiNSM}, {0x061B, 0x064A, bidiAL},
+	{0x064B, 0x065F, bidiNSM}, {0x0660, 0x0669, bidiAN}, {0x066A, 0x066A, bidiET}, {0x066B, 0x066C, bidiAN},
+	{0x066D, 0x066F, bidiAL}, {0x0670, 0x0670, bidiNSM}, {0x0671, 0x06D5, bidiAL}, {0x06D6, 0x06DC, bidiNSM},
+	{0x06DD, 0x06DD, bidiAN}, {0x06DE, 0x06DE, bidiON}, {0x06DF, 0x06E4, bidiNSM}, {0x06E5, 0x06E6, bidiAL},
+	{0x06E7, 0x06E8, bidiNSM}, {0x06E9, 0x06E9, bidiON}, {0x06EA, 0x06ED, bidiNSM}, {0x06EE, 0x06EF, bidiAL},
+	{0x06F0, 0x06F9, bidiEN}, {0x06FA, 0x0710, bidiAL}, {0x0711, 0x0711, bidiNSM}, {0x0712, 0x072F, bidiAL},
+	{0x0730, 0x074A, bidiNSM}, {0x074B, 0x07A5, bidiAL}, {0x07A6, 0x07B0, bidiNSM}, {0x07B1, 0x07BF, bidiAL},
+	{0x07C0, 0x07EA, bidiR}, {0x07EB, 0x07F3, bidiNSM}, {0x07F4, 0x085F, bidiR}, {0x0860, 0x08D2, bidiAL},
+	{0x08D3, 0x08E1, bidiNSM}, {0x08E2, 0x08E2, bidiAN}, {0x08E3, 0x0902, bidiNSM}, {0x093A, 0x093A, bidiNSM},
+	{0x093C, 0x093C, bidiNSM}, {0x0941, 0x0948, bidiNSM}, {0x094D, 0x094D, bidiNSM}, {0x0951, 0x0957, bidiNSM},
+	{0x0962, 0x0963, bidiNSM}, {0x1680, 0x1680, bidiWS}, {0x1AB0, 0x1AFF, bidiNSM}, {0x1DC0, 0x1DFF, bidiNSM},
+	{0x2000, 0x200A, bidiWS}, {0x200B, 0x200D, bidiBN}, {0x200F, 0x200F, bidiR}, {0x2010, 0x2027, bidiON},
+	{0x2028, 0x2028, bidiWS}, {0x2029, 0x2029, bidiB}, {0x202A, 0x202A, bidiLRE}, {0x202B, 0x202B, bidiRLE},
+	{0x202C, 0x202C, bidiPDF}, {0x202D, 0x202D, bidiLRO}, {0x202E, 0x202E, bidiRLO}, {0x202F, 0x202F, bidiCS},
+	{0x2030, 0x2034, bidiET}, {0x2035, 0x2043, bidiON}, {0x2044, 0x2044, bidiCS}, {0x2045, 0x205E, bidiON},
+	{0x205F, 0x205F, bidiWS}, {0x2060, 0x2064, bidiBN}, {0x2066, 0x2066, bidiLRI}, {0x2067, 0x2067, bidiRLI},
+	{0x2068, 0x2068, bidiFSI}, {0x2069, 0x2069, bidiPDI}, {0x206A, 0x206F, bidiBN}, {0x2070, 0x2070, bidiEN},
+	{0x2074, 0x2079, bidiEN}, {0x207A, 0x207B, bidiES}, {0x207C, 0x207E, bidiON}, {0x2080, 0x2089, bidiEN},
+	{0x208A, 0x208B, bidiES}, {0x208C, 0x208E, bidiON}, {0x20A0, 0x20CF, bidiET}, {0x20D0, 0x20F0, bidiNSM},
+	{0x2100, 0x2101, bidiON}, {0x2103, 0x2106, bidiON}, {0x2108, 0x2109, bidiON}, {0x2116, 0x2118, bidiON},
+	{0x211E, 0x2123, bidiON}, {0x2125, 0x2125, bidiON}, {0x2127, 0x2127, bidiON}, {0x2129, 0x2129, bidiON},
+	{0x212E, 0x212E, bidiET}, {0x2140, 0x2144, bidiON}, {0x214A, 0x214D, bidiON}, {0x2150, 0x215F, bidiON},
+	{0x2189, 0x218B, bidiON}, {0x2190, 0x2211, bidiON}, {0x2212, 0x2212, bidiES}, {0x2213, 0x2213, bidiET},
+	{0x2214, 0x2335, bidiON}, {0x237B, 0x2394, bidiON}, {0x2396, 0x2426, bidiON}, {0x2440, 0x244A, bidiON},
+	{0x2460, 0x2487, bidiON}, {0x2488, 0x249B, bidiEN}, {0x24EA, 0x26AB, bidiON}, {0x26AD, 0x27FF, bidiON},
+	{0x2900, 0x2B73, bidiON}, {0x2B76, 0x2B95, bidiON}, {0x2B97, 0x2BFF, bidiON}, {0x2CE5, 0x2CEA, bidiON},
+	{0x2E00, 0x2E5D, bidiON}, {0x3000, 0x3000, bidiWS}, {0x3001, 0x3004, bidiON}, {0x3008, 0x3020, bidiON},
+	{0x3030, 0x3030, bidiON}, {0x30FB, 0x30FB, bidiON}, {0xFB1D, 0xFB1D, bidiR}, {0xFB1E, 0xFB1E, bidiNSM},
+	{0xFB1F, 0xFB28, bidiR}, {0xFB29, 0xFB29, bidiES}, {0xFB2A, 0xFB4F, bidiR}, {0xFB50, 0xFD3D, bidiAL},
+	{0xFD3E, 0xFD3F, bidiON}, {0xFD40, 0xFDCF, bidiAL}, {0xFDF0, 0xFDFC, bidiAL}, {0xFDFD, 0xFDFF, bidiON},
+	{0xFE00, 0xFE0F, bidiNSM}, {0xFE10, 0xFE19, bidiON}, {0xFE20, 0xFE2F, bidiNSM}, {0xFE30, 0xFE4F, bidiON},
+	{0xFE50, 0xFE50, bidiCS}, {0xFE51, 0xFE51, bidiON}, {0xFE52, 0xFE52, bidiCS}, {0xFE54, 0xFE54, bidiON},
+	{0xFE55, 0xFE55, bidiCS}, {0xFE56, 0xFE5E, bidiON}, {0xFE5F, 0xFE5F, bidiET}, {0xFE60, 0xFE61, bidiON},
+	{0xFE62, 0xFE63, bidiES}, {0xFE64, 0xFE66, bidiON}, {0xFE68, 0xFE68, bidiON}, {0xFE69, 0xFE6A, bidiET},
+	{0xFE6B, 0xFE6B, bidiON}, {0xFE70, 0xFEFE, bidiAL}, {0xFEFF, 0xFEFF, bidiBN}, {0xFF01, 0xFF02, bidiON},
+	{0xFF03, 0xFF05, bidiET}, {0xFF06, 0xFF0A, bidiON}, {0xFF0B, 0xFF0B, bidiES}, {0xFF0C, 0xFF0C, bidiCS},
+	{0xFF0D, 0xFF0D, bidiES}, {0xFF0E, 0xFF0F, bidiCS}, {0xFF10, 0xFF19, bidiEN}, {0xFF1A, 0xFF1A, bidiCS},
+	{0xFF1B, 0xFF20, bidiON}, {0xFF3B, 0xFF40, bidiON}, {0xFF5B, 0xFF65, bidiON}, {0xFFE0, 0xFFE1, bidiET},
+	{0xFFE2, 0xFFE4, bidiON}, {0xFFE5, 0xFFE6, bidiET}, {0xFFE8, 0xFFEE, bidiON}, {0xFFF9, 0xFFFD, bidiON},
+	{0x10800, 0x10FFF, bidiR}, {0x1E800, 0x1EDFF, bidiR}, {0x1EE00, 0x1EEFF, bidiAL}, {0x1EF00, 0x1EFFF, bidiR},
+	{0x1F300, 0x1FAFF, bidiON},
+}
+
+func bidiClassOf(r rune) bidiClass {
+	i := sort.Search(len(bidiClasses), func(i int) bool { return bidiClasses[i].last >= r })
+	if i < len(bidiClasses) && bidiClasses[i].first <= r {
+		return bidiClasses[i].class
+	}
+	return bidiL
+}
+
+// bidiBrackets are the paired brackets, opening bracket first.
+var bidiBrackets = [][2]rune{
+	{'(', ')'}, {'[', ']'}, {'{', '}'}, {0x2045, 0x2046}, {0x207D, 0x207E}, {0x208D, 0x208E},
+	{0x2308, 0x2309}, {0x230A, 0x230B}, {0x2329, 0x232A}, {0x3008, 0x3009}, {0x300A, 0x300B},
+	{0x300C, 0x300D}, {0x300E, 0x300F}, {0x3010, 0x3011}, {0x3014, 0x3015}, {0x3016, 0x3017},
+	{0x3018, 0x3019}, {0x301A, 0x301B}, {0xFF08, 0xFF09}, {0xFF3B, 0xFF3D}, {0xFF5B, 0xFF5D},
+	{0xFF5F, 0xFF60}, {0xFF62, 0xFF63},
+}
+
+// bidiMirrors are pairs of characters which are mirrored in right to left text.
+var bidiMirrors = map[rune]rune{
+	'<': '>', '>': '<', 0x00AB: 0x00BB, 0x00BB: 0x00AB, 0x2039: 0x203A, 0x203A: 0x2039,
+	0x2264: 0x2265, 0x2265: 0x2264,
+}
+
+func init() {
+	for _, pair := range bidiBrackets {
+		bidiMirrors[pair[0]] = pair[1]
+		bidiMirrors[pair[1]] = pair[0]
+	}
+}
+
+// bidiMirror returns the mirrored glyph of the rune for right to left text (rule L4).
+func bidiMirror(r rune) rune {
+	if m, ok := bidiMirrors[r]; ok {
+		return m
+	}
+	return r
+}
+
+// bidiBracket returns the canonical opening bracket of a bracket, and
+// whether it is an opening one. ok is false for other runes.
+func bidiBracket(r rune) (opening rune, open, ok bool) {
+	switch r {
+	case 0x3008:
+		r = 0x2329
+	case 0x3009:
+		r = 0x232A
+	}
+	for _, pair := range bidiBrackets {
+		if r == pair[0] {
+			return r, true, true
+		}
+		if r == pair[1] {
+			return pair[0], false, true
+		}
+	}
+	return 0, false, false
+}
+
+// Bidi is a text resolved by the Unicode Bidirectional Algorithm (UAX #9).
+// Paragraph separators start a new paragraph.
+type Bidi struct {
+	classes    []bidiClass
+	levels     []uint8
+	paragraphs []bidiParagraph
+	direction  FONSDirection
+}
+
+type bidiParagraph struct {
+	end   int
+	level uint8
+}
+
+// NewBidi resolves the embedding levels of the runes (rules P1 to I2).
+func NewBidi(runes []rune, direction FONSDirection) *Bidi {
+	b := &Bidi{
+		classes:   make([]bidiClass, len(runes)),
+		levels:    make([]uint8, len(runes)),
+		direction: direction,
+	}
+	simple := direction != DIRECTION_RTL
+	for i, r := range runes {
+		b.classes[i] = bidiClassOf(r)
+		switch b.classes[i] {
+		case bidiR, bidiAL, bidiAN, bidiLRE, bidiLRO, bidiRLE, bidiRLO, bidiPDF, bidiLRI, bidiRLI, bidiFSI, bidiPDI:
+			simple = false
+		}
+	}
+	if simple {
+		b.paragraphs = []bidiParagraph{{end: len(runes)}}
+		return b
+	}
+	start := 0
+	for i := range runes {
+		if b.classes[i] == bidiB || i == len(runes)-1 {
+			b.resolveParagraph(runes, start, i+1)
+			start = i + 1
+		}
+	}
+	return b
+}
+
+// Levels returns the resolved embedding levels of the runes, odd levels are right to left.
+func (b *Bidi) Levels() []uint8 {
+	return b.levels
+}
+
+// ParagraphLevel returns the embedding level of the paragraph of the rune at index.
+func (b *Bidi) ParagraphLevel(index int) uint8 {
+	for _, p := range b.paragraphs {
+		if index < p.end {
+			return p.level
+		}
+	}
+	if b.direction == DIRECTION_RTL {
+		return 1
+	}
+	return 0
+}
+
+// LineLevels returns the levels of the runes [start, end) displayed as one
+// line, trailing whitespace and separators take the paragraph level (rule L1).
+func (b *Bidi) LineLevels(start, end int) []uint8 {
+	levels := append([]uint8(nil), b.levels[start:end]...)
+	paragraphLevel := b.ParagraphLevel(start)
+	trailing := true
+	for i := end - 1; i >= start; i-- {
+		switch c := b.classes[i]; {
+		case c == bidiS || c == bidiB:
+			levels[i-start] = paragraphLevel
+			trailing = true
+		case trailing && (c == bidiWS || c == bidiBN || c >= bidiLRE):
+			levels[i-start] = paragraphLevel
+		default:
+			trailing = false
+		}
+	}
+	return levels
+}
+
+// VisualOrder returns the indexes, relative to start, of the runes [start,
+// end) displayed as one line in visual order from left to right (rule L2).
+func (b *Bidi) VisualOrder(start, end int) []int {
+	return bidiReorder(b.LineLevels(start, end))
+}
+
+// bidiReorder returns the indexes of the levels in visual order. From the
+// highest level to the lowest odd level, every run of at least that level is
+// reversed.
+func bidiReorder(levels []uint8) []int {
+	order := make([]int, len(levels))
+	var highest, lowestOdd uint8 = 0, 0xFF
+	for i, level := range levels {
+		order[i] = i
+		if level > highest {
+			highest = level
+		}
+		if level&1 == 1 && level < lowestOdd {
+			lowestOdd = level
+		}
+	}
+	for level := highest; level >= lowestOdd && level > 0; level-- {
+		for i := 0; i < len(order); {
+			if levels[order[i]] < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(order) && levels[order[j]] >= level {
+				j++
+			}
+			for l, r := i, j-1; l < r; l, r = l+1, r-1 {
+				order[l], order[r] = order[r], order[l]
+			}
+			i = j
+		}
+	}
+	return order
+}
+
+func bidiRemoved(c bidiClass) bool {
+	return c == bidiBN || (c >= bidiLRE && c <= bidiPDF)
+}
+
+func bidiIsolateInitiator(c bidiClass) bool {
+	return c == bidiLRI || c == bidiRLI || c == bidiFSI
+}
+
+// bidiStrong returns the strong direction a resolved type counts as, numbers
+// count as right to left. Other types return bidiON.
+func bidiStrong(c bidiClass) bidiClass {
+	switch c {
+	case bidiL:
+		return bidiL
+	case bidiR, bidiAL, bidiEN, bidiAN:
+		return bidiR
+	}
+	return bidiON
+}
+
+func bidiDirection(level uint8) bidiClass {
+	if level&1 == 1 {
+		return bidiR
+	}
+	return bidiL
+}
+
+// resolveParagraph resolves the levels of the paragraph [start, end).
+func (b *Bidi) resolveParagraph(runes []rune, start, end int) {
+	n := end - start
+	classes := b.classes[start:end]
+	types := append([]bidiClass(nil), classes...)
+	levels := b.levels[start:end]
+
+	// matching isolate initiators and PDIs (BD9)
+	matchingPDI := make([]int, n)
+	matchedPDI := make([]bool, n)
+	var openIsolates []int
+	for i, c := range classes {
+		matchingPDI[i] = -1
+		if bidiIsolateInitiator(c) {
+			openIsolates = append(openIsolates, i)
+		} else if c == bidiPDI && len(openIsolates) > 0 {
+			matchingPDI[openIsolates[len(openIsolates)-1]] = i
+			matchedPDI[i] = true
+			openIsolates = openIsolates[:len(openIsolates)-1]
+		}
+	}
+	firstStrong := func(from, to int) bidiClass {
+		for i := from; i < to; i++ {
+			switch classes[i] {
+			case bidiL:
+				return bidiL
+			case bidiR, bidiAL:
+				return bidiR
+			case bidiLRI, bidiRLI, bidiFSI:
+				if matchingPDI[i] < 0 {
+					return bidiON
+				}
+				i = matchingPDI[i]
+			}
+		}
+		return bidiON
+	}
+
+	// P2, P3
+	var paragraphLevel uint8
+	switch b.direction {
+	case DIRECTION_RTL:
+		paragraphLevel = 1
+	case DIRECTION_AUTO:
+		if firstStrong(0, n) == bidiR {
+			paragraphLevel = 1
+		}
+	}
+	b.paragraphs = append(b.paragraphs, bidiParagraph{end: end, level: paragraphLevel})
+
+	// X1-X8 explicit levels and directions
+	type status struct {
+		level    uint8
+		override bidiClass
+		isolate  bool
+	}
+	nextLevel := func(level uint8, rtl bool) uint8 {
+		if rtl {
+			return (level + 1) | 1
+		}
+		return (level + 2) &^ 1
+	}
+	stack := []status{{paragraphLevel, bidiON, false}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+	for i, c := range classes {
+		top := stack[len(stack)-1]
+		levels[i] = top.level
+		switch c {
+		case bidiRLE, bidiLRE, bidiRLO, bidiLRO:
+			level := nextLevel(top.level, c == bidiRLE || c == bidiRLO)
+			if level <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				override := bidiON
+				if c == bidiRLO {
+					override = bidiR
+				} else if c == bidiLRO {
+					override = bidiL
+				}
+				stack = append(stack, status{level, override, false})
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+		case bidiRLI, bidiLRI, bidiFSI:
+			if top.override != bidiON {
+				types[i] = top.override
+			}
+			rtl := c == bidiRLI
+			if c == bidiFSI {
+				to := n
+				if matchingPDI[i] >= 0 {
+					to = matchingPDI[i]
+				}
+				rtl = firstStrong(i+1, to) == bidiR
+			}
+			level := nextLevel(top.level, rtl)
+			if level <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, status{level, bidiON, true})
+			} else {
+				overflowIsolates++
+			}
+		case bidiPDI:
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			levels[i] = top.level
+			if top.override != bidiON {
+				types[i] = top.override
+			}
+		case bidiPDF:
+			if overflowIsolates == 0 {
+				if overflowEmbeddings > 0 {
+					overflowEmbeddings--
+				} else if !top.isolate && len(stack) >= 2 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+		case bidiB:
+			levels[i] = paragraphLevel
+		case bidiBN:
+		default:
+			if top.override != bidiON {
+				types[i] = top.override
+			}
+		}
+	}
+
+	// X9, X10 level runs without the removed characters, linked to isolating run sequences
+	var runs [][]int
+	runOf := make([]int, n)
+	for i := 0; i < n; i++ {
+		if bidiRemoved(classes[i]) {
+			continue
+		}
+		if len(runs) == 0 || levels[runs[len(runs)-1][0]] != levels[i] {
+			runs = append(runs, nil)
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], i)
+		runOf[i] = len(runs) - 1
+	}
+	for _, run := range runs {
+		if classes[run[0]] == bidiPDI && matchedPDI[run[0]] {
+			continue
+		}
+		sequence := append([]int(nil), run...)
+		for {
+			last := sequence[len(sequence)-1]
+			pdi := matchingPDI[last]
+			if !bidiIsolateInitiator(classes[last]) || pdi < 0 || runs[runOf[pdi]][0] != pdi {
+				break
+			}
+			sequence = append(sequence, runs[runOf[pdi]]...)
+		}
+		b.resolveSequence(runes[start:end], classes, types, levels, sequence, paragraphLevel)
+	}
+
+	// removed characters take the level of the preceding character
+	for i := 0; i < n; i++ {
+		if bidiRemoved(classes[i]) {
+			if i > 0 {
+				levels[i] = levels[i-1]
+			} else {
+				levels[i] = paragraphLevel
+			}
+		}
+	}
+}
+
+// resolveSequence resolves the types (rules W1 to N2) and the levels (rules
+// I1 and I2) of an isolating run sequence.
+func (b *Bidi) resolveSequence(runes []rune, classes, types []bidiClass, levels []uint8, sequence []int, paragraphLevel uint8) {
+	n := len(types)
+	level := levels[sequence[0]]
+
+	prev := sequence[0] - 1
+	for prev >= 0 && bidiRemoved(classes[prev]) {
+		prev--
+	}
+	sosLevel := paragraphLevel
+	if prev >= 0 {
+		sosLevel = levels[prev]
+	}
+	last := sequence[len(sequence)-1]
+	next := last + 1
+	for next < n && bidiRemoved(classes[next]) {
+		next++
+	}
+	eosLevel := paragraphLevel
+	if next < n && !bidiIsolateInitiator(classes[last]) {
+		eosLevel = levels[next]
+	}
+	if level > sosLevel {
+		sosLevel = level
+	}
+	if level > eosLevel {
+		eosLevel = level
+	}
+	sos := bidiDirection(sosLevel)
+	eos := bidiDirection(eosLevel)
+
+	t := make([]bidiClass, len(sequence))
+	for k, i := range sequence {
+		t[k] = types[i]
+	}
+
+	// W1 non-spacing marks
+	for k := range t {
+		if t[k] != bidiNSM {
+			continue
+		}
+		switch {
+		case k == 0:
+			t[k] = sos
+		case bidiIsolateInitiator(t[k-1]) || t[k-1] == bidiPDI:
+			t[k] = bidiON
+		default:
+			t[k] = t[k-1]
+		}
+	}
+	// W2, W3 European numbers after Arabic letters
+	lastStrong := sos
+	for k := range t {
+		switch t[k] {
+		case bidiL, bidiR, bidiAL:
+			lastStrong = t[k]
+		case bidiEN:
+			if lastStrong == bidiAL {
+				t[k] = bidiAN
+			}
+		}
+	}
+	for k := range t {
+		if t[k] == bidiAL {
+			t[k] = bidiR
+		}
+	}
+	// W4 separators between numbers
+	for k := 1; k < len(t)-1; k++ {
+		switch {
+		case t[k] == bidiES && t[k-1] == bidiEN && t[k+1] == bidiEN:
+			t[k] = bidiEN
+		case t[k] == bidiCS && t[k-1] == bidiEN && t[k+1] == bidiEN:
+			t[k] = bidiEN
+		case t[k] == bidiCS && t[k-1] == bidiAN && t[k+1] == bidiAN:
+			t[k] = bidiAN
+		}
+	}
+	// W5 terminators adjacent to European numbers
+	for k := 0; k < len(t); k++ {
+		if t[k] != bidiET {
+			continue
+		}
+		e := k
+		for e < len(t) && t[e] == bidiET {
+			e++
+		}
+		if (k > 0 && t[k-1] == bidiEN) || (e < len(t) && t[e] == bidiEN) {
+			for m := k; m < e; m++ {
+				t[m] = bidiEN
+			}
+		}
+		k = e
+	}
+	// W6, W7
+	lastStrong = sos
+	for k := range t {
+		switch t[k] {
+		case bidiES, bidiET, bidiCS:
+			t[k] = bidiON
+		case bidiL, bidiR:
+			lastStrong = t[k]
+		case bidiEN:
+			if lastStrong == bidiL {
+				t[k] = bidiL
+			}
+		}
+	}
+
+	// N0 paired brackets (BD16)
+	embedding := bidiDirection(level)
+	type bracketPair struct{ open, close int }
+	var pairs []bracketPair
+	var openers []struct {
+		k       int
+		bracket rune
+	}
+brackets:
+	for k, i := range sequence {
+		if t[k] != bidiON {
+			continue
+		}
+		bracket, open, ok := bidiBracket(runes[i])
+		switch {
+		case !ok:
+		case open:
+			if len(openers) == 63 {
+				break brackets
+			}
+			openers = append(openers, struct {
+				k       int
+				bracket rune
+			}{k, bracket})
+		default:
+			for m := len(openers) - 1; m >= 0; m-- {
+				if openers[m].bracket == bracket {
+					pairs = append(pairs, bracketPair{openers[m].k, k})
+					openers = openers[:m]
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].open < pairs[j].open })
+	for _, pair := range pairs {
+		found := bidiON
+		for k := pair.open + 1; k < pair.close; k++ {
+			if d := bidiStrong(t[k]); d == embedding {
+				found = embedding
+				break
+			} else if d != bidiON {
+				found = d
+			}
+		}
+		if found == bidiON {
+			continue
+		}
+		if found != embedding {
+			context := sos
+			for k := pair.open - 1; k >= 0; k-- {
+				if d := bidiStrong(t[k]); d != bidiON {
+					context = d
+					break
+				}
+			}
+			if context != found {
+				found = embedding
+			}
+		}
+		for _, k := range []int{pair.open, pair.close} {
+			t[k] = found
+			for m := k + 1; m < len(t) && classes[sequence[m]] == bidiNSM; m++ {
+				t[m] = found
+			}
+		}
+	}
+
+	// N1, N2 neutrals take the direction of the surrounding text, or the embedding direction
+	for k := 0; k < len(t); {
+		if bidiStrong(t[k]) != bidiON {
+			k++
+			continue
+		}
+		e := k
+		for e < len(t) && bidiStrong(t[e]) == bidiON {
+			e++
+		}
+		before, after := sos, eos
+		if k > 0 {
+			before = bidiStrong(t[k-1])
+		}
+		if e < len(t) {
+			after = bidiStrong(t[e])
+		}
+		direction := embedding
+		if before == after {
+			direction = before
+		}
+		for m := k; m < e; m++ {
+			t[m] = direction
+		}
+		k = e
+	}
+
+	// I1, I2
+	for k, i := range sequence {
+		if levels[i]&1 == 0 {
+			switch t[k] {
+			case bidiR:
+				levels[i]++
+			case bidiAN, bidiEN:
+				levels[i] += 2
+			}
+		} else if t[k] == bidiL || t[k] == bidiEN || t[k] == bidiAN {
+			levels[i]++
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Command fontatlas rasterizes text with a FontStash and writes its glyph atlas
+// to a PNG image, which helps with finding bugs of the glyph cache.
+//
+// Usage:
+//
+//	fontatlas -size 24 -mode sdf -text "Hello, World" -o atlas.png Roboto-Regular.ttf [fallback.ttf...]
+//
+// The fonts after the first one are its fallbacks. Color glyphs are written to
+// a second image, whose name ends with -color.png.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jxo/davinci/font"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var modes = map[string]font.FONSRenderMode{
+	"bitmap":   font.RENDER_BITMAP,
+	"sdf":      font.RENDER_SDF,
+	"subpixel": font.RENDER_SUBPIXEL,
+	"lcd":      font.RENDER_LCD,
+}
+
+func main() {
+	var ascii []rune
+	for r := rune(0x20); r < 0x7f; r++ {
+		ascii = append(ascii, r)
+	}
+	text := flag.String("text", string(ascii), "text to rasterize")
+	textFile := flag.String("textfile", "", "file with text to rasterize instead of -text")
+	size := flag.Float64("size", 16, "font size in pixels")
+	blur := flag.Float64("blur", 0, "blur radius in pixels")
+	mode := flag.String("mode", "bitmap", "render mode: bitmap, sdf, subpixel or lcd")
+	hinting := flag.Bool("hinting", false, "fit small glyphs to the pixel grid")
+	width := flag.Int("width", 512, "width of the atlas")
+	height := flag.Int("height", 512, "height of the atlas")
+	output := flag.String("o", "atlas.png", "image file to write")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: fontatlas [flags] font.ttf [fallback.ttf...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	renderMode, ok := modes[*mode]
+	if flag.NArg() == 0 || !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *textFile != "" {
+		data, err := ioutil.ReadFile(*textFile)
+		if err != nil {
+			fail(err)
+		}
+		*text = string(data)
+	}
+
+	stash := font.New(*width, *height)
+	for i, path := range flag.Args() {
+		id := stash.AddFont(path, path)
+		if id == font.INVALID {
+			fail(fmt.Errorf("can't load %s", path))
+		}
+		if i > 0 {
+			stash.AddFallbackFont(0, id)
+		}
+	}
+	stash.SetFont(0)
+	stash.SetSize(float32(*size))
+	stash.SetBlur(float32(*blur))
+	stash.SetRenderMode(renderMode)
+	stash.SetHinting(*hinting)
+	for _, line := range strings.Split(*text, "\n") {
+		iter := stash.TextIter(0, 0, line)
+		for _, ok := iter.Next(); ok; _, ok = iter.Next() {
+			if iter.PrevGlyph == nil {
+				fmt.Fprintln(os.Stderr, "fontatlas: the atlas is full")
+				break
+			}
+		}
+	}
+
+	if err := writeFile(*output, func(f *os.File) error {
+		return stash.WriteAtlasPNG(f)
+	}); err != nil {
+		fail(err)
+	}
+	if img := stash.ColorAtlasImage(); img != nil {
+		colorOutput := strings.TrimSuffix(*output, ".png") + "-color.png"
+		if err := writeFile(colorOutput, func(f *os.File) error {
+			return png.Encode(f, img)
+		}); err != nil {
+			fail(err)
+		}
+	}
+	stats := stash.AtlasStats()
+	fmt.Printf("%s: %d glyphs, %.0f%% of the atlas used\n", *output, stats.Glyphs, stats.Usage*100)
+}
+
+func writeFile(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "fontatlas:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,117 @@
+// Command fontsubset writes a TrueType font with only the glyphs of the given
+// codepoints, which makes fonts embedded into applications smaller.
+//
+// Usage:
+//
+//	fontsubset -ranges U+0020-007E,U+2026 -text "äöü" -o Roboto-Subset.ttf Roboto-Regular.ttf
+//
+// The codepoints are taken from the ranges, the text and the file given with -textfile.
+// Kerning is kept, other layout features like the substitutions of GSUB aren't,
+// see truetype.FontInfo.Subset.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jxo/davinci/font/truetype"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	text := flag.String("text", "", "characters to keep")
+	textFile := flag.String("textfile", "", "file with characters to keep")
+	ranges := flag.String("ranges", "", "codepoint ranges to keep, like U+0020-007E,U+2026")
+	index := flag.Int("index", 0, "index of the face in a font collection")
+	output := flag.String("o", "", "subset font file to write")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: fontsubset [flags] -o output.ttf input.ttf")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *output == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	codepoints, err := parseRanges(*ranges)
+	if err != nil {
+		fail(err)
+	}
+	codepoints = append(codepoints, []rune(*text)...)
+	if *textFile != "" {
+		data, err := ioutil.ReadFile(*textFile)
+		if err != nil {
+			fail(err)
+		}
+		codepoints = append(codepoints, []rune(string(data))...)
+	}
+
+	data, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+	offset := truetype.GetFontOffsetForIndex(data, *index)
+	if offset < 0 {
+		fail(fmt.Errorf("%s has no face %d", flag.Arg(0), *index))
+	}
+	info, err := truetype.InitFont(data, offset)
+	if err != nil {
+		fail(err)
+	}
+	subset, err := info.Subset(codepoints)
+	if err != nil {
+		fail(err)
+	}
+	if info.HasSubstitutions() {
+		fmt.Fprintf(os.Stderr, "warning: %s has GSUB substitutions, like ligatures, which the subset doesn't keep\n", flag.Arg(0))
+	}
+	if err := ioutil.WriteFile(*output, subset, 0644); err != nil {
+		fail(err)
+	}
+	fmt.Printf("%s: %d bytes, %d before\n", *output, len(subset), len(data))
+}
+
+// parseRanges returns the codepoints of comma separated ranges like U+0020-007E
+// and single codepoints like U+2026.
+func parseRanges(s string) ([]rune, error) {
+	var codepoints []rune
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last := part, part
+		if i := strings.IndexByte(part, '-'); i >= 0 {
+			first, last = part[:i], part[i+1:]
+		}
+		a, err := parseCodepoint(first)
+		if err != nil {
+			return nil, err
+		}
+		b, err := parseCodepoint(last)
+		if err != nil {
+			return nil, err
+		}
+		for r := a; r <= b; r++ {
+			codepoints = append(codepoints, r)
+		}
+	}
+	return codepoints, nil
+}
+
+func parseCodepoint(s string) (rune, error) {
+	hex := strings.TrimPrefix(strings.TrimPrefix(s, "U+"), "u+")
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || v > 0x10ffff {
+		return 0, fmt.Errorf("invalid codepoint %q", s)
+	}
+	return rune(v), nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "fontsubset:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,42 @@
+package font
+
+import (
+	"errors"
+	"github.com/jxo/davinci/font/truetype"
+)
+
+// Face describes one font face of a font file or a TrueType collection (.ttc).
+type Face struct {
+	Index  int    // Face index for FontStash.AddFontFromCollection().
+	Family string // Family name like "Noto Sans CJK JP".
+	Style  string // Style (subfamily) name like "Bold".
+}
+
+// ListFaces returns the faces of a font file or a TrueType collection.
+// Typographic family and style names are used when the name table has them.
+func ListFaces(data []byte) ([]Face, error) {
+	count := truetype.GetNumberOfFonts(data)
+	if count == 0 {
+		return nil, errors.New("not a font file")
+	}
+	faces := make([]Face, 0, count)
+	for i := 0; i < count; i++ {
+		info, err := truetype.InitFont(data, truetype.GetFontOffsetForIndex(data, i))
+		if err != nil {
+			return nil, err
+		}
+		face := Face{
+			Index:  i,
+			Family: info.GetFontName(truetype.NAME_ID_TYPOGRAPHIC_FAMILY),
+			Style:  info.GetFontName(truetype.NAME_ID_TYPOGRAPHIC_SUBFAMILY),
+		}
+		if face.Family == "" {
+			face.Family = info.GetFontName(truetype.NAME_ID_FAMILY)
+		}
+		if face.Style == "" {
+			face.Style = info.GetFontName(truetype.NAME_ID_SUBFAMILY)
+		}
+		faces = append(faces, face)
+	}
+	return faces, nil
+}
@@ -0,0 +1,257 @@
+package font
+
+import (
+	"github.com/jxo/davinci/font/truetype"
+	"math"
+)
+
+// FONS_COLOR_ATLAS_SIZE is the width and the height of the atlas of color glyphs.
+const FONS_COLOR_ATLAS_SIZE = 512
+
+// colorAtlas keeps the color glyphs, as premultiplied RGBA pixels.
+type colorAtlas struct {
+	atlas     *Atlas
+	data      []byte
+	dirtyRect [4]int
+	full      bool
+}
+
+// getColorGlyph returns the color glyph of the index in renderFont, rasterizing
+// it into the color atlas if it isn't cached yet, and whether the glyph has
+// COLR layers or a color bitmap. Color glyphs aren't blurred. The glyph is nil
+// when the color atlas is full, see ColorAtlasFull. Glyphs larger than the
+// whole color atlas are reported as not colored, so their outline is drawn.
+func (stash *FontStash) getColorGlyph(renderFont *Font, index, size int) (*Glyph, bool) {
+	glyphKey := GlyphKey{
+		index:     index,
+		size:      int16(size),
+		variation: renderFont.variation,
+	}
+	glyph, ok := renderFont.colorGlyphs[glyphKey]
+	if ok {
+		glyph.used = stash.frame
+		return glyph, true
+	}
+	const pad = 2
+	scale := renderFont.getPixelHeightScale(float32(size) / 10.0)
+	advance, _ := renderFont.font.GetGlyphHMetrics(index)
+	ppem := float32(renderFont.font.GetUnitsPerEm()) * scale
+
+	layers := renderFont.font.GetGlyphLayers(index)
+	var bitmap *truetype.GlyphBitmap
+	var x0, y0, x1, y1 int
+	if layers != nil {
+		x0, y0, x1, y1 = renderFont.glyphLayersBox(layers, scale)
+	} else if bitmap = renderFont.font.GetGlyphBitmap(index, int(math.Ceil(float64(ppem)))); bitmap != nil {
+		x0, y0, x1, y1 = glyphBitmapBox(bitmap, ppem/float32(bitmap.PPEM))
+	} else {
+		return nil, false
+	}
+	if x1-x0+pad*2 > FONS_COLOR_ATLAS_SIZE || y1-y0+pad*2 > FONS_COLOR_ATLAS_SIZE {
+		return nil, false
+	}
+	var pixels []byte
+	if layers != nil {
+		pixels = renderFont.renderGlyphLayers(layers, scale, x0, y0, x1, y1)
+	} else {
+		pixels = scaleGlyphBitmap(bitmap, ppem/float32(bitmap.PPEM), x0, y0, x1, y1)
+	}
+	if stash.color == nil {
+		stash.color = &colorAtlas{
+			atlas:     NewAtlas(FONS_COLOR_ATLAS_SIZE, FONS_COLOR_ATLAS_SIZE, FONS_INIT_ATLAS_NODES),
+			data:      make([]byte, FONS_COLOR_ATLAS_SIZE*FONS_COLOR_ATLAS_SIZE*4),
+			dirtyRect: [4]int{FONS_COLOR_ATLAS_SIZE, FONS_COLOR_ATLAS_SIZE, 0, 0},
+		}
+	}
+	gw := x1 - x0 + pad*2
+	gh := y1 - y0 + pad*2
+	gx, gy, err := stash.color.atlas.AddRect(gw, gh)
+	if err != nil {
+		stash.color.full = true
+		return nil, true
+	}
+	glyph = &Glyph{
+		Index: index,
+		Color: true,
+		font:  renderFont,
+		scale: scale,
+		size:  int16(size),
+		x0:    int16(gx),
+		y0:    int16(gy),
+		x1:    int16(gx + gw),
+		y1:    int16(gy + gh),
+		xAdv:  int16(scale * float32(advance) * 10.0),
+		xOff:  int16(x0 - pad),
+		yOff:  int16(y0 - pad),
+		used:  stash.frame,
+	}
+	renderFont.colorGlyphs[glyphKey] = glyph
+
+	// the border of the padding stays transparent
+	stride := FONS_COLOR_ATLAS_SIZE * 4
+	w := (x1 - x0) * 4
+	for y := 0; y < y1-y0; y++ {
+		copy(stash.color.data[(gx+pad)*4+(gy+pad+y)*stride:], pixels[y*w:(y+1)*w])
+	}
+	dirty := &stash.color.dirtyRect
+	dirty[0] = fons__mini(dirty[0], gx)
+	dirty[1] = fons__mini(dirty[1], gy)
+	dirty[2] = fons__maxi(dirty[2], gx+gw)
+	dirty[3] = fons__maxi(dirty[3], gy+gh)
+	return glyph, true
+}
+
+// glyphLayersBox returns the box of the COLR layers.
+func (font *Font) glyphLayersBox(layers []truetype.ColorLayer, scale float32) (x0, y0, x1, y1 int) {
+	first := true
+	for _, layer := range layers {
+		lx0, ly0, lx1, ly1 := font.font.GetGlyphBitmapBoxSubpixel(layer.Glyph, float64(scale), float64(scale), 0, 0)
+		if lx1 <= lx0 || ly1 <= ly0 {
+			continue
+		}
+		if first {
+			x0, y0, x1, y1 = lx0, ly0, lx1, ly1
+			first = false
+		} else {
+			x0, y0 = fons__mini(x0, lx0), fons__mini(y0, ly0)
+			x1, y1 = fons__maxi(x1, lx1), fons__maxi(y1, ly1)
+		}
+	}
+	return
+}
+
+// renderGlyphLayers rasterizes the COLR layers over each other into their
+// box, and returns the premultiplied RGBA pixels. Layers of the foreground
+// are black, as the glyphs are drawn with their own colors.
+func (font *Font) renderGlyphLayers(layers []truetype.ColorLayer, scale float32, x0, y0, x1, y1 int) []byte {
+	w, h := x1-x0, y1-y0
+	pixels := make([]byte, w*h*4)
+	coverage := make([]byte, w*h)
+	for _, layer := range layers {
+		for i := range coverage {
+			coverage[i] = 0
+		}
+		lx0, ly0, lx1, ly1 := font.font.GetGlyphBitmapBoxSubpixel(layer.Glyph, float64(scale), float64(scale), 0, 0)
+		if lx1 <= lx0 || ly1 <= ly0 {
+			continue
+		}
+		font.renderGlyphBitmap(coverage, lx0-x0, ly0-y0, lx1-lx0, ly1-ly0, w, scale, scale, 0, layer.Glyph, false)
+		var r, g, b, a uint32 = 0, 0, 0, 255
+		if !layer.Foreground {
+			r, g, b, a = uint32(layer.R), uint32(layer.G), uint32(layer.B), uint32(layer.A)
+		}
+		for i, c := range coverage {
+			if c == 0 {
+				continue
+			}
+			// source over with the coverage of the layer
+			sa := a * uint32(c) / 255
+			p := pixels[i*4 : i*4+4]
+			p[0] = byte((r*sa + uint32(p[0])*(255-sa)) / 255)
+			p[1] = byte((g*sa + uint32(p[1])*(255-sa)) / 255)
+			p[2] = byte((b*sa + uint32(p[2])*(255-sa)) / 255)
+			p[3] = byte((255*sa + uint32(p[3])*(255-sa)) / 255)
+		}
+	}
+	return pixels
+}
+
+// glyphBitmapBox returns the box of the color bitmap scaled by ratio.
+func glyphBitmapBox(bitmap *truetype.GlyphBitmap, ratio float32) (x0, y0, x1, y1 int) {
+	bounds := bitmap.Image.Bounds()
+	left := float32(bitmap.X) * ratio
+	top := -float32(bitmap.Y) * ratio
+	x0 = int(math.Floor(float64(left)))
+	y0 = int(math.Floor(float64(top)))
+	x1 = int(math.Ceil(float64(left + float32(bounds.Dx())*ratio)))
+	y1 = int(math.Ceil(float64(top + float32(bounds.Dy())*ratio)))
+	return
+}
+
+// scaleGlyphBitmap scales the color bitmap by ratio into its box, averaging
+// the pixels it covers, and returns the premultiplied RGBA pixels.
+func scaleGlyphBitmap(bitmap *truetype.GlyphBitmap, ratio float32, x0, y0, x1, y1 int) []byte {
+	bounds := bitmap.Image.Bounds()
+	left := float32(bitmap.X) * ratio
+	top := -float32(bitmap.Y) * ratio
+	w, h := x1-x0, y1-y0
+	pixels := make([]byte, w*h*4)
+	samples := int(math.Ceil(float64(1 / ratio)))
+	if samples > 8 {
+		samples = 8
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [4]uint32
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					// sample points are spread evenly over the pixel
+					bx := (float32(x0+x) + (float32(sx)+0.5)/float32(samples) - left) / ratio
+					by := (float32(y0+y) + (float32(sy)+0.5)/float32(samples) - top) / ratio
+					if bx < 0 || by < 0 || bx >= float32(bounds.Dx()) || by >= float32(bounds.Dy()) {
+						continue
+					}
+					r, g, b, a := bitmap.Image.At(bounds.Min.X+int(bx), bounds.Min.Y+int(by)).RGBA()
+					sum[0] += r >> 8
+					sum[1] += g >> 8
+					sum[2] += b >> 8
+					sum[3] += a >> 8
+				}
+			}
+			n := uint32(samples * samples)
+			p := pixels[(x+y*w)*4:]
+			for i := range sum {
+				p[i] = byte(sum[i] / n)
+			}
+		}
+	}
+	return pixels
+}
+
+// ColorAtlasFull returns whether the color glyph of the last glyph lookup didn't
+// fit in the color atlas, which has to be reset with ResetColorAtlas. It is
+// false if the last lookup failed because the main atlas is full.
+func (stash *FontStash) ColorAtlasFull() bool {
+	return stash.color != nil && stash.color.full
+}
+
+// ResetColorAtlas removes all color glyphs. The whole texture is dirty afterwards,
+// and quads returned before refer to glyphs which don't exist anymore.
+func (stash *FontStash) ResetColorAtlas() {
+	if stash.color == nil {
+		return
+	}
+	stash.color.atlas.Reset(FONS_COLOR_ATLAS_SIZE, FONS_COLOR_ATLAS_SIZE)
+	stash.color.data = make([]byte, FONS_COLOR_ATLAS_SIZE*FONS_COLOR_ATLAS_SIZE*4)
+	stash.color.dirtyRect = [4]int{0, 0, FONS_COLOR_ATLAS_SIZE, FONS_COLOR_ATLAS_SIZE}
+	stash.color.full = false
+	// instances share the maps of their fonts
+	for _, font := range stash.fonts {
+		for key := range font.colorGlyphs {
+			delete(font.colorGlyphs, key)
+		}
+	}
+}
+
+// ValidateColorTexture returns the dirty rectangle of the color atlas, and
+// clears it. It returns nil if nothing changed.
+func (stash *FontStash) ValidateColorTexture() []int {
+	if stash.color == nil {
+		return nil
+	}
+	dirty := stash.color.dirtyRect
+	if dirty[0] < dirty[2] && dirty[1] < dirty[3] {
+		stash.color.dirtyRect = [4]int{FONS_COLOR_ATLAS_SIZE, FONS_COLOR_ATLAS_SIZE, 0, 0}
+		return dirty[:]
+	}
+	return nil
+}
+
+// GetColorTextureData returns the premultiplied RGBA pixels of the color atlas and its size,
+// or nil if there are no color glyphs yet.
+func (stash *FontStash) GetColorTextureData() ([]byte, int, int) {
+	if stash.color == nil {
+		return nil, 0, 0
+	}
+	return stash.color.data, FONS_COLOR_ATLAS_SIZE, FONS_COLOR_ATLAS_SIZE
+}
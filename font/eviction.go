@@ -0,0 +1,122 @@
+package font
+
+import (
+	"sort"
+)
+
+// FONS_EVICT_KEEP is the part of the atlas area kept for the most recently
+// used glyphs when the atlas is compacted, the rest is freed for new glyphs.
+const FONS_EVICT_KEEP = 0.5
+
+// AtlasStats reports the occupancy of the glyph atlas.
+type AtlasStats struct {
+	Width, Height int     // size of the atlas
+	Glyphs        int     // number of cached glyphs
+	GlyphArea     float32 // area of the cached glyphs, from 0 to 1
+	Usage         float32 // area under the skyline of the packer, from 0 to 1
+	Evicted       int     // glyphs evicted since the stash was created
+	Compactions   int     // times the atlas was compacted since the stash was created
+}
+
+// NextFrame starts a new frame. Glyphs remember the last frame they were
+// used in, EvictGlyphs keeps the most recently used ones.
+func (stash *FontStash) NextFrame() {
+	stash.frame++
+}
+
+// AtlasStats returns the occupancy of the glyph atlas.
+func (stash *FontStash) AtlasStats() AtlasStats {
+	stats := AtlasStats{
+		Width:       stash.params.width,
+		Height:      stash.params.height,
+		Usage:       stash.atlas.Usage(),
+		Evicted:     stash.evicted,
+		Compactions: stash.compactions,
+	}
+	area := 0
+	for _, font := range stash.fonts {
+		for _, glyph := range font.glyphs {
+			stats.Glyphs++
+			area += int(glyph.x1-glyph.x0) * int(glyph.y1-glyph.y0)
+		}
+	}
+	if stats.Width != 0 && stats.Height != 0 {
+		stats.GlyphArea = float32(area) / float32(stats.Width*stats.Height)
+	}
+	return stats
+}
+
+// EvictGlyphs compacts the atlas when it is full. The most recently used
+// glyphs, up to FONS_EVICT_KEEP of the atlas area, are packed again and the
+// others are removed from the cache. The whole texture is dirty afterwards,
+// and quads returned before refer to the old places of the glyphs.
+// It returns the number of evicted glyphs.
+func (stash *FontStash) EvictGlyphs() int {
+	type cachedGlyph struct {
+		key   GlyphKey
+		glyph *Glyph
+	}
+	var cached []cachedGlyph
+	for _, font := range stash.fonts {
+		for key, glyph := range font.glyphs {
+			cached = append(cached, cachedGlyph{key: key, glyph: glyph})
+		}
+	}
+	// least recently used glyphs last, the order of the others doesn't depend on the maps
+	sort.Slice(cached, func(i, j int) bool {
+		a, b := cached[i].glyph, cached[j].glyph
+		if a.used != b.used {
+			return a.used > b.used
+		}
+		if a.y0 != b.y0 {
+			return a.y0 < b.y0
+		}
+		return a.x0 < b.x0
+	})
+	width, height := stash.params.width, stash.params.height
+	budget := int(FONS_EVICT_KEEP * float32(width*height))
+	keep := 0
+	for area := 0; keep < len(cached); keep++ {
+		glyph := cached[keep].glyph
+		area += int(glyph.x1-glyph.x0) * int(glyph.y1-glyph.y0)
+		if area > budget {
+			break
+		}
+	}
+	kept := cached[:keep]
+	// taller glyphs first pack better
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].glyph.y1-kept[i].glyph.y0 > kept[j].glyph.y1-kept[j].glyph.y0
+	})
+
+	oldData := stash.textureData
+	stash.textureData = make([]byte, width*height)
+	stash.atlas.Reset(width, height)
+	stash.addWhiteRect(2, 2)
+	evicted := cached[keep:]
+	for _, c := range kept {
+		glyph := c.glyph
+		gw := int(glyph.x1 - glyph.x0)
+		gh := int(glyph.y1 - glyph.y0)
+		gx, gy, err := stash.atlas.AddRect(gw, gh)
+		if err != nil {
+			evicted = append(evicted, c)
+			continue
+		}
+		for y := 0; y < gh; y++ {
+			src := int(glyph.x0) + (int(glyph.y0)+y)*width
+			copy(stash.textureData[gx+(gy+y)*width:], oldData[src:src+gw])
+		}
+		glyph.x0 = int16(gx)
+		glyph.y0 = int16(gy)
+		glyph.x1 = int16(gx + gw)
+		glyph.y1 = int16(gy + gh)
+	}
+	for _, c := range evicted {
+		delete(c.glyph.font.glyphs, c.key)
+	}
+	stash.dirtyRect = [4]int{0, 0, width, height}
+	stash.evicted += len(evicted)
+	stash.compactions++
+	return len(evicted)
+}
@@ -34,41 +34,61 @@ type Params struct {
 }
 
 type State struct {
-	font    int
-	align   FONSAlign
-	size    float32
-	blur    float32
-	spacing float32
+	font       int
+	align      FONSAlign
+	size       float32
+	blur       float32
+	spacing    float32
+	features   FONSFeature
+	direction  FONSDirection
+	mode       FONSRenderMode
+	variations []Variation
+	tabStops   []float32
+	writing    FONSWritingMode
 }
 
 type GlyphKey struct {
-	codePoint  rune
+	index      int
 	size, blur int16
+	sdf        bool
+	phase      int8   // horizontal offset of subpixel positioned glyphs, in 1/FONS_SUBPIXEL_PHASES pixels
+	lcd        bool   // the glyph has a coverage for every subpixel, see RENDER_LCD
+	hinted     bool   // the outline was fitted to the pixel grid, see SetHinting
+	variation  string // normalized variation coordinates of the font instance
 }
 
 type Glyph struct {
-	codePoint        rune
 	Index            int
+	Color            bool  // the glyph is in the color atlas and is drawn with its own colors
+	font             *Font // font which has the glyph, differs from the requested font for fallbacks
+	scale            float32
 	size, blur       int16
+	sdf              bool // the glyph is a signed distance field, scaled to every size
 	x0, y0, x1, y1   int16
 	xAdv, xOff, yOff int16
+	used             int // last frame the glyph was used in
 }
 
 type Font struct {
-	font      *truetype.FontInfo
-	name      string
-	data      []byte
-	freeData  uint8
-	ascender  float32
-	descender float32
-	lineh     float32
-	glyphs    map[GlyphKey]*Glyph
-	lut       []int
+	font        *truetype.FontInfo
+	name        string
+	data        []byte
+	freeData    uint8
+	ascender    float32
+	descender   float32
+	lineh       float32
+	glyphs      map[GlyphKey]*Glyph
+	lut         []int
+	fallbacks   []int
+	colorGlyphs map[GlyphKey]*Glyph // glyphs of COLR layers and color bitmaps, in the color atlas
+	variation   string              // key of the variation coordinates of an instance, empty for the default
+	instances   map[string]*Font    // instances of a variable font by their variation keys
 }
 
 type Quad struct {
 	X0, Y0, S0, T0 float32
 	X1, Y1, S1, T1 float32
+	Rotated        bool // the glyph is rotated clockwise in vertical text, S0, T1 is at X0, Y0
 }
 
 type TextIterator struct {
@@ -83,6 +103,14 @@ type TextIterator struct {
 	NextIndex                          int
 	End                                int
 	Runes                              []rune
+	Features                           FONSFeature
+	Mode                               FONSRenderMode
+	RTL                                bool // the glyph is laid out right to left
+	glyphs                             []shapedGlyph
+	originX                            float32 // left edge of the text, tab stops are measured from it
+	tabStops                           []float32
+	vertical                           bool // the glyphs go down the column centered on X, see SetWritingMode
+	nextGlyph                          int
 }
 
 type FontStash struct {
@@ -97,6 +125,11 @@ type FontStash struct {
 	scratch     []byte
 	nscratch    int
 	state       State
+	frame       int
+	evicted     int
+	compactions int
+	color       *colorAtlas // created with the first color glyph
+	hinting     bool
 }
 
 func New(width, height int) *FontStash {
@@ -106,7 +139,7 @@ func New(width, height int) *FontStash {
 	}
 	stash := &FontStash{
 		params:      params,
-		atlas:       newAtlas(params.width, params.height, FONS_INIT_ATLAS_NODES),
+		atlas:       NewAtlas(params.width, params.height, FONS_INIT_ATLAS_NODES),
 		fonts:       make([]*Font, 0, 4),
 		itw:         1.0 / float32(params.width),
 		ith:         1.0 / float32(params.height),
@@ -115,11 +148,12 @@ func New(width, height int) *FontStash {
 		tcoords:     make([]float32, 0, FONS_VERTEX_COUNT*2),
 		dirtyRect:   [4]int{params.width, params.height, 0, 0},
 		state: State{
-			size:    12.0,
-			font:    0,
-			blur:    0.0,
-			spacing: 0.0,
-			align:   ALIGN_LEFT | ALIGN_BASELINE,
+			size:     12.0,
+			font:     0,
+			blur:     0.0,
+			spacing:  0.0,
+			align:    ALIGN_LEFT | ALIGN_BASELINE,
+			features: FEATURE_DEFAULT,
 		},
 	}
 	stash.addWhiteRect(2, 2)
@@ -136,7 +170,21 @@ func (stash *FontStash) AddFont(name, path string) int {
 }
 
 func (stash *FontStash) AddFontFromMemory(name string, data []byte, freeData uint8) int {
-	fontInstance, err := truetype.InitFont(data, 0)
+	return stash.addFont(name, data, freeData, 0)
+}
+
+// AddFontFromCollection adds the face at faceIndex of a TrueType collection (.ttc).
+// A plain font file is accepted as a collection with one face.
+func (stash *FontStash) AddFontFromCollection(name string, data []byte, faceIndex int) int {
+	return stash.addFont(name, data, 0, faceIndex)
+}
+
+func (stash *FontStash) addFont(name string, data []byte, freeData uint8, faceIndex int) int {
+	offset := truetype.GetFontOffsetForIndex(data, faceIndex)
+	if offset < 0 {
+		return INVALID
+	}
+	fontInstance, err := truetype.InitFont(data, offset)
 	if err != nil {
 		return INVALID
 	}
@@ -144,19 +192,37 @@ func (stash *FontStash) AddFontFromMemory(name string, data []byte, freeData uin
 	fh := float32(ascent - descent)
 
 	font := &Font{
-		glyphs:    make(map[GlyphKey]*Glyph),
-		name:      name,
-		data:      data,
-		freeData:  freeData,
-		font:      fontInstance,
-		ascender:  float32(ascent) / fh,
-		descender: float32(descent) / fh,
-		lineh:     (fh + float32(lineGap)) / fh,
+		glyphs:      make(map[GlyphKey]*Glyph),
+		colorGlyphs: make(map[GlyphKey]*Glyph),
+		name:        name,
+		data:        data,
+		freeData:    freeData,
+		font:        fontInstance,
+		ascender:    float32(ascent) / fh,
+		descender:   float32(descent) / fh,
+		lineh:       (fh + float32(lineGap)) / fh,
 	}
 	stash.fonts = append(stash.fonts, font)
 	return len(stash.fonts) - 1
 }
 
+// AddFallbackFont adds fallback font to the base font. Codepoints missing in the base font
+// are searched in its fallback fonts in the order they were added, then in their fallbacks.
+// Returns false if either font is invalid.
+func (stash *FontStash) AddFallbackFont(base, fallback int) bool {
+	if base < 0 || base >= len(stash.fonts) || fallback < 0 || fallback >= len(stash.fonts) || base == fallback {
+		return false
+	}
+	font := stash.fonts[base]
+	for _, f := range font.fallbacks {
+		if f == fallback {
+			return true
+		}
+	}
+	font.fallbacks = append(font.fallbacks, fallback)
+	return true
+}
+
 func (stash *FontStash) GetFontByName(name string) int {
 	for i, font := range stash.fonts {
 		if font.name == name {
@@ -182,6 +248,28 @@ func (stash *FontStash) SetAlign(align FONSAlign) {
 	stash.state.align = align
 }
 
+// SetFeatures sets the OpenType features applied to text.
+func (stash *FontStash) SetFeatures(features FONSFeature) {
+	stash.state.features = features
+}
+
+// SetDirection sets the base direction of the paragraphs of text.
+func (stash *FontStash) SetDirection(direction FONSDirection) {
+	stash.state.direction = direction
+}
+
+// SetTabStops sets the positions tabs advance to, from the left edge of the text. A single
+// position repeats, like every 4 spaces. After the last of several positions, the distance between
+// the last two repeats. Without positions, tabs advance to every 8 spaces of the font.
+func (stash *FontStash) SetTabStops(stops []float32) {
+	stash.state.tabStops = stops
+}
+
+// SetRenderMode sets how the glyphs are rasterized.
+func (stash *FontStash) SetRenderMode(mode FONSRenderMode) {
+	stash.state.mode = mode
+}
+
 func (stash *FontStash) SetFont(font int) {
 	stash.state.font = font
 }
@@ -200,6 +288,42 @@ func (stash *FontStash) VerticalMetrics() (float32, float32, float32) {
 	return font.ascender * iSize / 10.0, font.descender * iSize / 10.0, font.lineh * iSize / 10.0
 }
 
+// FontMetrics are the metrics of a font scaled to the font size. Positions and
+// heights are above the baseline, negative below it.
+type FontMetrics struct {
+	Ascender, Descender, LineHeight       float32
+	XHeight, CapHeight                    float32
+	UnderlinePosition, UnderlineThickness float32 // the position is the top of the line
+	StrikeoutPosition, StrikeoutThickness float32 // the position is the top of the line
+	UnitsPerEm                            int
+}
+
+// FontMetrics returns the metrics of the current font at the current size.
+func (stash *FontStash) FontMetrics() FontMetrics {
+	state := stash.state
+	if len(stash.fonts) < state.font+1 {
+		return FontMetrics{}
+	}
+	font := stash.fonts[state.font]
+	ascender, descender, lineh := stash.VerticalMetrics()
+	scale := font.getPixelHeightScale(float32(int16(state.size*10.0)) / 10.0)
+	xHeight, capHeight := font.font.GetFontXHeights()
+	underlinePosition, underlineThickness := font.font.GetUnderlineMetrics()
+	strikeoutPosition, strikeoutThickness := font.font.GetStrikeoutMetrics()
+	return FontMetrics{
+		Ascender:           ascender,
+		Descender:          descender,
+		LineHeight:         lineh,
+		XHeight:            float32(xHeight) * scale,
+		CapHeight:          float32(capHeight) * scale,
+		UnderlinePosition:  float32(underlinePosition) * scale,
+		UnderlineThickness: float32(underlineThickness) * scale,
+		StrikeoutPosition:  float32(strikeoutPosition) * scale,
+		StrikeoutThickness: float32(strikeoutThickness) * scale,
+		UnitsPerEm:         font.font.GetUnitsPerEm(),
+	}
+}
+
 func (stash *FontStash) LineBounds(y float32) (minY, maxY float32) {
 	state := stash.state
 	if len(stash.fonts) < state.font+1 {
@@ -233,11 +357,16 @@ func (stash *FontStash) GetTextureData() ([]byte, int, int) {
 	return stash.textureData, stash.params.width, stash.params.height
 }
 
+// AtlasUsage returns the used area of the glyph atlas, from 0 to 1.
+func (stash *FontStash) AtlasUsage() float32 {
+	return stash.atlas.Usage()
+}
+
 func (stash *FontStash) ResetAtlas(width, height int) {
 	// Flush pending glyphs
 	stash.flush()
 	// Reset atlas
-	stash.atlas.reset(width, height)
+	stash.atlas.Reset(width, height)
 	// Clear texture data
 	stash.textureData = make([]byte, width*height)
 	// Reset dirty rect
@@ -248,6 +377,7 @@ func (stash *FontStash) ResetAtlas(width, height int) {
 	// reset cached glyphs
 	for _, font := range stash.fonts {
 		font.glyphs = make(map[GlyphKey]*Glyph)
+		font.instances = nil
 	}
 	stash.params.width = width
 	stash.params.height = height
@@ -263,16 +393,18 @@ func (stash *FontStash) TextBounds(x, y float32, str string) (float32, []float32
 
 func (stash *FontStash) TextBoundsOfRunes(x, y float32, runes []rune) (float32, []float32) {
 	state := stash.state
-	prevGlyphIndex := -1
+	var prevGlyph *Glyph
 	size := int(state.size * 10.0)
 	blur := int(state.blur)
 
 	if len(stash.fonts) < state.font+1 {
 		return 0, nil
 	}
-	font := stash.fonts[state.font]
+	font := stash.varied(stash.fonts[state.font])
+	if state.writing == WRITING_VERTICAL {
+		return stash.verticalTextBounds(font, x, y, runes)
+	}
 
-	scale := font.getPixelHeightScale(state.size)
 	y += stash.getVerticalAlign(font, state.align, float32(size))
 
 	minX := x
@@ -281,11 +413,14 @@ func (stash *FontStash) TextBoundsOfRunes(x, y float32, runes []rune) (float32,
 	maxY := y
 	startX := x
 
-	for _, codePoint := range runes {
-		glyph := stash.getGlyph(font, codePoint, size, blur)
+	for _, shaped := range stash.shape(font, runes, state.features, state.direction, true, false) {
+		var quad Quad
+		var glyph *Glyph
+		glyph, quad, x, y = stash.glyphQuad(prevGlyph, &shaped, state.spacing, state.features, size, blur, state.mode, x, y)
+		if shaped.tab {
+			x = font.nextTabStop(state.tabStops, state.size, startX, x)
+		}
 		if glyph != nil {
-			var quad Quad
-			quad, x, y = stash.getQuad(font, prevGlyphIndex, glyph, scale, state.spacing, x, y)
 			if quad.X0 < minX {
 				minX = quad.X0
 			}
@@ -298,10 +433,8 @@ func (stash *FontStash) TextBoundsOfRunes(x, y float32, runes []rune) (float32,
 			if quad.Y1 > maxY {
 				maxY = quad.Y1
 			}
-			prevGlyphIndex = glyph.Index
-		} else {
-			prevGlyphIndex = -1
 		}
+		prevGlyph = glyph
 	}
 
 	advance := x - startX
@@ -323,22 +456,47 @@ func (stash *FontStash) TextIter(x, y float32, str string) *TextIterator {
 	return stash.TextIterForRunes(x, y, []rune(str))
 }
 
+// TextIterForRunes returns an iterator over the glyphs of the runes in visual order.
 func (stash *FontStash) TextIterForRunes(x, y float32, runes []rune) *TextIterator {
+	return stash.textIter(x, y, runes, true)
+}
+
+// LogicalTextIterForRunes returns an iterator over the glyphs of the runes in
+// logical order, as if all text was left to right. It is meant for measuring
+// parts of the text, like for breaking lines.
+func (stash *FontStash) LogicalTextIterForRunes(x, y float32, runes []rune) *TextIterator {
+	return stash.textIter(x, y, runes, false)
+}
+
+func (stash *FontStash) textIter(x, y float32, runes []rune, visual bool) *TextIterator {
 	state := stash.state
 	if len(stash.fonts) < state.font+1 {
 		return nil
 	}
-	font := stash.fonts[state.font]
-	if (state.align & ALIGN_LEFT) != 0 {
-		// do nothing
-	} else if (state.align & ALIGN_RIGHT) != 0 {
-		width, _ := stash.TextBoundsOfRunes(x, y, runes)
-		x -= width
-	} else if (state.align & ALIGN_CENTER) != 0 {
-		width, _ := stash.TextBoundsOfRunes(x, y, runes)
-		x -= width * 0.5
+	font := stash.varied(stash.fonts[state.font])
+	vertical := state.writing == WRITING_VERTICAL
+	mode := state.mode
+	if vertical {
+		x = stash.columnX(x)
+		if (state.align & (ALIGN_MIDDLE | ALIGN_BOTTOM)) != 0 {
+			height, _ := stash.TextBoundsOfRunes(x, y, runes)
+			y -= stash.columnShift(height)
+		}
+		if mode == RENDER_LCD {
+			mode = RENDER_SUBPIXEL
+		}
+	} else {
+		if (state.align & ALIGN_LEFT) != 0 {
+			// do nothing
+		} else if (state.align & ALIGN_RIGHT) != 0 {
+			width, _ := stash.TextBoundsOfRunes(x, y, runes)
+			x -= width
+		} else if (state.align & ALIGN_CENTER) != 0 {
+			width, _ := stash.TextBoundsOfRunes(x, y, runes)
+			x -= width * 0.5
+		}
+		y += stash.getVerticalAlign(font, state.align, state.size*10.0)
 	}
-	y += stash.getVerticalAlign(font, state.align, state.size*10.0)
 	iter := &TextIterator{
 		stash:        stash,
 		font:         font,
@@ -356,36 +514,57 @@ func (stash *FontStash) TextIterForRunes(x, y float32, runes []rune) *TextIterat
 		CodePoint:    0,
 		PrevGlyph:    nil,
 		Runes:        runes,
+		Features:     state.features,
+		Mode:         mode,
+		glyphs:       stash.shape(font, runes, state.features, state.direction, visual, vertical),
+		originX:      x,
+		tabStops:     state.tabStops,
+		vertical:     vertical,
 	}
 	return iter
 }
 
+// Next moves to the next glyph. The glyph belongs to the cluster of the runes
+// from CurrentIndex to NextIndex, which may have several glyphs.
 func (iter *TextIterator) Next() (quad Quad, ok bool) {
-	iter.CurrentIndex = iter.NextIndex
-	if iter.CurrentIndex == iter.End {
+	if iter.nextGlyph == len(iter.glyphs) {
+		iter.CurrentIndex = iter.NextIndex
 		return Quad{}, false
 	}
-	current := iter.NextIndex
-	stash := iter.stash
-	font := iter.font
+	shaped := iter.glyphs[iter.nextGlyph]
+	iter.nextGlyph++
+	iter.CurrentIndex = shaped.cluster
+	iter.RTL = shaped.level&1 == 1
 
-	iter.CodePoint = iter.Runes[current]
-	current++
+	iter.CodePoint = iter.Runes[shaped.cluster]
 	iter.X = iter.NextX
 	iter.Y = iter.NextY
-	glyph := stash.getGlyph(font, iter.CodePoint, iter.Size, iter.Blur)
-	prevGlyphIndex := -1
-	if iter.PrevGlyph != nil {
-		prevGlyphIndex = iter.PrevGlyph.Index
+	var glyph *Glyph
+	if iter.vertical {
+		var prev *shapedGlyph
+		if iter.nextGlyph > 1 {
+			prev = &iter.glyphs[iter.nextGlyph-2]
+		}
+		glyph, quad, iter.NextY = iter.stash.getVerticalQuad(prev, &shaped, iter.Spacing, iter.Features, iter.Size, iter.Blur, iter.Mode, iter.NextX, iter.NextY)
+		iter.PrevGlyph = glyph
+		iter.NextIndex = shaped.cluster + shaped.length
+		return quad, true
 	}
-	if glyph != nil {
-		quad, iter.NextX, iter.NextY = iter.stash.getQuad(font, prevGlyphIndex, glyph, iter.Scale, iter.Spacing, iter.NextX, iter.NextY)
+	glyph, quad, iter.NextX, iter.NextY = iter.stash.glyphQuad(iter.PrevGlyph, &shaped, iter.Spacing, iter.Features, iter.Size, iter.Blur, iter.Mode, iter.NextX, iter.NextY)
+	if shaped.tab {
+		iter.NextX = iter.font.nextTabStop(iter.tabStops, float32(iter.Size)/10.0, iter.originX, iter.NextX)
 	}
 	iter.PrevGlyph = glyph
-	iter.NextIndex = current
+	iter.NextIndex = shaped.cluster + shaped.length
 	return quad, true
 }
 
+// GlyphCount returns the number of glyphs of the shaped text, which may
+// differ from the number of runes.
+func (iter *TextIterator) GlyphCount() int {
+	return len(iter.glyphs)
+}
+
 func (stash *FontStash) flush() {
 	// Flush texture
 	stash.ValidateTexture()
@@ -396,7 +575,7 @@ func (stash *FontStash) flush() {
 }
 
 func (stash *FontStash) addWhiteRect(w, h int) {
-	gx, gy, err := stash.atlas.addRect(w, h)
+	gx, gy, err := stash.atlas.AddRect(w, h)
 	if err != nil {
 		return
 	}
@@ -429,29 +608,57 @@ func (stash *FontStash) getVerticalAlign(font *Font, align FONSAlign, iSize floa
 	return 0.0
 }
 
+// getGlyph returns the glyph of the codepoint from the font or its fallbacks.
 func (stash *FontStash) getGlyph(font *Font, codePoint rune, size, blur int) *Glyph {
+	renderFont, index := stash.findGlyphFont(font, codePoint)
+	return stash.getGlyphOfIndex(renderFont, index, size, blur, RENDER_BITMAP)
+}
+
+// getGlyphOfIndex returns the glyph of the index in renderFont, rasterizing it
+// into the atlas if it isn't cached yet. Signed distance field glyphs are the
+// same for every size and aren't blurred.
+func (stash *FontStash) getGlyphOfIndex(renderFont *Font, index, size, blur int, mode FONSRenderMode) *Glyph {
 	if size < 0 {
 		return nil
 	}
+	if renderFont.font.HasColorGlyphs() {
+		if glyph, ok := stash.getColorGlyph(renderFont, index, size); ok {
+			return glyph
+		}
+	}
+	if mode == RENDER_SDF {
+		return stash.getSDFGlyph(renderFont, index)
+	}
+	return stash.getBitmapGlyph(renderFont, index, size, blur, 0)
+}
+
+// getBitmapGlyph returns the coverage bitmap glyph of the index in renderFont
+// shifted right by phase/FONS_SUBPIXEL_PHASES pixels, rasterizing it into the
+// atlas if it isn't cached yet.
+func (stash *FontStash) getBitmapGlyph(renderFont *Font, index, size, blur, phase int) *Glyph {
 	if blur > 20 {
 		blur = 20
 	}
 	pad := blur + 2
 	glyphKey := GlyphKey{
-		codePoint: codePoint,
+		index:     index,
 		size:      int16(size),
 		blur:      int16(blur),
+		phase:     int8(phase),
+		hinted:    stash.hinted(size),
+		variation: renderFont.variation,
 	}
-	glyph, ok := font.glyphs[glyphKey]
+	glyph, ok := renderFont.glyphs[glyphKey]
 	if ok {
+		glyph.used = stash.frame
 		return glyph
 	}
-	scale := font.getPixelHeightScale(float32(size) / 10.0)
-	index := font.getGlyphIndex(codePoint)
-	advance, _, x0, y0, x1, y1 := font.buildGlyphBitmap(index, scale)
+	scale := renderFont.getPixelHeightScale(float32(size) / 10.0)
+	shiftX := float32(phase) / FONS_SUBPIXEL_PHASES
+	advance, _, x0, y0, x1, y1 := renderFont.buildGlyphBitmap(index, scale, scale, shiftX, glyphKey.hinted)
 	gw := x1 - x0 + pad*2
 	gh := y1 - y0 + pad*2
-	gx, gy, err := stash.atlas.addRect(gw, gh)
+	gx, gy, err := stash.atlas.AddRect(gw, gh)
 	if err != nil {
 		return nil
 	}
@@ -459,21 +666,23 @@ func (stash *FontStash) getGlyph(font *Font, codePoint rune, size, blur int) *Gl
 	gb := gy + gh
 	width := stash.params.width
 	glyph = &Glyph{
-		codePoint: codePoint,
-		Index:     index,
-		size:      int16(size),
-		blur:      int16(blur),
-		x0:        int16(gx),
-		y0:        int16(gy),
-		x1:        int16(gr),
-		y1:        int16(gb),
-		xAdv:      int16(scale * float32(advance) * 10.0),
-		xOff:      int16(x0 - pad),
-		yOff:      int16(y0 - pad),
-	}
-	font.glyphs[glyphKey] = glyph
+		Index: index,
+		font:  renderFont,
+		scale: scale,
+		size:  int16(size),
+		blur:  int16(blur),
+		x0:    int16(gx),
+		y0:    int16(gy),
+		x1:    int16(gr),
+		y1:    int16(gb),
+		xAdv:  int16(scale * float32(advance) * 10.0),
+		xOff:  int16(x0 - pad),
+		yOff:  int16(y0 - pad),
+		used:  stash.frame,
+	}
+	renderFont.glyphs[glyphKey] = glyph
 	// Rasterize
-	font.renderGlyphBitmap(stash.textureData, gx+pad, gy+pad, x1-x0, y1-y0, width, scale, scale, index)
+	renderFont.renderGlyphBitmap(stash.textureData, gx+pad, gy+pad, x1-x0, y1-y0, width, scale, scale, shiftX, index, glyphKey.hinted)
 	// Make sure there is one pixel empty border
 	for y := gy; y < gb; y++ {
 		stash.textureData[gx+y*width] = 0
@@ -496,34 +705,108 @@ func (stash *FontStash) getGlyph(font *Font, codePoint rune, size, blur int) *Gl
 	return glyph
 }
 
-func (stash *FontStash) getQuad(font *Font, prevGlyphIndex int, glyph *Glyph, scale, spacing float32, originalX, originalY float32) (quad Quad, x, y float32) {
+// findGlyphFont returns the font which has the codepoint, the font itself or one of its fallbacks,
+// and the glyph index in it. The font and glyph 0 are returned when no font has the codepoint.
+// The fallbacks of the fallbacks are searched after the direct ones, every font only once.
+func (stash *FontStash) findGlyphFont(font *Font, codePoint rune) (*Font, int) {
+	index := font.getGlyphIndex(codePoint)
+	if index != 0 || len(font.fallbacks) == 0 {
+		return font, index
+	}
+	searched := append([]int(nil), font.fallbacks...)
+	for i := 0; i < len(searched); i++ {
+		fallback := stash.fonts[searched[i]]
+		fallbackFont := stash.varied(fallback)
+		if fallbackIndex := fallbackFont.getGlyphIndex(codePoint); fallbackIndex != 0 {
+			return fallbackFont, fallbackIndex
+		}
+		for _, next := range fallback.fallbacks {
+			if !containsInt(searched, next) {
+				searched = append(searched, next)
+			}
+		}
+	}
+	return font, index
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// glyphQuad returns the glyph of the shaped glyph in the mode, its quad at the pen position
+// and the pen position after it. The glyph is nil, and the pen doesn't move, if the atlas is full.
+func (stash *FontStash) glyphQuad(prevGlyph *Glyph, shaped *shapedGlyph, spacing float32, features FONSFeature, size, blur int, mode FONSRenderMode, x, y float32) (*Glyph, Quad, float32, float32) {
+	if stash.color != nil {
+		stash.color.full = false
+	}
+	if mode == RENDER_SUBPIXEL || mode == RENDER_LCD {
+		return stash.getSubpixelQuad(prevGlyph, shaped, spacing, features, size, blur, mode == RENDER_LCD, x, y)
+	}
+	glyph := stash.getGlyphOfIndex(shaped.font, shaped.index, size, blur, mode)
+	if glyph == nil {
+		return nil, Quad{}, x, y
+	}
+	quad, x, y := stash.getQuad(prevGlyph, glyph, shaped, spacing, features, size, x, y)
+	return glyph, quad, x, y
+}
+
+// getQuad returns the quad of the shaped glyph at the pen position and the
+// pen position after it. Fonts without GPOS are kerned with their kern table,
+// only between glyphs of the same font. Letter spacing is only added between
+// clusters. Signed distance field glyphs are scaled to the size.
+func (stash *FontStash) getQuad(prevGlyph, glyph *Glyph, shaped *shapedGlyph, spacing float32, features FONSFeature, size int, originalX, originalY float32) (quad Quad, x, y float32) {
 	x = originalX
 	y = originalY
-	if prevGlyphIndex != -1 {
-		adv := float32(font.getGlyphKernAdvance(prevGlyphIndex, glyph.Index)) * scale
+	scale := glyph.scale
+	ratio := float32(1)
+	if glyph.sdf {
+		ratio = float32(size) / 10.0 / FONS_SDF_SIZE
+		scale *= ratio
+	}
+	if prevGlyph != nil {
+		var adv float32
+		if features&FEATURE_KERNING != 0 && !shaped.positioned && prevGlyph.font == glyph.font {
+			adv = float32(glyph.font.getGlyphKernAdvance(prevGlyph.Index, glyph.Index)) * scale
+		}
+		if shaped.joined {
+			spacing = 0
+		}
 		x += float32(int(adv + spacing + 0.5))
 	}
-	xOff := float32(int(glyph.xOff + 1))
-	yOff := float32(int(glyph.yOff + 1))
+	xOff := float32(int(glyph.xOff+1)) * ratio
+	yOff := float32(int(glyph.yOff+1)) * ratio
 	x0 := float32(int(glyph.x0 + 1))
 	y0 := float32(int(glyph.y0 + 1))
 	x1 := float32(int(glyph.x1 - 1))
 	y1 := float32(int(glyph.y1 - 1))
 	// only support FONS_ZERO_TOPLEFT
-	rx := float32(int(x + xOff))
-	ry := float32(int(y + yOff))
+	rx := x + xOff + float32(shaped.xOffset)*scale
+	ry := y + yOff - float32(shaped.yOffset)*scale
+	if !glyph.sdf {
+		rx = float32(int(rx))
+		ry = float32(int(ry))
+	}
 
+	itw, ith := stash.itw, stash.ith
+	if glyph.Color {
+		itw, ith = 1.0/FONS_COLOR_ATLAS_SIZE, 1.0/FONS_COLOR_ATLAS_SIZE
+	}
 	quad = Quad{
 		X0: rx,
 		Y0: ry,
-		X1: rx + x1 - x0,
-		Y1: ry + y1 - y0,
-		S0: x0 * stash.itw,
-		T0: y0 * stash.ith,
-		S1: x1 * stash.itw,
-		T1: y1 * stash.ith,
-	}
-	x += float32(int(float32(glyph.xAdv)/10.0 + 0.5))
+		X1: rx + (x1-x0)*ratio,
+		Y1: ry + (y1-y0)*ratio,
+		S0: x0 * itw,
+		T0: y0 * ith,
+		S1: x1 * itw,
+		T1: y1 * ith,
+	}
+	x += float32(int(float32(glyph.xAdv)/10.0*ratio + float32(shaped.xAdvance)*scale + 0.5))
 	return
 }
 
@@ -614,12 +897,56 @@ func (font *Font) getGlyphIndex(codePoint rune) int {
 	return font.font.FindGlyphIndex(int(codePoint))
 }
 
-func (font *Font) buildGlyphBitmap(index int, scale float32) (advance, lsb, x0, y0, x1, y1 int) {
+func (font *Font) buildGlyphBitmap(index int, scaleX, scaleY, shiftX float32, hinted bool) (advance, lsb, x0, y0, x1, y1 int) {
 	advance, lsb = font.font.GetGlyphHMetrics(index)
-	x0, y0, x1, y1 = font.font.GetGlyphBitmapBoxSubpixel(index, float64(scale), float64(scale), 0, 0)
+	if hinted {
+		vertices := font.font.HintGlyphShape(font.font.GetGlyphShape(index), float64(scaleY))
+		x0, y0, x1, y1 = truetype.GetShapeBitmapBox(vertices, float64(scaleX), float64(scaleY), float64(shiftX), 0)
+		return
+	}
+	x0, y0, x1, y1 = font.font.GetGlyphBitmapBoxSubpixel(index, float64(scaleX), float64(scaleY), float64(shiftX), 0)
 	return
 }
 
-func (font *Font) renderGlyphBitmap(data []byte, offsetX, offsetY, outWidth, outHeight, outStride int, scaleX, scaleY float32, index int) {
-	font.font.MakeGlyphBitmapSubpixel(data[offsetY*outStride+offsetX:], outWidth, outHeight, outStride, float64(scaleX), float64(scaleY), 0, 0, index)
+func (font *Font) renderGlyphBitmap(data []byte, offsetX, offsetY, outWidth, outHeight, outStride int, scaleX, scaleY, shiftX float32, index int, hinted bool) {
+	if !hinted {
+		font.font.MakeGlyphBitmapSubpixel(data[offsetY*outStride+offsetX:], outWidth, outHeight, outStride, float64(scaleX), float64(scaleY), float64(shiftX), 0, index)
+		return
+	}
+	if outWidth <= 0 || outHeight <= 0 {
+		return
+	}
+	vertices := font.font.HintGlyphShape(font.font.GetGlyphShape(index), float64(scaleY))
+	ix0, iy0, _, _ := truetype.GetShapeBitmapBox(vertices, float64(scaleX), float64(scaleY), float64(shiftX), 0)
+	bitmap := truetype.Bitmap{
+		W:      outWidth,
+		H:      outHeight,
+		Stride: outStride,
+		Pixels: data[offsetY*outStride+offsetX:],
+	}
+	truetype.Rasterize(&bitmap, 0.35, vertices, float64(scaleX), float64(scaleY), float64(shiftX), 0, ix0, iy0, true)
+}
+
+// nextTabStop returns the position of the first tab stop after x, for text of size
+// whose left edge is at originX. See SetTabStops.
+func (font *Font) nextTabStop(stops []float32, size, originX, x float32) float32 {
+	if len(stops) == 0 {
+		advance, _ := font.font.GetGlyphHMetrics(font.getGlyphIndex(' '))
+		stops = []float32{8 * float32(advance) * font.getPixelHeightScale(size)}
+	}
+	pos := x - originX
+	for _, stop := range stops {
+		if stop > pos {
+			return originX + stop
+		}
+	}
+	last := stops[len(stops)-1]
+	interval := last
+	if n := len(stops); n > 1 {
+		interval = last - stops[n-2]
+	}
+	if interval <= 0 {
+		return x
+	}
+	return originX + last + (float32(math.Floor(float64((pos-last)/interval)))+1)*interval
 }
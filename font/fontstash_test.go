@@ -0,0 +1,1086 @@
+package font
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/jxo/davinci/font/truetype"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// buildTestFont creates a minimal TrueType font. Every rune is mapped to a square glyph
+// with the specified advance width (unitsPerEm is 1000). Glyph 0 is empty.
+// Tables in extra are added to or replace the generated tables, a nil table removes one.
+func buildTestFont(runes []rune, advance int, extra map[string][]byte) []byte {
+	be := binary.BigEndian
+	numGlyphs := len(runes) + 1
+
+	var glyf bytes.Buffer
+	loca := make([]byte, 4*(numGlyphs+1))
+	hmtx := make([]byte, 4*numGlyphs)
+	be.PutUint16(hmtx, uint16(advance))
+	for i := 1; i < numGlyphs; i++ {
+		be.PutUint32(loca[4*i:], uint32(glyf.Len()))
+		for _, v := range []int16{1, 100, 0, 600, 700, 3, 0} {
+			binary.Write(&glyf, be, v)
+		}
+		glyf.Write([]byte{1, 1, 1, 1})
+		for _, v := range []int16{100, 0, 500, 0, 0, 700, 0, -700} {
+			binary.Write(&glyf, be, v)
+		}
+		be.PutUint16(hmtx[4*i:], uint16(advance))
+		be.PutUint16(hmtx[4*i+2:], 100)
+	}
+	be.PutUint32(loca[4*numGlyphs:], uint32(glyf.Len()))
+
+	var cmap bytes.Buffer
+	for _, v := range []uint16{0, 1, 3, 10} {
+		binary.Write(&cmap, be, v)
+	}
+	binary.Write(&cmap, be, uint32(12))
+	binary.Write(&cmap, be, []uint16{12, 0})
+	binary.Write(&cmap, be, []uint32{uint32(16 + 12*len(runes)), 0, uint32(len(runes))})
+	for i, r := range runes {
+		binary.Write(&cmap, be, []uint32{uint32(r), uint32(r), uint32(i + 1)})
+	}
+
+	head := make([]byte, 54)
+	be.PutUint32(head[0:], 0x00010000)
+	be.PutUint32(head[12:], 0x5F0F3CF5)
+	be.PutUint16(head[18:], 1000)
+	be.PutUint16(head[40:], 1000)
+	be.PutUint16(head[42:], 800)
+	be.PutUint16(head[50:], 1)
+
+	hhea := make([]byte, 36)
+	be.PutUint32(hhea[0:], 0x00010000)
+	be.PutUint16(hhea[4:], 800)
+	be.PutUint16(hhea[6:], uint16(0x10000-200))
+	be.PutUint16(hhea[34:], uint16(numGlyphs))
+
+	maxp := make([]byte, 6)
+	be.PutUint32(maxp[0:], 0x00005000)
+	be.PutUint16(maxp[4:], uint16(numGlyphs))
+
+	tables := map[string][]byte{
+		"cmap": cmap.Bytes(), "glyf": glyf.Bytes(), "head": head, "hhea": hhea,
+		"hmtx": hmtx, "loca": loca, "maxp": maxp,
+	}
+	for tag, table := range extra {
+		if table == nil {
+			delete(tables, tag)
+		} else {
+			tables[tag] = table
+		}
+	}
+	return assembleTestFont(tables)
+}
+
+// assembleTestFont writes the tables into a font file.
+func assembleTestFont(tables map[string][]byte) []byte {
+	be := binary.BigEndian
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var out bytes.Buffer
+	binary.Write(&out, be, uint32(0x00010000))
+	binary.Write(&out, be, []uint16{uint16(len(tags)), 0, 0, 0})
+	offset := 12 + 16*len(tags)
+	for _, tag := range tags {
+		out.WriteString(tag)
+		binary.Write(&out, be, []uint32{0, uint32(offset), uint32(len(tables[tag]))})
+		offset += (len(tables[tag]) + 3) &^ 3
+	}
+	for _, tag := range tags {
+		out.Write(tables[tag])
+		out.Write(make([]byte, (4-len(tables[tag])%4)%4))
+	}
+	return out.Bytes()
+}
+
+func TestFallbackFont(t *testing.T) {
+	stash := New(512, 512)
+	latin := stash.AddFontFromMemory("latin", buildTestFont([]rune("ab"), 500, nil), 0)
+	icons := stash.AddFontFromMemory("icons", buildTestFont([]rune("\ue000"), 1000, nil), 0)
+	if latin == INVALID || icons == INVALID {
+		t.Fatal("can't load test fonts")
+	}
+	stash.SetFont(latin)
+	stash.SetSize(10)
+
+	glyph := stash.getGlyph(stash.fonts[latin], '\ue000', 100, 0)
+	if glyph.Index != 0 {
+		t.Errorf("missing glyph should be glyph 0, but %d", glyph.Index)
+	}
+	if !stash.AddFallbackFont(latin, icons) {
+		t.Fatal("AddFallbackFont should succeed")
+	}
+	if stash.AddFallbackFont(latin, latin) {
+		t.Error("font can't be its own fallback")
+	}
+	glyph = stash.getGlyph(stash.fonts[latin], '\ue000', 100, 0)
+	if glyph.Index != 1 || glyph.font != stash.fonts[icons] {
+		t.Errorf("glyph should come from fallback font, but index %d", glyph.Index)
+	}
+
+	width, _ := stash.TextBounds(0, 0, "a\ue000b")
+	if width != 20 {
+		t.Errorf("advance should be 5+10+5, but %f", width)
+	}
+}
+
+func TestFallbackFontChain(t *testing.T) {
+	stash := New(512, 512)
+	latin := stash.AddFontFromMemory("latin", buildTestFont([]rune("ab"), 500, nil), 0)
+	greek := stash.AddFontFromMemory("greek", buildTestFont([]rune("\u03b1"), 600, nil), 0)
+	icons := stash.AddFontFromMemory("icons", buildTestFont([]rune("\u03b2\ue000"), 1000, nil), 0)
+	// latin -> greek -> icons -> latin, a cycle
+	stash.AddFallbackFont(latin, greek)
+	stash.AddFallbackFont(greek, icons)
+	stash.AddFallbackFont(icons, latin)
+	stash.SetFont(latin)
+	stash.SetSize(10)
+
+	for _, c := range []struct {
+		codePoint rune
+		font      int
+		index     int
+	}{
+		{'a', latin, 1},
+		{'\u03b1', greek, 1},
+		{'\ue000', icons, 2},
+		{'z', latin, 0},
+	} {
+		font, index := stash.findGlyphFont(stash.fonts[latin], c.codePoint)
+		if font != stash.fonts[c.font] || index != c.index {
+			t.Errorf("%q should be glyph %d of font %d, but %d of %s", c.codePoint, c.index, c.font, index, font.name)
+		}
+	}
+	// the direct fallback comes first
+	font, _ := stash.findGlyphFont(stash.fonts[icons], 'a')
+	if font != stash.fonts[latin] {
+		t.Errorf("'a' should come from the direct fallback of icons, but %s", font.name)
+	}
+
+	width, _ := stash.TextBounds(0, 0, "a\ue000b")
+	if width != 20 {
+		t.Errorf("advance should be 5+10+5, but %f", width)
+	}
+}
+
+// buildTestCFF creates a CFF table with the same squares as buildTestFont, except
+// that the bottom right corner is a cubic curve.
+func buildTestCFF(numGlyphs int) []byte {
+	num := func(v int) []byte {
+		switch {
+		case v >= -107 && v <= 107:
+			return []byte{byte(v + 139)}
+		case v >= 108 && v <= 1131:
+			return []byte{byte((v-108)>>8 + 247), byte(v - 108)}
+		default:
+			return []byte{byte((-v-108)>>8 + 251), byte(-v - 108)}
+		}
+	}
+	var glyph []byte
+	for _, op := range [][]int{{100, 0, 21}, {400, 0, 5}, {50, 0, 50, 50, 0, 50, 8}, {600, 7}, {-500, 6}} {
+		for _, v := range op[:len(op)-1] {
+			glyph = append(glyph, num(v)...)
+		}
+		glyph = append(glyph, byte(op[len(op)-1]))
+	}
+	glyph = append(glyph, 14)
+
+	charStrings := []byte{0, byte(numGlyphs), 1, 1, 2}
+	data := []byte{14}
+	for i := 1; i < numGlyphs; i++ {
+		data = append(data, glyph...)
+		charStrings = append(charStrings, byte(len(data)+1))
+	}
+	charStrings = append(charStrings, data...)
+
+	cff := []byte{1, 0, 4, 4}
+	cff = append(cff, 0, 1, 1, 1, 2, 'T') // name INDEX
+	cff = append(cff, 0, 1, 1, 1, 7, 29)  // top DICT INDEX
+	cff = append(cff, 0, 0, 0, 25, 17)    // CharStrings offset
+	cff = append(cff, 0, 0, 0, 0)         // string and global subr INDEXes
+	return append(cff, charStrings...)
+}
+
+func TestCFFFont(t *testing.T) {
+	data := buildTestFont([]rune("a"), 500, map[string][]byte{"glyf": nil, "loca": nil, "CFF ": buildTestCFF(2)})
+	stash := New(512, 512)
+	font := stash.AddFontFromMemory("cff", data, 0)
+	if font == INVALID {
+		t.Fatal("can't load CFF font")
+	}
+	info := stash.fonts[font].font
+	if ok, x0, y0, x1, y1 := info.GetGlyphBox(1); !ok || x0 != 100 || y0 != 0 || x1 != 600 || y1 != 700 {
+		t.Errorf("unexpected glyph box %v %d %d %d %d", ok, x0, y0, x1, y1)
+	}
+	shape := info.GetGlyphShape(1)
+	if len(shape) != 6 {
+		t.Fatalf("outline should have 6 vertices, but %d", len(shape))
+	}
+	if v := shape[2]; v.X != 600 || v.Y != 100 || v.CX != 550 || v.CY != 0 || v.CX1 != 600 || v.CY1 != 50 {
+		t.Errorf("unexpected cubic segment %+v", v)
+	}
+
+	stash.SetFont(font)
+	stash.SetSize(20)
+	glyph := stash.getGlyph(stash.fonts[font], 'a', 200, 0)
+	if glyph.Index != 1 || glyph.x1-glyph.x0 <= 2 {
+		t.Errorf("glyph should be rasterized, but %+v", glyph)
+	}
+}
+
+func TestSDFGlyph(t *testing.T) {
+	stash := New(512, 512)
+	font := stash.AddFontFromMemory("sdf", buildTestFont([]rune("a"), 1000, nil), 0)
+	stash.SetFont(font)
+	stash.SetRenderMode(RENDER_SDF)
+
+	glyph := stash.getGlyphOfIndex(stash.fonts[font], 1, 100, 0, RENDER_SDF)
+	if glyph == nil || glyph != stash.getGlyphOfIndex(stash.fonts[font], 1, 1000, 0, RENDER_SDF) {
+		t.Fatal("signed distance field glyph should be shared by all sizes")
+	}
+	texel := func(x, y int) byte {
+		return stash.textureData[int(glyph.x0)+x+(int(glyph.y0)+y)*512]
+	}
+	// the left edge of the square is at 4.8 pixels, 7.8 pixels in the field
+	y := FONS_SDF_SPREAD + 18
+	if texel(0, y) != 0 || texel(7, y) >= 128 || texel(8, y) <= 128 || texel(20, y) != 255 {
+		t.Errorf("unexpected distances %d %d %d %d", texel(0, y), texel(7, y), texel(8, y), texel(20, y))
+	}
+
+	for _, size := range []float32{24, 96} {
+		stash.SetSize(size)
+		width, bounds := stash.TextBounds(0, 0, "a")
+		if width != size || bounds[2]-bounds[0] != float32(glyph.x1-glyph.x0-2)*size/FONS_SDF_SIZE {
+			t.Errorf("glyph should be scaled to %f, but %f %v", size, width, bounds)
+		}
+	}
+}
+
+func TestEvictGlyphs(t *testing.T) {
+	stash := New(128, 128)
+	font := stash.fonts[stash.AddFontFromMemory("evict", buildTestFont([]rune("a"), 1000, nil), 0)]
+
+	recent := stash.getGlyph(font, 'a', 200, 0)
+	stash.NextFrame()
+	size := 100
+	for ; stash.getGlyph(font, 'a', size, 0) != nil; size++ {
+	}
+	stash.NextFrame()
+	if stash.getGlyph(font, 'a', 200, 0) != recent {
+		t.Fatal("cached glyph should be returned")
+	}
+	pixels := func(glyph *Glyph) []byte {
+		var data []byte
+		for y := glyph.y0; y < glyph.y1; y++ {
+			data = append(data, stash.textureData[int(glyph.x0)+int(y)*128:int(glyph.x1)+int(y)*128]...)
+		}
+		return data
+	}
+	before := pixels(recent)
+	full := stash.AtlasStats()
+
+	evicted := stash.EvictGlyphs()
+	stats := stash.AtlasStats()
+	if evicted == 0 || stats.Glyphs != full.Glyphs-evicted || stats.Evicted != evicted || stats.Compactions != 1 {
+		t.Fatalf("unexpected stats %+v after evicting %d glyphs of %+v", stats, evicted, full)
+	}
+	if stats.GlyphArea > FONS_EVICT_KEEP || stats.Usage >= full.Usage {
+		t.Errorf("atlas should be compacted, but %+v", stats)
+	}
+	if font.glyphs[GlyphKey{index: 1, size: 200}] != recent || !bytes.Equal(pixels(recent), before) {
+		t.Error("recently used glyph should be kept")
+	}
+	if stash.getGlyph(font, 'a', size, 0) == nil {
+		t.Error("new glyph should fit after the eviction")
+	}
+}
+
+func TestTextOutlines(t *testing.T) {
+	stash := New(64, 64)
+	stash.SetFont(stash.AddFontFromMemory("outline", buildTestFont([]rune("ab"), 1000, nil), 0))
+	stash.SetSize(20)
+	stash.SetSpacing(3)
+	stash.SetAlign(ALIGN_RIGHT | ALIGN_BASELINE)
+
+	advance, outlines := stash.TextOutlines(100, 50, []rune("ab"))
+	if len(outlines) != 2 || len(outlines[0].Vertices) == 0 {
+		t.Fatalf("unexpected outlines %+v", outlines)
+	}
+	glyphAdvance := 1000 * outlines[0].Scale
+	if advance != glyphAdvance*2+3 || outlines[0].X != 100-advance || outlines[1].X != outlines[0].X+glyphAdvance+3 || outlines[1].Y != 50 {
+		t.Errorf("unexpected layout %f %+v", advance, outlines)
+	}
+	if u := stash.AtlasStats(); u.Glyphs != 0 {
+		t.Errorf("outlines shouldn't be rasterized, but %+v", u)
+	}
+}
+
+func TestFontMetrics(t *testing.T) {
+	os2 := make([]byte, 96)
+	copy(os2, u16s(2))
+	copy(os2[26:], u16s(40, 300))
+	copy(os2[86:], u16s(500, 650))
+	post := make([]byte, 32)
+	copy(post[8:], u16s(0x10000-150, 60))
+
+	stash := New(64, 64)
+	measured := stash.AddFontFromMemory("measured", buildTestFont([]rune("Hx"), 1000, nil), 0)
+	stash.SetFont(measured)
+	stash.SetSize(20)
+	expected := FontMetrics{16, -4, 20, 14, 14, -2, 1, 7.5, 1, 1000}
+	if metrics := stash.FontMetrics(); !equalMetrics(metrics, expected) {
+		t.Errorf("metrics should be measured on the glyphs %+v, but %+v", expected, metrics)
+	}
+
+	stash.SetFont(stash.AddFontFromMemory("tables", buildTestFont([]rune("Hx"), 1000, map[string][]byte{"OS/2": os2, "post": post}), 0))
+	expected = FontMetrics{16, -4, 20, 10, 13, -3, 1.2, 6, 0.8, 1000}
+	if metrics := stash.FontMetrics(); !equalMetrics(metrics, expected) {
+		t.Errorf("metrics should be read from the tables %+v, but %+v", expected, metrics)
+	}
+}
+
+func TestFontVariations(t *testing.T) {
+	fvar := u16s(1, 0, 16, 2, 1, 20, 0, 8)
+	fvar = append(fvar, "wght"...)
+	fvar = append(fvar, u16s(100, 0, 400, 0, 900, 0, 0, 256)...)
+	avar := u16s(1, 0, 0, 1, 4, 0x10000-16384, 0x10000-16384, 0, 0, 8192, 4096, 16384, 16384)
+	// glyph 1 moves its points 1 and 2 and its advance by 200 units at the maximum weight
+	gvar := u16s(1, 0, 1, 0, 0, 20, 2, 0, 0, 26, 0, 0, 13)
+	gvar = append(gvar, u16s(1, 10, 16, 0xA000, 16384)...)
+	gvar = append(gvar, 4, 3, 0, 1, 1, 3, 0x43)
+	gvar = append(gvar, u16s(0, 200, 200, 200)...)
+	gvar = append(gvar, 0x83, 0)
+
+	stash := New(256, 256)
+	font := stash.fonts[stash.AddFontFromMemory("variable", buildTestFont([]rune("a"), 1000, map[string][]byte{"fvar": fvar, "avar": avar, "gvar": gvar}), 0)]
+	if axes := font.font.GetAxes(); len(axes) != 1 || axes[0] != (truetype.Axis{Tag: "wght", Min: 100, Default: 400, Max: 900}) {
+		t.Fatalf("unexpected axes %+v", axes)
+	}
+	regular := stash.getGlyph(font, 'a', 200, 0)
+	for _, test := range []struct {
+		weight  float32
+		x1, adv int
+	}{{400, 600, 1000}, {650, 650, 1050}, {900, 800, 1200}, {1000, 800, 1200}} {
+		stash.SetVariations([]Variation{{"wght", test.weight}})
+		instance := stash.varied(font)
+		_, _, _, x1, _ := instance.font.GetGlyphBox(1)
+		advance, _ := instance.font.GetGlyphHMetrics(1)
+		if x1 != test.x1 || advance != test.adv {
+			t.Errorf("glyph at weight %f should be %d wide with advance %d, but %d %d", test.weight, test.x1, test.adv, x1, advance)
+		}
+		if instance != stash.varied(font) {
+			t.Error("instances should be reused")
+		}
+		glyph := stash.getGlyph(instance, 'a', 200, 0)
+		if (glyph == regular) != (test.weight == 400) {
+			t.Errorf("glyphs at weight %f should be cached separately", test.weight)
+		}
+	}
+}
+
+func TestSubpixelGlyphs(t *testing.T) {
+	stash := New(256, 256)
+	stash.SetFont(stash.AddFontFromMemory("subpixel", buildTestFont([]rune("a"), 1000, nil), 0))
+	stash.SetSize(10)
+	stash.SetSpacing(0.25)
+	stash.SetRenderMode(RENDER_SUBPIXEL)
+
+	iter := stash.TextIterForRunes(0, 0, []rune("aaaaa"))
+	var quads []Quad
+	for quad, ok := iter.Next(); ok; quad, ok = iter.Next() {
+		quads = append(quads, quad)
+	}
+	// the glyphs are shifted in their bitmaps, their quads stay on pixels
+	for i, pen := range []float32{0, 10.25, 20.5, 30.75, 41} {
+		if d := quads[i].X0 - quads[0].X0 - pen; d < -1 || d > 1 || quads[i].X0 != float32(int(quads[i].X0)) {
+			t.Errorf("glyph %d should be near %f, but %f", i, quads[0].X0+pen, quads[i].X0)
+		}
+	}
+	if iter.NextX != 51 {
+		t.Errorf("pen shouldn't be rounded, but %f", iter.NextX)
+	}
+	if stats := stash.AtlasStats(); stats.Glyphs != 4 {
+		t.Errorf("glyphs should be cached for 4 phases, but %d", stats.Glyphs)
+	}
+
+	stash.SetRenderMode(RENDER_LCD)
+	stash.SetSpacing(0)
+	iter = stash.TextIterForRunes(0, 0, []rune("a"))
+	quad, _ := iter.Next()
+	glyph := iter.PrevGlyph
+	width := int(glyph.x1 - glyph.x0)
+	if width%3 != 0 || quad.X1-quad.X0 != float32(width/3-2) || (quad.S1-quad.S0)*256 != float32(width-6) {
+		t.Fatalf("LCD glyph should be three texels for every pixel, but %+v %+v", glyph, quad)
+	}
+	// the square covers every subpixel in its middle
+	middle := int(quad.S0*256) + 3*int(quad.X1-quad.X0)/2 + int(quad.T0*256+3)*256
+	if texels := stash.textureData[middle : middle+3]; !bytes.Equal(texels, []byte{255, 255, 255}) {
+		t.Errorf("unexpected subpixel coverage %v", texels)
+	}
+}
+
+func TestTabStops(t *testing.T) {
+	stash := New(256, 256)
+	stash.SetFont(stash.AddFontFromMemory("tabs", buildTestFont([]rune("a "), 500, nil), 0))
+	stash.SetSize(10)
+	for _, c := range []struct {
+		stops []float32
+		text  string
+		want  float32
+	}{
+		{nil, "a\ta", 45},
+		{[]float32{12}, "a\ta", 17},
+		{[]float32{12}, "aaa\t", 24},
+		{[]float32{12, 30}, "\t\t\t\t", 66},
+	} {
+		stash.SetTabStops(c.stops)
+		advance, _ := stash.TextBounds(100, 0, c.text)
+		iter := stash.TextIter(100, 0, c.text)
+		for _, ok := iter.Next(); ok; _, ok = iter.Next() {
+		}
+		if advance != c.want || iter.NextX != 100+c.want {
+			t.Errorf("%q with tab stops %v should advance %f, but %f and %f", c.text, c.stops, c.want, advance, iter.NextX-100)
+		}
+	}
+
+	// tabs of right to left text are drawn as spaces too
+	stash = New(256, 256)
+	stash.SetFont(stash.AddFontFromMemory("tabs", buildTestFont([]rune(" \u05d0"), 500, nil), 0))
+	stash.SetSize(10)
+	stash.SetDirection(DIRECTION_RTL)
+	iter := stash.TextIter(100, 0, "\u05d0\t\u05d0")
+	for _, ok := iter.Next(); ok; _, ok = iter.Next() {
+		if iter.CodePoint == '\t' && iter.PrevGlyph.Index != 1 {
+			t.Errorf("tab in right to left text should use the space glyph, but %d", iter.PrevGlyph.Index)
+		}
+	}
+}
+
+func TestVerticalText(t *testing.T) {
+	runes := []rune("a\u4e00")
+	vhea := make([]byte, 36)
+	binary.BigEndian.PutUint16(vhea[34:], uint16(len(runes)+1))
+	vmtx := u16s(1200, 50, 1200, 50, 1200, 50)
+	stash := New(256, 256)
+	vertical := stash.AddFontFromMemory("vertical", buildTestFont(runes, 500, map[string][]byte{"vhea": vhea, "vmtx": vmtx}), 0)
+	plain := stash.AddFontFromMemory("plain", buildTestFont(runes, 500, nil), 0)
+	stash.SetSize(10)
+
+	stash.SetFont(vertical)
+	iter := stash.TextIter(100, 0, "a")
+	horizontal, _ := iter.Next()
+	stash.SetWritingMode(WRITING_VERTICAL)
+	for _, c := range []struct {
+		font int
+		text string
+		want float32
+	}{
+		{vertical, "\u4e00\u4e00", 24},
+		{vertical, "aa", 10},
+		{vertical, "\u4e00a", 17},
+		{plain, "\u4e00\u4e00", 20},
+	} {
+		stash.SetFont(c.font)
+		if advance, _ := stash.TextBounds(100, 0, c.text); advance != c.want {
+			t.Errorf("%q should be %f high, not %f", c.text, c.want, advance)
+		}
+	}
+
+	// ideographs stay upright, letters are rotated clockwise
+	stash.SetFont(vertical)
+	stash.SetAlign(ALIGN_CENTER | ALIGN_BOTTOM)
+	iter = stash.TextIter(100, 0, "\u4e00a")
+	upright, _ := iter.Next()
+	if upright.Rotated || iter.Y != -17 || iter.NextY != -5 {
+		t.Errorf("an upright ideograph should start the column at -17 and advance 12, but %v from %f to %f", upright, iter.Y, iter.NextY)
+	}
+	rotated, _ := iter.Next()
+	if !rotated.Rotated || rotated.X1-rotated.X0 != horizontal.Y1-horizontal.Y0 || rotated.Y1-rotated.Y0 != horizontal.X1-horizontal.X0 {
+		t.Errorf("a letter should be rotated, but %v for %v", rotated, horizontal)
+	}
+	if iter.NextX != 100 || iter.NextY != 0 {
+		t.Errorf("the column should end at 100, 0, not %f, %f", iter.NextX, iter.NextY)
+	}
+}
+
+func TestHinting(t *testing.T) {
+	stash := New(256, 256)
+	stash.SetFont(stash.AddFontFromMemory("hinting", buildTestFont([]rune("H"), 1000, nil), 0))
+	// the square is 7.7 pixels high
+	stash.SetSize(11)
+	partialRows := func() int {
+		iter := stash.TextIterForRunes(0, 0, []rune("H"))
+		iter.Next()
+		glyph := iter.PrevGlyph
+		x := int(glyph.x0+glyph.x1) / 2
+		rows := 0
+		for y := int(glyph.y0); y < int(glyph.y1); y++ {
+			if c := stash.textureData[x+y*256]; c > 4 && c < 251 {
+				rows++
+			}
+		}
+		return rows
+	}
+	if rows := partialRows(); rows != 1 {
+		t.Errorf("the top of the square should cover a row partially, but %d rows", rows)
+	}
+	stash.SetHinting(true)
+	if rows := partialRows(); rows != 0 {
+		t.Errorf("the edges of the hinted square should be on pixels, but %d partial rows", rows)
+	}
+	if stats := stash.AtlasStats(); stats.Glyphs != 2 {
+		t.Errorf("hinted glyphs should be cached separately, but %d glyphs", stats.Glyphs)
+	}
+	stash.SetSize(FONS_HINT_MAX_SIZE + 1.1)
+	if rows := partialRows(); rows != 1 {
+		t.Errorf("large glyphs shouldn't be hinted, but %d partial rows", rows)
+	}
+}
+
+func TestColorGlyphs(t *testing.T) {
+	// glyph 1 is red under half transparent blue, both layers are the square of glyph 2
+	colr := u16s(0, 1, 0, 14, 0, 20, 2, 1, 0, 2, 2, 0, 2, 1)
+	cpal := append(u16s(0, 2, 1, 2, 0, 14, 0), 0, 0, 255, 255, 255, 0, 0, 128)
+
+	// glyph 1 is a green 4x4 PNG of a strike of 20 pixels per em
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{0, 255, 0, 255}), image.Point{}, draw.Src)
+	var encoded bytes.Buffer
+	png.Encode(&encoded, img)
+	cblc := append(u16s(3, 0, 0, 1, 0, 56, 0, 24, 0, 1), make([]byte, 28)...)
+	cblc = append(cblc, u16s(1, 1)...)
+	cblc = append(cblc, 20, 20, 32, 1)
+	cblc = append(cblc, u16s(1, 1, 0, 8, 1, 17, 0, 4, 0, 0, 0, 9+encoded.Len())...)
+	cbdt := append(u16s(3, 0), 4, 4, 2, 4, 5)
+	cbdt = append(cbdt, u16s(0, encoded.Len())...)
+	cbdt = append(cbdt, encoded.Bytes()...)
+
+	stash := New(64, 64)
+	layered := stash.fonts[stash.AddFontFromMemory("layered", buildTestFont([]rune("ab"), 1000, map[string][]byte{"COLR": colr, "CPAL": cpal}), 0)]
+	bitmap := stash.fonts[stash.AddFontFromMemory("bitmap", buildTestFont([]rune("😀"), 1000, map[string][]byte{"glyf": nil, "loca": nil, "CBLC": cblc, "CBDT": cbdt}), 0)]
+	if layered == nil || bitmap == nil {
+		t.Fatal("can't load color fonts")
+	}
+	pixel := func(glyph *Glyph, x, y int) []byte {
+		data, width, _ := stash.GetColorTextureData()
+		offset := (int(glyph.x0) + 2 + x + (int(glyph.y0)+2+y)*width) * 4
+		return data[offset : offset+4]
+	}
+
+	glyph := stash.getGlyph(layered, 'a', 200, 0)
+	if !glyph.Color || glyph.xOff != 1-2 || glyph.yOff != -14-2 {
+		t.Fatalf("unexpected layered glyph %+v", glyph)
+	}
+	if p := pixel(glyph, 5, 7); !bytes.Equal(p, []byte{127, 0, 128, 255}) {
+		t.Errorf("layers should be blended, but %v", p)
+	}
+	if glyph := stash.getGlyph(layered, 'b', 200, 0); glyph.Color {
+		t.Error("glyph without layers should be in the alpha atlas")
+	}
+
+	for _, size := range []int{200, 100} {
+		glyph = stash.getGlyph(bitmap, '😀', size, 0)
+		if !glyph.Color || int(glyph.x1-glyph.x0) != 4*size/200+4 {
+			t.Fatalf("unexpected bitmap glyph at %d %+v", size, glyph)
+		}
+		if p := pixel(glyph, 0, 0); !bytes.Equal(p, []byte{0, 255, 0, 255}) {
+			t.Errorf("bitmap should be scaled to %d, but %v", size, p)
+		}
+	}
+	if stats := stash.AtlasStats(); stats.Glyphs != 1 || stash.ValidateColorTexture() == nil {
+		t.Errorf("color glyphs should be in the color atlas, but %+v", stats)
+	}
+
+	stash.ResetColorAtlas()
+	if len(layered.colorGlyphs) != 0 || stash.ColorAtlasFull() {
+		t.Error("color glyphs should be removed")
+	}
+
+	// the second glyph doesn't fit next to the first one
+	layeredA := &shapedGlyph{font: layered, index: 1}
+	if glyph, _, _, _ := stash.glyphQuad(nil, layeredA, 0, 0, 6000, 0, RENDER_BITMAP, 0, 0); glyph == nil || !glyph.Color {
+		t.Fatal("large color glyph should fit in the color atlas")
+	}
+	if glyph, _, _, _ := stash.glyphQuad(nil, layeredA, 0, 0, 5000, 0, RENDER_BITMAP, 0, 0); glyph != nil || !stash.ColorAtlasFull() {
+		t.Error("color atlas should be full")
+	}
+	// a glyph larger than the color atlas takes the outline, which doesn't fit in the main atlas
+	if glyph, _, _, _ := stash.glyphQuad(nil, layeredA, 0, 0, 20000, 0, RENDER_BITMAP, 0, 0); glyph != nil || stash.ColorAtlasFull() {
+		t.Error("only the main atlas should be full")
+	}
+}
+
+func equalMetrics(a, b FontMetrics) bool {
+	av := []float32{a.Ascender, a.Descender, a.LineHeight, a.XHeight, a.CapHeight, a.UnderlinePosition, a.UnderlineThickness, a.StrikeoutPosition, a.StrikeoutThickness}
+	bv := []float32{b.Ascender, b.Descender, b.LineHeight, b.XHeight, b.CapHeight, b.UnderlinePosition, b.UnderlineThickness, b.StrikeoutPosition, b.StrikeoutThickness}
+	for i := range av {
+		if d := av[i] - bv[i]; d < -0.001 || d > 0.001 {
+			return false
+		}
+	}
+	return a.UnitsPerEm == b.UnitsPerEm
+}
+
+// u16s encodes the values as big-endian 16-bit integers.
+func u16s(values ...int) []byte {
+	out := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(out[2*i:], uint16(v))
+	}
+	return out
+}
+
+// buildTestLayout creates a GPOS or GSUB table with one feature of one lookup.
+func buildTestLayout(feature string, lookupType int, subtables ...[]byte) []byte {
+	out := u16s(1, 0, 10, 12, 26, 0, 1)
+	out = append(out, feature...)
+	out = append(out, u16s(8, 0, 1, 0, 1, 4, lookupType, 0, len(subtables))...)
+	offset := 6 + 2*len(subtables)
+	for _, subtable := range subtables {
+		out = append(out, u16s(offset)...)
+		offset += len(subtable)
+	}
+	for _, subtable := range subtables {
+		out = append(out, subtable...)
+	}
+	return out
+}
+
+func TestFontFeatures(t *testing.T) {
+	// glyphs: A=1, V=2, f=3, i=4, fi ligature=5
+	gpos := buildTestLayout("kern", 2,
+		// format 1: A V -100
+		append(u16s(1, 18, 4, 0, 1, 12), u16s(1, 2, -100, 1, 1, 1)...),
+		// format 2: class 1 (f) followed by class 1 (A) -50
+		append(u16s(2, 24, 4, 0, 30, 38, 2, 2, 0, 0, 0, -50), u16s(1, 1, 3, 1, 3, 1, 1, 2, 1, 1, 1, 1)...))
+	gsub := buildTestLayout("liga", 4, u16s(1, 18, 1, 8, 1, 4, 5, 2, 4, 1, 1, 3))
+	data := buildTestFont([]rune("AVfi\ue001"), 500, map[string][]byte{"GPOS": gpos, "GSUB": gsub})
+
+	stash := New(512, 512)
+	font := stash.AddFontFromMemory("features", data, 0)
+	if font == INVALID {
+		t.Fatal("can't load test font")
+	}
+	stash.SetFont(font)
+	stash.SetSize(100)
+
+	for _, pair := range []string{"AV", "fA"} {
+		stash.SetFeatures(0)
+		unkerned, _ := stash.TextBounds(0, 0, pair)
+		stash.SetFeatures(FEATURE_KERNING)
+		kerned, _ := stash.TextBounds(0, 0, pair)
+		if unkerned != 100 || kerned >= unkerned {
+			t.Errorf("%s should be kerned, but %f (unkerned %f)", pair, kerned, unkerned)
+		}
+	}
+
+	stash.SetFeatures(FEATURE_LIGATURES)
+	iter := stash.TextIter(0, 0, "fif")
+	iter.Next()
+	if iter.PrevGlyph.Index != 5 || iter.CurrentIndex != 0 || iter.NextIndex != 2 {
+		t.Errorf("fi should be a ligature, but glyph %d covers %d-%d", iter.PrevGlyph.Index, iter.CurrentIndex, iter.NextIndex)
+	}
+	iter.Next()
+	if iter.PrevGlyph.Index != 3 || iter.CurrentIndex != 2 || iter.NextIndex != 3 {
+		t.Errorf("last f should not be a ligature, but glyph %d", iter.PrevGlyph.Index)
+	}
+	if width, _ := stash.TextBounds(0, 0, "fif"); width != 100 {
+		t.Errorf("fif should have two glyphs, but width %f", width)
+	}
+	stash.SetFeatures(0)
+	if width, _ := stash.TextBounds(0, 0, "fif"); width != 150 {
+		t.Errorf("fif should have three glyphs without ligatures, but width %f", width)
+	}
+}
+
+func TestArabicShaping(t *testing.T) {
+	// glyphs: beh=1, fatha=2, initial beh=3
+	gsub := buildTestLayout("init", 1, u16s(2, 8, 1, 3, 1, 1, 1))
+	// beh has an anchor at (200, 800) for fatha, whose anchor is at the origin
+	gpos := buildTestLayout("mark", 4, u16s(1, 12, 18, 1, 24, 36, 1, 1, 2, 1, 1, 1, 1, 0, 6, 1, 0, 0, 1, 4, 1, 200, 800))
+	gdef := u16s(1, 0, 12, 0, 0, 0, 1, 1, 2, 1, 3)
+	data := buildTestFont([]rune("\u0628\u064e\ue001"), 500, map[string][]byte{"GSUB": gsub, "GPOS": gpos, "GDEF": gdef})
+
+	stash := New(512, 512)
+	font := stash.AddFontFromMemory("arabic", data, 0)
+	if font == INVALID {
+		t.Fatal("can't load test font")
+	}
+	stash.SetFont(font)
+	stash.SetSize(100)
+
+	var glyphs []int
+	for _, shaped := range stash.shape(stash.fonts[font], []rune("\u0628\u0628\u0628 \u0628\u064e\u0628"), FEATURE_DEFAULT, DIRECTION_AUTO, false, false) {
+		glyphs = append(glyphs, shaped.index)
+	}
+	if want := []int{3, 1, 1, 0, 3, 2, 1}; !equalInts(glyphs, want) {
+		t.Errorf("only letters joined to the following one should take the initial form: %v, want %v", glyphs, want)
+	}
+
+	// glyphs of right to left text come in visual order
+	iter := stash.TextIter(0, 0, "\u0628\u064e")
+	mark, _ := iter.Next()
+	base, _ := iter.Next()
+	if !iter.RTL {
+		t.Error("arabic text should be right to left")
+	}
+	if iter.CurrentIndex != 0 || iter.NextIndex != 2 {
+		t.Errorf("fatha should belong to the cluster of beh, but %d-%d", iter.CurrentIndex, iter.NextIndex)
+	}
+	if dx, dy := mark.X0-base.X0, mark.Y0-base.Y0; dx < 19 || dx > 21 || dy < -81 || dy > -79 {
+		t.Errorf("fatha should be attached at (20, -80) from beh, but (%f, %f)", dx, dy)
+	}
+	if width, _ := stash.TextBounds(0, 0, "\u0628\u064e"); width != 50 {
+		t.Errorf("fatha should have no advance, but width %f", width)
+	}
+}
+
+func TestThaiShaping(t *testing.T) {
+	// glyphs: KO KAI=1, PO PLA=2, SARA AA=3, SARA AM=4, MAI EK=5, NIKHAHIT=6, low left MAI EK=7, low MAI EK=8
+	data := buildTestFont([]rune("\u0e01\u0e1b\u0e32\u0e33\u0e48\u0e4d\uf705\uf70a"), 500, nil)
+	stash := New(512, 512)
+	font := stash.AddFontFromMemory("thai", data, 0)
+	if font == INVALID {
+		t.Fatal("can't load test font")
+	}
+	for _, test := range []struct {
+		text     string
+		glyphs   []int
+		clusters []int
+	}{
+		// SARA AM is decomposed, and NIKHAHIT goes before the tone mark
+		{"\u0e01\u0e48\u0e33", []int{1, 6, 5, 3}, []int{0, 0, 0, 0}},
+		{"\u0e01\u0e33", []int{1, 6, 3}, []int{0, 1, 1}},
+		// without an above vowel the tone mark is lowered, and moved left over an ascender
+		{"\u0e01\u0e48", []int{1, 8}, []int{0, 0}},
+		{"\u0e1b\u0e48", []int{2, 7}, []int{0, 0}},
+	} {
+		var glyphs, clusters []int
+		for _, shaped := range stash.shape(stash.fonts[font], []rune(test.text), FEATURE_DEFAULT, DIRECTION_AUTO, false, false) {
+			glyphs = append(glyphs, shaped.index)
+			clusters = append(clusters, shaped.cluster)
+		}
+		if !equalInts(glyphs, test.glyphs) || !equalInts(clusters, test.clusters) {
+			t.Errorf("%q: glyphs %v clusters %v, want %v %v", test.text, glyphs, clusters, test.glyphs, test.clusters)
+		}
+	}
+}
+
+func TestDevanagariShaping(t *testing.T) {
+	// glyphs: ANUSVARA=1, KA=2, RA=3, VOWEL SIGN I=4, VIRAMA=5, reph=6
+	// rphf forms the reph of RA and VIRAMA
+	gsub := buildTestLayout("rphf", 4, u16s(1, 18, 1, 8, 1, 4, 6, 2, 5, 1, 1, 3))
+	data := buildTestFont([]rune("\u0902\u0915\u0930\u093f\u094d\ue000"), 500, map[string][]byte{"GSUB": gsub})
+	stash := New(512, 512)
+	font := stash.AddFontFromMemory("devanagari", data, 0)
+	if font == INVALID {
+		t.Fatal("can't load test font")
+	}
+
+	// RA and VIRAMA before a consonant take the reph form, the consonant is the base
+	runes := []rune("\u0930\u094d\u0915\u0902")
+	buffer := make([]truetype.LayoutGlyph, len(runes))
+	for i := range buffer {
+		buffer[i] = truetype.LayoutGlyph{Index: i + 1, Cluster: i, Mask: maskGlobal}
+	}
+	buffer = reorderDevanagari(runes, buffer)
+	for i, g := range buffer {
+		if reph := g.Mask&maskReph != 0; reph != (i < 2) {
+			t.Errorf("glyph %d should have the reph mask %v, but mask %b", i, i < 2, g.Mask)
+		}
+	}
+	if buffer[3].Mask&maskPostBase == 0 {
+		t.Errorf("the modifier after the base should have the post-base mask, but %b", buffer[3].Mask)
+	}
+
+	for _, test := range []struct {
+		text     string
+		glyphs   []int
+		clusters []int
+	}{
+		// the pre-base matra moves before the consonant
+		{"\u0915\u093f", []int{4, 2}, []int{0, 0}},
+		// the reph moves to the end of the syllable, before the modifier
+		{"\u0930\u094d\u0915\u0902", []int{2, 6, 1}, []int{0, 0, 0}},
+		// both in one syllable, and the next syllable is a cluster of its own
+		{"\u0930\u094d\u0915\u093f\u0915", []int{4, 2, 6, 2}, []int{0, 0, 0, 4}},
+	} {
+		var glyphs, clusters []int
+		for _, shaped := range stash.shape(stash.fonts[font], []rune(test.text), FEATURE_DEFAULT, DIRECTION_AUTO, false, false) {
+			glyphs = append(glyphs, shaped.index)
+			clusters = append(clusters, shaped.cluster)
+		}
+		if !equalInts(glyphs, test.glyphs) || !equalInts(clusters, test.clusters) {
+			t.Errorf("%q: glyphs %v clusters %v, want %v %v", test.text, glyphs, clusters, test.glyphs, test.clusters)
+		}
+	}
+}
+
+func TestBidi(t *testing.T) {
+	text := []rune("car \u05d0\u05d1\u05d2 123 is")
+	b := NewBidi(text, DIRECTION_AUTO)
+	levels := make([]int, len(text))
+	for i, level := range b.LineLevels(0, len(text)) {
+		levels[i] = int(level)
+	}
+	if want := []int{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 0, 0, 0}; !equalInts(levels, want) {
+		t.Errorf("levels %v, want %v", levels, want)
+	}
+	if order, want := b.VisualOrder(0, len(text)), []int{0, 1, 2, 3, 8, 9, 10, 7, 6, 5, 4, 11, 12, 13}; !equalInts(order, want) {
+		t.Errorf("visual order %v, want %v", order, want)
+	}
+
+	// brackets around left to right text take the paragraph direction
+	text = []rune("\u05d0\u05d1(c)")
+	b = NewBidi(text, DIRECTION_AUTO)
+	if b.ParagraphLevel(0) != 1 {
+		t.Error("paragraph should be right to left")
+	}
+	levels = levels[:0]
+	for _, level := range b.Levels() {
+		levels = append(levels, int(level))
+	}
+	if want := []int{1, 1, 1, 2, 1}; !equalInts(levels, want) {
+		t.Errorf("levels %v, want %v", levels, want)
+	}
+}
+
+func TestLineBreaks(t *testing.T) {
+	// | marks an allowed break, ^ a mandatory break
+	for _, want := range []string{
+		"Hello, |world! |(test) |well-|known",
+		"3.14% |$(12) |x\u00a0y |a/|b",
+		"\u65e5|\u672c|\u306e|\u6587\u3063|\u3067|\u3059\u3002|\u300c\u306f\u300d",
+		"a\n^b\r\n^\n^c",
+		"\U0001F44D\U0001F3FB |ok |\u05d0-\u05d1",
+	} {
+		var text []rune
+		for _, r := range want {
+			if r != '|' && r != '^' {
+				text = append(text, r)
+			}
+		}
+		got := ""
+		for i, b := range LineBreaks(text) {
+			switch b {
+			case BREAK_ALLOWED:
+				got += "|"
+			case BREAK_MANDATORY:
+				got += "^"
+			}
+			got += string(text[i])
+		}
+		if got != want {
+			t.Errorf("breaks %q, want %q", got, want)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// buildTestName creates a name table with Windows Unicode family and style names.
+func buildTestName(family, style string) []byte {
+	be := binary.BigEndian
+	var strs bytes.Buffer
+	var records bytes.Buffer
+	for i, name := range []string{family, style} {
+		offset := strs.Len()
+		for _, r := range name {
+			binary.Write(&strs, be, uint16(r))
+		}
+		binary.Write(&records, be, []uint16{3, 1, 0x409, uint16(i + 1), uint16(strs.Len() - offset), uint16(offset)})
+	}
+	var out bytes.Buffer
+	binary.Write(&out, be, []uint16{0, 2, uint16(6 + records.Len())})
+	out.Write(records.Bytes())
+	out.Write(strs.Bytes())
+	return out.Bytes()
+}
+
+// buildTestCollection packs fonts into a TrueType collection.
+func buildTestCollection(fonts ...[]byte) []byte {
+	be := binary.BigEndian
+	header := 12 + 4*len(fonts)
+	var out bytes.Buffer
+	out.WriteString("ttcf")
+	binary.Write(&out, be, []uint32{0x00010000, uint32(len(fonts))})
+	offset := header
+	for _, f := range fonts {
+		binary.Write(&out, be, uint32(offset))
+		offset += len(f)
+	}
+	offset = header
+	for _, f := range fonts {
+		f = append([]byte(nil), f...)
+		// Table offsets are relative to the beginning of the collection.
+		for i := 0; i < int(be.Uint16(f[4:])); i++ {
+			record := 12 + 16*i + 8
+			be.PutUint32(f[record:], be.Uint32(f[record:])+uint32(offset))
+		}
+		out.Write(f)
+		offset += len(f)
+	}
+	return out.Bytes()
+}
+
+func TestFontCollection(t *testing.T) {
+	regular := buildTestFont([]rune("a"), 500, map[string][]byte{"name": buildTestName("Test Sans", "Regular")})
+	wide := buildTestFont([]rune("a"), 1000, map[string][]byte{"name": buildTestName("Test Sans", "Wide")})
+	collection := buildTestCollection(regular, wide)
+
+	faces, err := ListFaces(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 2 || faces[1].Family != "Test Sans" || faces[1].Style != "Wide" {
+		t.Fatalf("unexpected faces: %v", faces)
+	}
+
+	stash := New(512, 512)
+	if stash.AddFontFromCollection("missing", collection, 2) != INVALID {
+		t.Error("face index out of range should fail")
+	}
+	font := stash.AddFontFromCollection("wide", collection, 1)
+	if font == INVALID {
+		t.Fatal("can't load the second face")
+	}
+	stash.SetFont(font)
+	stash.SetSize(10)
+	if width, _ := stash.TextBounds(0, 0, "a"); width != 10 {
+		t.Errorf("advance of the second face should be 10, but %f", width)
+	}
+}
+
+func TestSubsetKernTable(t *testing.T) {
+	// the pairs ab, ba and ac of a kern table, c is dropped
+	pairs := [][3]int{{1, 2, -50}, {1, 3, -70}, {2, 1, 30}}
+	kern := u16s(0, 1, 0, 14+6*len(pairs), 1, len(pairs), 12, 1, 6)
+	for _, pair := range pairs {
+		kern = append(kern, u16s(pair[0], pair[1], pair[2])...)
+	}
+	info, err := truetype.InitFont(buildTestFont([]rune("abc"), 500, map[string][]byte{"kern": kern}), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsetData, err := info.Subset([]rune("ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subset, err := truetype.InitFont(subsetData, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range []string{"ab", "ba", "aa", "bb"} {
+		r1, r2 := int(pair[0]), int(pair[1])
+		if kern, subsetKern := info.GetCodepointKernAdvance(r1, r2), subset.GetCodepointKernAdvance(r1, r2); kern != subsetKern {
+			t.Errorf("%s should be kerned by %d, but %d", pair, kern, subsetKern)
+		}
+	}
+	if subset.FindGlyphIndex('c') != 0 {
+		t.Error("dropped c should map to glyph 0")
+	}
+}
+
+func TestSubsetFont(t *testing.T) {
+	for _, c := range []struct {
+		file string
+		keep []rune
+		drop []rune
+	}{
+		// é is a composite of e and the acute accent, AV, To and Ta are kerned
+		{"Roboto-Regular.ttf", []rune("a\u00e9AVTo"), []rune("bcxyz\u00e8")},
+		// private use codepoints are far from their glyph indexes
+		{"entypo.ttf", []rune{0xe700, 0x1f680}, []rune{0xe704}},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "sample", c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := truetype.InitFont(data, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subsetData, err := info.Subset(c.keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subset, err := truetype.InitFont(subsetData, 0)
+		if err != nil {
+			t.Fatalf("%s: the subset doesn't load: %v", c.file, err)
+		}
+		if len(subsetData) >= len(data) {
+			t.Errorf("%s: the subset of %d bytes should be smaller than %d", c.file, len(subsetData), len(data))
+		}
+		for _, r := range c.drop {
+			if index := subset.FindGlyphIndex(int(r)); index != 0 {
+				t.Errorf("%s: dropped %q should map to glyph 0, but %d", c.file, r, index)
+			}
+		}
+		kerned := 0
+		for _, r1 := range c.keep {
+			for _, r2 := range c.keep {
+				kern := info.GetCodepointKernAdvance(int(r1), int(r2))
+				if subsetKern := subset.GetCodepointKernAdvance(int(r1), int(r2)); kern != subsetKern {
+					t.Errorf("%s: %q%q should be kerned by %d, but %d", c.file, r1, r2, kern, subsetKern)
+				}
+				if kern != 0 {
+					kerned++
+				}
+			}
+		}
+		if c.file == "Roboto-Regular.ttf" && (kerned == 0 || !subset.HasPositioning()) {
+			t.Errorf("%s: the subset should keep the GPOS kerning of %d pairs", c.file, kerned)
+		}
+		// shaped text applies the kerning of the subset too
+		stash := New(512, 512)
+		original := stash.AddFontFromMemory("original", data, 0)
+		subsetFont := stash.AddFontFromMemory("subset", subsetData, 0)
+		stash.SetSize(40)
+		stash.SetFont(original)
+		width, _ := stash.TextBounds(0, 0, string(c.keep))
+		stash.SetFont(subsetFont)
+		if subsetWidth, _ := stash.TextBounds(0, 0, string(c.keep)); subsetWidth != width {
+			t.Errorf("%s: %q should be %f wide with the subset, but %f", c.file, string(c.keep), width, subsetWidth)
+		}
+		for _, r := range c.keep {
+			index, subsetIndex := info.FindGlyphIndex(int(r)), subset.FindGlyphIndex(int(r))
+			advance, _ := info.GetGlyphHMetrics(index)
+			subsetAdvance, _ := subset.GetGlyphHMetrics(subsetIndex)
+			shape, subsetShape := info.GetGlyphShape(index), subset.GetGlyphShape(subsetIndex)
+			if subsetIndex == 0 || advance != subsetAdvance || len(shape) == 0 || len(shape) != len(subsetShape) {
+				t.Errorf("%s: %q should keep its advance %d and %d vertices, but glyph %d has %d and %d", c.file, r, advance, len(shape), subsetIndex, subsetAdvance, len(subsetShape))
+				continue
+			}
+			for i := range shape {
+				if shape[i] != subsetShape[i] {
+					t.Errorf("%s: vertex %d of %q should be %v, not %v", c.file, i, r, shape[i], subsetShape[i])
+					break
+				}
+			}
+		}
+	}
+}
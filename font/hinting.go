@@ -0,0 +1,22 @@
+package font
+
+// FONS_HINT_MAX_SIZE is the largest pixel size hinted glyphs are rasterized at,
+// larger glyphs look better with their original outlines.
+const FONS_HINT_MAX_SIZE = 32
+
+// SetHinting sets whether bitmap glyphs have their horizontal edges fitted to
+// the pixel grid, see truetype.HintGlyphShape. Hinting is off by default, it
+// helps text at low pixel densities and distorts scaled text.
+func (stash *FontStash) SetHinting(enabled bool) {
+	stash.hinting = enabled
+}
+
+// Hinting returns whether bitmap glyphs are hinted.
+func (stash *FontStash) Hinting() bool {
+	return stash.hinting
+}
+
+// hinted returns whether glyphs of size, in tenths of pixels, are hinted.
+func (stash *FontStash) hinted(size int) bool {
+	return stash.hinting && size <= FONS_HINT_MAX_SIZE*10
+}
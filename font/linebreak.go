@@ -0,0 +1,435 @@
+package font
+
+import (
+	"sort"
+	"unicode"
+)
+
+// FONSBreak is a line break opportunity before a rune.
+type FONSBreak int
+
+const (
+	BREAK_NONE      FONSBreak = iota // the line can't be broken
+	BREAK_ALLOWED                    // the line can be broken
+	BREAK_MANDATORY                  // the line must be broken
+)
+
+// lineClass is a line breaking class of UAX #14.
+type lineClass uint8
+
+const (
+	lbAL lineClass = iota
+	lbBK
+	lbCR
+	lbLF
+	lbNL
+	lbCM
+	lbZWJ
+	lbSG
+	lbWJ
+	lbZW
+	lbGL
+	lbSP
+	lbB2
+	lbBA
+	lbBB
+	lbHY
+	lbCB
+	lbCL
+	lbCP
+	lbEX
+	lbIN
+	lbNS
+	lbOP
+	lbQU
+	lbIS
+	lbNU
+	lbPO
+	lbPR
+	lbSY
+	lbAI
+	lbCJ
+	lbEB
+	lbEM
+	lbH2
+	lbH3
+	lbHL
+	lbID
+	lbJL
+	lbJV
+	lbJT
+	lbRI
+	lbSA
+	lbXX
+)
+
+// lineClasses are the ranges of runes which are not lbAL, combining marks and
+// decimal digits are found with the unicode package.
+var lineClasses = []struct {
+	first, last rune
+	class       lineClass
+}{
+	{0x0000, 0x0008, lbCM}, {0x0009, 0x0009, lbBA}, {0x000A, 0x000A, lbLF}, {0x000B, 0x000C, lbBK},
+	{0x000D, 0x000D, lbCR}, {0x000E, 0x001F, lbCM}, {0x0020, 0x0020, lbSP}, {0x0021, 0x0021, lbEX},
+	{0x0022, 0x0022, lbQU}, {0x0024, 0x0024, lbPR}, {0x0025, 0x0025, lbPO}, {0x0027, 0x0027, lbQU},
+	{0x0028, 0x0028, lbOP}, {0x0029, 0x0029, lbCP}, {0x002B, 0x002B, lbPR}, {0x002C, 0x002C, lbIS},
+	{0x002D, 0x002D, lbHY}, {0x002E, 0x002E, lbIS}, {0x002F, 0x002F, lbSY}, {0x0030, 0x0039, lbNU},
+	{0x003A, 0x003B, lbIS}, {0x003F, 0x003F, lbEX}, {0x005B, 0x005B, lbOP}, {0x005C, 0x005C, lbPR},
+	{0x005D, 0x005D, lbCP}, {0x007B, 0x007B, lbOP}, {0x007C, 0x007C, lbBA}, {0x007D, 0x007D, lbCL},
+	{0x007F, 0x0084, lbCM}, {0x0085, 0x0085, lbNL}, {0x0086, 0x009F, lbCM}, {0x00A0, 0x00A0, lbGL},
+	{0x00A1, 0x00A1, lbOP}, {0x00A2, 0x00A2, lbPO}, {0x00A3, 0x00A5, lbPR}, {0x00A7, 0x00A8, lbAI},
+	{0x00AA, 0x00AA, lbAI}, {0x00AB, 0x00AB, lbQU}, {0x00AD, 0x00AD, lbBA}, {0x00B0, 0x00B0, lbPO},
+	{0x00B1, 0x00B1, lbPR}, {0x00B2, 0x00B3, lbAI}, {0x00B4, 0x00B4, lbBB}, {0x00B6, 0x00BA, lbAI},
+	{0x00BB, 0x00BB, lbQU}, {0x00BC, 0x00BE, lbAI}, {0x00BF, 0x00BF, lbOP}, {0x00D7, 0x00D7, lbAI},
+	{0x00F7, 0x00F7, lbAI}, {0x02C8, 0x02C8, lbBB}, {0x02CC, 0x02CC, lbBB}, {0x02DF, 0x02DF, lbBB},
+	{0x034F, 0x034F, lbGL}, {0x035C, 0x0362, lbGL}, {0x037E, 0x037E, lbIS}, {0x0589, 0x0589, lbIS},
+	{0x058A, 0x058A, lbBA}, {0x05BE, 0x05BE, lbBA}, {0x05D0, 0x05EA, lbHL}, {0x05EF, 0x05F2, lbHL},
+	{0x0609, 0x060A, lbPO}, {0x060C, 0x060D, lbIS}, {0x061B, 0x061B, lbEX}, {0x061D, 0x061F, lbEX},
+	{0x066A, 0x066A, lbPO}, {0x066B, 0x066C, lbNU}, {0x06D4, 0x06D4, lbEX}, {0x07F8, 0x07F8, lbIS},
+	{0x07F9, 0x07F9, lbEX}, {0x0964, 0x0965, lbBA}, {0x09F2, 0x09F3, lbPO}, {0x09FB, 0x09FB, lbPR},
+	{0x0AF1, 0x0AF1, lbPR}, {0x0BF9, 0x0BF9, lbPR}, {0x0D79, 0x0D79, lbPO}, {0x0E01, 0x0E3A, lbSA},
+	{0x0E3F, 0x0E3F, lbPR}, {0x0E40, 0x0E4E, lbSA}, {0x0E4F, 0x0E4F, lbAL}, {0x0E5A, 0x0E5B, lbBA},
+	{0x0E81, 0x0EDF, lbSA}, {0x0F01, 0x0F04, lbBB}, {0x0F06, 0x0F06, lbBB}, {0x0F08, 0x0F08, lbGL},
+	{0x0F0B, 0x0F0B, lbBA}, {0x0F0C, 0x0F0C, lbGL}, {0x0F0D, 0x0F11, lbEX}, {0x0F12, 0x0F12, lbGL},
+	{0x0F14, 0x0F14, lbEX}, {0x0F34, 0x0F34, lbBA}, {0x0F3A, 0x0F3A, lbOP}, {0x0F3B, 0x0F3B, lbCL},
+	{0x0F3C, 0x0F3C, lbOP}, {0x0F3D, 0x0F3D, lbCL}, {0x0F7F, 0x0F7F, lbBA}, {0x0F85, 0x0F85, lbBA},
+	{0x0FBE, 0x0FBF, lbBA}, {0x0FD2, 0x0FD2, lbBA}, {0x1000, 0x109F, lbSA}, {0x10FB, 0x10FB, lbAL},
+	{0x1100, 0x115F, lbJL}, {0x1160, 0x11A7, lbJV}, {0x11A8, 0x11FF, lbJT}, {0x1361, 0x1361, lbBA},
+	{0x1400, 0x1400, lbBA}, {0x1680, 0x1680, lbBA}, {0x169B, 0x169B, lbOP}, {0x169C, 0x169C, lbCL},
+	{0x16EB, 0x16ED, lbBA}, {0x1735, 0x1736, lbBA}, {0x1780, 0x17D3, lbSA}, {0x17D4, 0x17D5, lbBA},
+	{0x17D6, 0x17D6, lbNS}, {0x17D7, 0x17D7, lbSA}, {0x17D8, 0x17D8, lbBA}, {0x17D9, 0x17D9, lbAL},
+	{0x17DA, 0x17DA, lbBA}, {0x17DB, 0x17DB, lbPR}, {0x17DC, 0x17DD, lbSA}, {0x1802, 0x1803, lbEX},
+	{0x1804, 0x1805, lbBA}, {0x1806, 0x1806, lbBB}, {0x1808, 0x1809, lbEX}, {0x180E, 0x180E, lbGL},
+	{0x1950, 0x19DF, lbSA}, {0x1A20, 0x1AAF, lbSA}, {0x1B5A, 0x1B5B, lbBA}, {0x1B5D, 0x1B60, lbBA},
+	{0x1C3B, 0x1C3F, lbBA}, {0x1C7E, 0x1C7F, lbBA}, {0x2000, 0x2006, lbBA}, {0x2007, 0x2007, lbGL},
+	{0x2008, 0x200A, lbBA}, {0x200B, 0x200B, lbZW}, {0x200C, 0x200C, lbCM}, {0x200D, 0x200D, lbZWJ},
+	{0x2010, 0x2010, lbBA}, {0x2011, 0x2011, lbGL}, {0x2012, 0x2013, lbBA}, {0x2014, 0x2014, lbB2},
+	{0x2015, 0x2016, lbAI}, {0x2018, 0x2019, lbQU}, {0x201A, 0x201A, lbOP}, {0x201B, 0x201D, lbQU},
+	{0x201E, 0x201E, lbOP}, {0x201F, 0x201F, lbQU}, {0x2020, 0x2021, lbAI}, {0x2024, 0x2026, lbIN},
+	{0x2027, 0x2027, lbBA}, {0x2028, 0x2029, lbBK}, {0x202A, 0x202E, lbCM}, {0x202F, 0x202F, lbGL},
+	{0x2030, 0x2037, lbPO}, {0x2039, 0x203A, lbQU}, {0x203B, 0x203B, lbAI}, {0x203C, 0x203D, lbNS},
+	{0x2044, 0x2044, lbIS}, {0x2045, 0x2045, lbOP}, {0x2046, 0x2046, lbCL}, {0x2047, 0x2049, lbNS},
+	{0x2056, 0x2056, lbBA}, {0x2058, 0x205B, lbBA}, {0x205D, 0x205F, lbBA}, {0x2060, 0x2060, lbWJ},
+	{0x2066, 0x206F, lbCM}, {0x2074, 0x2074, lbAI}, {0x207D, 0x207D, lbOP}, {0x207E, 0x207E, lbCL},
+	{0x207F, 0x207F, lbAI}, {0x2081, 0x2084, lbAI}, {0x208D, 0x208D, lbOP}, {0x208E, 0x208E, lbCL},
+	{0x20A0, 0x20A6, lbPR}, {0x20A7, 0x20A7, lbPO}, {0x20A8, 0x20B5, lbPR}, {0x20B6, 0x20B6, lbPO},
+	{0x20B7, 0x20BA, lbPR}, {0x20BB, 0x20BB, lbPO}, {0x20BC, 0x20BD, lbPR}, {0x20BE, 0x20BE, lbPO},
+	{0x20BF, 0x20CF, lbPR}, {0x2103, 0x2103, lbPO}, {0x2105, 0x2105, lbAI}, {0x2109, 0x2109, lbPO},
+	{0x2113, 0x2113, lbAI}, {0x2116, 0x2116, lbPR}, {0x2121, 0x2122, lbAI}, {0x212B, 0x212B, lbAI},
+	{0x2212, 0x2213, lbPR}, {0x2308, 0x2308, lbOP}, {0x2309, 0x2309, lbCL}, {0x230A, 0x230A, lbOP},
+	{0x230B, 0x230B, lbCL}, {0x231A, 0x231B, lbID}, {0x2329, 0x2329, lbOP}, {0x232A, 0x232A, lbCL},
+	{0x23F0, 0x23F3, lbID}, {0x2600, 0x2603, lbID}, {0x2614, 0x2615, lbID}, {0x2618, 0x2618, lbID},
+	{0x261A, 0x261C, lbID}, {0x261D, 0x261D, lbEB}, {0x261E, 0x261F, lbID}, {0x2639, 0x263B, lbID},
+	{0x2668, 0x2669, lbID}, {0x267F, 0x267F, lbID}, {0x26BD, 0x26C8, lbID}, {0x26CD, 0x26CD, lbID},
+	{0x26CF, 0x26D1, lbID}, {0x26D3, 0x26D4, lbID}, {0x26D8, 0x26D9, lbID}, {0x26DC, 0x26DC, lbID},
+	{0x26DF, 0x26E1, lbID}, {0x26EA, 0x26EA, lbID}, {0x26F1, 0x26F5, lbID}, {0x26F7, 0x26F8, lbID},
+	{0x26F9, 0x26F9, lbEB}, {0x26FA, 0x26FA, lbID}, {0x26FD, 0x2704, lbID}, {0x2708, 0x2709, lbID},
+	{0x270A, 0x270D, lbEB}, {0x275B, 0x2760, lbQU}, {0x2762, 0x2763, lbEX}, {0x2768, 0x2768, lbOP},
+	{0x2769, 0x2769, lbCL}, {0x276A, 0x276A, lbOP}, {0x276B, 0x276B, lbCL}, {0x276C, 0x276C, lbOP},
+	{0x276D, 0x276D, lbCL}, {0x276E, 0x276E, lbOP}, {0x276F, 0x276F, lbCL}, {0x2770, 0x2770, lbOP},
+	{0x2771, 0x2771, lbCL}, {0x2772, 0x2772, lbOP}, {0x2773, 0x2773, lbCL}, {0x2774, 0x2774, lbOP},
+	{0x2775, 0x2775, lbCL}, {0x27C5, 0x27C5, lbOP}, {0x27C6, 0x27C6, lbCL}, {0x27E6, 0x27E6, lbOP},
+	{0x27E7, 0x27E7, lbCL}, {0x27E8, 0x27E8, lbOP}, {0x27E9, 0x27E9, lbCL}, {0x27EA, 0x27EA, lbOP},
+	{0x27EB, 0x27EB, lbCL}, {0x27EC, 0x27EC, lbOP}, {0x27ED, 0x27ED, lbCL}, {0x27EE, 0x27EE, lbOP},
+	{0x27EF, 0x27EF, lbCL}, {0x2983, 0x2983, lbOP}, {0x2984, 0x2984, lbCL}, {0x2985, 0x2985, lbOP},
+	{0x2986, 0x2986, lbCL}, {0x2987, 0x2987, lbOP}, {0x2988, 0x2988, lbCL}, {0x2989, 0x2989, lbOP},
+	{0x298A, 0x298A, lbCL}, {0x298B, 0x298B, lbOP}, {0x298C, 0x298C, lbCL}, {0x298D, 0x298D, lbOP},
+	{0x298E, 0x298E, lbCL}, {0x298F, 0x298F, lbOP}, {0x2990, 0x2990, lbCL}, {0x2991, 0x2991, lbOP},
+	{0x2992, 0x2992, lbCL}, {0x2993, 0x2993, lbOP}, {0x2994, 0x2994, lbCL}, {0x2995, 0x2995, lbOP},
+	{0x2996, 0x2996, lbCL}, {0x2997, 0x2997, lbOP}, {0x2998, 0x2998, lbCL}, {0x29D8, 0x29D8, lbOP},
+	{0x29D9, 0x29D9, lbCL}, {0x29DA, 0x29DA, lbOP}, {0x29DB, 0x29DB, lbCL}, {0x29FC, 0x29FC, lbOP},
+	{0x29FD, 0x29FD, lbCL}, {0x2CF9, 0x2CF9, lbEX}, {0x2CFA, 0x2CFC, lbBA}, {0x2CFE, 0x2CFF, lbEX},
+	{0x2E0E, 0x2E15, lbBA}, {0x2E17, 0x2E17, lbBA}, {0x2E18, 0x2E18, lbOP}, {0x2E19, 0x2E19, lbBA},
+	{0x2E22, 0x2E22, lbOP}, {0x2E23, 0x2E23, lbCL}, {0x2E24, 0x2E24, lbOP}, {0x2E25, 0x2E25, lbCL},
+	{0x2E26, 0x2E26, lbOP}, {0x2E27, 0x2E27, lbCL}, {0x2E28, 0x2E28, lbOP}, {0x2E29, 0x2E29, lbCL},
+	{0x2E2A, 0x2E2D, lbBA}, {0x2E2E, 0x2E2E, lbEX}, {0x2E30, 0x2E31, lbBA}, {0x2E33, 0x2E34, lbBA},
+	{0x2E3A, 0x2E3B, lbB2}, {0x2E3C, 0x2E3E, lbBA}, {0x2E40, 0x2E41, lbBA}, {0x2E42, 0x2E42, lbOP},
+	{0x2E43, 0x2E4A, lbBA}, {0x2E4C, 0x2E4C, lbBA}, {0x2E4E, 0x2E4F, lbBA}, {0x2E55, 0x2E55, lbOP},
+	{0x2E56, 0x2E56, lbCL}, {0x2E57, 0x2E57, lbOP}, {0x2E58, 0x2E58, lbCL}, {0x2E59, 0x2E59, lbOP},
+	{0x2E5A, 0x2E5A, lbCL}, {0x2E5B, 0x2E5B, lbOP}, {0x2E5C, 0x2E5C, lbCL}, {0x2E5D, 0x2E5D, lbBA},
+	{0x2E80, 0x2FFF, lbID}, {0x3000, 0x3000, lbBA}, {0x3001, 0x3002, lbCL}, {0x3003, 0x3004, lbID},
+	{0x3005, 0x3005, lbNS}, {0x3006, 0x3007, lbID}, {0x3008, 0x3008, lbOP}, {0x3009, 0x3009, lbCL},
+	{0x300A, 0x300A, lbOP}, {0x300B, 0x300B, lbCL}, {0x300C, 0x300C, lbOP}, {0x300D, 0x300D, lbCL},
+	{0x300E, 0x300E, lbOP}, {0x300F, 0x300F, lbCL}, {0x3010, 0x3010, lbOP}, {0x3011, 0x3011, lbCL},
+	{0x3012, 0x3013, lbID}, {0x3014, 0x3014, lbOP}, {0x3015, 0x3015, lbCL}, {0x3016, 0x3016, lbOP},
+	{0x3017, 0x3017, lbCL}, {0x3018, 0x3018, lbOP}, {0x3019, 0x3019, lbCL}, {0x301A, 0x301A, lbOP},
+	{0x301B, 0x301B, lbCL}, {0x301C, 0x301C, lbNS}, {0x301D, 0x301D, lbOP}, {0x301E, 0x301F, lbCL},
+	{0x3020, 0x3029, lbID}, {0x302A, 0x302F, lbCM}, {0x3030, 0x303A, lbID}, {0x303B, 0x303C, lbNS},
+	{0x303D, 0x303F, lbID}, {0x3041, 0x3041, lbCJ}, {0x3042, 0x3042, lbID}, {0x3043, 0x3043, lbCJ},
+	{0x3044, 0x3044, lbID}, {0x3045, 0x3045, lbCJ}, {0x3046, 0x3046, lbID}, {0x3047, 0x3047, lbCJ},
+	{0x3048, 0x3048, lbID}, {0x3049, 0x3049, lbCJ}, {0x304A, 0x3062, lbID}, {0x3063, 0x3063, lbCJ},
+	{0x3064, 0x3082, lbID}, {0x3083, 0x3083, lbCJ}, {0x3084, 0x3084, lbID}, {0x3085, 0x3085, lbCJ},
+	{0x3086, 0x3086, lbID}, {0x3087, 0x3087, lbCJ}, {0x3088, 0x308D, lbID}, {0x308E, 0x308E, lbCJ},
+	{0x308F, 0x3094, lbID}, {0x3095, 0x3096, lbCJ}, {0x3099, 0x309A, lbCM}, {0x309B, 0x309E, lbNS},
+	{0x309F, 0x309F, lbID}, {0x30A0, 0x30A0, lbNS}, {0x30A1, 0x30A1, lbCJ}, {0x30A2, 0x30A2, lbID},
+	{0x30A3, 0x30A3, lbCJ}, {0x30A4, 0x30A4, lbID}, {0x30A5, 0x30A5, lbCJ}, {0x30A6, 0x30A6, lbID},
+	{0x30A7, 0x30A7, lbCJ}, {0x30A8, 0x30A8, lbID}, {0x30A9, 0x30A9, lbCJ}, {0x30AA, 0x30C2, lbID},
+	{0x30C3, 0x30C3, lbCJ}, {0x30C4, 0x30E2, lbID}, {0x30E3, 0x30E3, lbCJ}, {0x30E4, 0x30E4, lbID},
+	{0x30E5, 0x30E5, lbCJ}, {0x30E6, 0x30E6, lbID}, {0x30E7, 0x30E7, lbCJ}, {0x30E8, 0x30ED, lbID},
+	{0x30EE, 0x30EE, lbCJ}, {0x30EF, 0x30F4, lbID}, {0x30F5, 0x30F6, lbCJ}, {0x30F7, 0x30FA, lbID},
+	{0x30FB, 0x30FB, lbNS}, {0x30FC, 0x30FC, lbCJ}, {0x30FD, 0x30FE, lbNS}, {0x30FF, 0x31EF, lbID},
+	{0x31F0, 0x31FF, lbCJ}, {0x3200, 0x4DBF, lbID}, {0x4E00, 0xA014, lbID}, {0xA015, 0xA015, lbNS},
+	{0xA016, 0xA4CF, lbID}, {0xA4FE, 0xA4FF, lbBA}, {0xA60D, 0xA60D, lbBA}, {0xA60E, 0xA60E, lbEX},
+	{0xA60F, 0xA60F, lbBA}, {0xA6F3, 0xA6F7, lbBA}, {0xA874, 0xA875, lbBB}, {0xA876, 0xA877, lbEX},
+	{0xA8CE, 0xA8CF, lbBA}, {0xA92E, 0xA92F, lbBA}, {0xA960, 0xA97C, lbJL}, {0xA9C7, 0xA9C9, lbBA},
+	{0xA9E0, 0xA9FE, lbSA}, {0xAA00, 0xAADF, lbSA}, {0xAAF0, 0xAAF1, lbBA}, {0xD7B0, 0xD7C6, lbJV},
+	{0xD7CB, 0xD7FB, lbJT}, {0xD800, 0xDFFF, lbSG}, {0xE000, 0xF8FF, lbXX}, {0xF900, 0xFAFF, lbID},
+	{0xFB1D, 0xFB1D, lbHL}, {0xFB1F, 0xFB28, lbHL}, {0xFB2A, 0xFB4F, lbHL}, {0xFD3E, 0xFD3E, lbCL},
+	{0xFD3F, 0xFD3F, lbOP}, {0xFDFC, 0xFDFC, lbPO}, {0xFE00, 0xFE0F, lbCM}, {0xFE10, 0xFE10, lbIS},
+	{0xFE11, 0xFE12, lbCL}, {0xFE13, 0xFE14, lbIS}, {0xFE15, 0xFE16, lbEX}, {0xFE17, 0xFE17, lbOP},
+	{0xFE18, 0xFE18, lbCL}, {0xFE19, 0xFE19, lbIN}, {0xFE30, 0xFE34, lbID}, {0xFE35, 0xFE35, lbOP},
+	{0xFE36, 0xFE36, lbCL}, {0xFE37, 0xFE37, lbOP}, {0xFE38, 0xFE38, lbCL}, {0xFE39, 0xFE39, lbOP},
+	{0xFE3A, 0xFE3A, lbCL}, {0xFE3B, 0xFE3B, lbOP}, {0xFE3C, 0xFE3C, lbCL}, {0xFE3D, 0xFE3D, lbOP},
+	{0xFE3E, 0xFE3E, lbCL}, {0xFE3F, 0xFE3F, lbOP}, {0xFE40, 0xFE40, lbCL}, {0xFE41, 0xFE41, lbOP},
+	{0xFE42, 0xFE42, lbCL}, {0xFE43, 0xFE43, lbOP}, {0xFE44, 0xFE44, lbCL}, {0xFE45, 0xFE46, lbID},
+	{0xFE47, 0xFE47, lbOP}, {0xFE48, 0xFE48, lbCL}, {0xFE49, 0xFE4F, lbID}, {0xFE50, 0xFE50, lbCL},
+	{0xFE51, 0xFE51, lbID}, {0xFE52, 0xFE52, lbCL}, {0xFE54, 0xFE55, lbNS}, {0xFE56, 0xFE57, lbEX},
+	{0xFE58, 0xFE58, lbID}, {0xFE59, 0xFE59, lbOP}, {0xFE5A, 0xFE5A, lbCL}, {0xFE5B, 0xFE5B, lbOP},
+	{0xFE5C, 0xFE5C, lbCL}, {0xFE5D, 0xFE5D, lbOP}, {0xFE5E, 0xFE5E, lbCL}, {0xFE5F, 0xFE68, lbID},
+	{0xFE69, 0xFE69, lbPR}, {0xFE6A, 0xFE6A, lbPO}, {0xFE6B, 0xFE6B, lbID}, {0xFEFF, 0xFEFF, lbWJ},
+	{0xFF01, 0xFF01, lbEX}, {0xFF02, 0xFF03, lbID}, {0xFF04, 0xFF04, lbPR}, {0xFF05, 0xFF05, lbPO},
+	{0xFF06, 0xFF07, lbID}, {0xFF08, 0xFF08, lbOP}, {0xFF09, 0xFF09, lbCL}, {0xFF0A, 0xFF0B, lbID},
+	{0xFF0C, 0xFF0C, lbCL}, {0xFF0D, 0xFF0D, lbID}, {0xFF0E, 0xFF0E, lbCL}, {0xFF0F, 0xFF19, lbID},
+	{0xFF1A, 0xFF1B, lbNS}, {0xFF1C, 0xFF1E, lbID}, {0xFF1F, 0xFF1F, lbEX}, {0xFF20, 0xFF3A, lbID},
+	{0xFF3B, 0xFF3B, lbOP}, {0xFF3C, 0xFF3C, lbID}, {0xFF3D, 0xFF3D, lbCL}, {0xFF3E, 0xFF5A, lbID},
+	{0xFF5B, 0xFF5B, lbOP}, {0xFF5C, 0xFF5C, lbID}, {0xFF5D, 0xFF5D, lbCL}, {0xFF5E, 0xFF5E, lbID},
+	{0xFF5F, 0xFF5F, lbOP}, {0xFF60, 0xFF61, lbCL}, {0xFF62, 0xFF62, lbOP}, {0xFF63, 0xFF64, lbCL},
+	{0xFF65, 0xFF65, lbNS}, {0xFF66, 0xFF66, lbID}, {0xFF67, 0xFF70, lbCJ}, {0xFF71, 0xFF9D, lbID},
+	{0xFF9E, 0xFF9F, lbNS}, {0xFFA0, 0xFFDC, lbID}, {0xFFE0, 0xFFE0, lbPO}, {0xFFE1, 0xFFE1, lbPR},
+	{0xFFE2, 0xFFE4, lbID}, {0xFFE5, 0xFFE6, lbPR}, {0xFFF9, 0xFFFB, lbCM}, {0xFFFC, 0xFFFC, lbCB},
+	{0xFFFD, 0xFFFD, lbAI}, {0x1B000, 0x1B2FF, lbID}, {0x1F000, 0x1F0FF, lbID}, {0x1F100, 0x1F1E5, lbAI},
+	{0x1F1E6, 0x1F1FF, lbRI}, {0x1F200, 0x1F384, lbID}, {0x1F385, 0x1F385, lbEB}, {0x1F386, 0x1F3C1, lbID},
+	{0x1F3C2, 0x1F3C4, lbEB}, {0x1F3C5, 0x1F3C6, lbID}, {0x1F3C7, 0x1F3C7, lbEB}, {0x1F3C8, 0x1F3C9, lbID},
+	{0x1F3CA, 0x1F3CC, lbEB}, {0x1F3CD, 0x1F3FA, lbID}, {0x1F3FB, 0x1F3FF, lbEM}, {0x1F400, 0x1F441, lbID},
+	{0x1F442, 0x1F443, lbEB}, {0x1F444, 0x1F445, lbID}, {0x1F446, 0x1F450, lbEB}, {0x1F451, 0x1F465, lbID},
+	{0x1F466, 0x1F478, lbEB}, {0x1F479, 0x1F47B, lbID}, {0x1F47C, 0x1F47C, lbEB}, {0x1F47D, 0x1F480, lbID},
+	{0x1F481, 0x1F483, lbEB}, {0x1F484, 0x1F484, lbID}, {0x1F485, 0x1F487, lbEB}, {0x1F488, 0x1F48E, lbID},
+	{0x1F48F, 0x1F48F, lbEB}, {0x1F490, 0x1F490, lbID}, {0x1F491, 0x1F491, lbEB}, {0x1F492, 0x1F49F, lbID},
+	{0x1F4A0, 0x1F4A0, lbAL}, {0x1F4A1, 0x1F4A1, lbID}, {0x1F4A2, 0x1F4A2, lbAL}, {0x1F4A3, 0x1F4A3, lbID},
+	{0x1F4A4, 0x1F4A4, lbAL}, {0x1F4A5, 0x1F4A9, lbID}, {0x1F4AA, 0x1F4AA, lbEB}, {0x1F4AB, 0x1F4AE, lbID},
+	{0x1F4AF, 0x1F4AF, lbAL}, {0x1F4B0, 0x1F4B0, lbID}, {0x1F4B1, 0x1F4B2, lbAL}, {0x1F4B3, 0x1F573, lbID},
+	{0x1F574, 0x1F575, lbEB}, {0x1F576, 0x1F579, lbID}, {0x1F57A, 0x1F57A, lbEB}, {0x1F57B, 0x1F58F, lbID},
+	{0x1F590, 0x1F590, lbEB}, {0x1F591, 0x1F594, lbID}, {0x1F595, 0x1F596, lbEB}, {0x1F597, 0x1F5D3, lbID},
+	{0x1F5DC, 0x1F5F3, lbID}, {0x1F5FA, 0x1F644, lbID}, {0x1F645, 0x1F647, lbEB}, {0x1F648, 0x1F64A, lbID},
+	{0x1F64B, 0x1F64F, lbEB}, {0x1F680, 0x1F6A2, lbID}, {0x1F6A3, 0x1F6A3, lbEB}, {0x1F6A4, 0x1F6B3, lbID},
+	{0x1F6B4, 0x1F6B6, lbEB}, {0x1F6B7, 0x1F6BF, lbID}, {0x1F6C0, 0x1F6C0, lbEB}, {0x1F6C1, 0x1F6CB, lbID},
+	{0x1F6CC, 0x1F6CC, lbEB}, {0x1F6CD, 0x1F6FF, lbID}, {0x1F774, 0x1F77F, lbID}, {0x1F7D5, 0x1F7FF, lbID},
+	{0x1F80C, 0x1F80F, lbID}, {0x1F848, 0x1F84F, lbID}, {0x1F85A, 0x1F85F, lbID}, {0x1F888, 0x1F88F, lbID},
+	{0x1F8AE, 0x1F90B, lbID}, {0x1F90C, 0x1F90C, lbEB}, {0x1F90D, 0x1F90E, lbID}, {0x1F90F, 0x1F90F, lbEB},
+	{0x1F910, 0x1F917, lbID}, {0x1F918, 0x1F91F, lbEB}, {0x1F920, 0x1F925, lbID}, {0x1F926, 0x1F926, lbEB},
+	{0x1F927, 0x1F92F, lbID}, {0x1F930, 0x1F939, lbEB}, {0x1F93A, 0x1F93B, lbID}, {0x1F93C, 0x1F93E, lbEB},
+	{0x1F93F, 0x1F976, lbID}, {0x1F977, 0x1F977, lbEB}, {0x1F978, 0x1F9B4, lbID}, {0x1F9B5, 0x1F9B6, lbEB},
+	{0x1F9B7, 0x1F9B7, lbID}, {0x1F9B8, 0x1F9B9, lbEB}, {0x1F9BA, 0x1F9BA, lbID}, {0x1F9BB, 0x1F9BB, lbEB},
+	{0x1F9BC, 0x1F9CC, lbID}, {0x1F9CD, 0x1F9CF, lbEB}, {0x1F9D0, 0x1F9D0, lbID}, {0x1F9D1, 0x1F9DD, lbEB},
+	{0x1F9DE, 0x1FAC2, lbID}, {0x1FAC3, 0x1FAC5, lbEB}, {0x1FAC6, 0x1FAEF, lbID}, {0x1FAF0, 0x1FAF8, lbEB},
+	{0x1FAF9, 0x1FAFF, lbID}, {0x1FC00, 0x1FFFD, lbID}, {0x20000, 0x2FFFD, lbID}, {0x30000, 0x3FFFD, lbID},
+	{0xE0001, 0xE0001, lbCM}, {0xE0020, 0xE007F, lbCM}, {0xE0100, 0xE01EF, lbCM}, {0xF0000, 0x10FFFD, lbXX},
+}
+
+func lineClassOf(r rune) lineClass {
+	i := sort.Search(len(lineClasses), func(i int) bool { return lineClasses[i].last >= r })
+	if i < len(lineClasses) && lineClasses[i].first <= r {
+		return lineClasses[i].class
+	}
+	switch {
+	case r >= 0xAC00 && r <= 0xD7A3:
+		if (r-0xAC00)%28 == 0 {
+			return lbH2
+		}
+		return lbH3
+	case unicode.In(r, unicode.Mn, unicode.Mc, unicode.Me):
+		return lbCM
+	case unicode.Is(unicode.Nd, r):
+		return lbNU
+	}
+	return lbAL
+}
+
+// resolveLineClass maps the classes which depend on context to the classes
+// used by the rules (rule LB1). Small kana are not breakable before, like in
+// strict Japanese line breaking.
+func resolveLineClass(r rune) lineClass {
+	switch c := lineClassOf(r); c {
+	case lbAI, lbSG, lbXX:
+		return lbAL
+	case lbSA:
+		if unicode.In(r, unicode.Mn, unicode.Mc) {
+			return lbCM
+		}
+		return lbAL
+	case lbCJ:
+		return lbNS
+	default:
+		return c
+	}
+}
+
+// eastAsianWide reports if the rune is wide or full width, for rule LB30.
+func eastAsianWide(r rune) bool {
+	return r >= 0x1100 && r <= 0x115F || r >= 0x2E80 && r <= 0xA4CF || r >= 0xAC00 && r <= 0xD7A3 ||
+		r >= 0xF900 && r <= 0xFAFF || r >= 0xFE30 && r <= 0xFE6F || r >= 0xFF00 && r <= 0xFF60 ||
+		r >= 0xFFE0 && r <= 0xFFE6 || r >= 0x1F300 && r <= 0x1F64F || r >= 0x1F900 && r <= 0x1F9FF ||
+		r >= 0x20000 && r <= 0x3FFFD
+}
+
+// LineBreaks returns the line break opportunity before each rune of the
+// text, with the rules of the Unicode line breaking algorithm (UAX #14).
+// The text can always be broken at its end.
+func LineBreaks(runes []rune) []FONSBreak {
+	breaks := make([]FONSBreak, len(runes))
+	if len(runes) == 0 {
+		return breaks
+	}
+	classes := make([]lineClass, len(runes))
+	for i, r := range runes {
+		classes[i] = resolveLineClass(r)
+	}
+	// base is the class of the previous rune with its combining marks
+	// (rule LB9), beforeBase the one before it, and spaceBase the last one
+	// which is not a space.
+	base := classes[0]
+	if base == lbCM || base == lbZWJ {
+		base = lbAL // rule LB10
+	}
+	beforeBase, spaceBase := lbXX, base
+	regional := 0
+	if base == lbRI {
+		regional = 1
+	}
+	for i := 1; i < len(runes); i++ {
+		cur := classes[i]
+		// a combining mark takes the class of its base (rules LB9 and LB10)
+		if cur == lbCM || cur == lbZWJ {
+			switch base {
+			case lbBK, lbCR, lbLF, lbNL, lbSP, lbZW:
+			default:
+				continue
+			}
+		}
+		breaks[i] = lineBreak(base, beforeBase, spaceBase, classes[i-1], cur, runes[i-1], runes[i], regional)
+		if cur == lbCM || cur == lbZWJ {
+			cur = lbAL
+		}
+		beforeBase, base = base, cur
+		if cur != lbSP {
+			spaceBase = cur
+		}
+		if cur == lbRI {
+			regional++
+		} else {
+			regional = 0
+		}
+	}
+	return breaks
+}
+
+// lineBreak returns the break opportunity between the runes a and b (rules
+// LB4 to LB31). base is the class of a with its combining marks, prev the
+// class of the rune just before b, and regional the number of regional
+// indicators in a row before b.
+func lineBreak(base, beforeBase, spaceBase, prev, cur lineClass, a, b rune, regional int) FONSBreak {
+	// mandatory breaks and spaces (rules LB4 to LB7)
+	switch {
+	case prev == lbCR && cur == lbLF:
+		return BREAK_NONE
+	case prev == lbBK || prev == lbCR || prev == lbLF || prev == lbNL:
+		return BREAK_MANDATORY
+	case cur == lbBK || cur == lbCR || cur == lbLF || cur == lbNL || cur == lbSP || cur == lbZW:
+		return BREAK_NONE
+	}
+	if base == lbSP {
+		base = spaceBase
+	} else {
+		spaceBase = lbXX
+	}
+	// after spaces, only the rules LB8 and LB14 to LB17 look past them
+	switch {
+	case base == lbZW: // LB8
+		return BREAK_ALLOWED
+	case prev == lbZWJ: // LB8a
+		return BREAK_NONE
+	case cur == lbWJ || base == lbWJ && spaceBase == lbXX: // LB11
+		return BREAK_NONE
+	case base == lbGL && spaceBase == lbXX: // LB12
+		return BREAK_NONE
+	case cur == lbGL && spaceBase == lbXX && base != lbBA && base != lbHY: // LB12a
+		return BREAK_NONE
+	case cur == lbCL || cur == lbCP || cur == lbEX || cur == lbIS || cur == lbSY: // LB13
+		return BREAK_NONE
+	case base == lbOP: // LB14
+		return BREAK_NONE
+	case base == lbQU && cur == lbOP: // LB15
+		return BREAK_NONE
+	case (base == lbCL || base == lbCP) && cur == lbNS: // LB16
+		return BREAK_NONE
+	case base == lbB2 && cur == lbB2: // LB17
+		return BREAK_NONE
+	case spaceBase != lbXX: // LB18
+		return BREAK_ALLOWED
+	}
+	switch {
+	case cur == lbQU || base == lbQU: // LB19
+		return BREAK_NONE
+	case cur == lbCB || base == lbCB: // LB20
+		return BREAK_ALLOWED
+	case cur == lbBA || cur == lbHY || cur == lbNS || base == lbBB: // LB21
+		return BREAK_NONE
+	case beforeBase == lbHL && (base == lbHY || base == lbBA): // LB21a
+		return BREAK_NONE
+	case base == lbSY && cur == lbHL: // LB21b
+		return BREAK_NONE
+	case cur == lbIN: // LB22
+		return BREAK_NONE
+	case (base == lbAL || base == lbHL) && cur == lbNU || base == lbNU && (cur == lbAL || cur == lbHL): // LB23
+		return BREAK_NONE
+	case base == lbPR && (cur == lbID || cur == lbEB || cur == lbEM): // LB23a
+		return BREAK_NONE
+	case (base == lbID || base == lbEB || base == lbEM) && cur == lbPO:
+		return BREAK_NONE
+	case (base == lbPR || base == lbPO) && (cur == lbAL || cur == lbHL): // LB24
+		return BREAK_NONE
+	case (base == lbAL || base == lbHL) && (cur == lbPR || cur == lbPO):
+		return BREAK_NONE
+	case lineNumeric(base, cur): // LB25
+		return BREAK_NONE
+	case base == lbJL && (cur == lbJL || cur == lbJV || cur == lbH2 || cur == lbH3): // LB26
+		return BREAK_NONE
+	case (base == lbJV || base == lbH2) && (cur == lbJV || cur == lbJT):
+		return BREAK_NONE
+	case (base == lbJT || base == lbH3) && cur == lbJT:
+		return BREAK_NONE
+	case lineKorean(base) && cur == lbPO || base == lbPR && lineKorean(cur): // LB27
+		return BREAK_NONE
+	case (base == lbAL || base == lbHL) && (cur == lbAL || cur == lbHL): // LB28
+		return BREAK_NONE
+	case base == lbIS && (cur == lbAL || cur == lbHL): // LB29
+		return BREAK_NONE
+	case (base == lbAL || base == lbHL || base == lbNU) && cur == lbOP && !eastAsianWide(b): // LB30
+		return BREAK_NONE
+	case base == lbCP && !eastAsianWide(a) && (cur == lbAL || cur == lbHL || cur == lbNU):
+		return BREAK_NONE
+	case base == lbRI && cur == lbRI && regional%2 == 1: // LB30a
+		return BREAK_NONE
+	case base == lbEB && cur == lbEM: // LB30b
+		return BREAK_NONE
+	}
+	return BREAK_ALLOWED // LB31
+}
+
+// lineNumeric reports if the pair is inside of a number, like "$(12.50)"
+// or "-3%" (rule LB25).
+func lineNumeric(base, cur lineClass) bool {
+	switch base {
+	case lbCL, lbCP, lbNU:
+		return cur == lbPO || cur == lbPR || base == lbNU && cur == lbNU
+	case lbPO, lbPR:
+		return cur == lbOP || cur == lbNU
+	case lbHY, lbIS, lbSY, lbOP:
+		return cur == lbNU
+	}
+	return false
+}
+
+func lineKorean(c lineClass) bool {
+	return c == lbJL || c == lbJV || c == lbJT || c == lbH2 || c == lbH3
+}
@@ -0,0 +1,78 @@
+package font
+
+import (
+	"github.com/jxo/davinci/font/truetype"
+)
+
+// GlyphOutline is the outline of a glyph of a text laid out by TextOutlines.
+type GlyphOutline struct {
+	X, Y     float32 // origin of the glyph, y grows down
+	Scale    float32 // pixels per font unit of the vertices, whose y grows up
+	Vertices []truetype.Vertex
+}
+
+// TextOutlines lays out the runes in visual order like TextIterForRunes and
+// returns the outlines of their glyphs and the advance of the text. Nothing
+// is rasterized and, unlike quads, the positions aren't rounded to pixels.
+func (stash *FontStash) TextOutlines(x, y float32, runes []rune) (float32, []GlyphOutline) {
+	state := stash.state
+	if len(stash.fonts) < state.font+1 {
+		return 0, nil
+	}
+	font := stash.varied(stash.fonts[state.font])
+	glyphs := stash.shape(font, runes, state.features, state.direction, true, false)
+	advance := stash.outlineAdvance(glyphs, nil)
+	if (state.align & ALIGN_LEFT) != 0 {
+		// do nothing
+	} else if (state.align & ALIGN_RIGHT) != 0 {
+		x -= advance
+	} else if (state.align & ALIGN_CENTER) != 0 {
+		x -= advance * 0.5
+	}
+	y += stash.getVerticalAlign(font, state.align, state.size*10.0)
+
+	outlines := make([]GlyphOutline, 0, len(glyphs))
+	stash.outlineAdvance(glyphs, func(shaped *shapedGlyph, pen, scale float32) {
+		vertices := shaped.font.font.GetGlyphShape(shaped.index)
+		if len(vertices) == 0 {
+			return
+		}
+		outlines = append(outlines, GlyphOutline{
+			X:        x + pen + float32(shaped.xOffset)*scale,
+			Y:        y - float32(shaped.yOffset)*scale,
+			Scale:    scale,
+			Vertices: vertices,
+		})
+	})
+	return advance, outlines
+}
+
+// outlineAdvance returns the advance of the shaped glyphs with kerning and
+// letter spacing applied like getQuad, without rounding. visit is called
+// with the pen position of every glyph if it isn't nil.
+func (stash *FontStash) outlineAdvance(glyphs []shapedGlyph, visit func(shaped *shapedGlyph, pen, scale float32)) float32 {
+	state := stash.state
+	var pen float32
+	for i := range glyphs {
+		shaped := &glyphs[i]
+		scale := shaped.font.getPixelHeightScale(state.size)
+		if i > 0 {
+			prev := &glyphs[i-1]
+			if state.features&FEATURE_KERNING != 0 && !shaped.positioned && prev.font == shaped.font {
+				pen += float32(shaped.font.getGlyphKernAdvance(prev.index, shaped.index)) * scale
+			}
+			if !shaped.joined {
+				pen += state.spacing
+			}
+		}
+		if visit != nil {
+			visit(shaped, pen, scale)
+		}
+		advance, _ := shaped.font.font.GetGlyphHMetrics(shaped.index)
+		pen += float32(advance+shaped.xAdvance) * scale
+		if shaped.tab {
+			pen = shaped.font.nextTabStop(state.tabStops, state.size, 0, pen)
+		}
+	}
+	return pen
+}
@@ -0,0 +1,173 @@
+package font
+
+import (
+	"math"
+)
+
+// FONSRenderMode selects how glyphs are rasterized into the atlas.
+type FONSRenderMode int
+
+const (
+	RENDER_BITMAP   FONSRenderMode = iota // coverage bitmaps, rasterized for every size and blur
+	RENDER_SDF                            // signed distance fields, rasterized once for every size
+	RENDER_SUBPIXEL                       // coverage bitmaps at FONS_SUBPIXEL_PHASES horizontal offsets, not snapped to pixels
+	RENDER_LCD                            // like RENDER_SUBPIXEL with a coverage for every RGB subpixel, not blurred
+)
+
+const (
+	FONS_SDF_SIZE       = 48 // pixel height of the glyphs rasterized as signed distance fields
+	FONS_SDF_SPREAD     = 6  // pixels covered by the fields on both sides of the outlines
+	FONS_SDF_OVERSAMPLE = 4  // oversampling of the outlines the fields are computed from
+)
+
+// getSDFGlyph returns the signed distance field glyph of the index in
+// renderFont, computing it into the atlas if it isn't cached yet. A texel
+// is 0.5 on the outline, and changes by 0.5 every FONS_SDF_SPREAD pixels of
+// FONS_SDF_SIZE, more inside of the glyph.
+func (stash *FontStash) getSDFGlyph(renderFont *Font, index int) *Glyph {
+	glyphKey := GlyphKey{
+		index:     index,
+		size:      FONS_SDF_SIZE * 10,
+		sdf:       true,
+		variation: renderFont.variation,
+	}
+	glyph, ok := renderFont.glyphs[glyphKey]
+	if ok {
+		glyph.used = stash.frame
+		return glyph
+	}
+	const over = FONS_SDF_OVERSAMPLE
+	const pad = FONS_SDF_SPREAD + 1
+	scale := renderFont.getPixelHeightScale(FONS_SDF_SIZE)
+	advance, _, hx0, hy0, hx1, hy1 := renderFont.buildGlyphBitmap(index, scale*over, scale*over, 0, false)
+	x0, y0 := floorDiv(hx0, over), floorDiv(hy0, over)
+	x1, y1 := -floorDiv(-hx1, over), -floorDiv(-hy1, over)
+	gw := x1 - x0 + pad*2
+	gh := y1 - y0 + pad*2
+	gx, gy, err := stash.atlas.AddRect(gw, gh)
+	if err != nil {
+		return nil
+	}
+	gr := gx + gw
+	gb := gy + gh
+	glyph = &Glyph{
+		Index: index,
+		font:  renderFont,
+		scale: scale,
+		size:  FONS_SDF_SIZE * 10,
+		sdf:   true,
+		x0:    int16(gx),
+		y0:    int16(gy),
+		x1:    int16(gr),
+		y1:    int16(gb),
+		xAdv:  int16(scale * float32(advance) * 10.0),
+		xOff:  int16(x0 - pad),
+		yOff:  int16(y0 - pad),
+		used:  stash.frame,
+	}
+	renderFont.glyphs[glyphKey] = glyph
+
+	// Rasterize the oversampled outline, then average its distances.
+	hw, hh := gw*over, gh*over
+	coverage := make([]byte, hw*hh)
+	if hx1 > hx0 && hy1 > hy0 {
+		renderFont.renderGlyphBitmap(coverage, hx0-(x0-pad)*over, hy0-(y0-pad)*over, hx1-hx0, hy1-hy0, hw, scale*over, scale*over, 0, index, false)
+	}
+	field := signedDistances(coverage, hw, hh)
+	width := stash.params.width
+	for y := 0; y < gh; y++ {
+		for x := 0; x < gw; x++ {
+			var d float32
+			for sy := 0; sy < over; sy++ {
+				for sx := 0; sx < over; sx++ {
+					d += field[x*over+sx+(y*over+sy)*hw]
+				}
+			}
+			d /= over * over * over
+			v := 0.5 - d/(2*FONS_SDF_SPREAD)
+			if v < 0 {
+				v = 0
+			} else if v > 1 {
+				v = 1
+			}
+			stash.textureData[gx+x+(gy+y)*width] = byte(v*255 + 0.5)
+		}
+	}
+
+	stash.dirtyRect[0] = fons__mini(stash.dirtyRect[0], gx)
+	stash.dirtyRect[1] = fons__mini(stash.dirtyRect[1], gy)
+	stash.dirtyRect[2] = fons__maxi(stash.dirtyRect[2], gr)
+	stash.dirtyRect[3] = fons__maxi(stash.dirtyRect[3], gb)
+
+	return glyph
+}
+
+// signedDistances returns the distance in pixels of every pixel to the outline
+// of the shape, where the coverage is at least half, negative inside of it.
+func signedDistances(coverage []byte, w, h int) []float32 {
+	outside := distanceTransform(coverage, w, h, true)
+	inside := distanceTransform(coverage, w, h, false)
+	for i := range outside {
+		outside[i] -= inside[i]
+	}
+	return outside
+}
+
+// distanceTransform returns the distance of every pixel to the nearest pixel
+// inside (or outside) of the shape, with the 8 points sequential Euclidean
+// distance transform.
+func distanceTransform(coverage []byte, w, h int, inside bool) []float32 {
+	const far = 1 << 12
+	dx := make([]int, w*h)
+	dy := make([]int, w*h)
+	for i, c := range coverage {
+		if (c >= 128) != inside {
+			dx[i], dy[i] = far, far
+		}
+	}
+	compare := func(x, y, ox, oy int) {
+		if x+ox < 0 || x+ox >= w || y+oy < 0 || y+oy >= h {
+			return
+		}
+		i := x + y*w
+		j := i + ox + oy*w
+		nx, ny := dx[j]+ox, dy[j]+oy
+		if nx*nx+ny*ny < dx[i]*dx[i]+dy[i]*dy[i] {
+			dx[i], dy[i] = nx, ny
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			compare(x, y, -1, 0)
+			compare(x, y, 0, -1)
+			compare(x, y, -1, -1)
+			compare(x, y, 1, -1)
+		}
+		for x := w - 1; x >= 0; x-- {
+			compare(x, y, 1, 0)
+		}
+	}
+	for y := h - 1; y >= 0; y-- {
+		for x := w - 1; x >= 0; x-- {
+			compare(x, y, 1, 0)
+			compare(x, y, 0, 1)
+			compare(x, y, -1, 1)
+			compare(x, y, 1, 1)
+		}
+		for x := 0; x < w; x++ {
+			compare(x, y, -1, 0)
+		}
+	}
+	distances := make([]float32, w*h)
+	for i := range distances {
+		distances[i] = float32(math.Sqrt(float64(dx[i]*dx[i] + dy[i]*dy[i])))
+	}
+	return distances
+}
+
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
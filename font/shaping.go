@@ -0,0 +1,751 @@
+package font
+
+import (
+	"github.com/jxo/davinci/font/truetype"
+)
+
+// FONSFeature selects the OpenType features applied to text.
+type FONSFeature int
+
+const (
+	FEATURE_KERNING   FONSFeature = 1 << 0 // GPOS kern feature, or the kern table
+	FEATURE_LIGATURES             = 1 << 1 // GSUB liga and clig features
+	FEATURE_DEFAULT               = FEATURE_KERNING | FEATURE_LIGATURES
+)
+
+// shapedGlyph is a glyph of shaped text which belongs to the cluster of the
+// runes [cluster, cluster+length) of the input. Several glyphs may belong to
+// the same cluster.
+type shapedGlyph struct {
+	font    *Font
+	index   int
+	cluster int
+	length  int
+	level   uint8 // bidi embedding level, odd levels are right to left
+	joined  bool  // same cluster as the preceding glyph, no letter spacing in between
+	tab     bool  // a tab, drawn as a space which advances to the next tab stop
+	upright bool  // stays upright in vertical text, other glyphs are rotated
+
+	// GPOS adjustments in font units, positioned is false if the font has
+	// no GPOS table and kerning comes from the kern table.
+	xAdvance, xOffset, yOffset int
+	positioned                 bool
+}
+
+// script is the writing system of a run of text, which selects the shaper
+// and the OpenType script tags.
+type script int
+
+const (
+	scriptCommon script = iota // punctuation, digits and marks, belongs to the surrounding script
+	scriptDefault
+	scriptLatin
+	scriptGreek
+	scriptCyrillic
+	scriptHebrew
+	scriptArabic
+	scriptDevanagari
+	scriptThai
+)
+
+var scriptTags = map[script][]string{
+	scriptLatin:      {"latn"},
+	scriptGreek:      {"grek"},
+	scriptCyrillic:   {"cyrl"},
+	scriptHebrew:     {"hebr"},
+	scriptArabic:     {"arab"},
+	scriptDevanagari: {"dev2", "deva"},
+	scriptThai:       {"thai"},
+}
+
+func runeScript(r rune) script {
+	switch {
+	case r < 0x41, r >= 0x5B && r <= 0x60, r >= 0x7B && r <= 0xBF, r == 0xD7, r == 0xF7:
+		return scriptCommon
+	case r >= 0x0300 && r <= 0x036F, r >= 0x1AB0 && r <= 0x1AFF, r >= 0x1DC0 && r <= 0x1DFF:
+		return scriptCommon
+	case r >= 0x2000 && r <= 0x206F, r >= 0x20D0 && r <= 0x20FF, r >= 0xFE20 && r <= 0xFE2F:
+		return scriptCommon
+	case r == 0x0964 || r == 0x0965:
+		return scriptCommon
+	case r <= 0x024F, r >= 0x1E00 && r <= 0x1EFF:
+		return scriptLatin
+	case r >= 0x0370 && r <= 0x03FF, r >= 0x1F00 && r <= 0x1FFF:
+		return scriptGreek
+	case r >= 0x0400 && r <= 0x052F:
+		return scriptCyrillic
+	case r >= 0x0590 && r <= 0x05FF, r >= 0xFB1D && r <= 0xFB4F:
+		return scriptHebrew
+	case r >= 0x0600 && r <= 0x06FF, r >= 0x0750 && r <= 0x077F, r >= 0x08A0 && r <= 0x08FF,
+		r >= 0xFB50 && r <= 0xFDFF, r >= 0xFE70 && r <= 0xFEFF:
+		return scriptArabic
+	case r >= 0x0900 && r <= 0x097F, r >= 0xA8E0 && r <= 0xA8FF:
+		return scriptDevanagari
+	case r >= 0x0E01 && r <= 0x0E5B:
+		return scriptThai
+	}
+	return scriptDefault
+}
+
+// itemize returns the script of each rune. Common runes take the script of
+// the preceding rune, or of the following one at the start of the text.
+func itemize(runes []rune) []script {
+	scripts := make([]script, len(runes))
+	last := scriptCommon
+	for i, r := range runes {
+		scripts[i] = runeScript(r)
+		if scripts[i] == scriptCommon {
+			scripts[i] = last
+		} else {
+			last = scripts[i]
+		}
+	}
+	next := scriptDefault
+	for i := len(runes) - 1; i >= 0; i-- {
+		if scripts[i] == scriptCommon {
+			scripts[i] = next
+		} else {
+			next = scripts[i]
+		}
+	}
+	return scripts
+}
+
+// Masks of the features applied to the glyphs of a run.
+const (
+	maskGlobal uint32 = 1 << iota
+	maskIsolated
+	maskFinal
+	maskMedial
+	maskInitial
+	maskReph
+	maskPreBase
+	maskPostBase
+)
+
+// shape maps the runes, displayed as one line, to glyphs of the font and its
+// fallbacks, and applies the OpenType features of their scripts to runs of the
+// same font, script and direction. The glyphs are in visual order if visual is
+// true, and in logical order otherwise. Vertical text gets the vertical forms
+// of the glyphs, and the glyphs are marked as upright or rotated.
+func (stash *FontStash) shape(font *Font, runes []rune, features FONSFeature, direction FONSDirection, visual, vertical bool) []shapedGlyph {
+	levels := NewBidi(runes, direction).LineLevels(0, len(runes))
+	fonts := make([]*Font, len(runes))
+	indexes := make([]int, len(runes))
+	for i, codePoint := range runes {
+		if levels[i]&1 == 1 {
+			codePoint = bidiMirror(codePoint)
+		}
+		if codePoint == '\t' {
+			codePoint = ' '
+		}
+		fonts[i], indexes[i] = stash.findGlyphFont(font, codePoint)
+	}
+	scripts := itemize(runes)
+
+	glyphs := make([]shapedGlyph, 0, len(runes))
+	for start := 0; start < len(runes); {
+		end := start + 1
+		for end < len(runes) && fonts[end] == fonts[start] && scripts[end] == scripts[start] && levels[end] == levels[start] {
+			end++
+		}
+		glyphs = append(glyphs, fonts[start].shapeRun(runes, indexes, start, end, scripts[start], levels[start], features, vertical)...)
+		start = end
+	}
+
+	clusterEnd := len(runes)
+	for i := len(glyphs) - 1; i >= 0; i-- {
+		if i+1 < len(glyphs) && glyphs[i+1].cluster != glyphs[i].cluster {
+			clusterEnd = glyphs[i+1].cluster
+		}
+		glyphs[i].length = clusterEnd - glyphs[i].cluster
+	}
+
+	if visual {
+		glyphLevels := make([]uint8, len(glyphs))
+		for i := range glyphs {
+			glyphLevels[i] = glyphs[i].level
+		}
+		logical := glyphs
+		glyphs = make([]shapedGlyph, len(logical))
+		for i, index := range bidiReorder(glyphLevels) {
+			glyphs[i] = logical[index]
+		}
+	}
+	for i := range glyphs {
+		glyphs[i].joined = i > 0 && glyphs[i].cluster == glyphs[i-1].cluster
+		glyphs[i].tab = runes[glyphs[i].cluster] == '\t' && !glyphs[i].joined
+		glyphs[i].upright = vertical && isUpright(runes[glyphs[i].cluster])
+	}
+	return glyphs
+}
+
+// shapeRun shapes the runes [start, end) of the embedding level, which have
+// the glyphs indexes in the font.
+func (font *Font) shapeRun(runes []rune, indexes []int, start, end int, s script, level uint8, features FONSFeature, vertical bool) []shapedGlyph {
+	buffer := make([]truetype.LayoutGlyph, end-start)
+	for i := range buffer {
+		buffer[i] = truetype.LayoutGlyph{Index: indexes[start+i], Cluster: start + i, Mask: maskGlobal}
+		if i > 0 && isCombining(runes[start+i]) {
+			buffer[i].Cluster = buffer[i-1].Cluster
+		}
+	}
+	tags := scriptTags[s]
+	info := font.font
+
+	var gsub [][]truetype.LayoutFeature
+	switch s {
+	case scriptArabic:
+		setArabicMasks(runes[start:end], buffer)
+		gsub = [][]truetype.LayoutFeature{
+			layoutFeatures(maskGlobal, "ccmp", "locl"),
+			layoutFeatures(maskIsolated, "isol"),
+			layoutFeatures(maskFinal, "fina"),
+			layoutFeatures(maskMedial, "medi"),
+			layoutFeatures(maskInitial, "init"),
+			layoutFeatures(maskGlobal, "rlig"),
+			layoutFeatures(maskGlobal, "calt"),
+			layoutFeatures(maskGlobal, "mset"),
+		}
+	case scriptDevanagari:
+		buffer = reorderDevanagari(runes[start:end], buffer)
+		gsub = [][]truetype.LayoutFeature{
+			layoutFeatures(maskGlobal, "locl", "ccmp"),
+			layoutFeatures(maskGlobal, "nukt"),
+			layoutFeatures(maskGlobal, "akhn"),
+			layoutFeatures(maskReph, "rphf"),
+			layoutFeatures(maskGlobal, "rkrf"),
+			layoutFeatures(maskPostBase, "blwf"),
+			layoutFeatures(maskPreBase, "half"),
+			layoutFeatures(maskPostBase, "pstf"),
+			layoutFeatures(maskGlobal, "vatu"),
+			layoutFeatures(maskGlobal, "cjct"),
+		}
+	case scriptThai:
+		buffer = font.shapeThai(runes[start:end], buffer)
+		gsub = [][]truetype.LayoutFeature{
+			layoutFeatures(maskGlobal, "ccmp", "locl", "rlig", "calt"),
+		}
+	default:
+		gsub = [][]truetype.LayoutFeature{
+			layoutFeatures(maskGlobal, "ccmp", "locl", "rlig", "calt"),
+		}
+	}
+	for _, stage := range gsub {
+		buffer = info.Substitute(buffer, tags, stage)
+	}
+	if s == scriptDevanagari {
+		moveReph(buffer)
+		buffer = info.Substitute(buffer, tags, layoutFeatures(maskGlobal, "pres", "abvs", "blws", "psts", "haln", "calt"))
+	}
+	if features&FEATURE_LIGATURES != 0 {
+		buffer = info.Substitute(buffer, tags, layoutFeatures(maskGlobal, "liga", "clig"))
+	}
+	if vertical {
+		buffer = info.Substitute(buffer, tags, layoutFeatures(maskGlobal, "vert"))
+	}
+
+	positioned := info.HasPositioning()
+	if positioned {
+		gpos := layoutFeatures(maskGlobal, "dist", "abvm", "blwm", "mark", "mkmk")
+		if features&FEATURE_KERNING != 0 {
+			gpos = append(gpos, layoutFeatures(maskGlobal, "kern")...)
+		}
+		info.Position(buffer, tags, gpos, level&1 == 1)
+	}
+
+	glyphs := make([]shapedGlyph, len(buffer))
+	for i, g := range buffer {
+		glyphs[i] = shapedGlyph{
+			font:       font,
+			index:      g.Index,
+			cluster:    g.Cluster,
+			level:      level,
+			xAdvance:   g.XAdvance,
+			xOffset:    g.XOffset,
+			yOffset:    g.YOffset,
+			positioned: positioned,
+		}
+	}
+	return glyphs
+}
+
+// isCombining returns true for marks and joiners, which belong to the
+// cluster of the preceding character.
+func isCombining(r rune) bool {
+	switch {
+	case r >= 0x0300 && r <= 0x036F, r >= 0x0483 && r <= 0x0489:
+		return true
+	case r >= 0x0591 && r <= 0x05BD, r == 0x05BF, r == 0x05C1, r == 0x05C2, r == 0x05C4, r == 0x05C5, r == 0x05C7:
+		return true
+	case r >= 0x0610 && r <= 0x061A, r >= 0x064B && r <= 0x065F, r == 0x0670, r >= 0x06D6 && r <= 0x06DC,
+		r >= 0x06DF && r <= 0x06E4, r == 0x06E7, r == 0x06E8, r >= 0x06EA && r <= 0x06ED, r >= 0x08D3 && r <= 0x08FF:
+		return true
+	case r >= 0x0900 && r <= 0x0903, r >= 0x093A && r <= 0x094F && r != 0x093D, r >= 0x0951 && r <= 0x0957,
+		r == 0x0962, r == 0x0963:
+		return true
+	case r == 0x0E31, r >= 0x0E34 && r <= 0x0E3A, r >= 0x0E47 && r <= 0x0E4E:
+		return true
+	case r >= 0x1AB0 && r <= 0x1AFF, r >= 0x1DC0 && r <= 0x1DFF, r >= 0x20D0 && r <= 0x20FF,
+		r >= 0xFE20 && r <= 0xFE2F, r == 0x200C, r == 0x200D:
+		return true
+	}
+	return false
+}
+
+// layoutFeatures returns the features with the tags applied to the mask.
+func layoutFeatures(mask uint32, tags ...string) []truetype.LayoutFeature {
+	features := make([]truetype.LayoutFeature, len(tags))
+	for i, tag := range tags {
+		features[i] = truetype.LayoutFeature{Tag: tag, Mask: mask}
+	}
+	return features
+}
+
+// Arabic joining types.
+const (
+	joinNone        = iota // U, doesn't join
+	joinRight              // R, joins with the preceding letter only
+	joinDual               // D, joins on both sides
+	joinCausing            // C, tatweel and zero width joiner
+	joinTransparent        // T, marks
+)
+
+// arabicJoiningTypes are ranges of runes with a joining type other than joinNone.
+var arabicJoiningTypes = []struct {
+	first, last rune
+	joining     int
+}{
+	{0x0610, 0x061A, joinTransparent},
+	{0x0620, 0x0620, joinDual},
+	{0x0622, 0x0625, joinRight},
+	{0x0626, 0x0626, joinDual},
+	{0x0627, 0x0627, joinRight},
+	{0x0628, 0x0628, joinDual},
+	{0x0629, 0x0629, joinRight},
+	{0x062A, 0x062E, joinDual},
+	{0x062F, 0x0632, joinRight},
+	{0x0633, 0x063F, joinDual},
+	{0x0640, 0x0640, joinCausing},
+	{0x0641, 0x0647, joinDual},
+	{0x0648, 0x0648, joinRight},
+	{0x0649, 0x064A, joinDual},
+	{0x064B, 0x065F, joinTransparent},
+	{0x066E, 0x066F, joinDual},
+	{0x0670, 0x0670, joinTransparent},
+	{0x0671, 0x0673, joinRight},
+	{0x0675, 0x0677, joinRight},
+	{0x0678, 0x0687, joinDual},
+	{0x0688, 0x0699, joinRight},
+	{0x069A, 0x06BF, joinDual},
+	{0x06C0, 0x06C0, joinRight},
+	{0x06C1, 0x06C2, joinDual},
+	{0x06C3, 0x06CB, joinRight},
+	{0x06CC, 0x06CC, joinDual},
+	{0x06CD, 0x06CD, joinRight},
+	{0x06CE, 0x06CE, joinDual},
+	{0x06CF, 0x06CF, joinRight},
+	{0x06D0, 0x06D1, joinDual},
+	{0x06D2, 0x06D3, joinRight},
+	{0x06D5, 0x06D5, joinRight},
+	{0x06D6, 0x06DC, joinTransparent},
+	{0x06DF, 0x06E4, joinTransparent},
+	{0x06E7, 0x06E8, joinTransparent},
+	{0x06EA, 0x06ED, joinTransparent},
+	{0x06EE, 0x06EF, joinRight},
+	{0x06FA, 0x06FC, joinDual},
+	{0x06FF, 0x06FF, joinDual},
+	{0x0750, 0x0758, joinDual},
+	{0x0759, 0x075B, joinRight},
+	{0x075C, 0x076A, joinDual},
+	{0x076B, 0x076C, joinRight},
+	{0x076D, 0x0770, joinDual},
+	{0x0771, 0x0771, joinRight},
+	{0x0772, 0x0772, joinDual},
+	{0x0773, 0x0774, joinRight},
+	{0x0775, 0x0777, joinDual},
+	{0x0778, 0x0779, joinRight},
+	{0x077A, 0x077F, joinDual},
+	{0x08D3, 0x08E1, joinTransparent},
+	{0x08E3, 0x08FF, joinTransparent},
+	{0x200D, 0x200D, joinCausing},
+}
+
+func arabicJoining(r rune) int {
+	for _, t := range arabicJoiningTypes {
+		if r < t.first {
+			break
+		}
+		if r <= t.last {
+			return t.joining
+		}
+	}
+	if r >= 0x0300 && r <= 0x036F {
+		return joinTransparent
+	}
+	return joinNone
+}
+
+// setArabicMasks selects the isolated, final, medial or initial form of
+// every joining letter from its neighbours, skipping transparent marks.
+func setArabicMasks(runes []rune, buffer []truetype.LayoutGlyph) {
+	forms := make([]uint32, len(runes))
+	prev := -1
+	prevJoining := joinNone
+	for i, r := range runes {
+		joining := arabicJoining(r)
+		if joining == joinTransparent {
+			continue
+		}
+		if joining != joinNone {
+			forms[i] = maskIsolated
+		}
+		if prev >= 0 && (prevJoining == joinDual || prevJoining == joinCausing) &&
+			(joining == joinDual || joining == joinRight || joining == joinCausing) {
+			if forms[prev] == maskFinal {
+				forms[prev] = maskMedial
+			} else {
+				forms[prev] = maskInitial
+			}
+			forms[i] = maskFinal
+		}
+		prev, prevJoining = i, joining
+	}
+	for i := range buffer {
+		buffer[i].Mask |= forms[i]
+	}
+}
+
+// Devanagari character categories, kept in the Info of the glyphs.
+const (
+	devOther = iota
+	devConsonant
+	devRa
+	devVowel
+	devNukta
+	devHalant
+	devMatra
+	devPreBaseMatra
+	devModifier
+	devJoiner
+	devNonJoiner
+)
+
+func devanagariCategory(r rune) uint16 {
+	switch {
+	case r == 0x0930:
+		return devRa
+	case r >= 0x0915 && r <= 0x0939, r >= 0x0958 && r <= 0x095F, r >= 0x0978 && r <= 0x097F:
+		return devConsonant
+	case r >= 0x0904 && r <= 0x0914, r == 0x0960, r == 0x0961, r >= 0x0972 && r <= 0x0977:
+		return devVowel
+	case r == 0x093C:
+		return devNukta
+	case r == 0x094D:
+		return devHalant
+	case r == 0x093F, r == 0x094E:
+		return devPreBaseMatra
+	case r >= 0x093A && r <= 0x093B, r >= 0x093E && r <= 0x094C, r == 0x094F,
+		r >= 0x0955 && r <= 0x0957, r == 0x0962, r == 0x0963:
+		return devMatra
+	case r >= 0x0900 && r <= 0x0903:
+		return devModifier
+	case r == 0x200D:
+		return devJoiner
+	case r == 0x200C:
+		return devNonJoiner
+	}
+	return devOther
+}
+
+func isDevanagariConsonant(category uint16) bool {
+	return category == devConsonant || category == devRa
+}
+
+// reorderDevanagari splits the run into syllables, moves pre-base matras in
+// front of the syllable's consonants and sets the masks of the basic forms.
+// The glyphs of a syllable become one cluster.
+func reorderDevanagari(runes []rune, buffer []truetype.LayoutGlyph) []truetype.LayoutGlyph {
+	for i := range buffer {
+		buffer[i].Info = devanagariCategory(runes[i])
+	}
+	for start := 0; start < len(buffer); {
+		end := start + 1
+		category := buffer[start].Info
+		if isDevanagariConsonant(category) || category == devVowel {
+		syllable:
+			for end < len(buffer) {
+				switch buffer[end].Info {
+				case devNukta, devMatra, devPreBaseMatra, devModifier, devJoiner:
+					end++
+				case devHalant:
+					end++
+					if end < len(buffer) && (buffer[end].Info == devJoiner || buffer[end].Info == devNonJoiner) {
+						end++
+					}
+					if end < len(buffer) && isDevanagariConsonant(buffer[end].Info) {
+						end++
+					}
+				default:
+					break syllable
+				}
+			}
+		}
+		reorderSyllable(buffer[start:end])
+		start = end
+	}
+	return buffer
+}
+
+func reorderSyllable(syllable []truetype.LayoutGlyph) {
+	if len(syllable) == 0 {
+		return
+	}
+	for i := range syllable {
+		syllable[i].Cluster = syllable[0].Cluster
+	}
+	first := 0
+	reph := len(syllable) >= 3 && syllable[0].Info == devRa && syllable[1].Info == devHalant &&
+		isDevanagariConsonant(syllable[2].Info)
+	if reph {
+		first = 2
+	}
+
+	// The base is the last consonant, unless it takes a below-base form
+	// (rakaar) after a halant.
+	base := -1
+	last := true
+	for i := len(syllable) - 1; i >= first; i-- {
+		if !isDevanagariConsonant(syllable[i].Info) {
+			continue
+		}
+		if last && syllable[i].Info == devRa && i >= first+2 && syllable[i-1].Info == devHalant {
+			last = false
+			continue
+		}
+		base = i
+		break
+	}
+	if base < 0 {
+		return
+	}
+
+	for i := base + 1; i < len(syllable); i++ {
+		if syllable[i].Info == devPreBaseMatra {
+			matra := syllable[i]
+			copy(syllable[first+1:i+1], syllable[first:i])
+			syllable[first] = matra
+			base++
+			break
+		}
+	}
+	for i := range syllable {
+		switch {
+		case reph && i < 2:
+			syllable[i].Mask |= maskReph
+		case i < base && syllable[i].Info != devPreBaseMatra:
+			syllable[i].Mask |= maskPreBase
+		case i > base:
+			syllable[i].Mask |= maskPostBase
+		}
+	}
+}
+
+// moveReph moves reph glyphs formed by the rphf feature to the end of their
+// syllable, before any final modifiers.
+func moveReph(buffer []truetype.LayoutGlyph) {
+	for start := 0; start < len(buffer); {
+		end := start + 1
+		for end < len(buffer) && buffer[end].Cluster == buffer[start].Cluster {
+			end++
+		}
+		if buffer[start].Mask&maskReph != 0 && (end == start+1 || buffer[start+1].Mask&maskReph == 0) {
+			to := end - 1
+			for to > start && buffer[to].Info == devModifier {
+				to--
+			}
+			reph := buffer[start]
+			copy(buffer[start:to], buffer[start+1:to+1])
+			buffer[to] = reph
+		}
+		start = end
+	}
+}
+
+// Thai mark types of the fallback mark positioning.
+const (
+	thaiAboveVowel = iota
+	thaiBelowVowel
+	thaiTone
+	thaiNotMark
+)
+
+// Thai consonant types, by the parts of the glyph which collide with marks.
+const (
+	thaiNormal             = iota
+	thaiAscender           // PO PLA, FO FA and FO FAN reach into the space of above marks
+	thaiRemovableDescender // YO YING and THO THAN lose their descender under below marks
+	thaiDescender          // DO CHADA and TO PATAK reach into the space of below marks
+	thaiNotConsonant
+)
+
+// Actions on Thai marks, which select a shifted variant from the private use
+// area of the font.
+const (
+	thaiNop = iota
+	thaiShiftDown
+	thaiShiftLeft
+	thaiShiftDownLeft
+	thaiRemoveDescender
+)
+
+type thaiEdge struct {
+	action int
+	next   int
+}
+
+// thaiAboveStates and thaiBelowStates are the state machines of the above and
+// below marks of a consonant, indexed by the state and the mark type.
+var thaiAboveStates = [4][3]thaiEdge{
+	{{thaiNop, 3}, {thaiNop, 0}, {thaiShiftDown, 3}},
+	{{thaiShiftLeft, 2}, {thaiNop, 1}, {thaiShiftDownLeft, 2}},
+	{{thaiNop, 3}, {thaiNop, 2}, {thaiShiftLeft, 3}},
+	{{thaiNop, 3}, {thaiNop, 3}, {thaiNop, 3}},
+}
+
+var thaiBelowStates = [3][3]thaiEdge{
+	{{thaiNop, 0}, {thaiNop, 2}, {thaiNop, 0}},
+	{{thaiNop, 1}, {thaiRemoveDescender, 2}, {thaiNop, 1}},
+	{{thaiNop, 2}, {thaiShiftDown, 2}, {thaiNop, 2}},
+}
+
+// thaiAboveStart and thaiBelowStart are the initial states after a consonant type.
+var thaiAboveStart = [5]int{0, 1, 0, 0, 3}
+var thaiBelowStart = [5]int{0, 0, 1, 2, 2}
+
+// thaiPUA maps the characters of each action to their Windows and Mac private
+// use area variants.
+var thaiPUA = map[int]map[rune][2]rune{
+	thaiShiftDown: {
+		0x0E48: {0xF70A, 0xF88B}, 0x0E49: {0xF70B, 0xF88E}, 0x0E4A: {0xF70C, 0xF891},
+		0x0E4B: {0xF70D, 0xF894}, 0x0E4C: {0xF70E, 0xF897}, 0x0E38: {0xF718, 0xF89B},
+		0x0E39: {0xF719, 0xF89C}, 0x0E3A: {0xF71A, 0xF89D},
+	},
+	thaiShiftDownLeft: {
+		0x0E48: {0xF705, 0xF88C}, 0x0E49: {0xF706, 0xF88F}, 0x0E4A: {0xF707, 0xF892},
+		0x0E4B: {0xF708, 0xF895}, 0x0E4C: {0xF709, 0xF898},
+	},
+	thaiShiftLeft: {
+		0x0E48: {0xF713, 0xF88A}, 0x0E49: {0xF714, 0xF88D}, 0x0E4A: {0xF715, 0xF890},
+		0x0E4B: {0xF716, 0xF893}, 0x0E4C: {0xF717, 0xF896}, 0x0E31: {0xF710, 0xF884},
+		0x0E34: {0xF701, 0xF885}, 0x0E35: {0xF702, 0xF886}, 0x0E36: {0xF703, 0xF887},
+		0x0E37: {0xF704, 0xF888}, 0x0E47: {0xF712, 0xF889}, 0x0E4D: {0xF711, 0xF899},
+	},
+	thaiRemoveDescender: {
+		0x0E0D: {0xF70F, 0xF89A}, 0x0E10: {0xF700, 0xF89E},
+	},
+}
+
+func thaiMarkType(r rune) int {
+	switch {
+	case r == 0x0E31, r >= 0x0E34 && r <= 0x0E37, r == 0x0E47, r == 0x0E4D, r == 0x0E4E:
+		return thaiAboveVowel
+	case r >= 0x0E38 && r <= 0x0E3A:
+		return thaiBelowVowel
+	case r >= 0x0E48 && r <= 0x0E4C:
+		return thaiTone
+	}
+	return thaiNotMark
+}
+
+func thaiConsonantType(r rune) int {
+	switch {
+	case r == 0x0E1B, r == 0x0E1D, r == 0x0E1F:
+		return thaiAscender
+	case r == 0x0E0D, r == 0x0E10:
+		return thaiRemovableDescender
+	case r == 0x0E0E, r == 0x0E0F:
+		return thaiDescender
+	case r >= 0x0E01 && r <= 0x0E2E:
+		return thaiNormal
+	}
+	return thaiNotConsonant
+}
+
+func isThaiAboveMark(r rune) bool {
+	return r == 0x0E31 || r >= 0x0E34 && r <= 0x0E37 || r >= 0x0E47 && r <= 0x0E4E
+}
+
+// shapeThai decomposes SARA AM into NIKHAHIT and SARA AA, and moves NIKHAHIT
+// in front of the above marks of the consonant. Fonts without Thai GSUB
+// lookups usually place marks with private use area glyphs, which are
+// selected the way Windows and Mac do.
+func (font *Font) shapeThai(runes []rune, buffer []truetype.LayoutGlyph) []truetype.LayoutGlyph {
+	nikhahit := font.getGlyphIndex(0x0E4D)
+	saraAa := font.getGlyphIndex(0x0E32)
+	codePoints := make([]rune, 0, len(runes))
+	out := make([]truetype.LayoutGlyph, 0, len(buffer))
+	for i, r := range runes {
+		if r != 0x0E33 || nikhahit == 0 || saraAa == 0 {
+			codePoints = append(codePoints, r)
+			out = append(out, buffer[i])
+			continue
+		}
+		g := buffer[i]
+		to := len(out)
+		for to > 0 && isThaiAboveMark(codePoints[to-1]) {
+			to--
+		}
+		if to < len(out) {
+			g.Cluster = out[to].Cluster
+			for k := to; k < len(out); k++ {
+				out[k].Cluster = g.Cluster
+			}
+		}
+		g.Index = nikhahit
+		out = append(out[:to], append([]truetype.LayoutGlyph{g}, out[to:]...)...)
+		codePoints = append(codePoints[:to], append([]rune{0x0E4D}, codePoints[to:]...)...)
+		g.Index = saraAa
+		out = append(out, g)
+		codePoints = append(codePoints, 0x0E32)
+	}
+	if !font.font.HasScriptSubstitutions("thai") {
+		font.shiftThaiMarks(codePoints, out)
+	}
+	return out
+}
+
+// shiftThaiMarks replaces marks which collide with their consonant or with
+// each other, and consonants which collide with below marks, by their private
+// use area variants if the font has them.
+func (font *Font) shiftThaiMarks(codePoints []rune, buffer []truetype.LayoutGlyph) {
+	above := thaiAboveStart[thaiNotConsonant]
+	below := thaiBelowStart[thaiNotConsonant]
+	base := 0
+	for i, r := range codePoints {
+		mark := thaiMarkType(r)
+		if mark == thaiNotMark {
+			consonant := thaiConsonantType(r)
+			above, below = thaiAboveStart[consonant], thaiBelowStart[consonant]
+			base = i
+			continue
+		}
+		aboveEdge := thaiAboveStates[above][mark]
+		belowEdge := thaiBelowStates[below][mark]
+		above, below = aboveEdge.next, belowEdge.next
+		action := aboveEdge.action
+		if action == thaiNop {
+			action = belowEdge.action
+		}
+		target := i
+		if action == thaiRemoveDescender {
+			target = base
+		}
+		for _, variant := range thaiPUA[action][codePoints[target]] {
+			if index := font.getGlyphIndex(variant); index != 0 {
+				buffer[target].Index = index
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package font
+
+import (
+	"math"
+)
+
+// FONS_SUBPIXEL_PHASES is the number of horizontal offsets glyphs are rasterized
+// at in RENDER_SUBPIXEL and RENDER_LCD modes.
+const FONS_SUBPIXEL_PHASES = 4
+
+// lcdFilter spreads the coverage of a subpixel to its neighbours, which
+// reduces color fringes. The weights sum up to 256.
+var lcdFilter = [5]int{8, 77, 86, 77, 8}
+
+// getSubpixelQuad is glyphQuad for RENDER_SUBPIXEL and RENDER_LCD modes. The pen
+// position isn't rounded, the glyph is rasterized at the nearest phase of the
+// pixel instead. LCD glyphs are three texels wide for every pixel, the quad
+// maps the middle texels to the pixels.
+func (stash *FontStash) getSubpixelQuad(prevGlyph *Glyph, shaped *shapedGlyph, spacing float32, features FONSFeature, size, blur int, lcd bool, originalX, y float32) (*Glyph, Quad, float32, float32) {
+	renderFont := shaped.font
+	scale := renderFont.getPixelHeightScale(float32(size) / 10.0)
+	x := originalX
+	if prevGlyph != nil {
+		if features&FEATURE_KERNING != 0 && !shaped.positioned && prevGlyph.font == renderFont {
+			x += float32(renderFont.getGlyphKernAdvance(prevGlyph.Index, shaped.index)) * scale
+		}
+		if !shaped.joined {
+			x += spacing
+		}
+	}
+	rx := x + float32(shaped.xOffset)*scale
+	ix := float32(math.Floor(float64(rx)))
+	phase := int((rx-ix)*FONS_SUBPIXEL_PHASES + 0.5)
+	if phase == FONS_SUBPIXEL_PHASES {
+		ix++
+		phase = 0
+	}
+
+	var glyph *Glyph
+	color := false
+	if size >= 0 && renderFont.font.HasColorGlyphs() {
+		glyph, color = stash.getColorGlyph(renderFont, shaped.index, size)
+	}
+	if size < 0 || color {
+		// color glyphs aren't shifted
+	} else if lcd {
+		glyph = stash.getLCDGlyph(renderFont, shaped.index, size, phase)
+	} else {
+		glyph = stash.getBitmapGlyph(renderFont, shaped.index, size, blur, phase)
+	}
+	if glyph == nil {
+		return nil, Quad{}, originalX, y
+	}
+
+	itw, ith := stash.itw, stash.ith
+	if glyph.Color {
+		itw, ith = 1.0/FONS_COLOR_ATLAS_SIZE, 1.0/FONS_COLOR_ATLAS_SIZE
+	}
+	x0 := float32(int(glyph.x0 + 1))
+	y0 := float32(int(glyph.y0 + 1))
+	x1 := float32(int(glyph.x1 - 1))
+	y1 := float32(int(glyph.y1 - 1))
+	width := x1 - x0
+	if lcd && !glyph.Color {
+		x0 += 2
+		x1 -= 2
+		width = (x1 - x0) / 3
+	}
+	// only vertical positions are snapped to pixels
+	rx = ix + float32(int(glyph.xOff+1))
+	ry := float32(int(y + float32(int(glyph.yOff+1)) - float32(shaped.yOffset)*scale))
+	quad := Quad{
+		X0: rx,
+		Y0: ry,
+		X1: rx + width,
+		Y1: ry + y1 - y0,
+		S0: x0 * itw,
+		T0: y0 * ith,
+		S1: x1 * itw,
+		T1: y1 * ith,
+	}
+	advance, _ := renderFont.font.GetGlyphHMetrics(shaped.index)
+	x += float32(advance+shaped.xAdvance) * scale
+	return glyph, quad, x, y
+}
+
+// getLCDGlyph returns the glyph of the index in renderFont with a coverage for
+// every RGB subpixel, shifted right by phase/FONS_SUBPIXEL_PHASES pixels,
+// rasterizing it into the atlas if it isn't cached yet. Every pixel is three
+// texels of the atlas, one for every subpixel.
+func (stash *FontStash) getLCDGlyph(renderFont *Font, index, size, phase int) *Glyph {
+	const pad = 2
+	glyphKey := GlyphKey{
+		index:     index,
+		size:      int16(size),
+		phase:     int8(phase),
+		lcd:       true,
+		hinted:    stash.hinted(size),
+		variation: renderFont.variation,
+	}
+	glyph, ok := renderFont.glyphs[glyphKey]
+	if ok {
+		glyph.used = stash.frame
+		return glyph
+	}
+	scale := renderFont.getPixelHeightScale(float32(size) / 10.0)
+	shiftX := float32(phase) / FONS_SUBPIXEL_PHASES
+	// the outline is rasterized three times wider, the filter spreads it by two subpixels
+	advance, _, hx0, y0, hx1, y1 := renderFont.buildGlyphBitmap(index, scale*3, scale, shiftX*3, glyphKey.hinted)
+	x0, x1 := floorDiv(hx0-2, 3), -floorDiv(-hx1-2, 3)
+	gw := (x1 - x0 + pad*2) * 3
+	gh := y1 - y0 + pad*2
+	gx, gy, err := stash.atlas.AddRect(gw, gh)
+	if err != nil {
+		return nil
+	}
+	gr := gx + gw
+	gb := gy + gh
+	glyph = &Glyph{
+		Index: index,
+		font:  renderFont,
+		scale: scale,
+		size:  int16(size),
+		x0:    int16(gx),
+		y0:    int16(gy),
+		x1:    int16(gr),
+		y1:    int16(gb),
+		xAdv:  int16(scale * float32(advance) * 10.0),
+		xOff:  int16(x0 - pad),
+		yOff:  int16(y0 - pad),
+		used:  stash.frame,
+	}
+	renderFont.glyphs[glyphKey] = glyph
+
+	sw := (x1 - x0) * 3
+	coverage := make([]byte, sw*(y1-y0))
+	if hx1 > hx0 && y1 > y0 {
+		renderFont.renderGlyphBitmap(coverage, hx0-x0*3, 0, hx1-hx0, y1-y0, sw, scale*3, scale, shiftX*3, index, glyphKey.hinted)
+	}
+	width := stash.params.width
+	for y := gy; y < gb; y++ {
+		row := stash.textureData[gx+y*width : gr+y*width]
+		for i := range row {
+			row[i] = 0
+		}
+	}
+	for y := 0; y < y1-y0; y++ {
+		src := coverage[y*sw : (y+1)*sw]
+		dst := stash.textureData[gx+pad*3+(gy+pad+y)*width:]
+		for i := range src {
+			sum := 0
+			for k, weight := range lcdFilter {
+				if j := i + k - 2; j >= 0 && j < sw {
+					sum += weight * int(src[j])
+				}
+			}
+			dst[i] = byte(fons__mini(sum>>8, 255))
+		}
+	}
+
+	stash.dirtyRect[0] = fons__mini(stash.dirtyRect[0], gx)
+	stash.dirtyRect[1] = fons__mini(stash.dirtyRect[1], gy)
+	stash.dirtyRect[2] = fons__maxi(stash.dirtyRect[2], gr)
+	stash.dirtyRect[3] = fons__maxi(stash.dirtyRect[3], gb)
+	return glyph
+}
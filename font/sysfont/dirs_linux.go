@@ -0,0 +1,34 @@
+package sysfont
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dirs returns the font directories of the user and of the system, following the XDG
+// base directory specification like fontconfig.
+func Dirs() []string {
+	home, _ := os.UserHomeDir()
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" && home != "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	var dirs []string
+	if dataHome != "" {
+		dirs = append(dirs, filepath.Join(dataHome, "fonts"))
+	}
+	if home != "" {
+		dirs = append(dirs, filepath.Join(home, ".fonts"))
+	}
+	for _, dir := range strings.Split(dataDirs, ":") {
+		if dir != "" {
+			dirs = append(dirs, filepath.Join(dir, "fonts"))
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,9 @@
+// +build !linux
+
+package sysfont
+
+// Dirs returns the font directories of the system. Only Linux is supported yet,
+// fonts of other systems have to be scanned with the directories given to Scan.
+func Dirs() []string {
+	return nil
+}
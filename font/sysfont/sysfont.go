@@ -0,0 +1,176 @@
+// Package sysfont finds the fonts installed in the system, so that applications can load
+// them with vg.Context.CreateFont instead of embedding their own.
+package sysfont
+
+import (
+	"github.com/jxo/davinci/font/truetype"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Font is a font face found in a font file.
+type Font struct {
+	Path   string
+	Index  int    // face index in a TrueType collection, see vg.Context.CreateFontFromCollection
+	Family string // typographic family name like "Noto Sans", or the legacy family name
+	Style  string // typographic style name like "Bold Italic", or the legacy style name
+	Weight int    // 100 for thin to 900 for black, 400 is regular
+	Italic bool
+	ranges [][2]int // codepoint ranges mapped by the cmap
+}
+
+// HasRune returns whether the font has a glyph of the rune.
+func (font *Font) HasRune(r rune) bool {
+	i := sort.Search(len(font.ranges), func(i int) bool {
+		return font.ranges[i][1] >= int(r)
+	})
+	return i < len(font.ranges) && font.ranges[i][0] <= int(r)
+}
+
+// Database is a list of fonts to match queries against.
+type Database struct {
+	Fonts []*Font
+}
+
+// genericFamilies lists common families of Linux distributions for the generic
+// family names, in the order of preference.
+var genericFamilies = map[string][]string{
+	"sans-serif": {"Noto Sans", "DejaVu Sans", "Liberation Sans", "Cantarell", "Ubuntu", "Roboto", "FreeSans"},
+	"serif":      {"Noto Serif", "DejaVu Serif", "Liberation Serif", "FreeSerif"},
+	"monospace":  {"Noto Sans Mono", "DejaVu Sans Mono", "Liberation Mono", "Ubuntu Mono", "FreeMono"},
+}
+
+func init() {
+	genericFamilies["sans"] = genericFamilies["sans-serif"]
+	genericFamilies["mono"] = genericFamilies["monospace"]
+}
+
+// Scan finds the fonts in the directories and their subdirectories. Files which
+// can't be read or parsed are skipped.
+func Scan(dirs ...string) *Database {
+	db := &Database{}
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || seen[path] {
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".ttf", ".otf", ".ttc", ".otc":
+			default:
+				return nil
+			}
+			seen[path] = true
+			db.addFile(path)
+			return nil
+		})
+	}
+	return db
+}
+
+// addFile adds the faces of the font file.
+func (db *Database) addFile(path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for i := 0; i < truetype.GetNumberOfFonts(data); i++ {
+		info, err := truetype.InitFont(data, truetype.GetFontOffsetForIndex(data, i))
+		if err != nil {
+			continue
+		}
+		font := &Font{
+			Path:   path,
+			Index:  i,
+			Family: info.GetFontName(truetype.NAME_ID_TYPOGRAPHIC_FAMILY),
+			Style:  info.GetFontName(truetype.NAME_ID_TYPOGRAPHIC_SUBFAMILY),
+			Weight: info.GetWeightClass(),
+			Italic: info.IsItalic(),
+			ranges: info.GetCodepointRanges(),
+		}
+		if font.Family == "" {
+			font.Family = info.GetFontName(truetype.NAME_ID_FAMILY)
+		}
+		if font.Style == "" {
+			font.Style = info.GetFontName(truetype.NAME_ID_SUBFAMILY)
+		}
+		db.Fonts = append(db.Fonts, font)
+	}
+}
+
+// Match returns the font of the family closest to the weight and the style, which has a glyph
+// of sampleRune unless it is zero. The generic families "sans-serif", "serif" and "monospace"
+// are mapped to common installed families. When no font of the family has the rune, the closest
+// font of any family which has it is returned, for fallbacks. Match returns nil if no font matches.
+func (db *Database) Match(family string, weight int, italic bool, sampleRune rune) *Font {
+	return db.match(family, weight, italic, sampleRune, func(*Font) bool { return true })
+}
+
+func (db *Database) match(family string, weight int, italic bool, sampleRune rune, accept func(*Font) bool) *Font {
+	families := []string{family}
+	families = append(families, genericFamilies[strings.ToLower(family)]...)
+	families = append(families, "")
+	for _, name := range families {
+		var best *Font
+		bestScore := 0
+		for _, font := range db.Fonts {
+			if name != "" && !strings.EqualFold(font.Family, name) {
+				continue
+			}
+			if !accept(font) || (sampleRune != 0 && !font.HasRune(sampleRune)) {
+				continue
+			}
+			score := styleDistance(font, weight, italic)
+			if best == nil || score < bestScore {
+				best, bestScore = font, score
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	return nil
+}
+
+// styleDistance returns how much the style of the font differs from the weight
+// and the style, a wrong slant weighs more than any difference of weight.
+func styleDistance(font *Font, weight int, italic bool) int {
+	distance := font.Weight - weight
+	if distance < 0 {
+		distance = -distance
+	}
+	if font.Italic != italic {
+		distance += 1000
+	}
+	return distance
+}
+
+var (
+	system     *Database
+	systemOnce sync.Once
+)
+
+// System returns the fonts of the directories of Dirs, which are scanned on the first call.
+func System() *Database {
+	systemOnce.Do(func() {
+		system = Scan(Dirs()...)
+	})
+	return system
+}
+
+// Match returns the path of the installed font which matches the query best, see
+// Database.Match, or "" if there are no fonts. Only the first faces of collections are
+// matched, so that the path can be loaded with vg.Context.CreateFont.
+func Match(family string, weight int, italic bool, sampleRune rune) string {
+	font := System().match(family, weight, italic, sampleRune, func(font *Font) bool {
+		return font.Index == 0
+	})
+	if font == nil {
+		return ""
+	}
+	return font.Path
+}
@@ -0,0 +1,55 @@
+package sysfont
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sysfont")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"Roboto-Regular.ttf", "Roboto-Bold.ttf", "Roboto-Light.ttf", "entypo.ttf"} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "..", "sample", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub := filepath.Join(dir, name[:len(name)-4])
+		os.Mkdir(sub, 0755)
+		if err := ioutil.WriteFile(filepath.Join(sub, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ioutil.WriteFile(filepath.Join(dir, "broken.ttf"), []byte("not a font"), 0644)
+
+	db := Scan(dir)
+	if len(db.Fonts) != 4 {
+		t.Fatalf("4 fonts should be found, but %d", len(db.Fonts))
+	}
+	for _, c := range []struct {
+		family string
+		weight int
+		italic bool
+		r      rune
+		want   string
+	}{
+		{"Roboto", 700, false, 'a', "Roboto-Bold.ttf"},
+		{"roboto", 320, false, 0, "Roboto-Light.ttf"},
+		{"Roboto", 400, true, 'a', "Roboto-Regular.ttf"},
+		{"sans-serif", 400, false, 'a', "Roboto-Regular.ttf"},
+		{"Roboto", 400, false, '→', "entypo.ttf"},
+		{"Roboto", 400, false, '中', ""},
+	} {
+		got := ""
+		if font := db.Match(c.family, c.weight, c.italic, c.r); font != nil {
+			got = filepath.Base(font.Path)
+		}
+		if got != c.want {
+			t.Errorf("Match(%q, %d, %v, %q) should be %q, but %q", c.family, c.weight, c.italic, c.r, c.want, got)
+		}
+	}
+}
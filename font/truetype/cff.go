@@ -0,0 +1,718 @@
+package truetype
+
+import (
+	"errors"
+	"math"
+)
+
+// Compact Font Format (CFF/CFF2) outlines, as found in OpenType .otf files.
+// Glyphs are stored as Type 2 charstrings which are run through a small
+// interpreter producing the same Vertex lists as glyf outlines, with cubic
+// segments (vcubic) in place of quadratic ones.
+
+// cffFont is the parsed state of a `CFF ` or `CFF2` table.
+type cffFont struct {
+	data        []byte // the CFF table
+	cff2        bool
+	gsubrs      cffIndex
+	subrs       cffIndex // local subrs of the top Private DICT (non-CID CFF)
+	charStrings cffIndex
+	fontDicts   cffIndex
+	fdSelect    []byte
+	varStore    int // offset of the ItemVariationStore in data, 0 if none
+	// cached local subrs and default vsindex of each font dict
+	fdSubrs   []cffIndex
+	fdVSIndex []int
+	coords    []float64 // normalized variation coordinates of the instance
+}
+
+// cffIndex is a CFF INDEX structure: a count followed by an offset array
+// and the object data.
+type cffIndex struct {
+	data    []byte
+	count   int
+	offSize int
+	header  int // offset of the offset array
+}
+
+// cffBuf is a bounds-checked reader over CFF data. Reads past the end
+// return zero, like stb_truetype's stbtt__buf.
+type cffBuf struct {
+	data   []byte
+	cursor int
+}
+
+func (b *cffBuf) get8() int {
+	if b.cursor >= len(b.data) || b.cursor < 0 {
+		b.cursor++
+		return 0
+	}
+	v := int(b.data[b.cursor])
+	b.cursor++
+	return v
+}
+
+func (b *cffBuf) peek8() int {
+	if b.cursor >= len(b.data) || b.cursor < 0 {
+		return 0
+	}
+	return int(b.data[b.cursor])
+}
+
+func (b *cffBuf) get(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = v<<8 | uint32(b.get8())
+	}
+	return v
+}
+
+func (b *cffBuf) skip(n int) {
+	b.cursor += n
+}
+
+func (b *cffBuf) seek(o int) {
+	b.cursor = o
+}
+
+func (b *cffBuf) done() bool {
+	return b.cursor >= len(b.data)
+}
+
+// readIndex reads an INDEX at the cursor and moves past it. CFF2 INDEXes
+// have a 32-bit count.
+func (b *cffBuf) readIndex(count32 bool) cffIndex {
+	start := b.cursor
+	idx := cffIndex{}
+	if count32 {
+		idx.count = int(b.get(4))
+	} else {
+		idx.count = int(b.get(2))
+	}
+	if idx.count == 0 || idx.count > len(b.data) {
+		idx.count = 0
+		return idx
+	}
+	idx.offSize = b.get8()
+	if idx.offSize < 1 || idx.offSize > 4 {
+		idx.count = 0
+		return idx
+	}
+	idx.header = b.cursor - start
+	b.skip(idx.offSize * idx.count)
+	b.skip(int(b.get(idx.offSize)) - 1)
+	if b.cursor > len(b.data) || b.cursor < start {
+		idx.count = 0
+		return idx
+	}
+	idx.data = b.data[start:b.cursor]
+	return idx
+}
+
+// get returns the i-th object of the INDEX, or nil when out of range.
+func (idx cffIndex) get(i int) []byte {
+	if i < 0 || i >= idx.count {
+		return nil
+	}
+	b := cffBuf{data: idx.data, cursor: idx.header + i*idx.offSize}
+	start := int(b.get(idx.offSize))
+	end := int(b.get(idx.offSize))
+	base := idx.header + (idx.count+1)*idx.offSize - 1
+	if start < 1 || end < start || base+end > len(idx.data) {
+		return nil
+	}
+	return idx.data[base+start : base+end]
+}
+
+// subr returns the subroutine n, applying the bias for the INDEX size.
+func (idx cffIndex) subr(n int) []byte {
+	bias := 107
+	if idx.count >= 33900 {
+		bias = 32768
+	} else if idx.count >= 1240 {
+		bias = 1131
+	}
+	return idx.get(n + bias)
+}
+
+// cffInt reads an integer DICT operand.
+func (b *cffBuf) cffInt() int {
+	b0 := b.get8()
+	switch {
+	case b0 >= 32 && b0 <= 246:
+		return b0 - 139
+	case b0 >= 247 && b0 <= 250:
+		return (b0-247)*256 + b.get8() + 108
+	case b0 >= 251 && b0 <= 254:
+		return -(b0-251)*256 - b.get8() - 108
+	case b0 == 28:
+		return int(int16(b.get(2)))
+	case b0 == 29:
+		return int(int32(b.get(4)))
+	}
+	return 0
+}
+
+func (b *cffBuf) skipOperand() {
+	if b.peek8() == 30 {
+		// real number, nibbles terminated by 0xf
+		b.skip(1)
+		for !b.done() {
+			v := b.get8()
+			if v&0xf == 0xf || v>>4 == 0xf {
+				break
+			}
+		}
+	} else {
+		b.cffInt()
+	}
+}
+
+// dictGet returns the operands of the DICT entry key (escaped operators
+// are 0x100|op), or nil if the DICT doesn't contain it.
+func dictGet(dict []byte, key int) []byte {
+	b := cffBuf{data: dict}
+	for !b.done() {
+		start := b.cursor
+		for !b.done() && b.peek8() >= 28 {
+			b.skipOperand()
+		}
+		end := b.cursor
+		op := b.get8()
+		if op == 12 {
+			op = b.get8() | 0x100
+		}
+		if op == key && end <= len(dict) {
+			return dict[start:end]
+		}
+	}
+	return nil
+}
+
+// dictInts reads up to len(out) integer operands of the DICT entry key.
+func dictInts(dict []byte, key int, out []int) {
+	b := cffBuf{data: dictGet(dict, key)}
+	for i := 0; i < len(out) && !b.done(); i++ {
+		out[i] = b.cffInt()
+	}
+}
+
+// parseCFF parses a `CFF ` (cff2 false) or `CFF2` table.
+func parseCFF(data []byte, cff2 bool) (*cffFont, error) {
+	cff := &cffFont{data: data, cff2: cff2}
+	b := &cffBuf{data: data}
+	var topDict []byte
+	if cff2 {
+		b.skip(2)
+		hdrSize := b.get8()
+		topSize := int(b.get(2))
+		if hdrSize+topSize > len(data) {
+			return nil, errors.New("CFF2 top DICT out of range")
+		}
+		topDict = data[hdrSize : hdrSize+topSize]
+		b.seek(hdrSize + topSize)
+		cff.gsubrs = b.readIndex(true)
+	} else {
+		b.skip(2)
+		b.seek(b.get8())
+		b.readIndex(false) // name INDEX, only the first font is used
+		topDict = b.readIndex(false).get(0)
+		b.readIndex(false) // string INDEX
+		cff.gsubrs = b.readIndex(false)
+
+		csType := []int{2}
+		dictInts(topDict, 0x100|6, csType)
+		if csType[0] != 2 {
+			return nil, errors.New("Only Type 2 charstrings are supported")
+		}
+		cff.subrs = cff.privateSubrs(topDict)
+	}
+
+	var charStrings, fdArray, fdSelect, varStore = []int{0}, []int{0}, []int{0}, []int{0}
+	dictInts(topDict, 17, charStrings)
+	dictInts(topDict, 0x100|36, fdArray)
+	dictInts(topDict, 0x100|37, fdSelect)
+	dictInts(topDict, 24, varStore)
+	if charStrings[0] == 0 {
+		return nil, errors.New("CFF CharStrings not found")
+	}
+	b.seek(charStrings[0])
+	cff.charStrings = b.readIndex(cff2)
+	if cff.charStrings.count == 0 {
+		return nil, errors.New("CFF CharStrings are empty")
+	}
+
+	if fdArray[0] != 0 {
+		b.seek(fdArray[0])
+		cff.fontDicts = b.readIndex(cff2)
+		if fdSelect[0] != 0 && fdSelect[0] < len(data) {
+			cff.fdSelect = data[fdSelect[0]:]
+		} else if !cff2 || cff.fontDicts.count > 1 {
+			return nil, errors.New("CFF FDSelect not found")
+		}
+		cff.fdSubrs = make([]cffIndex, cff.fontDicts.count)
+		cff.fdVSIndex = make([]int, cff.fontDicts.count)
+		for i := range cff.fdSubrs {
+			fd := cff.fontDicts.get(i)
+			cff.fdSubrs[i] = cff.privateSubrs(fd)
+			cff.fdVSIndex[i] = cff.privateVSIndex(fd)
+		}
+	}
+	if cff2 && varStore[0] != 0 {
+		// the ItemVariationStore is preceded by its 16-bit length
+		cff.varStore = varStore[0] + 2
+	}
+	return cff, nil
+}
+
+func (cff *cffFont) privateDict(fontDict []byte) (dict []byte, offset int) {
+	private := []int{0, 0}
+	dictInts(fontDict, 18, private)
+	size, offset := private[0], private[1]
+	if size <= 0 || offset <= 0 || offset+size > len(cff.data) {
+		return nil, 0
+	}
+	return cff.data[offset : offset+size], offset
+}
+
+// privateSubrs returns the local subrs of the Private DICT referenced by
+// fontDict.
+func (cff *cffFont) privateSubrs(fontDict []byte) cffIndex {
+	pdict, offset := cff.privateDict(fontDict)
+	subrs := []int{0}
+	dictInts(pdict, 19, subrs)
+	if subrs[0] == 0 {
+		return cffIndex{}
+	}
+	b := cffBuf{data: cff.data, cursor: offset + subrs[0]}
+	return b.readIndex(cff.cff2)
+}
+
+func (cff *cffFont) privateVSIndex(fontDict []byte) int {
+	pdict, _ := cff.privateDict(fontDict)
+	vsindex := []int{0}
+	dictInts(pdict, 22, vsindex)
+	return vsindex[0]
+}
+
+// fontDictIndex returns the font dict selected for the glyph, or -1.
+func (cff *cffFont) fontDictIndex(glyphIndex int) int {
+	if cff.fontDicts.count == 0 {
+		return -1
+	}
+	if cff.fdSelect == nil {
+		return 0
+	}
+	b := cffBuf{data: cff.fdSelect}
+	fd := -1
+	switch b.get8() {
+	case 0:
+		b.skip(glyphIndex)
+		fd = b.get8()
+	case 3, 4:
+		size := 2
+		if cff.fdSelect[0] == 4 {
+			size = 4
+		}
+		nRanges := int(b.get(size))
+		start := int(b.get(size))
+		for i := 0; i < nRanges; i++ {
+			v := int(b.get(size / 2))
+			end := int(b.get(size))
+			if glyphIndex >= start && glyphIndex < end {
+				fd = v
+				break
+			}
+			start = end
+		}
+	}
+	if fd >= cff.fontDicts.count {
+		return -1
+	}
+	return fd
+}
+
+// blendScalars returns the scalar of each region of vsindex at the
+// coordinates of the instance. At the default instance of the font every
+// region contributes nothing.
+func (cff *cffFont) blendScalars(vsindex int) []float64 {
+	if cff.varStore == 0 {
+		return nil
+	}
+	return itemVariationStore{data: cff.data, offset: cff.varStore}.regionScalars(vsindex, cff.coords)
+}
+
+// csContext collects the output of a charstring run: either the vertices
+// or, when bounds is set, only the bounding box.
+type csContext struct {
+	bounds                 bool
+	started                bool
+	firstX, firstY         float64
+	x, y                   float64
+	minX, maxX, minY, maxY int
+	vertices               []Vertex
+}
+
+func (c *csContext) trackVertex(x, y int) {
+	if x > c.maxX || !c.started {
+		c.maxX = x
+	}
+	if y > c.maxY || !c.started {
+		c.maxY = y
+	}
+	if x < c.minX || !c.started {
+		c.minX = x
+	}
+	if y < c.minY || !c.started {
+		c.minY = y
+	}
+	c.started = true
+}
+
+func (c *csContext) v(t uint8, x, y, cx, cy, cx1, cy1 int) {
+	if c.bounds {
+		c.trackVertex(x, y)
+		if t == vcubic {
+			c.trackVertex(cx, cy)
+			c.trackVertex(cx1, cy1)
+		}
+		return
+	}
+	c.vertices = append(c.vertices, Vertex{Type: t, X: x, Y: y, CX: cx, CY: cy, CX1: cx1, CY1: cy1})
+}
+
+func (c *csContext) closeShape() {
+	if c.firstX != c.x || c.firstY != c.y {
+		c.v(vline, int(c.firstX), int(c.firstY), 0, 0, 0, 0)
+	}
+}
+
+func (c *csContext) rmoveTo(dx, dy float64) {
+	c.closeShape()
+	c.x += dx
+	c.y += dy
+	c.firstX, c.firstY = c.x, c.y
+	c.v(vmove, int(c.x), int(c.y), 0, 0, 0, 0)
+}
+
+func (c *csContext) rlineTo(dx, dy float64) {
+	c.x += dx
+	c.y += dy
+	c.v(vline, int(c.x), int(c.y), 0, 0, 0, 0)
+}
+
+func (c *csContext) rcurveTo(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	cx1 := c.x + dx1
+	cy1 := c.y + dy1
+	cx2 := cx1 + dx2
+	cy2 := cy1 + dy2
+	c.x = cx2 + dx3
+	c.y = cy2 + dy3
+	c.v(vcubic, int(c.x), int(c.y), int(cx1), int(cy1), int(cx2), int(cy2))
+}
+
+const (
+	csMaxStack    = 513 // CFF2 maximum, CFF allows 48
+	csMaxSubrCall = 10
+)
+
+// run interprets the charstring of glyphIndex into c.
+func (cff *cffFont) run(glyphIndex int, c *csContext) error {
+	var s [csMaxStack]float64
+	var subrStack [csMaxSubrCall]cffBuf
+	sp, subrDepth, maskBits := 0, 0, 0
+	inHeader := true
+	subrs := cff.subrs
+	vsindex := 0
+	if fd := cff.fontDictIndex(glyphIndex); fd >= 0 {
+		subrs = cff.fdSubrs[fd]
+		vsindex = cff.fdVSIndex[fd]
+	}
+
+	data := cff.charStrings.get(glyphIndex)
+	if data == nil {
+		return errors.New("charstring not found")
+	}
+	b := cffBuf{data: data}
+	for {
+		if b.done() {
+			// CFF2 has no return/endchar: the end of a subr returns and
+			// the end of the charstring ends the glyph.
+			if !cff.cff2 {
+				return errors.New("no endchar")
+			}
+			if subrDepth == 0 {
+				c.closeShape()
+				return nil
+			}
+			subrDepth--
+			b = subrStack[subrDepth]
+			continue
+		}
+		i := 0
+		clearStack := true
+		b0 := b.get8()
+		switch b0 {
+		case 0x13, 0x14: // hintmask, cntrmask
+			if inHeader {
+				maskBits += sp / 2 // implicit vstem
+			}
+			inHeader = false
+			b.skip((maskBits + 7) / 8)
+
+		case 0x01, 0x03, 0x12, 0x17: // hstem, vstem, hstemhm, vstemhm
+			maskBits += sp / 2
+
+		case 0x15: // rmoveto
+			inHeader = false
+			if sp < 2 {
+				return errors.New("rmoveto stack")
+			}
+			c.rmoveTo(s[sp-2], s[sp-1])
+		case 0x04: // vmoveto
+			inHeader = false
+			if sp < 1 {
+				return errors.New("vmoveto stack")
+			}
+			c.rmoveTo(0, s[sp-1])
+		case 0x16: // hmoveto
+			inHeader = false
+			if sp < 1 {
+				return errors.New("hmoveto stack")
+			}
+			c.rmoveTo(s[sp-1], 0)
+
+		case 0x05: // rlineto
+			if sp < 2 {
+				return errors.New("rlineto stack")
+			}
+			for ; i+1 < sp; i += 2 {
+				c.rlineTo(s[i], s[i+1])
+			}
+
+		// hlineto/vlineto and vhcurveto/hvcurveto alternate horizontal and
+		// vertical, starting from a different place.
+		case 0x06, 0x07: // hlineto, vlineto
+			if sp < 1 {
+				return errors.New("hlineto stack")
+			}
+			horizontal := b0 == 0x06
+			for ; i < sp; i++ {
+				if horizontal {
+					c.rlineTo(s[i], 0)
+				} else {
+					c.rlineTo(0, s[i])
+				}
+				horizontal = !horizontal
+			}
+
+		case 0x1e, 0x1f: // vhcurveto, hvcurveto
+			if sp < 4 {
+				return errors.New("vhcurveto stack")
+			}
+			horizontal := b0 == 0x1f
+			for ; i+3 < sp; i += 4 {
+				last := 0.0
+				if sp-i == 5 {
+					last = s[i+4]
+				}
+				if horizontal {
+					c.rcurveTo(s[i], 0, s[i+1], s[i+2], last, s[i+3])
+				} else {
+					c.rcurveTo(0, s[i], s[i+1], s[i+2], s[i+3], last)
+				}
+				horizontal = !horizontal
+			}
+
+		case 0x08: // rrcurveto
+			if sp < 6 {
+				return errors.New("rrcurveto stack")
+			}
+			for ; i+5 < sp; i += 6 {
+				c.rcurveTo(s[i], s[i+1], s[i+2], s[i+3], s[i+4], s[i+5])
+			}
+
+		case 0x18: // rcurveline
+			if sp < 8 {
+				return errors.New("rcurveline stack")
+			}
+			for ; i+5 < sp-2; i += 6 {
+				c.rcurveTo(s[i], s[i+1], s[i+2], s[i+3], s[i+4], s[i+5])
+			}
+			if i+1 >= sp {
+				return errors.New("rcurveline stack")
+			}
+			c.rlineTo(s[i], s[i+1])
+
+		case 0x19: // rlinecurve
+			if sp < 8 {
+				return errors.New("rlinecurve stack")
+			}
+			for ; i+1 < sp-6; i += 2 {
+				c.rlineTo(s[i], s[i+1])
+			}
+			if i+5 >= sp {
+				return errors.New("rlinecurve stack")
+			}
+			c.rcurveTo(s[i], s[i+1], s[i+2], s[i+3], s[i+4], s[i+5])
+
+		case 0x1a, 0x1b: // vvcurveto, hhcurveto
+			if sp < 4 {
+				return errors.New("vvcurveto stack")
+			}
+			f := 0.0
+			if sp&1 != 0 {
+				f = s[i]
+				i++
+			}
+			for ; i+3 < sp; i += 4 {
+				if b0 == 0x1b {
+					c.rcurveTo(s[i], f, s[i+1], s[i+2], s[i+3], 0)
+				} else {
+					c.rcurveTo(f, s[i], s[i+1], s[i+2], 0, s[i+3])
+				}
+				f = 0
+			}
+
+		case 0x0a, 0x1d: // callsubr, callgsubr
+			if sp < 1 {
+				return errors.New("callsubr stack")
+			}
+			sp--
+			v := int(s[sp])
+			if subrDepth >= csMaxSubrCall {
+				return errors.New("subr recursion limit")
+			}
+			subrStack[subrDepth] = b
+			subrDepth++
+			var subr []byte
+			if b0 == 0x0a {
+				subr = subrs.subr(v)
+			} else {
+				subr = cff.gsubrs.subr(v)
+			}
+			if len(subr) == 0 {
+				return errors.New("subr not found")
+			}
+			b = cffBuf{data: subr}
+			clearStack = false
+
+		case 0x0b: // return
+			if subrDepth <= 0 {
+				return errors.New("return outside subr")
+			}
+			subrDepth--
+			b = subrStack[subrDepth]
+			clearStack = false
+
+		case 0x0e: // endchar
+			c.closeShape()
+			return nil
+
+		case 0x0f: // vsindex (CFF2)
+			if sp < 1 {
+				return errors.New("vsindex stack")
+			}
+			vsindex = int(s[sp-1])
+
+		case 0x10: // blend (CFF2)
+			if sp < 1 {
+				return errors.New("blend stack")
+			}
+			scalars := cff.blendScalars(vsindex)
+			n := int(s[sp-1])
+			k := len(scalars)
+			base := sp - 1 - n*(k+1)
+			if n < 0 || base < 0 {
+				return errors.New("blend stack")
+			}
+			for j := 0; j < n; j++ {
+				for r, scalar := range scalars {
+					s[base+j] += scalar * s[base+n+j*k+r]
+				}
+			}
+			sp = base + n
+			clearStack = false
+
+		case 0x0c: // two-byte escape
+			// the flex implementations ignore the flex depth and always
+			// draw curves.
+			switch b.get8() {
+			case 0x22: // hflex
+				if sp < 7 {
+					return errors.New("hflex stack")
+				}
+				c.rcurveTo(s[0], 0, s[1], s[2], s[3], 0)
+				c.rcurveTo(s[4], 0, s[5], -s[2], s[6], 0)
+			case 0x23: // flex
+				if sp < 13 {
+					return errors.New("flex stack")
+				}
+				c.rcurveTo(s[0], s[1], s[2], s[3], s[4], s[5])
+				c.rcurveTo(s[6], s[7], s[8], s[9], s[10], s[11])
+			case 0x24: // hflex1
+				if sp < 9 {
+					return errors.New("hflex1 stack")
+				}
+				c.rcurveTo(s[0], s[1], s[2], s[3], s[4], 0)
+				c.rcurveTo(s[5], 0, s[6], s[7], s[8], -(s[1] + s[3] + s[7]))
+			case 0x25: // flex1
+				if sp < 11 {
+					return errors.New("flex1 stack")
+				}
+				dx := s[0] + s[2] + s[4] + s[6] + s[8]
+				dy := s[1] + s[3] + s[5] + s[7] + s[9]
+				dx6, dy6 := s[10], s[10]
+				if math.Abs(dx) > math.Abs(dy) {
+					dy6 = -dy
+				} else {
+					dx6 = -dx
+				}
+				c.rcurveTo(s[0], s[1], s[2], s[3], s[4], s[5])
+				c.rcurveTo(s[6], s[7], s[8], s[9], dx6, dy6)
+			default:
+				return errors.New("unimplemented charstring operator")
+			}
+
+		default:
+			if b0 != 255 && b0 != 28 && b0 < 32 {
+				return errors.New("reserved charstring operator")
+			}
+			var f float64
+			if b0 == 255 {
+				f = float64(int32(b.get(4))) / 0x10000
+			} else {
+				b.skip(-1)
+				f = float64(int16(b.cffInt()))
+			}
+			if sp >= csMaxStack {
+				return errors.New("charstring stack overflow")
+			}
+			s[sp] = f
+			sp++
+			clearStack = false
+		}
+		if clearStack {
+			sp = 0
+		}
+	}
+}
+
+// glyphShape returns the outline of the glyph, nil if it is empty or invalid.
+func (cff *cffFont) glyphShape(glyphIndex int) []Vertex {
+	c := &csContext{}
+	if cff.run(glyphIndex, c) != nil {
+		return nil
+	}
+	return c.vertices
+}
+
+// glyphBox returns the bounding box of the glyph's outline, including
+// the curve control points.
+func (cff *cffFont) glyphBox(glyphIndex int) (result bool, x0, y0, x1, y1 int) {
+	c := &csContext{bounds: true}
+	if cff.run(glyphIndex, c) != nil || !c.started {
+		return false, 0, 0, 0, 0
+	}
+	return true, c.minX, c.minY, c.maxX, c.maxY
+}
@@ -0,0 +1,253 @@
+package truetype
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+)
+
+// ColorLayer is a layer of a color glyph of the COLR table. Layers are drawn
+// from the bottom up, every one is the outline of a glyph filled with a color.
+type ColorLayer struct {
+	Glyph      int
+	R, G, B, A uint8 // color of the layer from the first palette of CPAL, not premultiplied
+	Foreground bool  // the layer has the color of the text instead
+}
+
+// GlyphBitmap is a color bitmap glyph of the CBDT or sbix table.
+type GlyphBitmap struct {
+	Image image.Image
+	PPEM  int // pixels per em of the strike of the bitmap
+	X, Y  int // top left corner of the bitmap from the glyph origin in pixels of the strike, y grows up
+}
+
+// HasColorGlyphs returns whether the font has COLR layers or color bitmaps.
+func (font *FontInfo) HasColorGlyphs() bool {
+	return (font.colr != 0 && font.cpal != 0) || (font.cblc != 0 && font.cbdt != 0) || font.sbix != 0
+}
+
+// GetGlyphLayers returns the COLR layers of the glyph, or nil if the glyph has no layers.
+func (font *FontInfo) GetGlyphLayers(glyph int) []ColorLayer {
+	data := font.data
+	if font.colr == 0 || font.cpal == 0 {
+		return nil
+	}
+	numBaseGlyphs := int(u16(data, font.colr+2))
+	baseGlyphs := font.colr + int(u32(data, font.colr+4))
+	layers := font.colr + int(u32(data, font.colr+8))
+	numLayers := int(u16(data, font.colr+12))
+
+	// base glyph records are sorted by glyph
+	low, high := 0, numBaseGlyphs
+	for low < high {
+		mid := (low + high) / 2
+		record := baseGlyphs + mid*6
+		g := int(u16(data, record))
+		if g < glyph {
+			low = mid + 1
+		} else if g > glyph {
+			high = mid
+		} else {
+			first := int(u16(data, record+2))
+			count := int(u16(data, record+4))
+			if first+count > numLayers {
+				return nil
+			}
+			result := make([]ColorLayer, count)
+			for i := range result {
+				layer := layers + (first+i)*4
+				result[i] = font.paletteColor(int(u16(data, layer+2)))
+				result[i].Glyph = int(u16(data, layer))
+			}
+			return result
+		}
+	}
+	return nil
+}
+
+// paletteColor returns the color of the entry of the first palette of CPAL.
+func (font *FontInfo) paletteColor(entry int) ColorLayer {
+	data := font.data
+	if entry == 0xFFFF || entry >= int(u16(data, font.cpal+2)) {
+		return ColorLayer{Foreground: true}
+	}
+	records := font.cpal + int(u32(data, font.cpal+8))
+	record := records + (int(u16(data, font.cpal+12))+entry)*4
+	// color records are BGRA
+	return ColorLayer{R: data[record+2], G: data[record+1], B: data[record], A: data[record+3]}
+}
+
+// GetGlyphBitmap returns the color bitmap of the glyph from the strike which fits ppem best,
+// the smallest one which isn't smaller, or the largest one. It returns nil if the glyph has no
+// bitmap or its PNG can't be decoded.
+func (font *FontInfo) GetGlyphBitmap(glyph, ppem int) *GlyphBitmap {
+	if font.cblc != 0 && font.cbdt != 0 {
+		if bitmap := font.cbdtBitmap(glyph, ppem); bitmap != nil {
+			return bitmap
+		}
+	}
+	if font.sbix != 0 {
+		return font.sbixBitmap(glyph, ppem)
+	}
+	return nil
+}
+
+// bestStrike returns the index of the strike of ppems which fits ppem best.
+func bestStrike(ppems []int, ppem int) int {
+	best := -1
+	for i, p := range ppems {
+		if best < 0 {
+			best = i
+		} else if b := ppems[best]; (b < ppem && p > b) || (p >= ppem && p < b) {
+			best = i
+		}
+	}
+	return best
+}
+
+// cbdtBitmap returns the PNG bitmap of the glyph from the CBLC and CBDT tables.
+func (font *FontInfo) cbdtBitmap(glyph, ppem int) *GlyphBitmap {
+	data := font.data
+	numSizes := int(u32(data, font.cblc+4))
+	var ppems, sizes []int
+	for i := 0; i < numSizes; i++ {
+		size := font.cblc + 8 + i*48
+		if glyph >= int(u16(data, size+40)) && glyph <= int(u16(data, size+42)) {
+			ppems = append(ppems, int(data[size+45]))
+			sizes = append(sizes, size)
+		}
+	}
+	best := bestStrike(ppems, ppem)
+	if best < 0 {
+		return nil
+	}
+	size := sizes[best]
+	subtables := font.cblc + int(u32(data, size))
+	numSubtables := int(u32(data, size+8))
+	for i := 0; i < numSubtables; i++ {
+		entry := subtables + i*8
+		first := int(u16(data, entry))
+		last := int(u16(data, entry+2))
+		if glyph < first || glyph > last {
+			continue
+		}
+		subtable := subtables + int(u32(data, entry+4))
+		imageFormat := int(u16(data, subtable+2))
+		imageData := font.cbdt + int(u32(data, subtable+4))
+		var offset, metrics int
+		switch u16(data, subtable) {
+		case 1:
+			offset = imageData + int(u32(data, subtable+8+(glyph-first)*4))
+		case 2:
+			offset = imageData + int(u32(data, subtable+8))*(glyph-first)
+			metrics = subtable + 12
+		case 3:
+			offset = imageData + int(u16(data, subtable+8+(glyph-first)*2))
+		case 4, 5:
+			format := u16(data, subtable)
+			pairs := subtable + 12
+			if format == 5 {
+				pairs = subtable + 24
+				metrics = subtable + 12
+			}
+			numGlyphs := int(u32(data, pairs-4))
+			found := false
+			for j := 0; j < numGlyphs && !found; j++ {
+				if format == 4 && int(u16(data, subtable+12+j*4)) == glyph {
+					offset = imageData + int(u16(data, subtable+14+j*4))
+					found = true
+				} else if format == 5 && int(u16(data, pairs+j*2)) == glyph {
+					offset = imageData + int(u32(data, subtable+8))*j
+					found = true
+				}
+			}
+			if !found {
+				return nil
+			}
+		default:
+			return nil
+		}
+		bitmap := &GlyphBitmap{PPEM: ppems[best]}
+		switch imageFormat {
+		case 17:
+			metrics = offset
+			offset += 5
+		case 18:
+			metrics = offset
+			offset += 8
+		case 19:
+			if metrics == 0 {
+				return nil
+			}
+		default:
+			return nil
+		}
+		// small and big glyph metrics start with height, width, bearingX and bearingY
+		bitmap.X = int(int8(data[metrics+2]))
+		bitmap.Y = int(int8(data[metrics+3]))
+		length := int(u32(data, offset))
+		if offset+4+length > len(data) {
+			return nil
+		}
+		img, err := png.Decode(bytes.NewReader(data[offset+4 : offset+4+length]))
+		if err != nil {
+			return nil
+		}
+		bitmap.Image = img
+		return bitmap
+	}
+	return nil
+}
+
+// sbixBitmap returns the PNG bitmap of the glyph from the sbix table.
+func (font *FontInfo) sbixBitmap(glyph, ppem int) *GlyphBitmap {
+	data := font.data
+	if glyph >= font.numGlyphs {
+		return nil
+	}
+	numStrikes := int(u32(data, font.sbix+4))
+	var ppems, strikes []int
+	for i := 0; i < numStrikes; i++ {
+		strike := font.sbix + int(u32(data, font.sbix+8+i*4))
+		// strikes without data for the glyph don't count
+		if u32(data, strike+4+glyph*4) != u32(data, strike+8+glyph*4) {
+			ppems = append(ppems, int(u16(data, strike)))
+			strikes = append(strikes, strike)
+		}
+	}
+	best := bestStrike(ppems, ppem)
+	if best < 0 {
+		return nil
+	}
+	strike := strikes[best]
+	// a dupe glyph refers to the data of another glyph of the strike
+	for dupes := 0; dupes < 4; dupes++ {
+		start := strike + int(u32(data, strike+4+glyph*4))
+		end := strike + int(u32(data, strike+8+glyph*4))
+		if end-start < 8 || end > len(data) {
+			return nil
+		}
+		switch string(data[start+4 : start+8]) {
+		case "dupe":
+			glyph = int(u16(data, start+8))
+			if glyph >= font.numGlyphs {
+				return nil
+			}
+			continue
+		case "png ":
+			img, err := png.Decode(bytes.NewReader(data[start+8 : end]))
+			if err != nil {
+				return nil
+			}
+			// the origin offset is the bottom left corner of the bitmap
+			return &GlyphBitmap{
+				Image: img,
+				PPEM:  ppems[best],
+				X:     int(int16(u16(data, start))),
+				Y:     int(int16(u16(data, start+2))) + img.Bounds().Dy(),
+			}
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package truetype
+
+import (
+	"math"
+	"sort"
+)
+
+// hintEdge is a horizontal edge of an outline found by HintGlyphShape.
+type hintEdge struct {
+	y       int
+	weight  float64 // signed length of the horizontal segments, positive for top edges
+	target  float64 // fitted position in font units
+	snapped bool
+	partner int // index of the other edge of a stem, -1 if the edge isn't part of one
+}
+
+func (e *hintEdge) top() bool {
+	return e.weight > 0
+}
+
+// HintGlyphShape fits the horizontal edges of the outline to the pixel grid of
+// scale pixels per font unit, which makes small text crisper. It is a light
+// autohinter: only vertical positions move, so advances and subpixel positions
+// are kept. Edges near the baseline, the x-height and the cap height are
+// aligned to those zones, the others are rounded, and the width of horizontal
+// stems is rounded to at least one pixel. The points between edges are
+// interpolated. The vertices aren't modified, a hinted copy is returned.
+func (font *FontInfo) HintGlyphShape(vertices []Vertex, scale float64) []Vertex {
+	edges := findHintEdges(vertices, scale)
+	if len(edges) == 0 {
+		return vertices
+	}
+	em := float64(font.GetUnitsPerEm())
+	xHeight, capHeight := font.GetFontXHeights()
+	fuzz := int(em * 0.03)
+	fit := func(y float64) float64 {
+		return math.Floor(y*scale+0.5) / scale
+	}
+	stemWidth := func(width int) float64 {
+		return math.Max(1, math.Floor(float64(width)*scale+0.5)) / scale
+	}
+	snap := func(i int, target float64) {
+		edge := &edges[i]
+		edge.target = target
+		edge.snapped = true
+		if p := edge.partner; p >= 0 && !edges[p].snapped {
+			if edges[p].y > edge.y {
+				edges[p].target = target + stemWidth(edges[p].y-edge.y)
+			} else {
+				edges[p].target = target - stemWidth(edge.y-edges[p].y)
+			}
+			edges[p].snapped = true
+		}
+	}
+
+	// stems pair bottom edges with the nearest top edges above them
+	for i := range edges {
+		edges[i].partner = -1
+	}
+	maxStem := int(em * 0.3)
+	for i := range edges {
+		if edges[i].top() {
+			continue
+		}
+		for j := i + 1; j < len(edges) && edges[j].y-edges[i].y <= maxStem; j++ {
+			if edges[j].top() {
+				if edges[j].partner < 0 {
+					edges[i].partner = j
+					edges[j].partner = i
+				}
+				break
+			}
+		}
+	}
+	// the zones first, overshoots are flattened at small sizes
+	for i := range edges {
+		edge := &edges[i]
+		if edge.snapped {
+			continue
+		}
+		if !edge.top() && absInt(edge.y) <= fuzz {
+			snap(i, 0)
+		} else if edge.top() && absInt(edge.y-xHeight) <= fuzz {
+			snap(i, fit(float64(xHeight)))
+		} else if edge.top() && absInt(edge.y-capHeight) <= fuzz {
+			snap(i, fit(float64(capHeight)))
+		}
+	}
+	for i := range edges {
+		if !edges[i].snapped {
+			snap(i, fit(float64(edges[i].y)))
+		}
+	}
+	// the order of the edges is kept
+	for i := 1; i < len(edges); i++ {
+		edges[i].target = math.Max(edges[i].target, edges[i-1].target)
+	}
+
+	hinted := make([]Vertex, len(vertices))
+	for i, v := range vertices {
+		v.Y = hintY(edges, v.Y)
+		v.CY = hintY(edges, v.CY)
+		v.CY1 = hintY(edges, v.CY1)
+		hinted[i] = v
+	}
+	return hinted
+}
+
+// findHintEdges returns the horizontal edges of the outline sorted by their
+// position. Straight segments at least half a pixel long and extrema of curves
+// make edges, whose weight tells on which side the outline is filled.
+func findHintEdges(vertices []Vertex, scale float64) []hintEdge {
+	// outer contours are clockwise in TrueType and counterclockwise in CFF
+	var area float64
+	var x, y, startX, startY int
+	for _, v := range vertices {
+		if v.Type == vmove {
+			area += float64(x-startX) * float64(y+startY)
+			startX, startY = v.X, v.Y
+		} else {
+			area += float64(v.X-x) * float64(v.Y+y)
+		}
+		x, y = v.X, v.Y
+	}
+	area += float64(x-startX) * float64(y+startY)
+	// the sum is positive for clockwise contours
+	sign := 1.0
+	if area < 0 {
+		sign = -1
+	}
+
+	weights := make(map[int]float64)
+	horizontal := func(dx, dy int) bool {
+		return dx != 0 && absInt(dy)*20 <= absInt(dx)
+	}
+	x, y = 0, 0
+	for _, v := range vertices {
+		switch v.Type {
+		case vline:
+			if horizontal(v.X-x, v.Y-y) && float64(absInt(v.X-x))*scale >= 0.5 {
+				weights[(y+v.Y)/2] += sign * float64(v.X-x)
+			}
+		case vcurve:
+			if horizontal(v.CX-x, v.CY-y) {
+				weights[y] += sign * float64(v.CX-x)
+			}
+			if horizontal(v.X-v.CX, v.Y-v.CY) {
+				weights[v.Y] += sign * float64(v.X-v.CX)
+			}
+		case vcubic:
+			if horizontal(v.CX-x, v.CY-y) {
+				weights[y] += sign * float64(v.CX-x)
+			}
+			if horizontal(v.X-v.CX1, v.Y-v.CY1) {
+				weights[v.Y] += sign * float64(v.X-v.CX1)
+			}
+		}
+		x, y = v.X, v.Y
+	}
+	edges := make([]hintEdge, 0, len(weights))
+	for y, weight := range weights {
+		if weight != 0 {
+			edges = append(edges, hintEdge{y: y, weight: weight})
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].y < edges[j].y
+	})
+	return edges
+}
+
+// hintY moves the coordinate with the edges, interpolating between them.
+func hintY(edges []hintEdge, y int) int {
+	i := sort.Search(len(edges), func(i int) bool {
+		return edges[i].y >= y
+	})
+	var fitted float64
+	switch {
+	case i == len(edges):
+		last := &edges[i-1]
+		fitted = float64(y) + last.target - float64(last.y)
+	case edges[i].y == y || i == 0:
+		fitted = float64(y) + edges[i].target - float64(edges[i].y)
+	default:
+		a, b := &edges[i-1], &edges[i]
+		t := float64(y-a.y) / float64(b.y-a.y)
+		fitted = a.target + (b.target-a.target)*t
+	}
+	return int(math.Floor(fitted + 0.5))
+}
+
+// GetShapeBitmapBox returns the box of the pixels covered by the vertices, including
+// their control points, like GetGlyphBitmapBoxSubpixel.
+func GetShapeBitmapBox(vertices []Vertex, scaleX, scaleY, shiftX, shiftY float64) (ix0, iy0, ix1, iy1 int) {
+	if len(vertices) == 0 {
+		return
+	}
+	x0, y0, x1, y1 := shapeBox(vertices)
+	ix0 = int(math.Floor(float64(x0)*scaleX + shiftX))
+	iy0 = -int(math.Ceil(float64(y1)*scaleY + shiftY))
+	ix1 = int(math.Ceil(float64(x1)*scaleX + shiftX))
+	iy1 = -int(math.Floor(float64(y0)*scaleY + shiftY))
+	return
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,1022 @@
+package truetype
+
+import (
+	"sort"
+)
+
+// OpenType layout tables (GSUB, GPOS and GDEF).
+//
+// Substitute and Position apply the lookups of a set of features to a run of
+// glyphs, the way a shaper does: lookups run in lookup list order, and each
+// lookup only applies to the glyphs whose Mask intersects the mask of its
+// features. Supported are single, multiple, ligature and (chained) context
+// substitutions, and single, pair, mark and (chained) context positioning.
+// Cursive attachment, alternate and reverse chaining substitutions and device
+// tables are not supported.
+
+const (
+	gsubSingle         = 1
+	gsubMultiple       = 2
+	gsubLigature       = 4
+	gsubContext        = 5
+	gsubChainContext   = 6
+	gsubExtension      = 7
+	gposSingle         = 1
+	gposPairAdjustment = 2
+	gposMarkToBase     = 4
+	gposMarkToLigature = 5
+	gposMarkToMark     = 6
+	gposContext        = 7
+	gposChainContext   = 8
+	gposExtension      = 9
+
+	valueFormatXPlacement = 0x0001
+	valueFormatYPlacement = 0x0002
+	valueFormatXAdvance   = 0x0004
+	valueFormatYAdvance   = 0x0008
+
+	lookupIgnoreBaseGlyphs    = 0x0002
+	lookupIgnoreLigatures     = 0x0004
+	lookupIgnoreMarks         = 0x0008
+	lookupUseMarkFilteringSet = 0x0010
+	lookupMarkAttachmentType  = 0xFF00
+
+	glyphClassBase      = 1
+	glyphClassLigature  = 2
+	glyphClassMark      = 3
+	maxLayoutNesting    = 8
+	maxLayoutBufferSize = 4096
+)
+
+// LayoutGlyph is a glyph of a run of text being shaped by Substitute and Position.
+type LayoutGlyph struct {
+	Index   int    // glyph index
+	Cluster int    // index of the first character of the cluster the glyph belongs to
+	Mask    uint32 // features which apply to the glyph, see LayoutFeature
+	Info    uint16 // left to the caller, ligatures keep the one of the first component
+
+	// Positioning adjustments in font units.
+	XAdvance, XOffset, YOffset int
+
+	attach           int // index+1 of the glyph a mark is attached to
+	attachX, attachY int // offset of the mark from the glyph it is attached to
+}
+
+// LayoutFeature selects the feature with the tag for the glyphs whose Mask
+// intersects Mask.
+type LayoutFeature struct {
+	Tag  string
+	Mask uint32
+}
+
+func (font *FontInfo) initLayout() {
+	font.kernLookups = nil
+	for _, ref := range font.featureLookups(font.gpos, nil, []LayoutFeature{{"kern", 1}}) {
+		font.kernLookups = append(font.kernLookups, ref.offset)
+	}
+}
+
+// HasPositioning returns true if the font has a GPOS table. Kerning of such
+// fonts is applied by Position.
+func (font *FontInfo) HasPositioning() bool {
+	return font.gpos != 0
+}
+
+// HasScriptSubstitutions returns true if the GSUB table lists the OpenType
+// script tag. Shapers fall back to other means for scripts the font doesn't
+// cover.
+func (font *FontInfo) HasScriptSubstitutions(script string) bool {
+	if font.gsub == 0 {
+		return false
+	}
+	data := font.data
+	scriptList := font.gsub + int(u16(data, font.gsub+4))
+	for i := 0; i < int(u16(data, scriptList)); i++ {
+		record := scriptList + 2 + 6*i
+		if string(data[record:record+4]) == script {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSubstitutions returns true if the font has a GSUB table.
+func (font *FontInfo) HasSubstitutions() bool {
+	return font.gsub != 0
+}
+
+// IsMarkGlyph returns true if GDEF classifies the glyph as a mark.
+func (font *FontInfo) IsMarkGlyph(glyph int) bool {
+	return font.gdefClass(glyph) == glyphClassMark
+}
+
+// Substitute applies the GSUB lookups of the features to the glyphs. The
+// scripts are OpenType script tags in order of preference, DFLT and latn are
+// tried after them. The returned slice replaces glyphs.
+func (font *FontInfo) Substitute(glyphs []LayoutGlyph, scripts []string, features []LayoutFeature) []LayoutGlyph {
+	if font.gsub == 0 {
+		return glyphs
+	}
+	a := &layoutApplier{font: font, table: font.gsub, glyphs: glyphs}
+	a.applyFeatures(scripts, features)
+	return a.glyphs
+}
+
+// Position applies the GPOS lookups of the features to the glyphs. Advances
+// of marks are zeroed, and attached marks are placed relative to the glyphs
+// they are attached to. The glyphs of right to left text are in logical
+// order, and are placed for being displayed in reverse order.
+func (font *FontInfo) Position(glyphs []LayoutGlyph, scripts []string, features []LayoutFeature, rtl bool) {
+	if font.gpos == 0 {
+		return
+	}
+	a := &layoutApplier{font: font, table: font.gpos, gpos: true, glyphs: glyphs}
+	a.applyFeatures(scripts, features)
+
+	for i := range glyphs {
+		if font.IsMarkGlyph(glyphs[i].Index) {
+			advance, _ := font.GetGlyphHMetrics(glyphs[i].Index)
+			glyphs[i].XAdvance = -advance
+		}
+	}
+	for i := range glyphs {
+		g := &glyphs[i]
+		if g.attach == 0 {
+			continue
+		}
+		base := g.attach - 1
+		pen := 0
+		for j := base; j < i; j++ {
+			if rtl {
+				advance, _ := font.GetGlyphHMetrics(glyphs[j+1].Index)
+				pen -= advance + glyphs[j+1].XAdvance
+			} else {
+				advance, _ := font.GetGlyphHMetrics(glyphs[j].Index)
+				pen += advance + glyphs[j].XAdvance
+			}
+		}
+		g.XOffset = glyphs[base].XOffset + g.attachX - pen
+		g.YOffset = glyphs[base].YOffset + g.attachY
+	}
+}
+
+// lookupRef is a lookup selected by features.
+type lookupRef struct {
+	index  int
+	offset int
+	mask   uint32
+}
+
+// findLangSys returns the default language system of the first of the
+// scripts the table has, 0 if it has none of them, or -1 if the table has no
+// scripts at all.
+func (font *FontInfo) findLangSys(table int, scripts []string) int {
+	data := font.data
+	scriptList := table + int(u16(data, table+4))
+	count := int(u16(data, scriptList))
+	if count == 0 {
+		return -1
+	}
+	for _, tag := range append(append([]string(nil), scripts...), "DFLT", "latn") {
+		for i := 0; i < count; i++ {
+			record := scriptList + 2 + 6*i
+			if string(data[record:record+4]) != tag {
+				continue
+			}
+			script := scriptList + int(u16(data, record+4))
+			if langSys := int(u16(data, script)); langSys != 0 {
+				return script + langSys
+			}
+			if u16(data, script+2) > 0 {
+				return script + int(u16(data, script+8))
+			}
+		}
+	}
+	return 0
+}
+
+// featureLookups returns the lookups of the features for the scripts in
+// lookup list order. Without a script list, features of any script are used.
+func (font *FontInfo) featureLookups(table int, scripts []string, features []LayoutFeature) []lookupRef {
+	if table == 0 {
+		return nil
+	}
+	data := font.data
+	featureList := table + int(u16(data, table+6))
+	lookupList := table + int(u16(data, table+8))
+	lookupCount := int(u16(data, lookupList))
+
+	var featureIndexes []int
+	var requiredFeature = -1
+	langSys := font.findLangSys(table, scripts)
+	switch {
+	case langSys < 0:
+		for i := 0; i < int(u16(data, featureList)); i++ {
+			featureIndexes = append(featureIndexes, i)
+		}
+	case langSys > 0:
+		if required := u16(data, langSys+2); required != 0xFFFF {
+			requiredFeature = int(required)
+			featureIndexes = append(featureIndexes, requiredFeature)
+		}
+		for i := 0; i < int(u16(data, langSys+4)); i++ {
+			featureIndexes = append(featureIndexes, int(u16(data, langSys+6+2*i)))
+		}
+	}
+
+	masks := make(map[int]uint32)
+	numFeatures := int(u16(data, featureList))
+	for _, index := range featureIndexes {
+		if index >= numFeatures {
+			continue
+		}
+		record := featureList + 2 + 6*index
+		tag := string(data[record : record+4])
+		var mask uint32
+		if index == requiredFeature {
+			mask = ^uint32(0)
+		}
+		for _, f := range features {
+			if f.Tag == tag {
+				mask |= f.Mask
+			}
+		}
+		if mask == 0 {
+			continue
+		}
+		feature := featureList + int(u16(data, record+4))
+		for j := 0; j < int(u16(data, feature+2)); j++ {
+			if lookup := int(u16(data, feature+4+2*j)); lookup < lookupCount {
+				masks[lookup] |= mask
+			}
+		}
+	}
+
+	refs := make([]lookupRef, 0, len(masks))
+	for index, mask := range masks {
+		refs = append(refs, lookupRef{
+			index:  index,
+			offset: lookupList + int(u16(data, lookupList+2+2*index)),
+			mask:   mask,
+		})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].index < refs[j].index })
+	return refs
+}
+
+// gdefClass returns the GDEF glyph class of the glyph, 0 if unknown.
+func (font *FontInfo) gdefClass(glyph int) int {
+	if font.gdef == 0 {
+		return 0
+	}
+	classDef := int(u16(font.data, font.gdef+4))
+	if classDef == 0 {
+		return 0
+	}
+	return font.glyphClass(font.gdef+classDef, glyph)
+}
+
+// markAttachClass returns the GDEF mark attachment class of the glyph.
+func (font *FontInfo) markAttachClass(glyph int) int {
+	if font.gdef == 0 {
+		return 0
+	}
+	classDef := int(u16(font.data, font.gdef+10))
+	if classDef == 0 {
+		return 0
+	}
+	return font.glyphClass(font.gdef+classDef, glyph)
+}
+
+// markGlyphSet returns the coverage table of the GDEF mark glyph set, 0 if
+// there is no such set.
+func (font *FontInfo) markGlyphSet(set int) int {
+	if font.gdef == 0 || u16(font.data, font.gdef+2) < 2 {
+		return 0
+	}
+	sets := int(u16(font.data, font.gdef+12))
+	if sets == 0 || set >= int(u16(font.data, font.gdef+sets+2)) {
+		return 0
+	}
+	return font.gdef + sets + int(u32(font.data, font.gdef+sets+4+4*set))
+}
+
+// layoutLookup is a parsed lookup table.
+type layoutLookup struct {
+	offset     int
+	lookupType int
+	flag       int
+	markSet    int // coverage of the mark filtering set
+	mask       uint32
+}
+
+// layoutApplier applies lookups of a GSUB or GPOS table to a glyph run.
+type layoutApplier struct {
+	font   *FontInfo
+	table  int
+	gpos   bool
+	glyphs []LayoutGlyph
+	depth  int
+}
+
+func (a *layoutApplier) applyFeatures(scripts []string, features []LayoutFeature) {
+	for _, ref := range a.font.featureLookups(a.table, scripts, features) {
+		lookup := a.lookup(ref.offset)
+		lookup.mask = ref.mask
+		for i := 0; i < len(a.glyphs); {
+			g := &a.glyphs[i]
+			if g.Mask&lookup.mask == 0 || a.skip(lookup, i) {
+				i++
+				continue
+			}
+			if next, ok := a.applyAt(lookup, i); ok && next > i {
+				i = next
+			} else {
+				i++
+			}
+		}
+	}
+}
+
+func (a *layoutApplier) lookup(offset int) layoutLookup {
+	data := a.font.data
+	lookup := layoutLookup{
+		offset:     offset,
+		lookupType: int(u16(data, offset)),
+		flag:       int(u16(data, offset+2)),
+		mask:       ^uint32(0),
+	}
+	if lookup.flag&lookupUseMarkFilteringSet != 0 {
+		count := int(u16(data, offset+4))
+		lookup.markSet = a.font.markGlyphSet(int(u16(data, offset+6+2*count)))
+	}
+	return lookup
+}
+
+// lookupByIndex returns the lookup at the index of the lookup list.
+func (a *layoutApplier) lookupByIndex(index int) (layoutLookup, bool) {
+	data := a.font.data
+	lookupList := a.table + int(u16(data, a.table+8))
+	if index >= int(u16(data, lookupList)) {
+		return layoutLookup{}, false
+	}
+	return a.lookup(lookupList + int(u16(data, lookupList+2+2*index))), true
+}
+
+// skip returns true if the lookup flags ignore the glyph at i.
+func (a *layoutApplier) skip(lookup layoutLookup, i int) bool {
+	glyph := a.glyphs[i].Index
+	switch a.font.gdefClass(glyph) {
+	case glyphClassBase:
+		return lookup.flag&lookupIgnoreBaseGlyphs != 0
+	case glyphClassLigature:
+		return lookup.flag&lookupIgnoreLigatures != 0
+	case glyphClassMark:
+		if lookup.flag&lookupIgnoreMarks != 0 {
+			return true
+		}
+		if lookup.flag&lookupUseMarkFilteringSet != 0 {
+			return lookup.markSet == 0 || a.font.coverageIndex(lookup.markSet, glyph) < 0
+		}
+		if attachType := lookup.flag & lookupMarkAttachmentType >> 8; attachType != 0 {
+			return a.font.markAttachClass(glyph) != attachType
+		}
+	}
+	return false
+}
+
+// nextIndex returns the index of the next glyph after i the lookup doesn't skip, -1 if none.
+func (a *layoutApplier) nextIndex(lookup layoutLookup, i int) int {
+	for j := i + 1; j < len(a.glyphs); j++ {
+		if !a.skip(lookup, j) {
+			return j
+		}
+	}
+	return -1
+}
+
+// prevIndex returns the index of the previous glyph before i the lookup doesn't skip, -1 if none.
+func (a *layoutApplier) prevIndex(lookup layoutLookup, i int) int {
+	for j := i - 1; j >= 0; j-- {
+		if !a.skip(lookup, j) {
+			return j
+		}
+	}
+	return -1
+}
+
+// applyAt applies the first subtable of the lookup which matches at the glyph i.
+// It returns the index of the glyph to continue with.
+func (a *layoutApplier) applyAt(lookup layoutLookup, i int) (next int, ok bool) {
+	data := a.font.data
+	extension := gsubExtension
+	if a.gpos {
+		extension = gposExtension
+	}
+	count := int(u16(data, lookup.offset+4))
+	for s := 0; s < count; s++ {
+		subtable := lookup.offset + int(u16(data, lookup.offset+6+2*s))
+		lookupType := lookup.lookupType
+		if lookupType == extension {
+			lookupType = int(u16(data, subtable+2))
+			subtable += int(u32(data, subtable+4))
+		}
+		if a.gpos {
+			next, ok = a.applyGPOS(lookup, lookupType, subtable, i)
+		} else {
+			next, ok = a.applyGSUB(lookup, lookupType, subtable, i)
+		}
+		if ok {
+			return next, true
+		}
+	}
+	return i + 1, false
+}
+
+func (a *layoutApplier) applyGSUB(lookup layoutLookup, lookupType, subtable, i int) (int, bool) {
+	data := a.font.data
+	glyph := a.glyphs[i].Index
+	switch lookupType {
+	case gsubSingle:
+		coverage := a.font.coverageIndex(subtable+int(u16(data, subtable+2)), glyph)
+		if coverage < 0 {
+			return 0, false
+		}
+		switch u16(data, subtable) {
+		case 1:
+			a.glyphs[i].Index = (glyph + int(int16(u16(data, subtable+4)))) & 0xFFFF
+			return i + 1, true
+		case 2:
+			if coverage < int(u16(data, subtable+4)) {
+				a.glyphs[i].Index = int(u16(data, subtable+6+2*coverage))
+				return i + 1, true
+			}
+		}
+	case gsubMultiple:
+		coverage := a.font.coverageIndex(subtable+int(u16(data, subtable+2)), glyph)
+		if coverage < 0 || coverage >= int(u16(data, subtable+4)) {
+			return 0, false
+		}
+		sequence := subtable + int(u16(data, subtable+6+2*coverage))
+		count := int(u16(data, sequence))
+		if count == 0 || len(a.glyphs)+count > maxLayoutBufferSize {
+			return 0, false
+		}
+		replacement := make([]LayoutGlyph, count)
+		for k := range replacement {
+			replacement[k] = a.glyphs[i]
+			replacement[k].Index = int(u16(data, sequence+2+2*k))
+		}
+		a.glyphs = append(a.glyphs[:i], append(replacement, a.glyphs[i+1:]...)...)
+		return i + count, true
+	case gsubLigature:
+		return a.applyLigature(lookup, subtable, i)
+	case gsubContext:
+		return a.applyContext(lookup, subtable, i, false)
+	case gsubChainContext:
+		return a.applyContext(lookup, subtable, i, true)
+	}
+	return 0, false
+}
+
+func (a *layoutApplier) applyLigature(lookup layoutLookup, subtable, i int) (int, bool) {
+	data := a.font.data
+	if u16(data, subtable) != 1 {
+		return 0, false
+	}
+	coverage := a.font.coverageIndex(subtable+int(u16(data, subtable+2)), a.glyphs[i].Index)
+	if coverage < 0 || coverage >= int(u16(data, subtable+4)) {
+		return 0, false
+	}
+	ligatureSet := subtable + int(u16(data, subtable+6+2*coverage))
+	numLigatures := int(u16(data, ligatureSet))
+	for l := 0; l < numLigatures; l++ {
+		ligature := ligatureSet + int(u16(data, ligatureSet+2+2*l))
+		components := int(u16(data, ligature+2))
+		positions, ok := a.matchForward(lookup, i, components-1, func(k, glyph int) bool {
+			return glyph == int(u16(data, ligature+4+2*k))
+		})
+		if !ok {
+			continue
+		}
+		a.glyphs[i].Index = int(u16(data, ligature))
+		last := i
+		if len(positions) > 0 {
+			last = positions[len(positions)-1]
+		}
+		a.mergeClusters(i, last+1)
+		for k := len(positions) - 1; k >= 0; k-- {
+			p := positions[k]
+			a.glyphs = append(a.glyphs[:p], a.glyphs[p+1:]...)
+		}
+		return i + 1, true
+	}
+	return 0, false
+}
+
+// mergeClusters makes the glyphs in [start, end) one cluster.
+func (a *layoutApplier) mergeClusters(start, end int) {
+	cluster := a.glyphs[start].Cluster
+	for k := start + 1; k < end; k++ {
+		if a.glyphs[k].Cluster < cluster {
+			cluster = a.glyphs[k].Cluster
+		}
+	}
+	for k := start; k < end; k++ {
+		a.glyphs[k].Cluster = cluster
+	}
+}
+
+// matchForward matches count glyphs following i, skipping the glyphs the
+// lookup ignores. It returns the indexes of the matched glyphs.
+func (a *layoutApplier) matchForward(lookup layoutLookup, i, count int, match func(k, glyph int) bool) ([]int, bool) {
+	if count < 0 {
+		return nil, false
+	}
+	positions := make([]int, 0, count)
+	j := i
+	for k := 0; k < count; k++ {
+		j = a.nextIndex(lookup, j)
+		if j < 0 || !match(k, a.glyphs[j].Index) {
+			return nil, false
+		}
+		positions = append(positions, j)
+	}
+	return positions, true
+}
+
+// matchBackward matches count glyphs preceding i, nearest first.
+func (a *layoutApplier) matchBackward(lookup layoutLookup, i, count int, match func(k, glyph int) bool) bool {
+	j := i
+	for k := 0; k < count; k++ {
+		j = a.prevIndex(lookup, j)
+		if j < 0 || !match(k, a.glyphs[j].Index) {
+			return false
+		}
+	}
+	return true
+}
+
+// contextRule is a rule of a (chained) context subtable. Backtrack, input
+// (without the first glyph) and lookahead are arrays of count 16-bit values
+// which match decodes.
+type contextRule struct {
+	backtrack, backtrackCount int
+	input, inputCount         int
+	lookahead, lookaheadCount int
+	records, recordCount      int
+	matchBacktrack            func(value, glyph int) bool
+	matchInput                func(value, glyph int) bool
+	matchLookahead            func(value, glyph int) bool
+}
+
+// applyContext applies a context (chained false) or chained context subtable.
+func (a *layoutApplier) applyContext(lookup layoutLookup, subtable, i int, chained bool) (int, bool) {
+	data := a.font.data
+	f := a.font
+	glyph := a.glyphs[i].Index
+	matchGlyph := func(value, glyph int) bool { return value == glyph }
+	matchCoverage := func(value, glyph int) bool { return f.coverageIndex(subtable+value, glyph) >= 0 }
+
+	// rules returns the rules of a rule set of format 1 or 2.
+	ruleSet := func(set int, match, matchBacktrack, matchLookahead func(value, glyph int) bool) []contextRule {
+		var rules []contextRule
+		for r := 0; r < int(u16(data, set)); r++ {
+			rule := set + int(u16(data, set+2+2*r))
+			var c contextRule
+			p := rule
+			if chained {
+				c.backtrackCount = int(u16(data, p))
+				c.backtrack = p + 2
+				p += 2 + 2*c.backtrackCount
+			}
+			c.inputCount = int(u16(data, p)) - 1
+			if chained {
+				c.input = p + 2
+				p += 2 + 2*c.inputCount
+				c.lookaheadCount = int(u16(data, p))
+				c.lookahead = p + 2
+				p += 2 + 2*c.lookaheadCount
+				c.recordCount = int(u16(data, p))
+				c.records = p + 2
+			} else {
+				c.recordCount = int(u16(data, p+2))
+				c.input = p + 4
+				c.records = p + 4 + 2*c.inputCount
+			}
+			c.matchBacktrack, c.matchInput, c.matchLookahead = matchBacktrack, match, matchLookahead
+			rules = append(rules, c)
+		}
+		return rules
+	}
+
+	var rules []contextRule
+	switch u16(data, subtable) {
+	case 1:
+		coverage := f.coverageIndex(subtable+int(u16(data, subtable+2)), glyph)
+		if coverage < 0 || coverage >= int(u16(data, subtable+4)) {
+			return 0, false
+		}
+		set := int(u16(data, subtable+6+2*coverage))
+		if set == 0 {
+			return 0, false
+		}
+		rules = ruleSet(subtable+set, matchGlyph, matchGlyph, matchGlyph)
+	case 2:
+		if f.coverageIndex(subtable+int(u16(data, subtable+2)), glyph) < 0 {
+			return 0, false
+		}
+		classDef := func(offset int) func(value, glyph int) bool {
+			classDef := subtable + int(u16(data, offset))
+			return func(value, glyph int) bool { return f.glyphClass(classDef, glyph) == value }
+		}
+		var matchBacktrack, matchInput, matchLookahead func(value, glyph int) bool
+		inputClassDef := subtable + 4
+		if chained {
+			matchBacktrack = classDef(subtable + 4)
+			matchLookahead = classDef(subtable + 8)
+			inputClassDef = subtable + 6
+		}
+		matchInput = classDef(inputClassDef)
+		sets := inputClassDef + 2
+		if chained {
+			sets += 2
+		}
+		class := f.glyphClass(subtable+int(u16(data, inputClassDef)), glyph)
+		if class >= int(u16(data, sets)) {
+			return 0, false
+		}
+		set := int(u16(data, sets+2+2*class))
+		if set == 0 {
+			return 0, false
+		}
+		rules = ruleSet(subtable+set, matchInput, matchBacktrack, matchLookahead)
+	case 3:
+		var c contextRule
+		p := subtable + 2
+		if chained {
+			c.backtrackCount = int(u16(data, p))
+			c.backtrack = p + 2
+			p += 2 + 2*c.backtrackCount
+			c.inputCount = int(u16(data, p)) - 1
+			if c.inputCount < 0 || f.coverageIndex(subtable+int(u16(data, p+2)), glyph) < 0 {
+				return 0, false
+			}
+			c.input = p + 4
+			p += 2 + 2*(c.inputCount+1)
+			c.lookaheadCount = int(u16(data, p))
+			c.lookahead = p + 2
+			p += 2 + 2*c.lookaheadCount
+			c.recordCount = int(u16(data, p))
+			c.records = p + 2
+		} else {
+			c.inputCount = int(u16(data, p)) - 1
+			c.recordCount = int(u16(data, p+2))
+			if c.inputCount < 0 || f.coverageIndex(subtable+int(u16(data, p+4)), glyph) < 0 {
+				return 0, false
+			}
+			c.input = p + 6
+			c.records = p + 4 + 2*(c.inputCount+1)
+		}
+		c.matchBacktrack, c.matchInput, c.matchLookahead = matchCoverage, matchCoverage, matchCoverage
+		rules = []contextRule{c}
+	}
+
+	for _, rule := range rules {
+		if next, ok := a.applyRule(lookup, i, rule); ok {
+			return next, true
+		}
+	}
+	return 0, false
+}
+
+// applyRule matches the context rule at the glyph i and applies its nested lookups.
+func (a *layoutApplier) applyRule(lookup layoutLookup, i int, rule contextRule) (int, bool) {
+	data := a.font.data
+	if rule.inputCount < 0 {
+		return 0, false
+	}
+	positions, ok := a.matchForward(lookup, i, rule.inputCount, func(k, glyph int) bool {
+		return rule.matchInput(int(u16(data, rule.input+2*k)), glyph)
+	})
+	if !ok {
+		return 0, false
+	}
+	positions = append([]int{i}, positions...)
+	last := positions[len(positions)-1]
+	if _, ok := a.matchForward(lookup, last, rule.lookaheadCount, func(k, glyph int) bool {
+		return rule.matchLookahead(int(u16(data, rule.lookahead+2*k)), glyph)
+	}); !ok {
+		return 0, false
+	}
+	if !a.matchBackward(lookup, i, rule.backtrackCount, func(k, glyph int) bool {
+		return rule.matchBacktrack(int(u16(data, rule.backtrack+2*k)), glyph)
+	}) {
+		return 0, false
+	}
+
+	end := last + 1
+	if a.depth >= maxLayoutNesting {
+		return end, true
+	}
+	a.depth++
+	for r := 0; r < rule.recordCount; r++ {
+		record := rule.records + 4*r
+		sequenceIndex := int(u16(data, record))
+		nested, ok := a.lookupByIndex(int(u16(data, record+2)))
+		if !ok || sequenceIndex >= len(positions) || positions[sequenceIndex] >= len(a.glyphs) {
+			continue
+		}
+		before := len(a.glyphs)
+		a.applyAt(nested, positions[sequenceIndex])
+		delta := len(a.glyphs) - before
+		end += delta
+		for k := sequenceIndex + 1; k < len(positions); k++ {
+			positions[k] += delta
+		}
+	}
+	a.depth--
+	return end, true
+}
+
+func (a *layoutApplier) applyGPOS(lookup layoutLookup, lookupType, subtable, i int) (int, bool) {
+	data := a.font.data
+	glyph := a.glyphs[i].Index
+	switch lookupType {
+	case gposSingle:
+		coverage := a.font.coverageIndex(subtable+int(u16(data, subtable+2)), glyph)
+		if coverage < 0 {
+			return 0, false
+		}
+		format := int(u16(data, subtable+4))
+		switch u16(data, subtable) {
+		case 1:
+			a.applyValue(&a.glyphs[i], subtable+6, format)
+			return i + 1, true
+		case 2:
+			if coverage < int(u16(data, subtable+6)) {
+				a.applyValue(&a.glyphs[i], subtable+8+coverage*valueRecordSize(format), format)
+				return i + 1, true
+			}
+		}
+	case gposPairAdjustment:
+		j := a.nextIndex(lookup, i)
+		if j < 0 {
+			return 0, false
+		}
+		record1, format1, record2, format2, ok := a.font.pairValues(subtable, glyph, a.glyphs[j].Index)
+		if !ok {
+			return 0, false
+		}
+		a.applyValue(&a.glyphs[i], record1, format1)
+		a.applyValue(&a.glyphs[j], record2, format2)
+		if format2 != 0 {
+			return j + 1, true
+		}
+		return j, true
+	case gposMarkToBase, gposMarkToLigature, gposMarkToMark:
+		return a.applyMark(lookup, lookupType, subtable, i)
+	case gposContext:
+		return a.applyContext(lookup, subtable, i, false)
+	case gposChainContext:
+		return a.applyContext(lookup, subtable, i, true)
+	}
+	return 0, false
+}
+
+// applyValue adds the ValueRecord adjustments to the glyph.
+func (a *layoutApplier) applyValue(g *LayoutGlyph, record, format int) {
+	data := a.font.data
+	value := func(flag int) int {
+		if format&flag == 0 {
+			return 0
+		}
+		return int(int16(u16(data, record+valueRecordSize(format&(flag-1)))))
+	}
+	g.XOffset += value(valueFormatXPlacement)
+	g.YOffset += value(valueFormatYPlacement)
+	g.XAdvance += value(valueFormatXAdvance)
+}
+
+// applyMark attaches the mark at i to the preceding base, ligature or mark.
+func (a *layoutApplier) applyMark(lookup layoutLookup, lookupType, subtable, i int) (int, bool) {
+	data := a.font.data
+	f := a.font
+	mark := f.coverageIndex(subtable+int(u16(data, subtable+2)), a.glyphs[i].Index)
+	if mark < 0 {
+		return 0, false
+	}
+	classCount := int(u16(data, subtable+6))
+	markArray := subtable + int(u16(data, subtable+8))
+	baseArray := subtable + int(u16(data, subtable+10))
+
+	j := i - 1
+	if lookupType == gposMarkToMark {
+		j = a.prevIndex(lookup, i)
+		if j < 0 || !f.IsMarkGlyph(a.glyphs[j].Index) {
+			return 0, false
+		}
+	} else {
+		for j >= 0 && f.IsMarkGlyph(a.glyphs[j].Index) {
+			j--
+		}
+	}
+	if j < 0 {
+		return 0, false
+	}
+	base := f.coverageIndex(subtable+int(u16(data, subtable+4)), a.glyphs[j].Index)
+	if base < 0 || mark >= int(u16(data, markArray)) {
+		return 0, false
+	}
+	class := int(u16(data, markArray+2+4*mark))
+	markAnchor := markArray + int(u16(data, markArray+2+4*mark+2))
+	if class >= classCount {
+		return 0, false
+	}
+
+	var baseAnchor int
+	if lookupType == gposMarkToLigature {
+		// marks are attached to the last component of the ligature
+		if base >= int(u16(data, baseArray)) {
+			return 0, false
+		}
+		ligature := baseArray + int(u16(data, baseArray+2+2*base))
+		components := int(u16(data, ligature))
+		if components == 0 {
+			return 0, false
+		}
+		if anchor := int(u16(data, ligature+2+((components-1)*classCount+class)*2)); anchor != 0 {
+			baseAnchor = ligature + anchor
+		}
+	} else {
+		if base >= int(u16(data, baseArray)) {
+			return 0, false
+		}
+		if anchor := int(u16(data, baseArray+2+(base*classCount+class)*2)); anchor != 0 {
+			baseAnchor = baseArray + anchor
+		}
+	}
+	if baseAnchor == 0 {
+		return 0, false
+	}
+
+	g := &a.glyphs[i]
+	g.attach = j + 1
+	g.attachX = int(int16(u16(data, baseAnchor+2))) - int(int16(u16(data, markAnchor+2)))
+	g.attachY = int(int16(u16(data, baseAnchor+4))) - int(int16(u16(data, markAnchor+4)))
+	return i + 1, true
+}
+
+// coverageIndex returns the coverage index of the glyph, or -1 if the
+// coverage table doesn't contain it.
+func (font *FontInfo) coverageIndex(coverage, glyph int) int {
+	data := font.data
+	switch u16(data, coverage) {
+	case 1:
+		count := int(u16(data, coverage+2))
+		i := sort.Search(count, func(i int) bool {
+			return int(u16(data, coverage+4+2*i)) >= glyph
+		})
+		if i < count && int(u16(data, coverage+4+2*i)) == glyph {
+			return i
+		}
+	case 2:
+		count := int(u16(data, coverage+2))
+		i := sort.Search(count, func(i int) bool {
+			return int(u16(data, coverage+4+6*i+2)) >= glyph
+		})
+		if i < count {
+			record := coverage + 4 + 6*i
+			start := int(u16(data, record))
+			if glyph >= start {
+				return int(u16(data, record+4)) + glyph - start
+			}
+		}
+	}
+	return -1
+}
+
+// glyphClass returns the class of the glyph in the class definition table.
+// Glyphs not listed are in class 0.
+func (font *FontInfo) glyphClass(classDef, glyph int) int {
+	data := font.data
+	switch u16(data, classDef) {
+	case 1:
+		start := int(u16(data, classDef+2))
+		count := int(u16(data, classDef+4))
+		if glyph >= start && glyph < start+count {
+			return int(u16(data, classDef+6+2*(glyph-start)))
+		}
+	case 2:
+		count := int(u16(data, classDef+2))
+		i := sort.Search(count, func(i int) bool {
+			return int(u16(data, classDef+4+6*i+2)) >= glyph
+		})
+		if i < count {
+			record := classDef + 4 + 6*i
+			if glyph >= int(u16(data, record)) {
+				return int(u16(data, record+4))
+			}
+		}
+	}
+	return 0
+}
+
+// valueRecordSize returns the size of a GPOS ValueRecord of the format.
+func valueRecordSize(format int) int {
+	size := 0
+	for ; format != 0; format >>= 1 {
+		size += format & 1
+	}
+	return size * 2
+}
+
+// getGPOSKernAdvance returns the sum of the advance adjustments of the kern
+// lookups for the pair of glyphs. ok is false if the font has no GPOS kerning.
+func (font *FontInfo) getGPOSKernAdvance(glyph1, glyph2 int) (advance int, ok bool) {
+	if len(font.kernLookups) == 0 {
+		return 0, false
+	}
+	a := &layoutApplier{font: font, table: font.gpos, gpos: true}
+	for _, subtables := range font.kernPairSubtables() {
+		for _, subtable := range subtables {
+			if record1, format1, _, _, found := font.pairValues(subtable, glyph1, glyph2); found {
+				var g LayoutGlyph
+				a.applyValue(&g, record1, format1)
+				advance += g.XAdvance
+				break
+			}
+		}
+	}
+	return advance, true
+}
+
+// kernPairSubtables returns the PairPos subtables of every kern lookup,
+// extension subtables resolved.
+func (font *FontInfo) kernPairSubtables() [][]int {
+	data := font.data
+	a := &layoutApplier{font: font, table: font.gpos, gpos: true}
+	lookups := make([][]int, 0, len(font.kernLookups))
+	for _, offset := range font.kernLookups {
+		lookup := a.lookup(offset)
+		if lookup.lookupType != gposPairAdjustment && lookup.lookupType != gposExtension {
+			continue
+		}
+		var subtables []int
+		count := int(u16(data, offset+4))
+		for s := 0; s < count; s++ {
+			subtable := offset + int(u16(data, offset+6+2*s))
+			if lookup.lookupType == gposExtension {
+				if u16(data, subtable+2) != gposPairAdjustment {
+					continue
+				}
+				subtable += int(u32(data, subtable+4))
+			}
+			subtables = append(subtables, subtable)
+		}
+		lookups = append(lookups, subtables)
+	}
+	return lookups
+}
+
+// pairValues returns the ValueRecords and their formats of the pair of glyphs
+// in a PairPos subtable.
+func (font *FontInfo) pairValues(subtable, glyph1, glyph2 int) (record1, format1, record2, format2 int, ok bool) {
+	data := font.data
+	coverage := font.coverageIndex(subtable+int(u16(data, subtable+2)), glyph1)
+	if coverage < 0 {
+		return
+	}
+	format1 = int(u16(data, subtable+4))
+	format2 = int(u16(data, subtable+6))
+	size1 := valueRecordSize(format1)
+	size2 := valueRecordSize(format2)
+
+	switch u16(data, subtable) {
+	case 1:
+		if coverage >= int(u16(data, subtable+8)) {
+			return
+		}
+		pairSet := subtable + int(u16(data, subtable+10+2*coverage))
+		count := int(u16(data, pairSet))
+		recordSize := 2 + size1 + size2
+		i := sort.Search(count, func(i int) bool {
+			return int(u16(data, pairSet+2+i*recordSize)) >= glyph2
+		})
+		if i < count && int(u16(data, pairSet+2+i*recordSize)) == glyph2 {
+			record1 = pairSet + 2 + i*recordSize + 2
+			return record1, format1, record1 + size1, format2, true
+		}
+	case 2:
+		class1 := font.glyphClass(subtable+int(u16(data, subtable+8)), glyph1)
+		class2 := font.glyphClass(subtable+int(u16(data, subtable+10)), glyph2)
+		class1Count := int(u16(data, subtable+12))
+		class2Count := int(u16(data, subtable+14))
+		if class1 >= class1Count || class2 >= class2Count {
+			return
+		}
+		record1 = subtable + 16 + (class1*class2Count+class2)*(size1+size2)
+		return record1, format1, record1 + size1, format2, true
+	}
+	return
+}
@@ -2,6 +2,7 @@ package truetype
 
 import (
 	"errors"
+	"unicode/utf16"
 )
 
 // FontInfo is defined publically so you can declare on on the stack or as a
@@ -15,9 +16,29 @@ type FontInfo struct {
 	hhea             int
 	hmtx             int
 	kern             int
-	numGlyphs        int // number of glyphs, needed for range checking
-	indexMap         int // a cmap mapping for our chosen character encoding
-	indexToLocFormat int // format needed to map from glyph index to glyph
+	gpos             int
+	gsub             int
+	gdef             int
+	name             int
+	os2              int
+	post             int
+	fvar             int
+	avar             int
+	gvar             int
+	hvar             int
+	colr             int
+	cpal             int
+	cblc             int
+	cbdt             int
+	sbix             int
+	vhea             int
+	vmtx             int
+	numGlyphs        int       // number of glyphs, needed for range checking
+	indexMap         int       // a cmap mapping for our chosen character encoding
+	indexToLocFormat int       // format needed to map from glyph index to glyph
+	cff              *cffFont  // CFF/CFF2 outlines, nil for glyf fonts
+	kernLookups      []int     // GPOS lookups of the kern feature
+	coords           []float64 // normalized variation coordinates of the instance, nil at the default
 }
 
 // Each .ttf/.ttc file may have more than one font. Each font has a sequential
@@ -27,6 +48,9 @@ type FontInfo struct {
 // '0' for index 0, and -1 for all other indices. You can just skip this step
 // if you know it's that kind of font.
 func GetFontOffsetForIndex(data []byte, index int) int {
+	if len(data) < 12 {
+		return -1
+	}
 	if isFont(data) {
 		if index == 0 {
 			return 0
@@ -42,12 +66,29 @@ func GetFontOffsetForIndex(data []byte, index int) int {
 			if index >= n {
 				return -1
 			}
-			return int(u32(data, 12+index*14))
+			return int(u32(data, 12+index*4))
 		}
 	}
 	return -1
 }
 
+// GetNumberOfFonts returns the number of fonts in a .ttf/.ttc file,
+// or 0 if the data is not a font.
+func GetNumberOfFonts(data []byte) int {
+	if len(data) < 12 {
+		return 0
+	}
+	if isFont(data) {
+		return 1
+	}
+	if string(data[0:4]) == "ttcf" {
+		if u32(data, 4) == 0x00010000 || u32(data, 4) == 0x00020000 {
+			return int(u32(data, 8))
+		}
+	}
+	return 0
+}
+
 // Given an offset into the file that defines a font, this function builds the
 // necessary cached info for the rest of the system.
 func InitFont(data []byte, offset int) (font *FontInfo, err error) {
@@ -66,10 +107,45 @@ func InitFont(data []byte, offset int) (font *FontInfo, err error) {
 	font.hhea = findTable(data, offset, "hhea")
 	font.hmtx = findTable(data, offset, "hmtx")
 	font.kern = findTable(data, offset, "kern")
-	if cmap == 0 || font.loca == 0 || font.head == 0 || font.glyf == 0 || font.hhea == 0 || font.hmtx == 0 {
+	font.gpos = findTable(data, offset, "GPOS")
+	font.gsub = findTable(data, offset, "GSUB")
+	font.gdef = findTable(data, offset, "GDEF")
+	font.name = findTable(data, offset, "name")
+	font.os2 = findTable(data, offset, "OS/2")
+	font.post = findTable(data, offset, "post")
+	font.fvar = findTable(data, offset, "fvar")
+	font.avar = findTable(data, offset, "avar")
+	font.gvar = findTable(data, offset, "gvar")
+	font.hvar = findTable(data, offset, "HVAR")
+	font.colr = findTable(data, offset, "COLR")
+	font.cpal = findTable(data, offset, "CPAL")
+	font.cblc = findTable(data, offset, "CBLC")
+	font.cbdt = findTable(data, offset, "CBDT")
+	font.sbix = findTable(data, offset, "sbix")
+	font.vhea = findTable(data, offset, "vhea")
+	font.vmtx = findTable(data, offset, "vmtx")
+	if cmap == 0 || font.head == 0 || font.hhea == 0 || font.hmtx == 0 {
 		err = errors.New("Required table not found")
 		return
 	}
+	if font.loca == 0 || font.glyf == 0 {
+		// OpenType fonts with CFF or CFF2 outlines
+		font.loca, font.glyf = 0, 0
+		cff2 := false
+		t := findTable(data, offset, "CFF ")
+		if t == 0 {
+			t = findTable(data, offset, "CFF2")
+			cff2 = true
+		}
+		if t == 0 && ((font.cblc != 0 && font.cbdt != 0) || font.sbix != 0) {
+			// color bitmap fonts may have no outlines
+		} else if t == 0 {
+			err = errors.New("Required table not found")
+			return
+		} else if font.cff, err = parseCFF(data[t:], cff2); err != nil {
+			return
+		}
+	}
 
 	t := findTable(data, offset, "maxp")
 	if t != 0 {
@@ -96,5 +172,70 @@ func InitFont(data []byte, offset int) (font *FontInfo, err error) {
 	}
 
 	font.indexToLocFormat = int(u16(data, font.head+50))
+	font.initLayout()
 	return
 }
+
+// GetFontName returns the string of the specified name ID (NAME_ID_FAMILY and so on) from
+// the name table. Windows Unicode records are preferred (US English first), then Mac Roman ones.
+// Returns "" if the font doesn't have the name.
+func (font *FontInfo) GetFontName(nameID int) string {
+	data := font.data
+	if font.name == 0 {
+		return ""
+	}
+	count := int(u16(data, font.name+2))
+	stringOffset := font.name + int(u16(data, font.name+4))
+	best := -1
+	bestScore := 0
+	for i := 0; i < count; i++ {
+		record := font.name + 6 + 12*i
+		if int(u16(data, record+6)) != nameID {
+			continue
+		}
+		platformID := int(u16(data, record))
+		encodingID := int(u16(data, record+2))
+		languageID := int(u16(data, record+4))
+		score := 0
+		switch {
+		case platformID == PLATFORM_ID_MICROSOFT && (encodingID == MS_EID_UNICODE_BMP || encodingID == MS_EID_UNICODE_FULL):
+			score = 3
+			if languageID == MS_LANG_ENGLISH {
+				score = 4
+			}
+		case platformID == PLATFORM_ID_UNICODE:
+			score = 2
+		case platformID == PLATFORM_ID_MAC && encodingID == 0:
+			score = 1
+		}
+		if score > bestScore {
+			best = record
+			bestScore = score
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	length := int(u16(data, best+8))
+	start := stringOffset + int(u16(data, best+10))
+	if start+length > len(data) {
+		return ""
+	}
+	str := data[start : start+length]
+	if bestScore == 1 {
+		// Mac Roman, only ASCII range is decoded.
+		runes := make([]rune, len(str))
+		for i, c := range str {
+			runes[i] = rune(c)
+			if c >= 0x80 {
+				runes[i] = '?'
+			}
+		}
+		return string(runes)
+	}
+	units := make([]uint16, length/2)
+	for i := range units {
+		units[i] = u16(str, i*2)
+	}
+	return string(utf16.Decode(units))
+}
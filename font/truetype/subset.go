@@ -0,0 +1,489 @@
+package truetype
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// Subset returns a TrueType font with only the glyphs of the codepoints, the
+// .notdef glyph and the components of composite glyphs, in their original order.
+// The glyf, loca, cmap and hmtx tables are rebuilt for the new glyph indexes, and
+// the head, hhea, maxp, OS/2 and name tables and the hinting programs are kept.
+// The post table loses its glyph names. Kerning is kept: the pairs of the kern
+// table are remapped, and the pair adjustments of the GPOS kern feature become
+// one lookup of advance adjustments, which makes subsets of fonts with class
+// based kerning larger. Other tables which refer to glyph indexes,
+// like GSUB, the other GPOS lookups, vmtx and the color and variation tables,
+// are left out, so variable fonts are subset at their default instance. Fonts
+// with CFF outlines aren't supported.
+func (font *FontInfo) Subset(codepoints []rune) ([]byte, error) {
+	if font.glyf == 0 || font.loca == 0 {
+		return nil, errors.New("Only fonts with TrueType outlines can be subset")
+	}
+	if font.indexToLocFormat >= 2 {
+		return nil, errors.New("Unknown index-glyph map format")
+	}
+	data := font.data
+	be := binary.BigEndian
+
+	// the glyphs of the codepoints and their components
+	mapping := make(map[rune]int)
+	used := map[int]bool{0: true}
+	for _, r := range codepoints {
+		if index := font.FindGlyphIndex(int(r)); index != 0 {
+			mapping[r] = index
+			font.subsetGlyph(used, index)
+		}
+	}
+	glyphs := make([]int, 0, len(used))
+	for index := range used {
+		glyphs = append(glyphs, index)
+	}
+	sort.Ints(glyphs)
+	newIndexes := make(map[int]int, len(glyphs))
+	for i, index := range glyphs {
+		newIndexes[index] = i
+	}
+
+	// default advances, the variations are left out
+	metrics := *font
+	metrics.coords = nil
+	var glyf []byte
+	loca := make([]byte, 4*(len(glyphs)+1))
+	hmtx := make([]byte, 4*len(glyphs))
+	for i, index := range glyphs {
+		be.PutUint32(loca[4*i:], uint32(len(glyf)))
+		start, end := font.glyphRange(index)
+		glyph := append([]byte(nil), data[start:end]...)
+		for _, offset := range font.glyphComponents(index) {
+			be.PutUint16(glyph[offset:], uint16(newIndexes[int(u16(glyph, offset))]))
+		}
+		glyf = append(glyf, glyph...)
+		glyf = append(glyf, make([]byte, (4-len(glyph)%4)%4)...)
+		advance, lsb := metrics.GetGlyphHMetrics(index)
+		be.PutUint16(hmtx[4*i:], uint16(advance))
+		be.PutUint16(hmtx[4*i+2:], uint16(lsb))
+	}
+	be.PutUint32(loca[4*len(glyphs):], uint32(len(glyf)))
+
+	runes := make([]rune, 0, len(mapping))
+	for r := range mapping {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool {
+		return runes[i] < runes[j]
+	})
+	newGlyphs := make([]int, len(runes))
+	for i, r := range runes {
+		newGlyphs[i] = newIndexes[mapping[r]]
+	}
+	cmap, err := subsetCmap(runes, newGlyphs)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := map[string][]byte{
+		"cmap": cmap,
+		"glyf": glyf,
+		"hmtx": hmtx,
+		"loca": loca,
+	}
+	for _, tag := range []string{"head", "hhea", "maxp", "OS/2", "name", "post", "cvt ", "fpgm", "prep", "gasp"} {
+		if table := font.tableData(tag); table != nil {
+			tables[tag] = append([]byte(nil), table...)
+		}
+	}
+	if kern := font.subsetKern(newIndexes); kern != nil {
+		tables["kern"] = kern
+	}
+	gpos, err := metrics.subsetGPOSKerning(glyphs)
+	if err != nil {
+		return nil, err
+	}
+	if gpos != nil {
+		tables["GPOS"] = gpos
+	}
+	head := tables["head"]
+	be.PutUint32(head[8:], 0) // checkSumAdjustment, set by assembleFont
+	be.PutUint16(head[50:], 1)
+	be.PutUint16(tables["hhea"][34:], uint16(len(glyphs)))
+	if maxp := tables["maxp"]; maxp != nil {
+		be.PutUint16(maxp[4:], uint16(len(glyphs)))
+	}
+	if os2 := tables["OS/2"]; len(os2) >= 68 && len(runes) > 0 {
+		be.PutUint16(os2[64:], uint16(minInt(int(runes[0]), 0xffff)))
+		be.PutUint16(os2[66:], uint16(minInt(int(runes[len(runes)-1]), 0xffff)))
+	}
+	if post := tables["post"]; len(post) >= 32 {
+		// version 3 has no glyph names
+		post = post[:32]
+		be.PutUint32(post, 0x00030000)
+		tables["post"] = post
+	}
+	return assembleFont(tables), nil
+}
+
+// subsetKern returns a kern table with the pairs of the first subtable whose
+// glyphs are both kept, nil if there are none. Like GetGlyphKernAdvance, only a
+// horizontal format 0 subtable is used.
+func (font *FontInfo) subsetKern(newIndexes map[int]int) []byte {
+	data := font.data
+	if font.kern == 0 || u16(data, font.kern+2) < 1 || u16(data, font.kern+8) != 1 {
+		return nil
+	}
+	type kernPair struct {
+		glyphs uint32
+		value  uint16
+	}
+	var pairs []kernPair
+	for i := 0; i < int(u16(data, font.kern+10)); i++ {
+		p := font.kern + 18 + 6*i
+		left, okLeft := newIndexes[int(u16(data, p))]
+		right, okRight := newIndexes[int(u16(data, p+2))]
+		if okLeft && okRight {
+			pairs = append(pairs, kernPair{uint32(left)<<16 | uint32(right), u16(data, p+4)})
+		}
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].glyphs < pairs[j].glyphs
+	})
+
+	be := binary.BigEndian
+	entrySelector := 0
+	for 1<<uint(entrySelector+1) <= len(pairs) {
+		entrySelector++
+	}
+	searchRange := 6 << uint(entrySelector)
+	kern := make([]byte, 18+6*len(pairs))
+	be.PutUint16(kern[2:], 1)
+	// readers rely on nPairs when the length doesn't fit
+	be.PutUint16(kern[6:], uint16(minInt(len(kern)-4, 0xffff)))
+	be.PutUint16(kern[8:], 1)
+	be.PutUint16(kern[10:], uint16(len(pairs)))
+	be.PutUint16(kern[12:], uint16(searchRange))
+	be.PutUint16(kern[14:], uint16(entrySelector))
+	be.PutUint16(kern[16:], uint16(6*len(pairs)-searchRange))
+	for i, pair := range pairs {
+		be.PutUint32(kern[18+6*i:], pair.glyphs)
+		be.PutUint16(kern[22+6*i:], pair.value)
+	}
+	return kern
+}
+
+// subsetGPOSKerning returns a GPOS table whose kern feature adjusts the advances
+// of the pairs of the glyphs like the kern feature of the font, nil if none of
+// them is kerned. The new glyph indexes are the positions in glyphs. The pairs
+// are split into PairPos subtables reached through extension subtables, so
+// their size isn't limited by 16-bit offsets.
+func (font *FontInfo) subsetGPOSKerning(glyphs []int) ([]byte, error) {
+	if len(font.kernLookups) == 0 {
+		return nil, nil
+	}
+	be := binary.BigEndian
+	subtables := font.kernPairSubtables()
+	covered := func(glyph int) bool {
+		for _, lookup := range subtables {
+			for _, subtable := range lookup {
+				if font.coverageIndex(subtable+int(u16(font.data, subtable+2)), glyph) >= 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	// PairPos format 1 subtables with an XAdvance value for the first glyph
+	var chunks [][]byte
+	var firsts []int
+	var pairSets [][]byte
+	flush := func() {
+		if len(firsts) == 0 {
+			return
+		}
+		header := 10 + 2*len(firsts)
+		chunk := make([]byte, header)
+		be.PutUint16(chunk[0:], 1)
+		be.PutUint16(chunk[4:], 0x0004)
+		be.PutUint16(chunk[8:], uint16(len(firsts)))
+		for i, pairSet := range pairSets {
+			be.PutUint16(chunk[10+2*i:], uint16(len(chunk)))
+			chunk = append(chunk, pairSet...)
+		}
+		be.PutUint16(chunk[2:], uint16(len(chunk)))
+		coverage := make([]byte, 4+2*len(firsts))
+		be.PutUint16(coverage[0:], 1)
+		be.PutUint16(coverage[2:], uint16(len(firsts)))
+		for i, first := range firsts {
+			be.PutUint16(coverage[4+2*i:], uint16(first))
+		}
+		chunks = append(chunks, append(chunk, coverage...))
+		firsts, pairSets = nil, nil
+	}
+	size := 0
+	for first, glyph1 := range glyphs {
+		if !covered(glyph1) {
+			continue
+		}
+		pairSet := make([]byte, 2)
+		for second, glyph2 := range glyphs {
+			if advance, _ := font.getGPOSKernAdvance(glyph1, glyph2); advance != 0 {
+				pairSet = append(pairSet, byte(second>>8), byte(second), byte(advance>>8), byte(advance))
+			}
+		}
+		if len(pairSet) == 2 {
+			continue
+		}
+		be.PutUint16(pairSet, uint16((len(pairSet)-2)/4))
+		// the pair set, its offset and its coverage entry
+		if 14+len(pairSet)+4 > 0xffff {
+			return nil, errors.New("Too many kerning pairs for a subtable")
+		}
+		if size+len(pairSet)+4 > 0xffff-14 {
+			flush()
+			size = 0
+		}
+		firsts = append(firsts, first)
+		pairSets = append(pairSets, pairSet)
+		size += len(pairSet) + 4
+	}
+	flush()
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	// the DFLT script with the kern feature, which has one extension lookup
+	gpos := []byte{
+		0, 1, 0, 0, 0, 10, 0, 30, 0, 44, // version 1.0 and the offsets of the lists
+		0, 1, 'D', 'F', 'L', 'T', 0, 8, 0, 4, 0, 0, 0, 0, 0xff, 0xff, 0, 1, 0, 0, // ScriptList
+		0, 1, 'k', 'e', 'r', 'n', 0, 8, 0, 0, 0, 1, 0, 0, // FeatureList
+		0, 1, 0, 4, // LookupList
+	}
+	lookup := make([]byte, 6+2*len(chunks)+8*len(chunks))
+	be.PutUint16(lookup[0:], gposExtension)
+	be.PutUint16(lookup[4:], uint16(len(chunks)))
+	offset := len(lookup)
+	for i, chunk := range chunks {
+		extension := 6 + 2*len(chunks) + 8*i
+		be.PutUint16(lookup[6+2*i:], uint16(extension))
+		be.PutUint16(lookup[extension:], 1)
+		be.PutUint16(lookup[extension+2:], gposPairAdjustment)
+		be.PutUint32(lookup[extension+4:], uint32(offset-extension))
+		offset += len(chunk)
+	}
+	gpos = append(gpos, lookup...)
+	for _, chunk := range chunks {
+		gpos = append(gpos, chunk...)
+	}
+	return gpos, nil
+}
+
+// subsetGlyph adds the glyph and the components of composite glyphs to used.
+func (font *FontInfo) subsetGlyph(used map[int]bool, index int) {
+	if used[index] || index >= font.numGlyphs {
+		return
+	}
+	used[index] = true
+	start, _ := font.glyphRange(index)
+	for _, offset := range font.glyphComponents(index) {
+		font.subsetGlyph(used, int(u16(font.data, start+offset)))
+	}
+}
+
+// glyphRange returns the start and the end of the data of the glyph in the glyf table.
+func (font *FontInfo) glyphRange(index int) (start, end int) {
+	if index >= font.numGlyphs {
+		return font.glyf, font.glyf
+	}
+	if font.indexToLocFormat == 0 {
+		start = int(u16(font.data, font.loca+index*2)) * 2
+		end = int(u16(font.data, font.loca+index*2+2)) * 2
+	} else {
+		start = int(u32(font.data, font.loca+index*4))
+		end = int(u32(font.data, font.loca+index*4+4))
+	}
+	if end < start || font.glyf+end > len(font.data) {
+		end = start
+	}
+	return font.glyf + start, font.glyf + end
+}
+
+// glyphComponents returns the offsets of the glyph indexes of the components of
+// a composite glyph from the start of its data, nil for simple glyphs.
+func (font *FontInfo) glyphComponents(index int) []int {
+	data := font.data
+	start, end := font.glyphRange(index)
+	if end-start < 10 || int16(u16(data, start)) >= 0 {
+		return nil
+	}
+	var components []int
+	for p := start + 10; p+4 <= end; {
+		flags := u16(data, p)
+		components = append(components, p+2-start)
+		p += 4
+		if flags&1 != 0 { // ARG_1_AND_2_ARE_WORDS
+			p += 4
+		} else {
+			p += 2
+		}
+		if flags&8 != 0 { // WE_HAVE_A_SCALE
+			p += 2
+		} else if flags&0x40 != 0 { // WE_HAVE_AN_X_AND_Y_SCALE
+			p += 4
+		} else if flags&0x80 != 0 { // WE_HAVE_A_TWO_BY_TWO
+			p += 8
+		}
+		if flags&0x20 == 0 { // MORE_COMPONENTS
+			break
+		}
+	}
+	return components
+}
+
+// tableData returns the data of the table, nil if the font doesn't have it.
+func (font *FontInfo) tableData(tag string) []byte {
+	data := font.data
+	numTables := int(u16(data, font.fontStart+4))
+	for i := 0; i < numTables; i++ {
+		loc := font.fontStart + 12 + 16*i
+		if string(data[loc:loc+4]) == tag {
+			offset := int(u32(data, loc+8))
+			length := int(u32(data, loc+12))
+			if offset+length > len(data) {
+				return nil
+			}
+			return data[offset : offset+length]
+		}
+	}
+	return nil
+}
+
+// subsetCmap returns a cmap table which maps the sorted runes to the glyphs, with a
+// format 4 subtable for the BMP and, if there are runes beyond it, a format 12 one.
+func subsetCmap(runes []rune, glyphs []int) ([]byte, error) {
+	be := binary.BigEndian
+
+	// segments of consecutive runes and glyphs, and the final 0xFFFF one
+	var starts, ends, deltas []int
+	var groups [][3]int
+	for i, r := range runes {
+		delta := glyphs[i] - int(r)
+		if r <= 0xfffe {
+			if n := len(ends); n > 0 && ends[n-1]+1 == int(r) && deltas[n-1] == delta {
+				ends[n-1]++
+			} else {
+				starts, ends, deltas = append(starts, int(r)), append(ends, int(r)), append(deltas, delta)
+			}
+		}
+		if n := len(groups); n > 0 && groups[n-1][1]+1 == int(r) && groups[n-1][2]+int(r)-groups[n-1][0] == glyphs[i] {
+			groups[n-1][1]++
+		} else {
+			groups = append(groups, [3]int{int(r), int(r), glyphs[i]})
+		}
+	}
+	starts, ends, deltas = append(starts, 0xffff), append(ends, 0xffff), append(deltas, 1)
+
+	segCount := len(starts)
+	length := 16 + 8*segCount
+	if length > 0xffff {
+		return nil, errors.New("Too many codepoints for a cmap subtable")
+	}
+	entrySelector := 0
+	for 1<<uint(entrySelector+1) <= segCount {
+		entrySelector++
+	}
+	searchRange := 2 << uint(entrySelector)
+	format4 := make([]byte, length)
+	be.PutUint16(format4[0:], 4)
+	be.PutUint16(format4[2:], uint16(length))
+	be.PutUint16(format4[6:], uint16(segCount*2))
+	be.PutUint16(format4[8:], uint16(searchRange))
+	be.PutUint16(format4[10:], uint16(entrySelector))
+	be.PutUint16(format4[12:], uint16(segCount*2-searchRange))
+	for i := range starts {
+		be.PutUint16(format4[14+2*i:], uint16(ends[i]))
+		be.PutUint16(format4[16+2*segCount+2*i:], uint16(starts[i]))
+		be.PutUint16(format4[16+4*segCount+2*i:], uint16(deltas[i]))
+		// idRangeOffset stays 0
+	}
+
+	subtables := [][]byte{format4}
+	encodings := []int{MS_EID_UNICODE_BMP}
+	if len(runes) > 0 && runes[len(runes)-1] > 0xffff {
+		format12 := make([]byte, 16+12*len(groups))
+		be.PutUint16(format12[0:], 12)
+		be.PutUint32(format12[4:], uint32(len(format12)))
+		be.PutUint32(format12[12:], uint32(len(groups)))
+		for i, group := range groups {
+			be.PutUint32(format12[16+12*i:], uint32(group[0]))
+			be.PutUint32(format12[20+12*i:], uint32(group[1]))
+			be.PutUint32(format12[24+12*i:], uint32(group[2]))
+		}
+		subtables = append(subtables, format12)
+		encodings = append(encodings, MS_EID_UNICODE_FULL)
+	}
+
+	cmap := make([]byte, 4+8*len(subtables))
+	be.PutUint16(cmap[2:], uint16(len(subtables)))
+	for i, subtable := range subtables {
+		be.PutUint16(cmap[4+8*i:], uint16(PLATFORM_ID_MICROSOFT))
+		be.PutUint16(cmap[6+8*i:], uint16(encodings[i]))
+		be.PutUint32(cmap[8+8*i:], uint32(len(cmap)))
+		cmap = append(cmap, subtable...)
+	}
+	return cmap, nil
+}
+
+// assembleFont writes the tables into a TrueType font file, with their checksums
+// and the checkSumAdjustment of the head table.
+func assembleFont(tables map[string][]byte) []byte {
+	be := binary.BigEndian
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	entrySelector := 0
+	for 1<<uint(entrySelector+1) <= len(tags) {
+		entrySelector++
+	}
+	searchRange := 16 << uint(entrySelector)
+	out := make([]byte, 12+16*len(tags))
+	be.PutUint32(out[0:], 0x00010000)
+	be.PutUint16(out[4:], uint16(len(tags)))
+	be.PutUint16(out[6:], uint16(searchRange))
+	be.PutUint16(out[8:], uint16(entrySelector))
+	be.PutUint16(out[10:], uint16(16*len(tags)-searchRange))
+	headOffset := -1
+	for i, tag := range tags {
+		table := tables[tag]
+		offset := len(out)
+		if tag == "head" {
+			headOffset = offset
+		}
+		out = append(out, table...)
+		out = append(out, make([]byte, (4-len(table)%4)%4)...)
+		entry := out[12+16*i:]
+		copy(entry, tag)
+		be.PutUint32(entry[4:], tableChecksum(out[offset:]))
+		be.PutUint32(entry[8:], uint32(offset))
+		be.PutUint32(entry[12:], uint32(len(table)))
+	}
+	if headOffset >= 0 {
+		be.PutUint32(out[headOffset+8:], 0xB1B0AFBA-tableChecksum(out))
+	}
+	return out
+}
+
+// tableChecksum returns the sum of the big-endian uint32 of the data, whose length is a multiple of 4.
+func tableChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i+4 <= len(data); i += 4 {
+		sum += u32(data, i)
+	}
+	return sum
+}
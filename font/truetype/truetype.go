@@ -25,10 +25,36 @@ const (
 	MS_EID_UNICODE_FULL     = 10
 )
 
+const (
+	MS_LANG_ENGLISH int = 0x0409
+)
+
+const (
+	NAME_ID_COPYRIGHT             int = 0
+	NAME_ID_FAMILY                    = 1
+	NAME_ID_SUBFAMILY                 = 2
+	NAME_ID_UNIQUE_ID                 = 3
+	NAME_ID_FULL_NAME                 = 4
+	NAME_ID_VERSION                   = 5
+	NAME_ID_POSTSCRIPT_NAME           = 6
+	NAME_ID_TYPOGRAPHIC_FAMILY        = 16
+	NAME_ID_TYPOGRAPHIC_SUBFAMILY     = 17
+)
+
 const (
 	vmove uint8 = iota + 1
 	vline
 	vcurve
+	vcubic
+)
+
+// Vertex types of the outlines returned by GetGlyphShape. Curves are quadratic
+// with the control point CX, CY, cubics have the second control point CX1, CY1.
+const (
+	VertexMove  = vmove
+	VertexLine  = vline
+	VertexCurve = vcurve
+	VertexCubic = vcubic
 )
 
 const (
@@ -42,6 +68,8 @@ type Vertex struct {
 	Y       int
 	CX      int
 	CY      int
+	CX1     int // second control point of vcubic
+	CY1     int
 	Type    uint8
 	Padding byte
 }
@@ -63,12 +91,19 @@ func (font *FontInfo) GetFontVMetrics() (int, int, int) {
 	return int(int16(u16(font.data, font.hhea+4))), int(int16(u16(font.data, font.hhea+6))), int(int16(u16(font.data, font.hhea+8)))
 }
 
-func (font *FontInfo) GetGlyphHMetrics(glyphIndex int) (int, int) {
+// GetGlyphHMetrics returns the advance width and the left side bearing of the glyph.
+// The advances of instances of variable fonts are varied, the bearings aren't.
+func (font *FontInfo) GetGlyphHMetrics(glyphIndex int) (advance, lsb int) {
 	numOfLongHorMetrics := int(u16(font.data, font.hhea+34))
 	if glyphIndex < numOfLongHorMetrics {
-		return int(int16(u16(font.data, font.hmtx+4*glyphIndex))), int(int16(u16(font.data, font.hmtx+4*glyphIndex+2)))
+		advance, lsb = int(int16(u16(font.data, font.hmtx+4*glyphIndex))), int(int16(u16(font.data, font.hmtx+4*glyphIndex+2)))
+	} else {
+		advance, lsb = int(int16(u16(font.data, font.hmtx+4*(numOfLongHorMetrics-1)))), int(int16(u16(font.data, font.hmtx+4*numOfLongHorMetrics+2*(glyphIndex-numOfLongHorMetrics))))
+	}
+	if font.coords != nil {
+		advance += int(math.Floor(font.advanceDelta(glyphIndex) + 0.5))
 	}
-	return int(int16(u16(font.data, font.hmtx+4*(numOfLongHorMetrics-1)))), int(int16(u16(font.data, font.hmtx+4*numOfLongHorMetrics+2*(glyphIndex-numOfLongHorMetrics))))
+	return
 }
 
 func (font *FontInfo) GetFontBoundingBox() (int, int, int, int) {
@@ -78,6 +113,88 @@ func (font *FontInfo) GetFontBoundingBox() (int, int, int, int) {
 		int(int16(u16(font.data, font.head+42)))
 }
 
+// GetUnitsPerEm returns the size of the em square in font units.
+func (font *FontInfo) GetUnitsPerEm() int {
+	return int(u16(font.data, font.head+18))
+}
+
+// GetFontXHeights returns the height of the lowercase and of the uppercase letters from the
+// OS/2 table. Fonts with an older OS/2 table are measured on the 'x' and 'H' glyphs.
+func (font *FontInfo) GetFontXHeights() (xHeight, capHeight int) {
+	if font.os2 != 0 && u16(font.data, font.os2) >= 2 {
+		xHeight = int(int16(u16(font.data, font.os2+86)))
+		capHeight = int(int16(u16(font.data, font.os2+88)))
+	}
+	ascent, _, _ := font.GetFontVMetrics()
+	if xHeight <= 0 {
+		xHeight = ascent / 2
+		if ok, _, _, _, y1 := font.GetGlyphBox(font.FindGlyphIndex('x')); ok && y1 > 0 {
+			xHeight = y1
+		}
+	}
+	if capHeight <= 0 {
+		capHeight = ascent * 7 / 10
+		if ok, _, _, _, y1 := font.GetGlyphBox(font.FindGlyphIndex('H')); ok && y1 > 0 {
+			capHeight = y1
+		}
+	}
+	return
+}
+
+// GetUnderlineMetrics returns the position of the top of the underline above the baseline,
+// negative below it, and its thickness from the post table, or common proportions of the em.
+func (font *FontInfo) GetUnderlineMetrics() (position, thickness int) {
+	if font.post != 0 {
+		position = int(int16(u16(font.data, font.post+8)))
+		thickness = int(int16(u16(font.data, font.post+10)))
+	}
+	if thickness <= 0 {
+		unitsPerEm := font.GetUnitsPerEm()
+		position = -unitsPerEm / 10
+		thickness = unitsPerEm / 20
+	}
+	return
+}
+
+// GetStrikeoutMetrics returns the position of the top of the strikeout above the baseline
+// and its thickness from the OS/2 table. Without them, the strikeout is as thick as the
+// underline and centered at half of the x-height.
+func (font *FontInfo) GetStrikeoutMetrics() (position, thickness int) {
+	if font.os2 != 0 {
+		thickness = int(int16(u16(font.data, font.os2+26)))
+		position = int(int16(u16(font.data, font.os2+28)))
+	}
+	if thickness <= 0 {
+		xHeight, _ := font.GetFontXHeights()
+		_, thickness = font.GetUnderlineMetrics()
+		position = (xHeight + thickness) / 2
+	}
+	return
+}
+
+// GetWeightClass returns the weight of the font from the OS/2 table, 100 for thin to 900 for
+// black. Fonts without it are 700 if the head table has the bold style, 400 otherwise.
+func (font *FontInfo) GetWeightClass() int {
+	if font.os2 != 0 {
+		if weight := int(u16(font.data, font.os2+4)); weight > 0 {
+			return weight
+		}
+	}
+	if u16(font.data, font.head+44)&1 != 0 {
+		return 700
+	}
+	return 400
+}
+
+// IsItalic returns whether the font is italic or oblique, from the OS/2 selection flags
+// and the style of the head table.
+func (font *FontInfo) IsItalic() bool {
+	if font.os2 != 0 && u16(font.data, font.os2+62)&(1<<0|1<<9) != 0 {
+		return true
+	}
+	return u16(font.data, font.head+44)&2 != 0
+}
+
 func (font *FontInfo) GetCodepointBitmapBox(codepoint int, scaleX, scaleY float64) (int, int, int, int) {
 	return font.GetCodepointBitmapBoxSubpixel(codepoint, scaleX, scaleY, 0, 0)
 }
@@ -198,6 +315,10 @@ func FlattenCurves(vertices []Vertex, objspaceFlatness float64) ([]point, []int,
 			tesselateCurve(&points, x, y, float64(vertex.CX), float64(vertex.CY), float64(vertex.X), float64(vertex.Y), objspaceFlatnessSquared, 0)
 			x = float64(vertex.X)
 			y = float64(vertex.Y)
+		case vcubic:
+			tesselateCubic(&points, x, y, float64(vertex.CX), float64(vertex.CY), float64(vertex.CX1), float64(vertex.CY1), float64(vertex.X), float64(vertex.Y), objspaceFlatnessSquared, 0)
+			x = float64(vertex.X)
+			y = float64(vertex.Y)
 		}
 		contourLengths[n] = len(points) - start
 	}
@@ -224,6 +345,34 @@ func tesselateCurve(points *[]point, x0, y0, x1, y1, x2, y2, objspaceFlatnessSqu
 	return 1
 }
 
+// tesselateCubic subdivides a cubic bezier until the control polygon is
+// within objspaceFlatnessSquared of the chord.
+func tesselateCubic(points *[]point, x0, y0, x1, y1, x2, y2, x3, y3, objspaceFlatnessSquared float64, n int) {
+	dx0, dy0 := x1-x0, y1-y0
+	dx1, dy1 := x2-x1, y2-y1
+	dx2, dy2 := x3-x2, y3-y2
+	dx, dy := x3-x0, y3-y0
+	longlen := math.Sqrt(dx0*dx0+dy0*dy0) + math.Sqrt(dx1*dx1+dy1*dy1) + math.Sqrt(dx2*dx2+dy2*dy2)
+	shortlen := math.Sqrt(dx*dx + dy*dy)
+	flatnessSquared := longlen*longlen - shortlen*shortlen
+
+	if n > 16 {
+		return
+	}
+	if flatnessSquared > objspaceFlatnessSquared {
+		x01, y01 := (x0+x1)/2, (y0+y1)/2
+		x12, y12 := (x1+x2)/2, (y1+y2)/2
+		x23, y23 := (x2+x3)/2, (y2+y3)/2
+		xa, ya := (x01+x12)/2, (y01+y12)/2
+		xb, yb := (x12+x23)/2, (y12+y23)/2
+		mx, my := (xa+xb)/2, (ya+yb)/2
+		tesselateCubic(points, x0, y0, x01, y01, xa, ya, mx, my, objspaceFlatnessSquared, n+1)
+		tesselateCubic(points, mx, my, xb, yb, x23, y23, x3, y3, objspaceFlatnessSquared, n+1)
+	} else {
+		*points = append(*points, point{x3, y3})
+	}
+}
+
 type Edge struct {
 	x0     float64
 	y0     float64
@@ -482,6 +631,12 @@ func (font *FontInfo) GetGlyphBitmapBoxSubpixel(glyph int, scaleX, scaleY, shift
 }
 
 func (font *FontInfo) GetGlyphBox(glyph int) (result bool, x0, y0, x1, y1 int) {
+	if font.cff != nil {
+		return font.cff.glyphBox(glyph)
+	}
+	if font.coords != nil && font.gvar != 0 {
+		return font.variedGlyphBox(glyph)
+	}
 	g := font.GetGlyphOffset(glyph)
 	if g < 0 {
 		result = false
@@ -497,6 +652,9 @@ func (font *FontInfo) GetGlyphBox(glyph int) (result bool, x0, y0, x1, y1 int) {
 }
 
 func (font *FontInfo) GetGlyphShape(glyphIndex int) []Vertex {
+	if font.cff != nil {
+		return font.cff.glyphShape(glyphIndex)
+	}
 	data := font.data
 	g := font.GetGlyphOffset(glyphIndex)
 	if g < 0 {
@@ -587,6 +745,25 @@ func (font *FontInfo) GetGlyphShape(glyphIndex int) []Vertex {
 			vertices[off+i].Y = y
 		}
 
+		// vary the points of instances of variable fonts
+		if font.coords != nil {
+			xs := make([]int, n)
+			ys := make([]int, n)
+			for i := range xs {
+				xs[i], ys[i] = vertices[off+i].X, vertices[off+i].Y
+			}
+			endPts := make([]int, numberOfContours)
+			for i := range endPts {
+				endPts[i] = int(u16(data, endPtsOfContours+i*2))
+			}
+			if dx, dy := font.glyphDeltas(glyphIndex, n+4, xs, ys, endPts); dx != nil {
+				for i := 0; i < n; i++ {
+					vertices[off+i].X += int(math.Floor(dx[i] + 0.5))
+					vertices[off+i].Y += int(math.Floor(dy[i] + 0.5))
+				}
+			}
+		}
+
 		// now convert them to our format
 		numVertices = 0
 		var sx, sy, cx, cy, scx, scy int
@@ -656,7 +833,13 @@ func (font *FontInfo) GetGlyphShape(glyphIndex int) []Vertex {
 		comp := g + 10
 		numVertices = 0
 		vertices = nil
-		for more {
+		// the offsets of the components of instances of variable fonts vary like points
+		var dx, dy []float64
+		if font.coords != nil {
+			count := font.glyphPointCount(glyphIndex)
+			dx, dy = font.glyphDeltas(glyphIndex, count+4, nil, nil, nil)
+		}
+		for component := 0; more; component++ {
 			var mtx = [6]float64{1, 0, 0, 1, 0, 0}
 
 			flags := int(u16(data, comp))
@@ -680,6 +863,10 @@ func (font *FontInfo) GetGlyphShape(glyphIndex int) []Vertex {
 				// @TODO handle matching point
 				panic("Handle matching point")
 			}
+			if component < len(dx)-4 {
+				mtx[4] += math.Floor(dx[component] + 0.5)
+				mtx[5] += math.Floor(dy[component] + 0.5)
+			}
 			if flags&(1<<3) != 0 { // WE_HAVE_A_SCALE
 				mtx[3] = float64(u16(data, comp)) / 16384.
 				comp += 2
@@ -758,7 +945,7 @@ func closeShape(vertices []Vertex, numVertices int, wasOff, startOff bool, sx, s
 }
 
 func (font *FontInfo) GetGlyphOffset(glyphIndex int) int {
-	if glyphIndex >= font.numGlyphs {
+	if font.glyf == 0 || glyphIndex >= font.numGlyphs {
 		// Glyph index out of range
 		return -1
 	}
@@ -813,13 +1000,19 @@ func (font *FontInfo) MakeGlyphBitmapSubpixel(output []byte, outW, outH, outStri
 }
 
 func (font *FontInfo) GetCodepointKernAdvance(ch1, ch2 int) int {
-	if font.kern == 0 {
+	if font.kern == 0 && len(font.kernLookups) == 0 {
 		return 0
 	}
 	return font.GetGlyphKernAdvance(font.FindGlyphIndex(ch1), font.FindGlyphIndex(ch2))
 }
 
+// GetGlyphKernAdvance returns the kerning between the glyphs in unscaled units.
+// GPOS pair adjustments of the kern feature are used when the font has them,
+// otherwise the first subtable of the legacy kern table.
 func (font *FontInfo) GetGlyphKernAdvance(glyph1, glyph2 int) int {
+	if advance, ok := font.getGPOSKernAdvance(glyph1, glyph2); ok {
+		return advance
+	}
 	data := font.kern
 
 	// we only look at the first table. it must be 'horizontal' and format 0.
@@ -914,7 +1107,8 @@ func (font *FontInfo) FindGlyphIndex(unicodeCodepoint int) int {
 
 		offset := int(u16(data, indexMap+14+segcount*6+2+2*item))
 		if offset == 0 {
-			return unicodeCodepoint + int(int16(u16(data, indexMap+14+segcount*4+2+2*item)))
+			// idDelta is added modulo 65536
+			return (unicodeCodepoint + int(u16(data, indexMap+14+segcount*4+2+2*item))) & 0xffff
 		}
 		return int(u16(data, offset+(unicodeCodepoint-start)*2+indexMap+14+segcount*6+2+2*item))
 	} else if format == 12 || format == 13 {
@@ -943,6 +1137,57 @@ func (font *FontInfo) FindGlyphIndex(unicodeCodepoint int) int {
 	panic("Glyph not found!")
 }
 
+// GetCodepointRanges returns the ranges of codepoints mapped to glyphs by the cmap, sorted and
+// not overlapping. Every range is the first and the last codepoint.
+func (font *FontInfo) GetCodepointRanges() [][2]int {
+	data := font.data
+	indexMap := font.indexMap
+	var ranges [][2]int
+	add := func(first, last int) {
+		if n := len(ranges); n > 0 && ranges[n-1][1]+1 >= first {
+			ranges[n-1][1] = maxInt(ranges[n-1][1], last)
+		} else {
+			ranges = append(ranges, [2]int{first, last})
+		}
+	}
+	addMapped := func(first, last int) {
+		for c := first; c <= last; c++ {
+			if font.FindGlyphIndex(c) != 0 {
+				add(c, c)
+			}
+		}
+	}
+
+	switch u16(data, indexMap) {
+	case 0:
+		addMapped(0, int(u16(data, indexMap+2))-7)
+	case 6:
+		first := int(u16(data, indexMap+6))
+		addMapped(first, first+int(u16(data, indexMap+8))-1)
+	case 4:
+		segcount := int(u16(data, indexMap+6) >> 1)
+		for i := 0; i < segcount; i++ {
+			end := int(u16(data, indexMap+14+i*2))
+			start := int(u16(data, indexMap+16+segcount*2+i*2))
+			if start == 0xffff {
+				continue
+			}
+			if u16(data, indexMap+16+segcount*6+i*2) == 0 {
+				add(start, end)
+			} else {
+				addMapped(start, end)
+			}
+		}
+	case 12, 13:
+		ngroups := int(u32(data, indexMap+12))
+		for i := 0; i < ngroups; i++ {
+			group := indexMap + 16 + i*12
+			add(int(u32(data, group)), int(u32(data, group+4)))
+		}
+	}
+	return ranges
+}
+
 func findTable(data []byte, offset int, tag string) int {
 	numTables := int(u16(data, offset+4))
 	tableDir := offset + 12
@@ -0,0 +1,594 @@
+package truetype
+
+import (
+	"math"
+)
+
+// OpenType font variations: the axes of the fvar table, normalized with the
+// avar table, select an instance of the font. Glyph outlines are varied with
+// the deltas of the gvar table, advances with the HVAR table, and CFF2
+// charstrings with the blend operator and their ItemVariationStore.
+
+// Axis is a variation axis of a variable font, in user units like 400 for the
+// regular weight.
+type Axis struct {
+	Tag               string
+	Min, Default, Max float32
+}
+
+const (
+	gvarSharedPointNumbers  = 0x8000
+	gvarTupleCountMask      = 0x0fff
+	gvarEmbeddedPeakTuple   = 0x8000
+	gvarIntermediateRegion  = 0x4000
+	gvarPrivatePointNumbers = 0x2000
+	gvarTupleIndexMask      = 0x0fff
+)
+
+// IsVariable returns true if the font has variation axes.
+func (font *FontInfo) IsVariable() bool {
+	return font.fvar != 0
+}
+
+// GetAxes returns the variation axes of the font, nil if it isn't variable.
+func (font *FontInfo) GetAxes() []Axis {
+	if font.fvar == 0 {
+		return nil
+	}
+	b := cffBuf{data: font.data, cursor: font.fvar + 4}
+	offset := int(b.get(2))
+	b.skip(2)
+	count := int(b.get(2))
+	size := int(b.get(2))
+	axes := make([]Axis, count)
+	for i := range axes {
+		b.seek(font.fvar + offset + i*size)
+		tag := []byte{byte(b.get8()), byte(b.get8()), byte(b.get8()), byte(b.get8())}
+		axes[i] = Axis{
+			Tag:     string(tag),
+			Min:     float32(int32(b.get(4))) / 65536,
+			Default: float32(int32(b.get(4))) / 65536,
+			Max:     float32(int32(b.get(4))) / 65536,
+		}
+	}
+	return axes
+}
+
+// NormalizeVariation returns the normalized coordinates of the axes for the
+// values in user units, with the avar mapping applied. Axes without a value
+// keep their default. It returns nil at the default instance.
+func (font *FontInfo) NormalizeVariation(values map[string]float32) []float64 {
+	axes := font.GetAxes()
+	coords := make([]float64, len(axes))
+	varied := false
+	for i, axis := range axes {
+		value, ok := values[axis.Tag]
+		if !ok {
+			continue
+		}
+		var v float64
+		if value < axis.Default && axis.Default > axis.Min {
+			v = float64(value-axis.Default) / float64(axis.Default-axis.Min)
+		} else if value > axis.Default && axis.Max > axis.Default {
+			v = float64(value-axis.Default) / float64(axis.Max-axis.Default)
+		}
+		v = math.Max(-1, math.Min(1, v))
+		v = font.mapAxis(i, v)
+		// coordinates are 2.14 fixed point numbers
+		coords[i] = math.Floor(v*16384+0.5) / 16384
+		varied = varied || coords[i] != 0
+	}
+	if !varied {
+		return nil
+	}
+	return coords
+}
+
+// mapAxis maps the normalized coordinate of the axis with the segment map of the avar table.
+func (font *FontInfo) mapAxis(axis int, v float64) float64 {
+	if font.avar == 0 {
+		return v
+	}
+	b := cffBuf{data: font.data, cursor: font.avar + 6}
+	if axis >= int(b.get(2)) {
+		return v
+	}
+	for i := 0; i < axis; i++ {
+		b.skip(int(b.get(2)) * 4)
+	}
+	count := int(b.get(2))
+	var prevFrom, prevTo float64
+	for i := 0; i < count; i++ {
+		from := float64(int16(b.get(2))) / 16384
+		to := float64(int16(b.get(2))) / 16384
+		if v == from {
+			return to
+		}
+		if v < from {
+			if i == 0 || from == prevFrom {
+				return to
+			}
+			return prevTo + (to-prevTo)*(v-prevFrom)/(from-prevFrom)
+		}
+		prevFrom, prevTo = from, to
+	}
+	if count == 0 {
+		return v
+	}
+	return prevTo
+}
+
+// Instance returns the font at the normalized coordinates returned by
+// NormalizeVariation. The instance shares the font data, nil coordinates
+// return the default instance.
+func (font *FontInfo) Instance(coords []float64) *FontInfo {
+	instance := *font
+	instance.coords = coords
+	if font.cff != nil {
+		cff := *font.cff
+		cff.coords = coords
+		instance.cff = &cff
+	}
+	return &instance
+}
+
+// tupleScalar returns the scalar of the deltas of a region at the coordinates.
+// Without start and end the region spans from 0 to the peak.
+func tupleScalar(coords, peak, start, end []float64) float64 {
+	scalar := 1.0
+	for i, p := range peak {
+		if p == 0 || i >= len(coords) {
+			continue
+		}
+		v := coords[i]
+		if v == p {
+			continue
+		}
+		s, e := math.Min(p, 0), math.Max(p, 0)
+		if start != nil {
+			s, e = start[i], end[i]
+			if s > p || p > e || s < 0 && e > 0 {
+				continue
+			}
+		}
+		if v <= s || v >= e {
+			return 0
+		}
+		if v < p {
+			scalar *= (v - s) / (p - s)
+		} else {
+			scalar *= (e - v) / (e - p)
+		}
+	}
+	return scalar
+}
+
+// itemVariationStore reads an ItemVariationStore at offset in data.
+type itemVariationStore struct {
+	data   []byte
+	offset int
+}
+
+// regionScalars returns the scalar of each region of the ItemVariationData
+// outer at the coordinates.
+func (store itemVariationStore) regionScalars(outer int, coords []float64) []float64 {
+	b := cffBuf{data: store.data, cursor: store.offset + 2}
+	regionList := store.offset + int(b.get(4))
+	if outer < 0 || outer >= int(b.get(2)) {
+		return nil
+	}
+	b.skip(outer * 4)
+	b.seek(store.offset + int(b.get(4)) + 4)
+	scalars := make([]float64, b.get(2))
+	if coords == nil {
+		return scalars
+	}
+	regions := cffBuf{data: store.data, cursor: regionList}
+	axisCount := int(regions.get(2))
+	regionCount := int(regions.get(2))
+	peak := make([]float64, axisCount)
+	start := make([]float64, axisCount)
+	end := make([]float64, axisCount)
+	for i := range scalars {
+		region := int(b.get(2))
+		if region >= regionCount {
+			continue
+		}
+		regions.seek(regionList + 4 + region*axisCount*6)
+		for a := 0; a < axisCount; a++ {
+			start[a] = float64(int16(regions.get(2))) / 16384
+			peak[a] = float64(int16(regions.get(2))) / 16384
+			end[a] = float64(int16(regions.get(2))) / 16384
+		}
+		scalars[i] = tupleScalar(coords, peak, start, end)
+	}
+	return scalars
+}
+
+// delta returns the delta of the item inner of the ItemVariationData outer at the coordinates.
+func (store itemVariationStore) delta(outer, inner int, coords []float64) float64 {
+	scalars := store.regionScalars(outer, coords)
+	b := cffBuf{data: store.data, cursor: store.offset + 8 + outer*4}
+	data := store.offset + int(b.get(4))
+	b.seek(data)
+	itemCount := int(b.get(2))
+	wordCount := int(b.get(2))
+	if inner < 0 || inner >= itemCount {
+		return 0
+	}
+	// long words have 32 bit words and 16 bit short deltas
+	size := 1
+	if wordCount&0x8000 != 0 {
+		size = 2
+	}
+	wordCount &= 0x7fff
+	rowSize := wordCount*size*2 + (len(scalars)-wordCount)*size
+	b.seek(data + 6 + len(scalars)*2 + inner*rowSize)
+	var delta float64
+	for i, scalar := range scalars {
+		var d int
+		if i < wordCount {
+			d = signExtend(b.get(size*2), size*2)
+		} else {
+			d = signExtend(b.get(size), size)
+		}
+		delta += scalar * float64(d)
+	}
+	return delta
+}
+
+func signExtend(v uint32, n int) int {
+	shift := uint(32 - n*8)
+	return int(int32(v<<shift) >> shift)
+}
+
+// advanceDelta returns the change of the advance of the glyph at the
+// coordinates of the instance, from the HVAR table or from the phantom
+// points of the gvar table.
+func (font *FontInfo) advanceDelta(glyphIndex int) float64 {
+	if font.hvar != 0 {
+		b := cffBuf{data: font.data, cursor: font.hvar + 4}
+		store := itemVariationStore{data: font.data, offset: font.hvar + int(b.get(4))}
+		mapping := int(b.get(4))
+		outer, inner := 0, glyphIndex
+		if mapping != 0 {
+			outer, inner = deltaSetIndex(font.data, font.hvar+mapping, glyphIndex)
+		}
+		return store.delta(outer, inner, font.coords)
+	}
+	count := font.glyphPointCount(glyphIndex)
+	dx, _ := font.glyphDeltas(glyphIndex, count+4, nil, nil, nil)
+	if dx == nil {
+		return 0
+	}
+	return dx[count+1] - dx[count]
+}
+
+// deltaSetIndex returns the outer and inner indexes of the item of the glyph
+// in a DeltaSetIndexMap.
+func deltaSetIndex(data []byte, offset, glyphIndex int) (int, int) {
+	b := cffBuf{data: data, cursor: offset}
+	format := b.get8()
+	entryFormat := b.get8()
+	var count int
+	if format == 0 {
+		count = int(b.get(2))
+	} else {
+		count = int(b.get(4))
+	}
+	if count == 0 {
+		return 0, glyphIndex
+	}
+	if glyphIndex >= count {
+		glyphIndex = count - 1
+	}
+	innerBits := uint(entryFormat&0x0f + 1)
+	size := (entryFormat&0x30)>>4 + 1
+	b.skip(glyphIndex * size)
+	entry := int(b.get(size))
+	return entry >> innerBits, entry & (1<<innerBits - 1)
+}
+
+// glyphPointCount returns the number of points of a simple glyph, or of
+// components of a composite glyph, which are varied like points.
+func (font *FontInfo) glyphPointCount(glyphIndex int) int {
+	g := font.GetGlyphOffset(glyphIndex)
+	if g < 0 {
+		return 0
+	}
+	numberOfContours := int(int16(u16(font.data, g)))
+	if numberOfContours > 0 {
+		return 1 + int(u16(font.data, g+10+numberOfContours*2-2))
+	}
+	count := 0
+	b := cffBuf{data: font.data, cursor: g + 10}
+	for more := numberOfContours < 0; more; count++ {
+		flags := int(b.get(2))
+		b.skip(2)
+		if flags&1 != 0 {
+			b.skip(4)
+		} else {
+			b.skip(2)
+		}
+		if flags&(1<<3) != 0 {
+			b.skip(2)
+		} else if flags&(1<<6) != 0 {
+			b.skip(4)
+		} else if flags&(1<<7) != 0 {
+			b.skip(8)
+		}
+		more = flags&(1<<5) != 0 && !b.done()
+	}
+	return count
+}
+
+// glyphDeltas returns the deltas of the numPoints points of the glyph at the
+// coordinates of the instance, including the 4 phantom points. The points
+// xs, ys and contour ends endPts of simple glyphs are needed to interpolate
+// the deltas of the points which a region doesn't move. It returns nil if
+// the glyph doesn't vary.
+func (font *FontInfo) glyphDeltas(glyphIndex, numPoints int, xs, ys, endPts []int) (dx, dy []float64) {
+	if font.gvar == 0 || font.coords == nil {
+		return nil, nil
+	}
+	data := font.data
+	b := cffBuf{data: data, cursor: font.gvar + 4}
+	axisCount := int(b.get(2))
+	sharedTupleCount := int(b.get(2))
+	sharedTuples := font.gvar + int(b.get(4))
+	glyphCount := int(b.get(2))
+	flags := int(b.get(2))
+	dataArray := font.gvar + int(b.get(4))
+	if glyphIndex >= glyphCount {
+		return nil, nil
+	}
+	var start, end int
+	if flags&1 != 0 {
+		b.skip(glyphIndex * 4)
+		start, end = int(b.get(4)), int(b.get(4))
+	} else {
+		b.skip(glyphIndex * 2)
+		start, end = int(b.get(2))*2, int(b.get(2))*2
+	}
+	if end <= start {
+		return nil, nil
+	}
+	glyphData := dataArray + start
+
+	b.seek(glyphData)
+	tupleCount := int(b.get(2))
+	serialized := cffBuf{data: data, cursor: glyphData + int(b.get(2))}
+	var sharedPoints []int
+	if tupleCount&gvarSharedPointNumbers != 0 {
+		sharedPoints = readPointNumbers(&serialized, numPoints)
+	}
+
+	dx = make([]float64, numPoints)
+	dy = make([]float64, numPoints)
+	peak := make([]float64, axisCount)
+	startTuple := make([]float64, axisCount)
+	endTuple := make([]float64, axisCount)
+	readTuple := func(tuple []float64, r *cffBuf) {
+		for i := range tuple {
+			tuple[i] = float64(int16(r.get(2))) / 16384
+		}
+	}
+	for t := 0; t < tupleCount&gvarTupleCountMask; t++ {
+		size := int(b.get(2))
+		index := int(b.get(2))
+		next := serialized.cursor + size
+		if index&gvarEmbeddedPeakTuple != 0 {
+			readTuple(peak, &b)
+		} else {
+			if index&gvarTupleIndexMask >= sharedTupleCount {
+				return nil, nil
+			}
+			shared := cffBuf{data: data, cursor: sharedTuples + (index&gvarTupleIndexMask)*axisCount*2}
+			readTuple(peak, &shared)
+		}
+		var scalar float64
+		if index&gvarIntermediateRegion != 0 {
+			readTuple(startTuple, &b)
+			readTuple(endTuple, &b)
+			scalar = tupleScalar(font.coords, peak, startTuple, endTuple)
+		} else {
+			scalar = tupleScalar(font.coords, peak, nil, nil)
+		}
+		if scalar == 0 {
+			serialized.seek(next)
+			continue
+		}
+
+		points := sharedPoints
+		if index&gvarPrivatePointNumbers != 0 {
+			points = readPointNumbers(&serialized, numPoints)
+		}
+		count := len(points)
+		if points == nil {
+			count = numPoints
+		}
+		tx := readDeltas(&serialized, count)
+		ty := readDeltas(&serialized, count)
+		serialized.seek(next)
+		if points != nil {
+			tx, ty = interpolateDeltas(points, tx, ty, numPoints, xs, ys, endPts)
+		}
+		for i := range tx {
+			dx[i] += scalar * tx[i]
+			dy[i] += scalar * ty[i]
+		}
+	}
+	return dx, dy
+}
+
+// readPointNumbers reads packed point numbers. It returns nil when all the
+// points are varied.
+func readPointNumbers(b *cffBuf, numPoints int) []int {
+	count := b.get8()
+	if count == 0 {
+		return nil
+	}
+	if count&0x80 != 0 {
+		count = (count&0x7f)<<8 | b.get8()
+	}
+	points := make([]int, 0, count)
+	point := 0
+	for len(points) < count && !b.done() {
+		control := b.get8()
+		size := 1
+		if control&0x80 != 0 {
+			size = 2
+		}
+		for i := 0; i <= control&0x7f && len(points) < count; i++ {
+			point += int(b.get(size))
+			if point < numPoints {
+				points = append(points, point)
+			}
+		}
+	}
+	return points
+}
+
+// readDeltas reads count packed deltas.
+func readDeltas(b *cffBuf, count int) []float64 {
+	deltas := make([]float64, 0, count)
+	for len(deltas) < count && !b.done() {
+		control := b.get8()
+		for i := 0; i <= control&0x3f && len(deltas) < count; i++ {
+			switch {
+			case control&0x80 != 0:
+				deltas = append(deltas, 0)
+			case control&0x40 != 0:
+				deltas = append(deltas, float64(int16(b.get(2))))
+			default:
+				deltas = append(deltas, float64(int8(b.get8())))
+			}
+		}
+	}
+	for len(deltas) < count {
+		deltas = append(deltas, 0)
+	}
+	return deltas
+}
+
+// interpolateDeltas returns the deltas of all the points from the deltas of
+// the points varied by a region. The other points of a contour get deltas
+// interpolated between the varied points around them, phantom points and
+// the points of contours which aren't varied at all don't move.
+func interpolateDeltas(points []int, tx, ty []float64, numPoints int, xs, ys, endPts []int) ([]float64, []float64) {
+	dx := make([]float64, numPoints)
+	dy := make([]float64, numPoints)
+	touched := make([]bool, numPoints)
+	for i, p := range points {
+		dx[p], dy[p] = tx[i], ty[i]
+		touched[p] = true
+	}
+	if xs == nil {
+		return dx, dy
+	}
+	first := 0
+	for _, last := range endPts {
+		if last >= len(xs) {
+			break
+		}
+		interpolateContour(xs, dx, touched, first, last)
+		interpolateContour(ys, dy, touched, first, last)
+		first = last + 1
+	}
+	return dx, dy
+}
+
+// interpolateContour interpolates the deltas of the untouched points of the
+// contour [first, last] in one direction.
+func interpolateContour(coords []int, deltas []float64, touched []bool, first, last int) {
+	start := -1
+	for i := first; i <= last; i++ {
+		if touched[i] {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return
+	}
+	next := func(i int) int {
+		if i == last {
+			return first
+		}
+		return i + 1
+	}
+	prev := start
+	for i := next(start); ; i = next(i) {
+		if !touched[i] {
+			continue
+		}
+		// the points between prev and i are untouched
+		c1, c2 := float64(coords[prev]), float64(coords[i])
+		d1, d2 := deltas[prev], deltas[i]
+		if c1 > c2 {
+			c1, c2, d1, d2 = c2, c1, d2, d1
+		}
+		for j := next(prev); j != i; j = next(j) {
+			c := float64(coords[j])
+			switch {
+			case c1 == c2:
+				if d1 == d2 {
+					deltas[j] = d1
+				}
+			case c <= c1:
+				deltas[j] = d1
+			case c >= c2:
+				deltas[j] = d2
+			default:
+				deltas[j] = d1 + (c-c1)/(c2-c1)*(d2-d1)
+			}
+		}
+		if i == start {
+			break
+		}
+		prev = i
+	}
+}
+
+// variedGlyphBox returns the bounding box of the varied outline of the glyph.
+func (font *FontInfo) variedGlyphBox(glyphIndex int) (result bool, x0, y0, x1, y1 int) {
+	vertices := font.GetGlyphShape(glyphIndex)
+	if len(vertices) == 0 {
+		return false, 0, 0, 0, 0
+	}
+	x0, y0, x1, y1 = shapeBox(vertices)
+	return true, x0, y0, x1, y1
+}
+
+// shapeBox returns the bounding box of the vertices and their control points.
+func shapeBox(vertices []Vertex) (x0, y0, x1, y1 int) {
+	x0, y0 = math.MaxInt32, math.MaxInt32
+	x1, y1 = math.MinInt32, math.MinInt32
+	for _, v := range vertices {
+		x0, y0 = minInt(x0, v.X), minInt(y0, v.Y)
+		x1, y1 = maxInt(x1, v.X), maxInt(y1, v.Y)
+		if v.Type == vcurve || v.Type == vcubic {
+			x0, y0 = minInt(x0, v.CX), minInt(y0, v.CY)
+			x1, y1 = maxInt(x1, v.CX), maxInt(y1, v.CY)
+		}
+		if v.Type == vcubic {
+			x0, y0 = minInt(x0, v.CX1), minInt(y0, v.CY1)
+			x1, y1 = maxInt(x1, v.CX1), maxInt(y1, v.CY1)
+		}
+	}
+	return
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
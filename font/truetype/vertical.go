@@ -0,0 +1,31 @@
+package truetype
+
+// HasVerticalMetrics returns whether the font has the vhea and vmtx tables.
+func (font *FontInfo) HasVerticalMetrics() bool {
+	return font.vhea != 0 && font.vmtx != 0
+}
+
+// GetGlyphVMetrics returns the advance height and the top side bearing of the glyph for
+// vertical text, the distance from the vertical origin to the top of the glyph. Without
+// vmtx, glyphs are as high as the ascender and the descender, and their origin is at the
+// ascender.
+func (font *FontInfo) GetGlyphVMetrics(glyphIndex int) (advance, tsb int) {
+	data := font.data
+	if font.HasVerticalMetrics() {
+		numOfLongVerMetrics := int(u16(data, font.vhea+34))
+		if numOfLongVerMetrics > 0 {
+			if glyphIndex < numOfLongVerMetrics {
+				return int(u16(data, font.vmtx+4*glyphIndex)), int(int16(u16(data, font.vmtx+4*glyphIndex+2)))
+			}
+			advance = int(u16(data, font.vmtx+4*(numOfLongVerMetrics-1)))
+			tsb = int(int16(u16(data, font.vmtx+4*numOfLongVerMetrics+2*(glyphIndex-numOfLongVerMetrics))))
+			return
+		}
+	}
+	ascent, descent, _ := font.GetFontVMetrics()
+	advance = ascent - descent
+	if ok, _, _, _, y1 := font.GetGlyphBox(glyphIndex); ok {
+		tsb = ascent - y1
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package font
+
+import (
+	"math"
+)
+
+// Variation is the value of a variation axis of variable fonts, in the
+// units of the axis, like Variation{"wght", 700} for bold.
+type Variation struct {
+	Tag   string
+	Value float32
+}
+
+// SetVariations sets the values of the variation axes of variable fonts.
+// Axes which aren't set, and fonts without the axes, keep their defaults.
+func (stash *FontStash) SetVariations(variations []Variation) {
+	stash.state.variations = variations
+}
+
+// varied returns the instance of the font at the variations of the state,
+// or the font itself if it isn't varied. Instances share the glyph cache
+// of their font, where the variation coordinates are part of the keys.
+func (stash *FontStash) varied(font *Font) *Font {
+	if len(stash.state.variations) == 0 || !font.font.IsVariable() {
+		return font
+	}
+	values := make(map[string]float32, len(stash.state.variations))
+	for _, v := range stash.state.variations {
+		values[v.Tag] = v.Value
+	}
+	coords := font.font.NormalizeVariation(values)
+	if coords == nil {
+		return font
+	}
+	key := variationKey(coords)
+	if instance, ok := font.instances[key]; ok {
+		return instance
+	}
+	if font.instances == nil {
+		font.instances = make(map[string]*Font)
+	}
+	instance := *font
+	instance.font = font.font.Instance(coords)
+	instance.variation = key
+	instance.instances = nil
+	font.instances[key] = &instance
+	return &instance
+}
+
+// variationKey encodes the normalized coordinates, which are 2.14 fixed point numbers.
+func variationKey(coords []float64) string {
+	key := make([]byte, 0, len(coords)*2)
+	for _, c := range coords {
+		v := uint16(int16(math.Floor(c*16384 + 0.5)))
+		key = append(key, byte(v>>8), byte(v))
+	}
+	return string(key)
+}
@@ -0,0 +1,163 @@
+package font
+
+import (
+	"math"
+)
+
+// FONSWritingMode selects whether text runs in rows or in columns.
+type FONSWritingMode int
+
+const (
+	WRITING_HORIZONTAL FONSWritingMode = iota // rows from left to right
+	WRITING_VERTICAL                          // columns from top to bottom
+)
+
+// SetWritingMode sets whether text runs in rows or in columns. In vertical text, upright
+// glyphs like the ones of CJK scripts are centered on the column, with the vertical
+// metrics of vmtx, and the other glyphs are rotated clockwise. The column is centered
+// on x for ALIGN_CENTER, and has its left or right edge at x for ALIGN_LEFT and
+// ALIGN_RIGHT. It starts at y, unless it is aligned with ALIGN_MIDDLE or ALIGN_BOTTOM.
+func (stash *FontStash) SetWritingMode(mode FONSWritingMode) {
+	stash.state.writing = mode
+}
+
+// isUpright returns whether the rune stays upright in vertical text, a simplified
+// Vertical_Orientation of Unicode. Runes of CJK scripts, fullwidth forms and many
+// symbols are upright, the others are rotated.
+func isUpright(r rune) bool {
+	switch {
+	case r == 0xA7, r == 0xA9, r == 0xAE, r == 0xB1, r >= 0xBC && r <= 0xBE, r == 0xD7, r == 0xF7:
+	case r >= 0x1100 && r <= 0x11FF: // Hangul Jamo
+	case r >= 0x2100 && r <= 0x214F: // letterlike symbols
+	case r >= 0x2460 && r <= 0x24FF, r >= 0x25A0 && r <= 0x27BF: // enclosed alphanumerics, shapes and dingbats
+	case r >= 0x2E80 && r <= 0xA4CF: // CJK, kana, bopomofo and Yi
+	case r >= 0xA960 && r <= 0xA97F, r >= 0xAC00 && r <= 0xD7FF: // Hangul
+	case r >= 0xF900 && r <= 0xFAFF: // CJK compatibility ideographs
+	case r >= 0xFE10 && r <= 0xFE1F, r >= 0xFE30 && r <= 0xFE6F: // vertical, compatibility and small forms
+	case r >= 0xFF01 && r <= 0xFF60, r >= 0xFFE0 && r <= 0xFFE7: // fullwidth forms
+	case r >= 0x1F000 && r <= 0x1FAFF: // emoji and pictographs
+	case r >= 0x20000 && r <= 0x3FFFF: // CJK extensions
+	default:
+		return false
+	}
+	return true
+}
+
+// columnX returns the center of a column of text aligned at x.
+func (stash *FontStash) columnX(x float32) float32 {
+	state := stash.state
+	if (state.align & ALIGN_LEFT) != 0 {
+		return x + state.size*0.5
+	} else if (state.align & ALIGN_RIGHT) != 0 {
+		return x - state.size*0.5
+	}
+	return x
+}
+
+// columnShift returns how much a column of height is moved up by its vertical alignment.
+func (stash *FontStash) columnShift(height float32) float32 {
+	state := stash.state
+	if (state.align & ALIGN_MIDDLE) != 0 {
+		return height * 0.5
+	} else if (state.align & ALIGN_BOTTOM) != 0 {
+		return height
+	}
+	return 0
+}
+
+// verticalTextBounds is TextBoundsOfRunes for vertical text, whose advance is the height of the column.
+func (stash *FontStash) verticalTextBounds(font *Font, x, y float32, runes []rune) (float32, []float32) {
+	state := stash.state
+	size := int(state.size * 10.0)
+	blur := int(state.blur)
+	x = stash.columnX(x)
+
+	minX, minY, maxX, maxY := x, y, x, y
+	startY := y
+	glyphs := stash.shape(font, runes, state.features, state.direction, true, true)
+	for i := range glyphs {
+		var prev *shapedGlyph
+		if i > 0 {
+			prev = &glyphs[i-1]
+		}
+		var glyph *Glyph
+		var quad Quad
+		glyph, quad, y = stash.getVerticalQuad(prev, &glyphs[i], state.spacing, state.features, size, blur, state.mode, x, y)
+		if glyph != nil {
+			if quad.X0 < minX {
+				minX = quad.X0
+			}
+			if quad.X1 > maxX {
+				maxX = quad.X1
+			}
+			if quad.Y0 < minY {
+				minY = quad.Y0
+			}
+			if quad.Y1 > maxY {
+				maxY = quad.Y1
+			}
+		}
+	}
+	height := y - startY
+	shift := stash.columnShift(height)
+	return height, []float32{minX, minY - shift, maxX, maxY - shift}
+}
+
+// getVerticalQuad is glyphQuad for vertical text in the column centered on x. It returns
+// the pen position below the glyph. Glyphs are placed like horizontal ones at the origin,
+// then moved to the column or rotated. Kerning only applies between rotated glyphs, and
+// LCD glyphs are replaced by subpixel ones, as their subpixels would be rotated.
+func (stash *FontStash) getVerticalQuad(prev, shaped *shapedGlyph, spacing float32, features FONSFeature, size, blur int, mode FONSRenderMode, x, y float32) (*Glyph, Quad, float32) {
+	if mode == RENDER_LCD {
+		mode = RENDER_SUBPIXEL
+	}
+	glyph, quad, advance, _ := stash.glyphQuad(nil, shaped, 0, features, size, blur, mode, 0, 0)
+	if glyph == nil {
+		return nil, Quad{}, y
+	}
+	renderFont := shaped.font
+	scale := renderFont.getPixelHeightScale(float32(size) / 10.0)
+	if prev != nil && !shaped.joined {
+		y += spacing
+	}
+	if prev != nil && !prev.upright && !shaped.upright && features&FEATURE_KERNING != 0 && !shaped.positioned && prev.font == renderFont {
+		y += float32(renderFont.getGlyphKernAdvance(prev.index, shaped.index)) * scale
+	}
+	snap := func(v float32) float32 {
+		if glyph.sdf {
+			return v
+		}
+		return float32(math.Floor(float64(v) + 0.5))
+	}
+
+	if shaped.upright {
+		hAdvance, _ := renderFont.font.GetGlyphHMetrics(shaped.index)
+		vAdvance, tsb := renderFont.font.GetGlyphVMetrics(shaped.index)
+		_, _, _, _, top := renderFont.font.GetGlyphBox(shaped.index)
+		// the vertical origin is at the middle of the advance and tsb above the glyph
+		dx := snap(x - float32(hAdvance)*scale*0.5)
+		dy := snap(y + float32(tsb+top)*scale)
+		quad.X0 += dx
+		quad.X1 += dx
+		quad.Y0 += dy
+		quad.Y1 += dy
+		return glyph, quad, y + float32(vAdvance)*scale
+	}
+
+	// the line between the ascender and the descender is centered on the column
+	ascent, descent, _ := renderFont.font.GetFontVMetrics()
+	baseline := snap(x - float32(ascent+descent)*scale*0.5)
+	top := snap(y)
+	quad = Quad{
+		X0:      baseline - quad.Y1,
+		Y0:      top + quad.X0,
+		X1:      baseline - quad.Y0,
+		Y1:      top + quad.X1,
+		S0:      quad.S0,
+		T0:      quad.T0,
+		S1:      quad.S1,
+		T1:      quad.T1,
+		Rotated: true,
+	}
+	return glyph, quad, y + advance
+}
@@ -3,7 +3,7 @@ module github.com/jxo/davinci
 require (
 	github.com/fatih/color v1.9.0 // indirect
 	github.com/fogleman/gg v1.3.0 // indirect
-	github.com/go-gl/gl v0.0.0-20190320180904-bf2b1f2f34d7 // indirect
+	github.com/go-gl/gl v0.0.0-20190320180904-bf2b1f2f34d7
 	github.com/go-gl/glfw v0.0.0-20190409004039-e6da0acd62b1 // indirect
 	github.com/goki/freetype v0.0.0-20181231101311-fa8a33aabaff
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
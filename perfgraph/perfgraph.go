@@ -17,6 +17,40 @@ const (
 	RenderFPS RenderStyle = iota
 	RenderMS
 	RenderPercent
+	RenderSeries // Graphs a StatsSeries, see NewStatsGraph()
+)
+
+// StatsSeries picks one value of vg.FrameStats to graph.
+type StatsSeries struct {
+	Unit  string
+	Value func(stats vg.FrameStats) float32
+}
+
+var (
+	SeriesDrawCalls = StatsSeries{"calls", func(s vg.FrameStats) float32 {
+		return float32(s.Render.DrawCalls)
+	}}
+	SeriesMergedCalls = StatsSeries{"merged", func(s vg.FrameStats) float32 {
+		return float32(s.Render.MergedCalls)
+	}}
+	SeriesTriangles = StatsSeries{"tris", func(s vg.FrameStats) float32 {
+		return float32(s.FillTriangles + s.StrokeTriangles + s.TextTriangles)
+	}}
+	SeriesTextTriangles = StatsSeries{"tris", func(s vg.FrameStats) float32 {
+		return float32(s.TextTriangles)
+	}}
+	SeriesVertexBytes = StatsSeries{"KB", func(s vg.FrameStats) float32 {
+		return float32(s.Render.VertexBytes) / 1024
+	}}
+	SeriesTextureUploads = StatsSeries{"uploads", func(s vg.FrameStats) float32 {
+		return float32(s.Render.TextureUploads)
+	}}
+	SeriesFontAtlasUsage = StatsSeries{"%", func(s vg.FrameStats) float32 {
+		return s.FontAtlasUsage * 100
+	}}
+	SeriesSaveCalls = StatsSeries{"saves", func(s vg.FrameStats) float32 {
+		return float32(s.SaveCalls)
+	}}
 )
 
 var backgroundColor = vg.RGBA(0, 0, 0, 128)
@@ -33,6 +67,7 @@ type PerfGraph struct {
 	style    RenderStyle
 	values   [graphHistoryCount]float32
 	head     int
+	series   StatsSeries
 
 	startTime      time.Time
 	lastUpdateTime time.Time
@@ -55,6 +90,20 @@ func NewPerfGraph(name, fontFace string, style RenderStyle) *PerfGraph {
 	}
 }
 
+// NewStatsGraph creates PerfGraph instance which shows the specified series of vg.FrameStats.
+// Values are recorded by UpdateStats().
+func NewStatsGraph(name, fontFace string, series StatsSeries) *PerfGraph {
+	pg := NewPerfGraph(name, fontFace, RenderSeries)
+	pg.series = series
+	return pg
+}
+
+// UpdateStats records the value of the graph's series. Call it after vg.Context.EndFrame().
+func (pg *PerfGraph) UpdateStats(stats vg.FrameStats) {
+	pg.head = (pg.head + 1) % graphHistoryCount
+	pg.values[pg.head] = pg.series.Value(stats)
+}
+
 // UpdateGraph updates timer it is needed to show graph
 func (pg *PerfGraph) UpdateGraph() (timeFromStart, frameTime float32) {
 	timeNow := time.Now()
@@ -91,6 +140,20 @@ func (pg *PerfGraph) RenderGraph(ctx *vg.Context, x, y float32) {
 			vy = y + h - ((v / 80.0) * h)
 			ctx.LineTo(vx, vy)
 		}
+	} else if pg.style == RenderSeries {
+		// Scale to the highest value in the history.
+		var max float32 = 1
+		for _, value := range pg.values {
+			if value > max {
+				max = value
+			}
+		}
+		for i := 0; i < graphHistoryCount; i++ {
+			v = pg.values[(pg.head+i)%graphHistoryCount]
+			vx = x + float32(i)/float32(graphHistoryCount-1)*w
+			vy = y + h - v/max*h
+			ctx.LineTo(vx, vy)
+		}
 	} else if pg.style == RenderPercent {
 		for i := 0; i < graphHistoryCount; i++ {
 			v = float32(pg.values[(pg.head+i)%graphHistoryCount])
@@ -135,6 +198,16 @@ func (pg *PerfGraph) RenderGraph(ctx *vg.Context, x, y float32) {
 		ctx.SetTextAlign(vg.AlignRight | vg.AlignBottom)
 		ctx.SetFillColor(msTextColor)
 		ctx.Text(x+w-3, y+h+1, fmt.Sprintf("%.2f ms", avg*1000.0))
+	} else if pg.style == RenderSeries {
+		ctx.SetFontSize(18.0)
+		ctx.SetTextAlign(vg.AlignRight | vg.AlignTop)
+		ctx.SetFillColor(fpsTextColor)
+		ctx.Text(x+w-3, y+1, fmt.Sprintf("%.1f %s", pg.values[pg.head], pg.series.Unit))
+
+		ctx.SetFontSize(15.0)
+		ctx.SetTextAlign(vg.AlignRight | vg.AlignBottom)
+		ctx.SetFillColor(msTextColor)
+		ctx.Text(x+w-3, y+h+1, fmt.Sprintf("avg %.1f", avg))
 	} else if pg.style == RenderPercent {
 		ctx.SetFontSize(18.0)
 		ctx.SetTextAlign(vg.AlignRight | vg.AlignTop)
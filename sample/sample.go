@@ -55,6 +55,7 @@ func main() {
 	glfw.SwapInterval(0)
 
 	fps := perfgraph.NewPerfGraph("Frame Time", "sans", perfgraph.RenderFPS)
+	calls := perfgraph.NewStatsGraph("Draw Calls", "sans", perfgraph.SeriesDrawCalls)
 
 	for !window.ShouldClose() {
 		t, _ := fps.UpdateGraph()
@@ -80,8 +81,10 @@ func main() {
 
 		demo.RenderDemo(ctx, float32(mx), float32(my), float32(winWidth), float32(winHeight), t, blowup, demoData)
 		fps.RenderGraph(ctx, 5, 5)
+		calls.RenderGraph(ctx, 210, 5)
 
 		ctx.EndFrame()
+		calls.UpdateStats(ctx.FrameStats())
 
 		gl.Enable(gl.DEPTH_TEST)
 		window.SwapBuffers()
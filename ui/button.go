@@ -37,6 +37,7 @@ type Button struct {
 	callback        func()
 	changeCallback  func(bool)
 	buttonGroup     []*Button
+	ellipsis        vg.Ellipsis
 }
 
 func NewButton(parent Widget, captions ...string) *Button {
@@ -139,6 +140,15 @@ func (b *Button) SetIconPosition(p ButtonIconPosition) {
 	b.iconPosition = p
 }
 
+// Ellipsis gets which part of a caption too wide for the button is replaced with an ellipsis.
+func (b *Button) Ellipsis() vg.Ellipsis {
+	return b.ellipsis
+}
+
+func (b *Button) SetEllipsis(mode vg.Ellipsis) {
+	b.ellipsis = mode
+}
+
 func (b *Button) Pushed() bool {
 	return b.pushed
 }
@@ -252,7 +262,7 @@ func (b *Button) PreferredSize(self Widget, ctx *vg.Context) (int, int) {
 		ctx.SetFontSize(ih)
 		iw, _ = ctx.TextBounds(0, 0, string([]rune{rune(b.icon)}))
 		iw += float32(b.y) * 0.15
-	} else if b.imageIcon > 0 {
+	} else if b.imageIcon != 0 {
 		ih *= 0.9
 		w, h, _ := ctx.ImageSize(b.imageIcon)
 		iw = float32(w) * ih / float32(h)
@@ -321,9 +331,27 @@ func (b *Button) Draw(self Widget, ctx *vg.Context) {
 	ctx.Stroke()
 
 	fontSize := float32(b.FontSize())
+	var iw, ih float32
+	if b.icon > 0 {
+		ih = fontSize * 1.5 / 2
+		ctx.SetFontSize(ih)
+		ctx.SetFontFace(b.theme.FontIcons)
+		iw, _ = ctx.TextBounds(0, 0, string([]rune{rune(b.icon)}))
+	} else if b.imageIcon != 0 {
+		ih = fontSize * 0.9
+		w, h, _ := ctx.ImageSize(b.imageIcon)
+		iw = float32(w) * ih / float32(h)
+	}
+	if iw > 0 && b.caption != "" {
+		iw += float32(b.h) * 0.15
+	}
 	ctx.SetFontSize(fontSize)
 	ctx.SetFontFace(b.theme.FontBold)
 	caption := b.caption
+	if b.ellipsis != vg.EllipsisNone {
+		// the caption keeps the padding of PreferredSize
+		caption = ctx.Ellipsize(caption, bw-iw-20, b.ellipsis)
+	}
 	tw, _ := ctx.TextBounds(0, 0, caption)
 
 	centerX := bx + bw*0.5
@@ -332,21 +360,7 @@ func (b *Button) Draw(self Widget, ctx *vg.Context) {
 	textPosY := centerY - 1.0
 
 	textColor := b.TextColor()
-	if b.icon > 0 || b.imageIcon > 0 {
-		var iw, ih float32
-		if b.icon > 0 {
-			ih = fontSize * 1.5 / 2
-			ctx.SetFontSize(ih)
-			ctx.SetFontFace(b.theme.FontIcons)
-			iw, _ = ctx.TextBounds(0, 0, string([]rune{rune(b.icon)}))
-		} else if b.imageIcon > 0 {
-			ih = fontSize * 0.9
-			w, h, _ := ctx.ImageSize(b.imageIcon)
-			iw = float32(w) * ih / float32(h)
-		}
-		if b.caption != "" {
-			iw += float32(b.h) * 0.15
-		}
+	if b.icon > 0 || b.imageIcon != 0 {
 		ctx.SetFillColor(textColor)
 		ctx.SetTextAlign(vg.AlignLeft | vg.AlignMiddle)
 		iconPosX := centerX
@@ -365,6 +379,8 @@ func (b *Button) Draw(self Widget, ctx *vg.Context) {
 			iconPosX = bx + bw - iw - 8
 		}
 		if b.icon > 0 {
+			ctx.SetFontSize(ih)
+			ctx.SetFontFace(b.theme.FontIcons)
 			ctx.TextRune(iconPosX, iconPosY, []rune{rune(b.icon)})
 		} else {
 			var eOff float32 = 0.25
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"github.com/jxo/davinci/vg"
+	"time"
 )
 
 type ImageSizePolicy int
@@ -14,8 +15,11 @@ const (
 type ImageView struct {
 	WidgetImplement
 
-	image  int
-	policy ImageSizePolicy
+	image     int
+	animation *vg.AnimatedImage
+	startTime time.Time
+	redraw    *time.Timer // paints the window when the next frame of the animation is due
+	policy    ImageSizePolicy
 }
 
 func NewImageView(parent Widget, images ...int) *ImageView {
@@ -42,6 +46,8 @@ func (i *ImageView) Image() int {
 
 func (i *ImageView) SetImage(image int) {
 	i.image = image
+	i.animation = nil
+	i.stopRedraw()
 }
 
 func (i *ImageView) Policy() ImageSizePolicy {
@@ -53,6 +59,9 @@ func (i *ImageView) SetPolicy(policy ImageSizePolicy) {
 }
 
 func (i *ImageView) PreferredSize(self Widget, ctx *vg.Context) (int, int) {
+	if i.animation != nil {
+		return i.animation.Width, i.animation.Height
+	}
 	if i.image == 0 {
 		return 0, 0
 	}
@@ -60,8 +69,25 @@ func (i *ImageView) PreferredSize(self Widget, ctx *vg.Context) (int, int) {
 	return w, h
 }
 
+// AnimatedImage() gets the animation shown instead of the still image (nil if none)
+func (i *ImageView) AnimatedImage() *vg.AnimatedImage {
+	return i.animation
+}
+
+// SetAnimatedImage() switches the view to animation mode and starts playing from the first frame
+func (i *ImageView) SetAnimatedImage(animation *vg.AnimatedImage) {
+	i.animation = animation
+	i.image = 0
+	i.startTime = time.Now()
+}
+
+// RestartAnimation() plays the animation again from the first frame
+func (i *ImageView) RestartAnimation() {
+	i.startTime = time.Now()
+}
+
 func (i *ImageView) Draw(self Widget, ctx *vg.Context) {
-	if i.image == 0 {
+	if i.image == 0 && i.animation == nil {
 		return
 	}
 	x := float32(i.x)
@@ -71,7 +97,7 @@ func (i *ImageView) Draw(self Widget, ctx *vg.Context) {
 
 	var w, h float32
 	{
-		iw, ih, _ := ctx.ImageSize(i.image)
+		iw, ih := i.PreferredSize(self, ctx)
 		w = float32(iw)
 		h = float32(ih)
 	}
@@ -96,7 +122,16 @@ func (i *ImageView) Draw(self Widget, ctx *vg.Context) {
 		}
 	}
 
-	imgPaint := vg.ImagePattern(x, y, w, h, 0, i.image, 1.0)
+	var imgPaint vg.Paint
+	if i.animation != nil {
+		elapsed := time.Since(i.startTime)
+		imgPaint = i.animation.Pattern(i.animation.FrameAt(elapsed), x, y, w, h, 0, 1.0)
+		if next, ok := i.animation.NextFrameAt(elapsed); ok {
+			i.scheduleRedraw(self, next-elapsed)
+		}
+	} else {
+		imgPaint = vg.ImagePattern(x, y, w, h, 0, i.image, 1.0)
+	}
 
 	ctx.BeginPath()
 	ctx.Rect(x, y, w, h)
@@ -104,6 +139,30 @@ func (i *ImageView) Draw(self Widget, ctx *vg.Context) {
 	ctx.Fill()
 }
 
+// scheduleRedraw paints the window of the view again after the delay, which replaces
+// the redraw scheduled before.
+func (i *ImageView) scheduleRedraw(self Widget, delay time.Duration) {
+	var widget Widget = self
+	for widget.Parent() != nil {
+		widget = widget.Parent()
+	}
+	win, ok := widget.(*Window)
+	if !ok {
+		return
+	}
+	i.stopRedraw()
+	i.redraw = time.AfterFunc(delay, func() {
+		win.Send(PaintEvent{})
+	})
+}
+
+func (i *ImageView) stopRedraw() {
+	if i.redraw != nil {
+		i.redraw.Stop()
+		i.redraw = nil
+	}
+}
+
 func (i *ImageView) String() string {
 	return i.StringHelper("ImageView", "")
 }
@@ -6,7 +6,9 @@ import (
 
 // Text label widget
 // The font and color can be customized. When SetFixedWidth()
-// is used, the text is wrapped when it surpasses the specified width
+// is used, the text is wrapped when it surpasses the specified width.
+// SetRichText() shows styled spans instead of the caption. With SetEllipsis()
+// the caption stays on one line, and is shortened to the width of the label.
 //
 type Label struct {
 	WidgetImplement
@@ -15,6 +17,8 @@ type Label struct {
 	color       vg.Color
 	columnWidth int
 	wrap        bool
+	richText    *vg.RichText
+	ellipsis    vg.Ellipsis
 }
 
 func NewLabel(parent Widget, caption string) *Label {
@@ -37,6 +41,25 @@ func (l *Label) SetCaption(caption string) {
 	l.caption = caption
 }
 
+// RichText() gets the styled spans shown instead of the caption, nil if there are none
+func (l *Label) RichText() []vg.TextSpan {
+	if l.richText == nil {
+		return nil
+	}
+	return l.richText.Spans
+}
+
+// SetRichText() sets styled spans shown instead of the caption. The label's font,
+// font size and color are used where the spans don't specify them.
+// Calling it without spans shows the caption again.
+func (l *Label) SetRichText(spans ...vg.TextSpan) {
+	if len(spans) == 0 {
+		l.richText = nil
+		return
+	}
+	l.richText = &vg.RichText{Spans: spans}
+}
+
 // Font() gets the currently active font
 func (l *Label) Font() string {
 	if l.fontFace == "" {
@@ -76,8 +99,19 @@ func (l *Label) SetWrap(wrap bool) {
 	l.wrap = wrap
 }
 
+// Ellipsis() gets which part of a caption too wide for the label is replaced with an ellipsis
+func (l *Label) Ellipsis() vg.Ellipsis {
+	return l.ellipsis
+}
+
+// SetEllipsis() sets which part of a caption too wide for the label is replaced with an ellipsis,
+// vg.EllipsisNone wraps or overflows the caption again
+func (l *Label) SetEllipsis(mode vg.Ellipsis) {
+	l.ellipsis = mode
+}
+
 func (l *Label) PreferredSize(self Widget, ctx *vg.Context) (int, int) {
-	if l.caption == "" {
+	if l.caption == "" && l.richText == nil {
 		return 0, 0
 	}
 	ctx.SetFontSize(float32(l.FontSize()))
@@ -90,6 +124,29 @@ func (l *Label) PreferredSize(self Widget, ctx *vg.Context) (int, int) {
 		width = l.columnWidth
 	}
 
+	if l.richText == nil && l.ellipsis != vg.EllipsisNone {
+		ctx.SetTextAlign(vg.AlignLeft | vg.AlignTop)
+		if width == 0 {
+			w, _ := ctx.TextBounds(0, 0, l.caption)
+			width = int(w)
+		}
+		return width, l.Theme().StandardFontSize
+	}
+	if l.richText != nil {
+		ctx.SetTextAlign(vg.AlignLeft | vg.AlignTop)
+		rows := ctx.RichTextRows(0, 0, float32(width), l.richText)
+		if len(rows) == 0 {
+			return width, 0
+		}
+		if width == 0 {
+			for _, row := range rows {
+				width = maxI(width, int(row.Width+0.99))
+			}
+		}
+		last := rows[len(rows)-1]
+		return width, int(last.Top + last.Height + 0.99)
+	}
+
 	if width > 0 {
 		ctx.SetTextAlign(vg.AlignLeft | vg.AlignTop)
 		bounds := ctx.TextBoxBounds(0, 0, float32(width), l.caption)
@@ -114,7 +171,24 @@ func (l *Label) Draw(self Widget, ctx *vg.Context) {
 		width = l.columnWidth
 	}
 
-	if width > 0 {
+	if l.richText != nil {
+		ctx.SetTextAlign(vg.AlignLeft | vg.AlignTop)
+		rows := ctx.RichTextRows(0, 0, float32(width), l.richText)
+		y := float32(l.y)
+		if width == 0 && len(rows) > 0 {
+			// a single row of rich text is centered vertically like the caption
+			last := rows[len(rows)-1]
+			y += (float32(l.h) - last.Top - last.Height) * 0.5
+		}
+		// the rows are laid out once, and moved to the label
+		ctx.Save()
+		ctx.Translate(float32(l.x), y)
+		ctx.DrawRichTextRows(l.richText, rows)
+		ctx.Restore()
+	} else if l.ellipsis != vg.EllipsisNone {
+		ctx.SetTextAlign(vg.AlignLeft | vg.AlignMiddle)
+		ctx.TextEllipsize(float32(l.x), float32(l.y)+float32(l.h)*0.5, float32(l.w), l.caption, l.ellipsis)
+	} else if width > 0 {
 		ctx.SetTextAlign(vg.AlignLeft | vg.AlignTop)
 		ctx.TextBox(float32(l.x), float32(l.y), float32(width), l.caption)
 	} else {
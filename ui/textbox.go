@@ -4,6 +4,7 @@ import (
 	"github.com/goxjs/glfw"
 	"github.com/jxo/davinci/vg"
 	"regexp"
+	"sort"
 	"strconv"
 )
 
@@ -31,6 +32,8 @@ type TextBox struct {
 	callback            func(string) bool
 	validFormat         bool
 	valueTemp           []rune
+	glyphs              []vg.GlyphPosition // positions of the runes of valueTemp when last drawn
+	lastX               float32
 	cursorPos           int
 	selectionPos        int
 	mousePos            [2]int
@@ -42,6 +45,7 @@ type TextBox struct {
 	preeditText         []rune
 	preeditBlocks       []int
 	preeditFocusedBlock int
+	ellipsis            vg.Ellipsis
 }
 
 func NewTextBox(parent Widget, values ...string) *TextBox {
@@ -64,9 +68,9 @@ func NewTextBox(parent Widget, values ...string) *TextBox {
 func (t *TextBox) init(value string) {
 	t.committed = true
 	t.value = value
-	t.unitImage = -1
 	t.validFormat = true
 	t.valueTemp = []rune(value)
+	t.unitImage = -1
 	t.cursorPos = -1
 	t.selectionPos = -1
 	t.mousePos = [2]int{-1, -1}
@@ -107,6 +111,15 @@ func (t *TextBox) SetAlignment(a TextAlignment) {
 	t.alignment = a
 }
 
+// Ellipsis gets which part of a value too wide for the box is replaced with an ellipsis while it isn't edited.
+func (t *TextBox) Ellipsis() vg.Ellipsis {
+	return t.ellipsis
+}
+
+func (t *TextBox) SetEllipsis(mode vg.Ellipsis) {
+	t.ellipsis = mode
+}
+
 func (t *TextBox) Units() string {
 	return t.units
 }
@@ -115,10 +128,12 @@ func (t *TextBox) SetUnits(units string) {
 	t.units = units
 }
 
+// UnitImage returns the image shown as the unit, -1 if there is none.
 func (t *TextBox) UnitImage() int {
 	return t.unitImage
 }
 
+// SetUnitImage sets the image shown as the unit, -1 to show the units text instead.
 func (t *TextBox) SetUnitImage(img int) {
 	t.unitImage = img
 }
@@ -236,18 +251,14 @@ func (t *TextBox) KeyboardEvent(self Widget, key glfw.Key, scanCode int, action
 				} else {
 					t.selectionPos = -1
 				}
-				if t.cursorPos > 0 {
-					t.cursorPos--
-				}
+				t.cursorPos = t.visualMove(t.cursorPos, -1)
 			case EditActionMoveRight:
 				if modifier == glfw.ModShift {
 					t.selectionPos = toI(t.selectionPos == -1, t.cursorPos, t.selectionPos)
 				} else {
 					t.selectionPos = -1
 				}
-				if t.cursorPos < len(t.valueTemp) {
-					t.cursorPos++
-				}
+				t.cursorPos = t.visualMove(t.cursorPos, 1)
 			case EditActionMoveLineTop:
 				if modifier == glfw.ModShift {
 					t.selectionPos = toI(t.selectionPos == -1, t.cursorPos, t.selectionPos)
@@ -272,7 +283,7 @@ func (t *TextBox) KeyboardEvent(self Widget, key glfw.Key, scanCode int, action
 			case EditActionDelete:
 				if !t.DeleteSelection() {
 					if t.cursorPos < len(t.valueTemp) {
-						t.valueTemp = append(t.valueTemp[:t.cursorPos], t.valueTemp[t.cursorPos+1:]...)
+						t.valueTemp = append(t.valueTemp[:t.cursorPos], t.valueTemp[t.clusterEnd(t.cursorPos):]...)
 					}
 				}
 			case EditActionCutUntilLineEnd:
@@ -338,7 +349,7 @@ func (t *TextBox) PreferredSize(self Widget, ctx *vg.Context) (int, int) {
 
 	var unitWidth, textWidth float32
 	ctx.SetFontSize(float32(t.FontSize()))
-	if t.unitImage > 0 {
+	if t.unitImage > 0 || t.unitImage < -1 {
 		w, h, _ := ctx.ImageSize(t.unitImage)
 		unitHeight := sizeH * 0.4
 		unitWidth = float32(w) * unitHeight / float32(h)
@@ -390,7 +401,7 @@ func (t *TextBox) Draw(self Widget, ctx *vg.Context) {
 	xSpacing := h * 0.3
 	var unitWidth float32
 
-	if t.unitImage > 0 {
+	if t.unitImage > 0 || t.unitImage < -1 {
 		iw, ih, _ := ctx.ImageSize(t.unitImage)
 		unitHeight := float32(ih) * 0.4
 		unitWidth = float32(iw) * unitHeight / float32(h)
@@ -434,7 +445,7 @@ func (t *TextBox) Draw(self Widget, ctx *vg.Context) {
 	drawPosX += t.textOffset
 
 	if t.committed {
-		ctx.Text(drawPosX, drawPosY, t.value)
+		ctx.TextEllipsize(drawPosX, drawPosY, clipWidth-2.0, t.value, t.ellipsis)
 	} else {
 		text := t.editingText()
 		textString := string(text)
@@ -464,6 +475,9 @@ func (t *TextBox) Draw(self Widget, ctx *vg.Context) {
 
 		// recompute cursor position
 		glyphs = ctx.TextGlyphPositionsRune(drawPosX, drawPosY, text)
+		if len(t.preeditText) == 0 {
+			t.glyphs, t.lastX = glyphs, bounds[2]
+		}
 
 		var caretX float32 = -1
 		if len(t.preeditText) != 0 {
@@ -505,17 +519,12 @@ func (t *TextBox) Draw(self Widget, ctx *vg.Context) {
 			caretX = t.textIndex2Position(t.cursorPos, bounds[2], glyphs)
 
 			if t.selectionPos > -1 {
-				caretX2 := caretX
-				selX := t.textIndex2Position(t.selectionPos, bounds[2], glyphs)
-
-				if caretX2 > selX {
-					selX, caretX2 = caretX2, selX
-				}
-
-				// draw selection
+				// draw selection, which is split on screen by direction runs
 				ctx.BeginPath()
 				ctx.SetFillColor(vg.MONO(255, 80))
-				ctx.Rect(caretX2, drawPosY-lineH*0.5, selX-caretX2, lineH)
+				for _, span := range selectionSpans(glyphs, t.cursorPos, t.selectionPos) {
+					ctx.Rect(span[0], drawPosY-lineH*0.5, span[1]-span[0], lineH)
+				}
 				ctx.Fill()
 			}
 		}
@@ -605,8 +614,14 @@ func (t *TextBox) updateCursor(ctx *vg.Context, lastX float32, glyphs []vg.Glyph
 	}
 }
 
+// textIndex2Position returns the caret position before the rune at index,
+// which is on its right side for right to left runes. The caret at the end
+// of the text is after the last rune.
 func (t *TextBox) textIndex2Position(index int, lastX float32, glyphs []vg.GlyphPosition) float32 {
 	if index == len(glyphs) {
+		if index > 0 && glyphs[index-1].RTL {
+			return glyphs[index-1].X - glyphs[index-1].Advance
+		}
 		return lastX
 	}
 	return glyphs[index].X
@@ -620,17 +635,86 @@ func (t *TextBox) position2CursorIndex(posX, lastX float32, glyphs []vg.GlyphPos
 	caretX := glyphs[0].X
 	for j := 1; j < len(glyphs); j++ {
 		glyph := &glyphs[j]
+		if glyph.Cluster != glyph.Index {
+			continue // the cursor can't be inside of a cluster
+		}
 		if absF(caretX-posX) > absF(glyph.X-posX) {
 			cursorIndex = j
 			caretX = glyph.X
 		}
 	}
-	if absF(caretX-posX) > absF(lastX-posX) {
+	if absF(caretX-posX) > absF(t.textIndex2Position(len(glyphs), lastX, glyphs)-posX) {
 		return len(glyphs)
 	}
 	return cursorIndex
 }
 
+// visualMove returns the cursor position nearest to pos on screen in the
+// direction dir, which moves through direction runs as they are displayed.
+// The cursor only stops at cluster starts and at the end of the text.
+func (t *TextBox) visualMove(pos, dir int) int {
+	if len(t.glyphs) != len(t.valueTemp) {
+		if dir < 0 && pos > 0 {
+			return pos - 1
+		} else if dir > 0 && pos < len(t.valueTemp) {
+			return pos + 1
+		}
+		return pos
+	}
+	x := t.textIndex2Position(pos, t.lastX, t.glyphs)
+	next := pos
+	var nextX float32
+	for i := 0; i <= len(t.glyphs); i++ {
+		if i < len(t.glyphs) && t.glyphs[i].Cluster != i {
+			continue
+		}
+		caretX := t.textIndex2Position(i, t.lastX, t.glyphs)
+		if (caretX-x)*float32(dir) > 0.5 && (next == pos || absF(caretX-x) < absF(nextX-x)) {
+			next, nextX = i, caretX
+		}
+	}
+	return next
+}
+
+// selectionSpans returns the horizontal spans on screen of the runes between
+// the logical positions begin and end.
+func selectionSpans(glyphs []vg.GlyphPosition, begin, end int) [][2]float32 {
+	if begin > end {
+		begin, end = end, begin
+	}
+	var spans [][2]float32
+	for i := begin; i < end && i < len(glyphs); i++ {
+		x0 := glyphs[i].X
+		if glyphs[i].RTL {
+			x0 -= glyphs[i].Advance
+		}
+		spans = append(spans, [2]float32{x0, x0 + glyphs[i].Advance})
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+	merged := spans[:0]
+	for _, span := range spans {
+		if last := len(merged) - 1; last >= 0 && span[0] <= merged[last][1]+0.5 {
+			merged[last][1] = maxF(merged[last][1], span[1])
+		} else {
+			merged = append(merged, span)
+		}
+	}
+	return merged
+}
+
+// clusterEnd returns the end of the shaped cluster which contains the rune at pos.
+func (t *TextBox) clusterEnd(pos int) int {
+	end := pos + 1
+	if len(t.glyphs) == len(t.valueTemp) {
+		for end < len(t.glyphs) && t.glyphs[end].Cluster != end {
+			end++
+		}
+	}
+	return end
+}
+
 func (t *TextBox) editingText() []rune {
 	if len(t.preeditText) == 0 {
 		return t.valueTemp
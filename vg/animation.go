@@ -0,0 +1,312 @@
+package vg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io/ioutil"
+	"time"
+)
+
+// AnimationFrame keeps the location of one frame inside the textures of an AnimatedImage
+// and how long the frame is shown.
+type AnimationFrame struct {
+	Image int           // Handle of the texture that contains the frame.
+	X, Y  int           // Top-left corner of the frame in the texture.
+	Delay time.Duration // Display time of the frame.
+}
+
+// AnimatedImage is a sequence of images (an animated GIF or APNG) whose fully composed frames
+// are packed into textures. Frames which don't fit into one texture of at most 2048x2048 pixels
+// are split across several. Context.CreateAnimatedImage() and its variants create this instance.
+type AnimatedImage struct {
+	Images        []int // Handles of the textures that contain the frames.
+	Width, Height int   // Size of one frame.
+	LoopCount     int   // Same as gif.GIF.LoopCount: 0 loops forever, -1 plays once, n > 0 repeats n times.
+	Frames        []AnimationFrame
+	duration      time.Duration
+}
+
+// Duration returns the length of one loop of the animation.
+func (a *AnimatedImage) Duration() time.Duration {
+	return a.duration
+}
+
+// FrameAt returns the index of the frame that should be shown at elapsed time t
+// from the beginning of the animation. It stays on the last frame after the loop count is exhausted.
+func (a *AnimatedImage) FrameAt(t time.Duration) int {
+	last := len(a.Frames) - 1
+	if last <= 0 || a.duration <= 0 || t < 0 {
+		return 0
+	}
+	if a.LoopCount != 0 {
+		plays := time.Duration(a.LoopCount + 1)
+		if a.LoopCount < 0 {
+			plays = 1
+		}
+		if t >= a.duration*plays {
+			return last
+		}
+	}
+	t %= a.duration
+	for i, frame := range a.Frames {
+		if t < frame.Delay {
+			return i
+		}
+		t -= frame.Delay
+	}
+	return last
+}
+
+// NextFrameAt returns the elapsed time from the beginning of the animation at which the frame
+// shown at elapsed time t is replaced. ok is false if the frame isn't replaced anymore.
+func (a *AnimatedImage) NextFrameAt(t time.Duration) (next time.Duration, ok bool) {
+	if len(a.Frames) <= 1 || a.duration <= 0 {
+		return 0, false
+	}
+	if t < 0 {
+		t = 0
+	}
+	var end time.Duration // of the last play, 0 if the animation loops forever
+	if a.LoopCount != 0 {
+		plays := time.Duration(a.LoopCount + 1)
+		if a.LoopCount < 0 {
+			plays = 1
+		}
+		end = a.duration * plays
+		if t >= end {
+			return 0, false
+		}
+	}
+	next = t / a.duration * a.duration
+	for _, frame := range a.Frames {
+		next += frame.Delay
+		if t < next {
+			break
+		}
+	}
+	if end > 0 && next >= end {
+		// the last frame stays
+		return 0, false
+	}
+	return next, true
+}
+
+// Pattern creates and returns an image pattern which shows the specified frame.
+// Parameters are same as ImagePattern(): (cx,cy) is the left-top location of the frame,
+// (w,h) the size of the frame and angle rotation around the top-left corner.
+func (a *AnimatedImage) Pattern(frame int, cx, cy, w, h, angle, alpha float32) Paint {
+	frame = clampI(frame, 0, len(a.Frames)-1)
+	f := a.Frames[frame]
+	cols, rows := a.grid()
+	tw, th := a.textureSize(frame / (cols * rows))
+	paint := ImagePattern(cx, cy, w, h, angle, f.Image, alpha)
+	paint.mapToSubImage(float32(f.X), float32(f.Y), float32(a.Width), float32(a.Height), float32(tw), float32(th))
+	return paint
+}
+
+func (a *AnimatedImage) grid() (cols, rows int) {
+	return animationGrid(len(a.Frames), a.Width+2*imagePadding, a.Height+2*imagePadding)
+}
+
+// textureSize returns the size of the page-th texture, the last one may have fewer frames.
+func (a *AnimatedImage) textureSize(page int) (int, int) {
+	cols, rows := a.grid()
+	n := len(a.Frames) - page*cols*rows
+	if n > cols*rows {
+		n = cols * rows
+	}
+	if n < cols {
+		return n * (a.Width + 2*imagePadding), a.Height + 2*imagePadding
+	}
+	return cols * (a.Width + 2*imagePadding), (n + cols - 1) / cols * (a.Height + 2*imagePadding)
+}
+
+// CreateAnimatedImage creates animated image by loading it from the disk from specified file name.
+// Returns nil if the file can't be read.
+func (c *Context) CreateAnimatedImage(filePath string, flags ImageFlags) *AnimatedImage {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	return c.CreateAnimatedImageFromMemory(flags, data)
+}
+
+// CreateAnimatedImageFromMemory creates animated image by loading it from the specified chunk of memory.
+// GIF and APNG are decoded with all their frames, other formats supported by CreateImageFromMemory()
+// become a single frame animation.
+// Returns nil if the data can't be decoded.
+func (c *Context) CreateAnimatedImageFromMemory(flags ImageFlags, data []byte) *AnimatedImage {
+	if bytes.HasPrefix(data, []byte("GIF8")) {
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil
+		}
+		return c.CreateAnimatedImageFromGIF(flags, g)
+	}
+	if isAPNG(data) {
+		frames, loopCount, err := decodeAPNG(data)
+		if err != nil {
+			return nil
+		}
+		return c.createAnimatedImage(flags, frames, loopCount)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	rgba := image.NewRGBA(img.Bounds().Sub(img.Bounds().Min))
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return c.createAnimatedImage(flags, []composedFrame{{rgba, 0}}, 0)
+}
+
+// CreateAnimatedImageFromGIF creates animated image from decoded GIF data.
+// Frame disposal methods are applied, so each frame in the texture is a complete picture.
+func (c *Context) CreateAnimatedImageFromGIF(flags ImageFlags, g *gif.GIF) *AnimatedImage {
+	frames, err := composeGIF(g)
+	if err != nil {
+		return nil
+	}
+	return c.createAnimatedImage(flags, frames, g.LoopCount)
+}
+
+// DeleteAnimatedImage deletes created animated image.
+func (c *Context) DeleteAnimatedImage(anim *AnimatedImage) {
+	if anim != nil {
+		for _, img := range anim.Images {
+			c.DeleteImage(img)
+		}
+		anim.Images = nil
+	}
+}
+
+// imagePadding is the gap around images packed into one texture.
+const imagePadding = 1
+
+type composedFrame struct {
+	image *image.RGBA
+	delay time.Duration
+}
+
+func (c *Context) createAnimatedImage(flags ImageFlags, frames []composedFrame, loopCount int) *AnimatedImage {
+	if len(frames) == 0 {
+		return nil
+	}
+	size := frames[0].image.Bounds().Size()
+	anim := &AnimatedImage{
+		Width:     size.X,
+		Height:    size.Y,
+		LoopCount: loopCount,
+		Frames:    make([]AnimationFrame, len(frames)),
+	}
+	cols, rows := anim.grid()
+	perTexture := cols * rows
+	for start := 0; start < len(frames); start += perTexture {
+		tw, th := anim.textureSize(start / perTexture)
+		texture := image.NewRGBA(image.Rect(0, 0, tw, th))
+		for i := start; i < len(frames) && i < start+perTexture; i++ {
+			x := ((i-start)%cols)*(size.X+2*imagePadding) + imagePadding
+			y := ((i-start)/cols)*(size.Y+2*imagePadding) + imagePadding
+			blitWithBorder(texture, frames[i].image, x, y)
+			anim.Frames[i] = AnimationFrame{X: x, Y: y, Delay: frames[i].delay}
+			anim.duration += frames[i].delay
+		}
+		img := c.CreateImageRGBA(tw, th, flags, texture.Pix)
+		if img == 0 {
+			c.DeleteAnimatedImage(anim)
+			return nil
+		}
+		for i := start; i < len(frames) && i < start+perTexture; i++ {
+			anim.Frames[i].Image = img
+		}
+		anim.Images = append(anim.Images, img)
+	}
+	return anim
+}
+
+// animationGrid returns the column and row count to place n frames of the size (w,h) in an
+// almost square texture. A texture keeps at most vgMaxAnimationImageSize pixels in each direction,
+// or a single frame if it is larger, and the frames which don't fit go to the next textures.
+func animationGrid(n, w, h int) (cols, rows int) {
+	cols = 1
+	for cols*cols < n {
+		cols++
+	}
+	cols = clampI(cols, 1, maxI(vgMaxAnimationImageSize/w, 1))
+	rows = clampI((n+cols-1)/cols, 1, maxI(vgMaxAnimationImageSize/h, 1))
+	return
+}
+
+// blitWithBorder copies src to dst at (x,y) and repeats its edge pixels into the surrounding padding
+// to avoid bleeding between neighboring frames when the texture is filtered.
+func blitWithBorder(dst, src *image.RGBA, x, y int) {
+	w := src.Rect.Dx()
+	h := src.Rect.Dy()
+	draw.Draw(dst, image.Rect(x, y, x+w, y+h), src, src.Rect.Min, draw.Src)
+	for p := 1; p <= imagePadding; p++ {
+		draw.Draw(dst, image.Rect(x, y-p, x+w, y-p+1), dst, image.Pt(x, y), draw.Src)
+		draw.Draw(dst, image.Rect(x, y+h+p-1, x+w, y+h+p), dst, image.Pt(x, y+h-1), draw.Src)
+	}
+	for p := 1; p <= imagePadding; p++ {
+		draw.Draw(dst, image.Rect(x-p, y-imagePadding, x-p+1, y+h+imagePadding), dst, image.Pt(x, y-imagePadding), draw.Src)
+		draw.Draw(dst, image.Rect(x+w+p-1, y-imagePadding, x+w+p, y+h+imagePadding), dst, image.Pt(x+w-1, y-imagePadding), draw.Src)
+	}
+}
+
+func composeGIF(g *gif.GIF) ([]composedFrame, error) {
+	if len(g.Image) == 0 {
+		return nil, errors.New("gif has no frame")
+	}
+	width := g.Config.Width
+	height := g.Config.Height
+	if width == 0 || height == 0 {
+		// Some encoders leave the logical screen empty, use the union of frames instead.
+		var bounds image.Rectangle
+		for _, img := range g.Image {
+			bounds = bounds.Union(img.Bounds())
+		}
+		width = bounds.Max.X
+		height = bounds.Max.Y
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	var previous *image.RGBA
+	frames := make([]composedFrame, len(g.Image))
+	for i, img := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+		var delay time.Duration
+		if i < len(g.Delay) {
+			delay = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		}
+		frames[i] = composedFrame{cloneRGBA(canvas), normalizeFrameDelay(delay)}
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames, nil
+}
+
+// normalizeFrameDelay follows browsers: too short delays are shown as 100ms.
+func normalizeFrameDelay(delay time.Duration) time.Duration {
+	if delay <= 10*time.Millisecond {
+		return 100 * time.Millisecond
+	}
+	return delay
+}
+
+func cloneRGBA(src *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(src.Rect)
+	copy(dst.Pix, src.Pix)
+	return dst
+}
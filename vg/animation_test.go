@@ -0,0 +1,241 @@
+package vg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestComposeGIFDisposal(t *testing.T) {
+	palette := color.Palette{color.Transparent, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	red := image.NewPaletted(image.Rect(0, 0, 2, 2), palette)
+	for i := range red.Pix {
+		red.Pix[i] = 1
+	}
+	blue := image.NewPaletted(image.Rect(1, 1, 2, 2), palette)
+	blue.Pix[0] = 2
+	g := &gif.GIF{
+		Image:    []*image.Paletted{red, blue, blue},
+		Delay:    []int{10, 20, 30},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		Config:   image.Config{Width: 2, Height: 2},
+	}
+	frames, err := composeGIF(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("3 frames are expected, but %d", len(frames))
+	}
+	if c := frames[1].image.RGBAAt(0, 0); c.R != 255 {
+		t.Errorf("second frame should keep first frame's pixel, but %v", c)
+	}
+	if c := frames[1].image.RGBAAt(1, 1); c.B != 255 {
+		t.Errorf("second frame should have blue pixel, but %v", c)
+	}
+	if c := frames[2].image.RGBAAt(1, 1); c.B != 255 || c.R != 0 {
+		t.Errorf("third frame should be drawn on cleared background, but %v", c)
+	}
+	if frames[1].delay != 200*time.Millisecond {
+		t.Errorf("delay should be 200ms, but %v", frames[1].delay)
+	}
+}
+
+func TestAnimatedImageFrameAt(t *testing.T) {
+	anim := &AnimatedImage{
+		Frames: []AnimationFrame{
+			{Delay: 100 * time.Millisecond},
+			{Delay: 200 * time.Millisecond},
+		},
+		duration:  300 * time.Millisecond,
+		LoopCount: -1,
+	}
+	cases := []struct {
+		t     time.Duration
+		frame int
+	}{
+		{0, 0},
+		{99 * time.Millisecond, 0},
+		{100 * time.Millisecond, 1},
+		{299 * time.Millisecond, 1},
+		{time.Second, 1},
+	}
+	for _, c := range cases {
+		if frame := anim.FrameAt(c.t); frame != c.frame {
+			t.Errorf("FrameAt(%v) should be %d, but %d", c.t, c.frame, frame)
+		}
+	}
+	anim.LoopCount = 0
+	if frame := anim.FrameAt(350 * time.Millisecond); frame != 0 {
+		t.Errorf("infinite animation should loop, but frame %d", frame)
+	}
+}
+
+func TestAnimatedImageNextFrameAt(t *testing.T) {
+	anim := &AnimatedImage{
+		Frames: []AnimationFrame{
+			{Delay: 100 * time.Millisecond},
+			{Delay: 200 * time.Millisecond},
+		},
+		duration:  300 * time.Millisecond,
+		LoopCount: 1,
+	}
+	cases := []struct {
+		t, next time.Duration
+		ok      bool
+	}{
+		{-time.Second, 100 * time.Millisecond, true},
+		{0, 100 * time.Millisecond, true},
+		{100 * time.Millisecond, 300 * time.Millisecond, true},
+		{299 * time.Millisecond, 300 * time.Millisecond, true},
+		{350 * time.Millisecond, 400 * time.Millisecond, true},
+		// the second play ends on the last frame
+		{450 * time.Millisecond, 0, false},
+		{time.Second, 0, false},
+	}
+	for _, c := range cases {
+		if next, ok := anim.NextFrameAt(c.t); next != c.next || ok != c.ok {
+			t.Errorf("NextFrameAt(%v) should be %v %v, but %v %v", c.t, c.next, c.ok, next, ok)
+		}
+		if next, ok := anim.NextFrameAt(c.t); ok && anim.FrameAt(next) == anim.FrameAt(c.t) {
+			t.Errorf("the frame at %v should differ from the frame at %v", next, c.t)
+		}
+	}
+	anim.LoopCount = 0
+	if next, ok := anim.NextFrameAt(time.Hour + 150*time.Millisecond); !ok || next != time.Hour+300*time.Millisecond {
+		t.Errorf("infinite animation should go on, but %v %v", next, ok)
+	}
+	anim.Frames = anim.Frames[:1]
+	if _, ok := anim.NextFrameAt(0); ok {
+		t.Error("a single frame isn't replaced")
+	}
+}
+
+func TestAnimationGridSplitsLargeAnimations(t *testing.T) {
+	cols, rows := animationGrid(9, 34, 34)
+	if cols != 3 || rows != 3 {
+		t.Errorf("9 small frames should fit in a 3x3 grid, but %dx%d", cols, rows)
+	}
+	// 200 frames of 500x500 pixels don't fit into one texture
+	cols, rows = animationGrid(200, 502, 502)
+	if cols != 4 || rows != 4 {
+		t.Errorf("a texture should keep 4x4 frames, but %dx%d", cols, rows)
+	}
+	anim := &AnimatedImage{Width: 500, Height: 500, Frames: make([]AnimationFrame, 200)}
+	if w, h := anim.textureSize(0); w > vgMaxAnimationImageSize || h > vgMaxAnimationImageSize {
+		t.Errorf("texture size should be limited, but %dx%d", w, h)
+	}
+	// frames 192..199 are on the 13th texture
+	if w, h := anim.textureSize(12); w != 4*502 || h != 2*502 {
+		t.Errorf("last texture should have 2 rows, but %dx%d", w, h)
+	}
+	// a frame larger than the limit gets its own texture
+	cols, rows = animationGrid(3, 3000, 100)
+	if cols != 1 || rows != 3 {
+		t.Errorf("wide frames should be stacked, but %dx%d", cols, rows)
+	}
+}
+
+func encodeTestPNGChunks(t *testing.T, img image.Image) (ihdr []byte, idat [][]byte) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := readPNGChunks(buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range chunks {
+		switch chunk.typ {
+		case "IHDR":
+			ihdr = chunk.data
+		case "IDAT":
+			idat = append(idat, chunk.data)
+		}
+	}
+	return
+}
+
+func testFrameControl(sequence, w, h, x, y int, delayNum, delayDen uint16, disposeOp, blendOp byte) []byte {
+	d := make([]byte, 26)
+	binary.BigEndian.PutUint32(d[0:], uint32(sequence))
+	binary.BigEndian.PutUint32(d[4:], uint32(w))
+	binary.BigEndian.PutUint32(d[8:], uint32(h))
+	binary.BigEndian.PutUint32(d[12:], uint32(x))
+	binary.BigEndian.PutUint32(d[16:], uint32(y))
+	binary.BigEndian.PutUint16(d[20:], delayNum)
+	binary.BigEndian.PutUint16(d[22:], delayDen)
+	d[24] = disposeOp
+	d[25] = blendOp
+	return d
+}
+
+func TestDecodeAPNG(t *testing.T) {
+	red := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	draw.Draw(red, red.Bounds(), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	blue := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	blue.Pix = []byte{0, 0, 255, 255}
+	ihdr, redData := encodeTestPNGChunks(t, red)
+	_, blueData := encodeTestPNGChunks(t, blue)
+
+	var buffer bytes.Buffer
+	buffer.Write(pngSignature)
+	writePNGChunk(&buffer, "IHDR", ihdr)
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], 3) // frames
+	binary.BigEndian.PutUint32(actl[4:], 2) // plays
+	writePNGChunk(&buffer, "acTL", actl)
+	writePNGChunk(&buffer, "fcTL", testFrameControl(0, 2, 2, 0, 0, 1, 10, apngDisposeNone, apngBlendSource))
+	for _, data := range redData {
+		writePNGChunk(&buffer, "IDAT", data)
+	}
+	writePNGChunk(&buffer, "fcTL", testFrameControl(1, 1, 1, 1, 1, 20, 100, apngDisposePrevious, apngBlendOver))
+	for _, data := range blueData {
+		writePNGChunk(&buffer, "fdAT", append([]byte{0, 0, 0, 2}, data...))
+	}
+	writePNGChunk(&buffer, "fcTL", testFrameControl(3, 1, 1, 0, 0, 0, 0, apngDisposeNone, apngBlendSource))
+	for _, data := range blueData {
+		writePNGChunk(&buffer, "fdAT", append([]byte{0, 0, 0, 4}, data...))
+	}
+	writePNGChunk(&buffer, "IEND", nil)
+	data := buffer.Bytes()
+
+	if !isAPNG(data) {
+		t.Fatal("data should be detected as APNG")
+	}
+	frames, loopCount, err := decodeAPNG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("3 frames are expected, but %d", len(frames))
+	}
+	if loopCount != 1 {
+		t.Errorf("2 plays should repeat once, but loop count %d", loopCount)
+	}
+	if frames[0].delay != 100*time.Millisecond || frames[1].delay != 200*time.Millisecond {
+		t.Errorf("delays should be 100ms and 200ms, but %v and %v", frames[0].delay, frames[1].delay)
+	}
+	if c := frames[1].image.RGBAAt(0, 0); c.R != 255 {
+		t.Errorf("second frame should keep first frame's pixel, but %v", c)
+	}
+	if c := frames[1].image.RGBAAt(1, 1); c.B != 255 || c.R != 0 {
+		t.Errorf("second frame should have blue pixel, but %v", c)
+	}
+	// the second frame is disposed to the previous canvas
+	if c := frames[2].image.RGBAAt(1, 1); c.R != 255 || c.B != 0 {
+		t.Errorf("third frame should be drawn on the first frame, but %v", c)
+	}
+	if c := frames[2].image.RGBAAt(0, 0); c.B != 255 {
+		t.Errorf("third frame should have blue pixel, but %v", c)
+	}
+	if isAPNG(redData[0]) {
+		t.Error("plain data shouldn't be detected as APNG")
+	}
+}
@@ -0,0 +1,221 @@
+package vg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"time"
+)
+
+// APNG is decoded by splitting it into plain PNG streams (one per frame) that image/png can read,
+// then compositing them with the dispose and blend operations of each frame control chunk.
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+const (
+	apngDisposeNone = iota
+	apngDisposeBackground
+	apngDisposePrevious
+)
+
+const (
+	apngBlendSource = iota
+	apngBlendOver
+)
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+type apngFrame struct {
+	width, height  int
+	x, y           int
+	delay          time.Duration
+	disposeOp      byte
+	blendOp        byte
+	data           [][]byte // IDAT compatible payloads
+	isDefaultImage bool
+}
+
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a png file")
+	}
+	var chunks []pngChunk
+	offset := len(pngSignature)
+	for offset+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		typ := string(data[offset+4 : offset+8])
+		if length < 0 || offset+12+length > len(data) {
+			return nil, errors.New("truncated png chunk")
+		}
+		chunks = append(chunks, pngChunk{typ, data[offset+8 : offset+8+length]})
+		offset += 12 + length
+		if typ == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+func isAPNG(data []byte) bool {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return false
+	}
+	for _, chunk := range chunks {
+		switch chunk.typ {
+		case "acTL":
+			return true
+		case "IDAT":
+			// acTL must appear before the first IDAT.
+			return false
+		}
+	}
+	return false
+}
+
+func decodeAPNG(data []byte) ([]composedFrame, int, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ihdr []byte
+	var shared []pngChunk // chunks like PLTE and tRNS which every frame needs
+	var frames []*apngFrame
+	var current *apngFrame
+	loopCount := 0
+	seenIDAT := false
+
+	for _, chunk := range chunks {
+		switch chunk.typ {
+		case "IHDR":
+			if len(chunk.data) != 13 {
+				return nil, 0, errors.New("invalid IHDR chunk")
+			}
+			ihdr = chunk.data
+		case "acTL":
+			if len(chunk.data) != 8 {
+				return nil, 0, errors.New("invalid acTL chunk")
+			}
+			plays := int(binary.BigEndian.Uint32(chunk.data[4:]))
+			// APNG counts plays (0 is infinite), AnimatedImage counts repeats like GIF.
+			if plays == 1 {
+				loopCount = -1
+			} else if plays > 1 {
+				loopCount = plays - 1
+			}
+		case "fcTL":
+			if len(chunk.data) != 26 {
+				return nil, 0, errors.New("invalid fcTL chunk")
+			}
+			d := chunk.data
+			delayNum := int(binary.BigEndian.Uint16(d[20:]))
+			delayDen := int(binary.BigEndian.Uint16(d[22:]))
+			if delayDen == 0 {
+				delayDen = 100
+			}
+			current = &apngFrame{
+				width:          int(binary.BigEndian.Uint32(d[4:])),
+				height:         int(binary.BigEndian.Uint32(d[8:])),
+				x:              int(binary.BigEndian.Uint32(d[12:])),
+				y:              int(binary.BigEndian.Uint32(d[16:])),
+				delay:          time.Duration(delayNum) * time.Second / time.Duration(delayDen),
+				disposeOp:      d[24],
+				blendOp:        d[25],
+				isDefaultImage: !seenIDAT,
+			}
+			frames = append(frames, current)
+		case "IDAT":
+			seenIDAT = true
+			if current != nil && current.isDefaultImage {
+				current.data = append(current.data, chunk.data)
+			}
+		case "fdAT":
+			if current == nil || len(chunk.data) < 4 {
+				return nil, 0, errors.New("invalid fdAT chunk")
+			}
+			current.data = append(current.data, chunk.data[4:])
+		case "IEND":
+		default:
+			if !seenIDAT {
+				shared = append(shared, chunk)
+			}
+		}
+	}
+	if ihdr == nil || len(frames) == 0 {
+		return nil, 0, errors.New("apng has no frame")
+	}
+
+	width := int(binary.BigEndian.Uint32(ihdr[0:]))
+	height := int(binary.BigEndian.Uint32(ihdr[4:]))
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	result := make([]composedFrame, 0, len(frames))
+
+	for i, frame := range frames {
+		img, err := decodeAPNGFrame(ihdr, shared, frame)
+		if err != nil {
+			return nil, 0, err
+		}
+		rect := image.Rect(frame.x, frame.y, frame.x+frame.width, frame.y+frame.height)
+		disposeOp := frame.disposeOp
+		if i == 0 && disposeOp == apngDisposePrevious {
+			disposeOp = apngDisposeBackground
+		}
+		var previous *image.RGBA
+		if disposeOp == apngDisposePrevious {
+			previous = cloneRGBA(canvas)
+		}
+		if frame.blendOp == apngBlendSource {
+			draw.Draw(canvas, rect, img, img.Bounds().Min, draw.Src)
+		} else {
+			draw.Draw(canvas, rect, img, img.Bounds().Min, draw.Over)
+		}
+		result = append(result, composedFrame{cloneRGBA(canvas), normalizeFrameDelay(frame.delay)})
+		switch disposeOp {
+		case apngDisposeBackground:
+			draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+		case apngDisposePrevious:
+			canvas = previous
+		}
+	}
+	return result, loopCount, nil
+}
+
+// decodeAPNGFrame builds a standalone PNG stream for the frame and decodes it.
+func decodeAPNGFrame(ihdr []byte, shared []pngChunk, frame *apngFrame) (image.Image, error) {
+	var buffer bytes.Buffer
+	buffer.Write(pngSignature)
+	header := make([]byte, len(ihdr))
+	copy(header, ihdr)
+	binary.BigEndian.PutUint32(header[0:], uint32(frame.width))
+	binary.BigEndian.PutUint32(header[4:], uint32(frame.height))
+	writePNGChunk(&buffer, "IHDR", header)
+	for _, chunk := range shared {
+		writePNGChunk(&buffer, chunk.typ, chunk.data)
+	}
+	for _, data := range frame.data {
+		writePNGChunk(&buffer, "IDAT", data)
+	}
+	writePNGChunk(&buffer, "IEND", nil)
+	return png.Decode(&buffer)
+}
+
+func writePNGChunk(buffer *bytes.Buffer, typ string, data []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], typ)
+	buffer.Write(header[:])
+	buffer.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+	buffer.Write(footer[:])
+}
@@ -65,6 +65,83 @@ const (
 	AlignBaseline Align = 1 << 6
 )
 
+// FontFeature is used for selecting OpenType features applied to text
+type FontFeature int
+
+const (
+	// FeatureKerning (default) adjusts the space between glyph pairs with GPOS kern feature or kern table.
+	FeatureKerning FontFeature = 1 << 0
+	// FeatureLigatures (default) substitutes ligatures with GSUB liga and clig features.
+	FeatureLigatures FontFeature = 1 << 1
+)
+
+// TextDirection is used for setting the base direction of the paragraphs of text
+type TextDirection int
+
+const (
+	// TextDirectionAuto (default) takes the direction of the first strong character of each paragraph.
+	TextDirectionAuto TextDirection = iota
+	// TextDirectionLTR lays paragraphs out from left to right.
+	TextDirectionLTR
+	// TextDirectionRTL lays paragraphs out from right to left.
+	TextDirectionRTL
+)
+
+// TextRenderMode is used for selecting how glyphs are rasterized
+type TextRenderMode int
+
+const (
+	// TextRenderBitmap (default) rasterizes glyphs for every size, which gives the sharpest small text.
+	TextRenderBitmap TextRenderMode = iota
+	// TextRenderSDF rasterizes glyphs once as signed distance fields, which are scaled by the shader.
+	// Zoomed text doesn't fill the font atlas, and it can be outlined and glow.
+	TextRenderSDF
+	// TextRenderSubpixel rasterizes glyphs at quarter pixel horizontal offsets, which spaces small text evenly.
+	TextRenderSubpixel
+	// TextRenderLCD is TextRenderSubpixel with a coverage for every subpixel of RGB LCD screens,
+	// which is blended in three passes. It is meant for unscaled text on an opaque background.
+	TextRenderLCD
+)
+
+// TextDecoration is used for setting the lines drawn with text, it can be combined
+type TextDecoration int
+
+const (
+	// Underline draws a line below the baseline.
+	Underline TextDecoration = 1 << iota
+	// Strikethrough draws a line through the lowercase letters.
+	Strikethrough
+	// Overline draws a line at the ascender.
+	Overline
+)
+
+// WritingMode is used for setting whether text runs in rows or in columns
+type WritingMode int
+
+const (
+	// WritingHorizontal (default) lays text out in rows, which progress from top to bottom.
+	WritingHorizontal WritingMode = iota
+	// WritingVerticalRL lays text out in columns from top to bottom, which progress from right
+	// to left like in Chinese, Japanese and Korean books.
+	WritingVerticalRL
+	// WritingVerticalLR lays text out in columns from top to bottom, which progress from left to right.
+	WritingVerticalLR
+)
+
+// Ellipsis is used for selecting which part of text too wide for its room is replaced with an ellipsis
+type Ellipsis int
+
+const (
+	// EllipsisNone (default) keeps the whole text.
+	EllipsisNone Ellipsis = iota
+	// EllipsisEnd replaces the end of the text.
+	EllipsisEnd
+	// EllipsisMiddle replaces the middle of the text, which keeps both ends of file paths.
+	EllipsisMiddle
+	// EllipsisStart replaces the start of the text.
+	EllipsisStart
+)
+
 // ImageFlags is used for setting image object
 type ImageFlags int
 
@@ -5,6 +5,8 @@ const (
 	vgMaxFontImageSize  = 2048
 	vgMaxFontImages     = 4
 
+	vgMaxAnimationImageSize = 2048
+
 	vgInitCommandsSize = 256
 	vgInitPointsSize   = 128
 	vgInitPathsSize    = 16
@@ -37,11 +39,3 @@ const (
 	vgTextureALPHA vgTextureType = 1
 	vgTextureRGBA  vgTextureType = 2
 )
-
-type vgCodePointSize int
-
-const (
-	vgNEWLINE vgCodePointSize = iota
-	vgSPACE
-	vgCHAR
-)
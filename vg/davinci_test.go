@@ -1,6 +1,9 @@
 package vg
 
 import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -71,3 +74,230 @@ func TestStateSaveRestore2(t *testing.T) {
 		t.Errorf("Restore() should set saved xform, but %v", topStateAgain.xform)
 	}
 }
+
+// stubParams is a backend which only keeps the textures and counts the draws, to test
+// a Context without OpenGL.
+type stubParams struct {
+	textures    map[int][2]int
+	lastTexture int
+	lastData    []byte
+	draws       int
+}
+
+func (p *stubParams) edgeAntiAlias() bool { return true }
+func (p *stubParams) renderCreate() error { return nil }
+func (p *stubParams) renderCreateTexture(texType vgTextureType, w, h int, flags ImageFlags, data []byte) int {
+	if p.textures == nil {
+		p.textures = make(map[int][2]int)
+	}
+	p.lastTexture++
+	p.textures[p.lastTexture] = [2]int{w, h}
+	p.lastData = data
+	return p.lastTexture
+}
+func (p *stubParams) renderDeleteTexture(image int) error {
+	delete(p.textures, image)
+	return nil
+}
+func (p *stubParams) renderUpdateTexture(image, x, y, w, h int, data []byte) error { return nil }
+func (p *stubParams) renderGetTextureSize(image int) (int, int, error) {
+	size := p.textures[image]
+	return size[0], size[1], nil
+}
+func (p *stubParams) renderViewport(width, height int) {}
+func (p *stubParams) renderCancel()                    {}
+func (p *stubParams) renderFlush()                     {}
+func (p *stubParams) renderFill(paint *Paint, scissor *vgScissor, fringe float32, bounds [4]float32, paths []vgPath) {
+	p.draws++
+}
+func (p *stubParams) renderStroke(paint *Paint, scissor *vgScissor, fringe float32, strokeWidth float32, paths []vgPath) {
+	p.draws++
+}
+func (p *stubParams) renderTriangles(paint *Paint, scissor *vgScissor, vertexes []vgVertex) {
+	p.draws++
+}
+func (p *stubParams) renderSDFTriangles(paint *Paint, scissor *vgScissor, vertexes []vgVertex, sdf *vgSDFText) {
+	p.draws++
+}
+func (p *stubParams) renderChannelTriangles(paint *Paint, scissor *vgScissor, vertexes []vgVertex, channel int) {
+	p.draws++
+}
+func (p *stubParams) renderTriangleStrip(paint *Paint, scissor *vgScissor, vertexes []vgVertex) {
+	p.draws++
+}
+func (p *stubParams) renderStats() RenderStats { return RenderStats{} }
+func (p *stubParams) renderDelete()            {}
+
+func createStubContext(t *testing.T) (*Context, *stubParams) {
+	params := &stubParams{}
+	c, err := createInternal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, params
+}
+
+func TestEvictTextAtlasCompaction(t *testing.T) {
+	c, _ := createStubContext(t)
+	data, err := ioutil.ReadFile(filepath.Join("..", "sample", "Roboto-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CreateFontFromMemory("sans", data, 0)
+	c.BeginFrame(100, 100, 1)
+	c.SetFontFace("sans")
+	// the last font image is in use, and the glyphs leave gaps which the W doesn't fit in
+	c.fontImageIdx = vgMaxFontImages - 1
+	c.fs.ResetAtlas(64, 64)
+	for _, glyph := range []struct {
+		text string
+		size float32
+	}{{"—", 43}, {"l", 28}, {"l", 88}, {"—", 30}, {"W", 60}} {
+		c.SetFontSize(glyph.size)
+		c.Text(0, 0, glyph.text)
+	}
+	stats := c.fs.AtlasStats()
+	if stats.Compactions != 1 || stats.Evicted != 0 || stats.Glyphs != 5 {
+		t.Errorf("compaction alone should make room for the W, but %+v", stats)
+	}
+}
+
+// createFullAtlasContext returns a context whose last font image is in use,
+// and no glyph fits in its atlas.
+func createFullAtlasContext(t *testing.T) *Context {
+	c, _ := createStubContext(t)
+	data, err := ioutil.ReadFile(filepath.Join("..", "sample", "Roboto-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CreateFontFromMemory("sans", data, 0)
+	c.BeginFrame(100, 100, 1)
+	c.SetFontFace("sans")
+	c.SetFontSize(20)
+	c.fontImageIdx = vgMaxFontImages - 1
+	c.fs.ResetAtlas(16, 16)
+	return c
+}
+
+func TestFullAtlasGlyphPositions(t *testing.T) {
+	c := createFullAtlasContext(t)
+	positions := c.TextGlyphPositions(0, 0, "WW")
+	if len(positions) != 2 {
+		t.Fatalf("2 positions are expected, but %d", len(positions))
+	}
+	for i, position := range positions {
+		if position.Index != i || position.Cluster != i {
+			t.Errorf("unmeasured rune %d should keep its own position, but %+v", i, position)
+		}
+	}
+}
+
+func TestFullAtlasBreakLines(t *testing.T) {
+	c := createFullAtlasContext(t)
+	for _, width := range []float32{1000, 10} {
+		for _, row := range c.TextBreakLines("WWW WWW", width) {
+			if row.StartIndex < 0 || row.EndIndex > 7 || row.NextIndex > 7 {
+				t.Errorf("row out of the text of width %f: %+v", width, row)
+			}
+		}
+	}
+}
+
+func createTextContext(t *testing.T) *Context {
+	c, _ := createStubContext(t)
+	data, err := ioutil.ReadFile(filepath.Join("..", "sample", "Roboto-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CreateFontFromMemory("sans", data, 0)
+	c.BeginFrame(100, 100, 1)
+	c.SetFontFace("sans")
+	c.SetFontSize(20)
+	return c
+}
+
+func TestEllipsize(t *testing.T) {
+	c := createTextContext(t)
+	text := "The quick brown fox jumps"
+	full, _ := c.TextBounds(0, 0, text)
+	maxWidth := full * 0.6
+	for _, test := range []struct {
+		mode  Ellipsis
+		match func(head, tail string) bool
+	}{
+		{EllipsisEnd, func(head, tail string) bool { return tail == "" && strings.HasPrefix(text, head) }},
+		{EllipsisMiddle, func(head, tail string) bool {
+			return head != "" && tail != "" && strings.HasPrefix(text, head) && strings.HasSuffix(text, tail)
+		}},
+		{EllipsisStart, func(head, tail string) bool { return head == "" && strings.HasSuffix(text, tail) }},
+	} {
+		result := c.Ellipsize(text, maxWidth, test.mode)
+		parts := strings.Split(result, "…")
+		if len(parts) != 2 || !test.match(parts[0], parts[1]) {
+			t.Errorf("mode %d shortened %q to %q", test.mode, text, result)
+			continue
+		}
+		width, _ := c.TextBounds(0, 0, result)
+		if width > maxWidth {
+			t.Errorf("mode %d: %q is %f wide, more than %f", test.mode, result, width, maxWidth)
+		}
+		if advance, want := c.TextEllipsize(0, 50, maxWidth, text, test.mode), c.Text(0, 50, result); advance != want {
+			t.Errorf("mode %d: TextEllipsize should advance %f, but %f", test.mode, want, advance)
+		}
+	}
+	if result := c.Ellipsize(text, full, EllipsisEnd); result != text {
+		t.Errorf("fitting text shouldn't be shortened, but %q", result)
+	}
+	if result := c.Ellipsize(text, maxWidth, EllipsisNone); result != text {
+		t.Errorf("text shouldn't be shortened without ellipsis mode, but %q", result)
+	}
+	if result := c.Ellipsize(text, 1, EllipsisEnd); result != "" {
+		t.Errorf("text should be empty if the ellipsis doesn't fit, but %q", result)
+	}
+}
+
+func TestEllipsizeClusters(t *testing.T) {
+	c := createTextContext(t)
+	// decomposed é, the mark is never cut from its base
+	text := strings.Repeat("é", 12)
+	full, _ := c.TextBounds(0, 0, text)
+	for _, mode := range []Ellipsis{EllipsisEnd, EllipsisMiddle, EllipsisStart} {
+		for width := full * 0.2; width < full; width += 3 {
+			result := []rune(c.Ellipsize(text, width, mode))
+			for i, r := range result {
+				if r == 'e' && (i+1 == len(result) || result[i+1] != '́') ||
+					r == '́' && (i == 0 || result[i-1] != 'e') {
+					t.Fatalf("mode %d split a cluster in %q", mode, string(result))
+				}
+			}
+		}
+	}
+}
+
+func TestEllipsizeRTL(t *testing.T) {
+	c := createTextContext(t)
+	c.SetTextDirection(TextDirectionRTL)
+	text := "שלום עולם יפה"
+	full, _ := c.TextBounds(0, 0, text)
+	maxWidth := full * 0.6
+	for _, test := range []struct {
+		mode       Ellipsis
+		head, tail bool
+	}{
+		{EllipsisEnd, true, false},
+		{EllipsisMiddle, true, true},
+		{EllipsisStart, false, true},
+	} {
+		// the ellipsis replaces the logical end, start or middle, whichever side it is drawn on
+		result := c.TextEllipsize(0, 50, maxWidth, text, test.mode)
+		shortened := c.Ellipsize(text, maxWidth, test.mode)
+		parts := strings.Split(shortened, "…")
+		if len(parts) != 2 || (parts[0] != "") != test.head || (parts[1] != "") != test.tail ||
+			!strings.HasPrefix(text, parts[0]) || !strings.HasSuffix(text, parts[1]) {
+			t.Errorf("mode %d shortened %q to %q", test.mode, text, shortened)
+		}
+		if result > maxWidth {
+			t.Errorf("mode %d: %q is %f wide, more than %f", test.mode, shortened, result, maxWidth)
+		}
+	}
+}
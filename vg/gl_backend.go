@@ -3,7 +3,7 @@ package vg
 import (
 	"errors"
 	"fmt"
-	"github.com/goxjs/gl"
+	"github.com/jxo/davinci/vg/internal/gl"
 	"strings"
 )
 
@@ -15,6 +15,9 @@ const (
 )
 
 // NewContext makes new DaVinci context that is entry point of this API
+//
+// The default backend uses GL ES 2 compatible calls. Build with the gl33 tag to use the OpenGL 3.3
+// core profile backend instead, the GL context has to be current and created with a core profile.
 func NewContext(flags CreateFlags) (*Context, error) {
 	params := &glParams{
 		isEdgeAntiAlias: (flags & AntiAlias) != 0,
@@ -100,21 +103,24 @@ const (
 )
 
 type glContext struct {
-	shader       glShader
-	view         [2]float32
-	textures     []*glTexture
-	textureID    int
-	vertexBuffer gl.Buffer
-	flags        CreateFlags
-	calls        []glCall
-	paths        []glPath
-	vertexes     []float32
-	uniforms     []glFragUniforms
+	shader    glShader
+	view      [2]float32
+	textures  []*glTexture
+	textureID int
+	buffers   glBuffers
+	flags     CreateFlags
+	calls     []glCall
+	paths     []glPath
+	vertexes  []float32
+	uniforms  []glFragUniforms
 
 	stencilMask     uint32
 	stencilFunc     gl.Enum
 	stencilFuncRef  int
 	stencilFuncMask uint32
+	boundTexture    int
+	boundUniform    int
+	stats           RenderStats
 }
 
 func (c *glContext) findTexture(id int) *glTexture {
@@ -155,7 +161,7 @@ func (c *glContext) setStencilFunc(fun gl.Enum, ref int, mask uint32) {
 	if c.stencilFunc != fun || c.stencilFuncRef != ref || c.stencilFuncMask != mask {
 		c.stencilFunc = fun
 		c.stencilFuncRef = ref
-		c.stencilMask = mask
+		c.stencilFuncMask = mask
 		gl.StencilFunc(fun, ref, mask)
 	}
 }
@@ -256,16 +262,52 @@ func (c *glContext) convertPaint(frag *glFragUniforms, paint *Paint, scissor *vg
 	return nil
 }
 
+// setUniforms uploads the uniforms and binds the texture of a call. Both are skipped
+// when they are same as the ones of the previous call.
 func (c *glContext) setUniforms(uniformOffset, image int) {
-	frag := c.uniforms[uniformOffset]
-	gl.Uniform4fv(c.shader.locations[glvgLocFRAG], frag[:])
+	frag := &c.uniforms[uniformOffset]
+	if c.boundUniform < 0 || *frag != c.uniforms[c.boundUniform] {
+		c.buffers.setFragUniforms(&c.shader, frag, uniformOffset)
+		c.stats.UniformUploads++
+	}
+	c.boundUniform = uniformOffset
 
+	if image == c.boundTexture {
+		return
+	}
 	if image != 0 {
 		c.bindTexture(&c.findTexture(image).tex)
 		checkError(c, "tex paint tex")
 	} else {
 		c.bindTexture(&gl.Texture{})
 	}
+	c.boundTexture = image
+	c.stats.TextureBinds++
+}
+
+func (c *glContext) drawArrays(mode gl.Enum, first, count int) {
+	gl.DrawArrays(mode, first, count)
+	c.stats.DrawCalls++
+}
+
+// mergeCalls joins adjacent calls which draw plain triangle lists from continuous vertexes
+// with the same uniforms (paint and scissor) and texture, so they are drawn at once.
+func (c *glContext) mergeCalls() {
+	if len(c.calls) < 2 {
+		return
+	}
+	merged := c.calls[:1]
+	for i := 1; i < len(c.calls); i++ {
+		call := c.calls[i]
+		last := &merged[len(merged)-1]
+		if last.canMerge(&call) && c.uniforms[last.uniformOffset] == c.uniforms[call.uniformOffset] {
+			last.triangleCount += call.triangleCount
+			c.stats.MergedCalls++
+			continue
+		}
+		merged = append(merged, call)
+	}
+	c.calls = merged
 }
 
 func (c *glContext) fill(call *glCall) {
@@ -287,7 +329,7 @@ func (c *glContext) fill(call *glCall) {
 	gl.Disable(gl.CULL_FACE)
 	for i := call.pathOffset; i < pathSentinel; i++ {
 		path := &c.paths[i]
-		gl.DrawArrays(gl.TRIANGLE_FAN, path.fillOffset, path.fillCount)
+		c.drawArrays(gl.TRIANGLE_FAN, path.fillOffset, path.fillCount)
 	}
 	gl.Enable(gl.CULL_FACE)
 
@@ -301,35 +343,23 @@ func (c *glContext) fill(call *glCall) {
 		// Draw fringes
 		for i := call.pathOffset; i < pathSentinel; i++ {
 			path := &c.paths[i]
-			gl.DrawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
+			c.drawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
 		}
 	}
 
 	// Draw fill
 	c.setStencilFunc(gl.NOTEQUAL, 0x00, 0xff)
 	gl.StencilOp(gl.ZERO, gl.ZERO, gl.ZERO)
-	gl.DrawArrays(gl.TRIANGLES, call.triangleOffset, call.triangleCount)
+	c.drawArrays(gl.TRIANGLES, call.triangleOffset, call.triangleCount)
 
 	gl.Disable(gl.STENCIL_TEST)
 }
 
 func (c *glContext) convexFill(call *glCall) {
-	paths := c.paths[call.pathOffset : call.pathOffset+call.pathCount]
-
+	// Fill and fringe are unrolled into one triangle list (see glParams.renderConvexFill).
 	c.setUniforms(call.uniformOffset, call.image)
 	checkError(c, "convex fill")
-
-	for i := range paths {
-		path := &paths[i]
-		gl.DrawArrays(gl.TRIANGLE_FAN, path.fillOffset, path.fillCount)
-	}
-
-	if c.flags&AntiAlias != 0 {
-		for i := range paths {
-			path := &paths[i]
-			gl.DrawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
-		}
-	}
+	c.drawArrays(gl.TRIANGLES, call.triangleOffset, call.triangleCount)
 }
 
 func (c *glContext) stroke(call *glCall) {
@@ -346,7 +376,7 @@ func (c *glContext) stroke(call *glCall) {
 		checkError(c, "stroke fill 0")
 		for i := range paths {
 			path := &paths[i]
-			gl.DrawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
+			c.drawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
 		}
 
 		// Draw anti-aliased pixels.
@@ -355,7 +385,7 @@ func (c *glContext) stroke(call *glCall) {
 		gl.StencilOp(gl.KEEP, gl.KEEP, gl.KEEP)
 		for i := range paths {
 			path := &paths[i]
-			gl.DrawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
+			c.drawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
 		}
 
 		// Clear stencil buffer.
@@ -365,7 +395,7 @@ func (c *glContext) stroke(call *glCall) {
 		checkError(c, "stroke fill 1")
 		for i := range paths {
 			path := &paths[i]
-			gl.DrawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
+			c.drawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
 		}
 		gl.ColorMask(true, true, true, true)
 		gl.Disable(gl.STENCIL_TEST)
@@ -374,7 +404,7 @@ func (c *glContext) stroke(call *glCall) {
 		checkError(c, "stroke fill")
 		for i := range paths {
 			path := &paths[i]
-			gl.DrawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
+			c.drawArrays(gl.TRIANGLE_STRIP, path.strokeOffset, path.strokeCount)
 		}
 	}
 }
@@ -382,13 +412,19 @@ func (c *glContext) stroke(call *glCall) {
 func (c *glContext) triangles(call *glCall) {
 	c.setUniforms(call.uniformOffset, call.image)
 	checkError(c, "triangles fill")
-	gl.DrawArrays(gl.TRIANGLES, call.triangleOffset, call.triangleCount)
+	if call.channel != 0 {
+		gl.ColorMask(call.channel == 1, call.channel == 2, call.channel == 3, false)
+	}
+	c.drawArrays(gl.TRIANGLES, call.triangleOffset, call.triangleCount)
+	if call.channel != 0 {
+		gl.ColorMask(true, true, true, true)
+	}
 }
 
 func (c *glContext) triangleStrip(call *glCall) {
 	c.setUniforms(call.uniformOffset, call.image)
 	checkError(c, "triangle strip fill")
-	gl.DrawArrays(gl.TRIANGLE_STRIP, call.triangleOffset, call.triangleCount)
+	c.drawArrays(gl.TRIANGLE_STRIP, call.triangleOffset, call.triangleCount)
 }
 
 type glParams struct {
@@ -404,15 +440,18 @@ func (p *glParams) renderCreate() error {
 	context := p.context
 	//align := 4
 
+	if err := gl.Init(); err != nil {
+		return err
+	}
 	checkError(context, "init")
 
 	if p.edgeAntiAlias() {
-		err := context.shader.createShader("shader", shaderHeader, "#define EDGE_AA 1", fillVertexShader, fillFragmentShader)
+		err := context.shader.createShader("shader", glShaderHeader(), "#define EDGE_AA 1", fillVertexShader, fillFragmentShader)
 		if err != nil {
 			return err
 		}
 	} else {
-		err := context.shader.createShader("shader", shaderHeader, "", fillVertexShader, fillFragmentShader)
+		err := context.shader.createShader("shader", glShaderHeader(), "", fillVertexShader, fillFragmentShader)
 		if err != nil {
 			return err
 		}
@@ -420,8 +459,9 @@ func (p *glParams) renderCreate() error {
 	checkError(context, "init")
 	context.shader.getUniforms()
 
-	context.vertexBuffer = gl.CreateBuffer()
-	context.vertexBuffer = gl.CreateBuffer()
+	if err := context.buffers.create(&context.shader); err != nil {
+		return err
+	}
 
 	checkError(context, "create done")
 	gl.Finish()
@@ -448,13 +488,16 @@ func (p *glParams) renderCreateTexture(texType vgTextureType, w, h int, flags Im
 
 	p.context.bindTexture(&tex.tex)
 	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	if data != nil {
+		p.context.stats.TextureUploads++
+	}
 
 	if texType == vgTextureRGBA {
 		data = prepareTextureBuffer(data, w, h, 4)
 		gl.TexImage2D(gl.TEXTURE_2D, 0, w, h, gl.RGBA, gl.UNSIGNED_BYTE, data)
 	} else {
 		data = prepareTextureBuffer(data, w, h, 1)
-		gl.TexImage2D(gl.TEXTURE_2D, 0, w, h, gl.LUMINANCE, gl.UNSIGNED_BYTE, data)
+		gl.TexImage2D(gl.TEXTURE_2D, 0, w, h, glAlphaFormat, gl.UNSIGNED_BYTE, data)
 	}
 
 	if (flags & ImageGenerateMipmaps) != 0 {
@@ -514,11 +557,12 @@ func (p *glParams) renderUpdateTexture(image, x, y, w, h int, data []byte) error
 	}
 	x = 0
 	w = tex.width
+	p.context.stats.TextureUploads++
 
 	if tex.texType == vgTextureRGBA {
 		gl.TexSubImage2D(gl.TEXTURE_2D, 0, x, y, w, h, gl.RGBA, gl.UNSIGNED_BYTE, data)
 	} else {
-		gl.TexSubImage2D(gl.TEXTURE_2D, 0, x, y, w, h, gl.LUMINANCE, gl.UNSIGNED_BYTE, data)
+		gl.TexSubImage2D(gl.TEXTURE_2D, 0, x, y, w, h, glAlphaFormat, gl.UNSIGNED_BYTE, data)
 	}
 
 	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
@@ -539,6 +583,7 @@ func (p *glParams) renderGetTextureSize(image int) (int, int, error) {
 func (p *glParams) renderViewport(width, height int) {
 	p.context.view[0] = float32(width)
 	p.context.view[1] = float32(height)
+	p.context.stats = RenderStats{}
 }
 
 func (p *glParams) renderCancel() {
@@ -551,6 +596,9 @@ func (p *glParams) renderCancel() {
 
 func (p *glParams) renderFlush() {
 	c := p.context
+	c.stats.Calls += len(c.calls)
+	c.stats.VertexBytes += len(c.vertexes) * 4
+	c.mergeCalls()
 
 	if len(c.calls) > 0 {
 		gl.UseProgram(c.shader.program)
@@ -572,11 +620,11 @@ func (p *glParams) renderFlush() {
 		c.stencilFunc = gl.ALWAYS
 		c.stencilFuncRef = 0
 		c.stencilFuncMask = 0xffffffff
-		b := castFloat32ToByte(c.vertexes)
+		c.boundTexture = 0
+		c.boundUniform = -1
 		//dumpLog("vertex:", c.vertexes)
 		// Upload vertex data
-		gl.BindBuffer(gl.ARRAY_BUFFER, c.vertexBuffer)
-		gl.BufferData(gl.ARRAY_BUFFER, b, gl.STREAM_DRAW)
+		c.buffers.upload(c.vertexes, c.uniforms)
 		gl.EnableVertexAttribArray(c.shader.vertexAttrib)
 		gl.EnableVertexAttribArray(c.shader.tcoordAttrib)
 		gl.VertexAttribPointer(c.shader.vertexAttrib, 2, gl.FLOAT, false, 4*4, 0)
@@ -604,7 +652,7 @@ func (p *glParams) renderFlush() {
 		gl.DisableVertexAttribArray(c.shader.vertexAttrib)
 		gl.DisableVertexAttribArray(c.shader.tcoordAttrib)
 		gl.Disable(gl.CULL_FACE)
-		gl.BindBuffer(gl.ARRAY_BUFFER, gl.Buffer{})
+		c.buffers.unbind()
 		gl.UseProgram(gl.Program{})
 		c.bindTexture(nil)
 	}
@@ -615,21 +663,20 @@ func (p *glParams) renderFlush() {
 }
 
 func (p *glParams) renderFill(paint *Paint, scissor *vgScissor, fringe float32, bounds [4]float32, paths []vgPath) {
+	if len(paths) == 1 && paths[0].convex {
+		p.renderConvexFill(paint, scissor, fringe, &paths[0])
+		return
+	}
 	c := p.context
 	var glPaths []glPath
 	c.calls = append(c.calls, glCall{
+		callType:  glvgFILL,
 		pathCount: len(paths),
 		image:     paint.image,
 	})
 	call := &c.calls[len(c.calls)-1]
 	glPaths, call.pathOffset = c.allocPath(call.pathCount)
 
-	if len(paths) == 0 && paths[0].convex {
-		call.callType = glvgCONVEXFILL
-	} else {
-		call.callType = glvgFILL
-	}
-
 	// Allocate vertices for all the paths
 	vertexOffset := c.allocVertexMemory(maxVertexCount(paths) + 6)
 	for i := range paths {
@@ -711,24 +758,63 @@ func (p *glParams) renderFill(paint *Paint, scissor *vgScissor, fringe float32,
 	c.vertexes[vertexOffset+3] = 1.0
 
 	// Setup uniforms for draw calls
-	var paintFrag *glFragUniforms
-	if call.callType == glvgFILL {
-		var uniforms []glFragUniforms
-		uniforms, call.uniformOffset = c.allocFragUniforms(2)
-		// Simple shader for stencil
-		u0 := &uniforms[0]
-		u0.reset()
-		u0.setStrokeThr(-1.0)
-		u0.setType(nsvgShaderSIMPLE)
-		paintFrag = &uniforms[1]
-	} else {
-		var frags []glFragUniforms
-		frags, call.uniformOffset = c.allocFragUniforms(1)
-		paintFrag = &frags[0]
+	var uniforms []glFragUniforms
+	uniforms, call.uniformOffset = c.allocFragUniforms(2)
+	// Simple shader for stencil
+	u0 := &uniforms[0]
+	u0.reset()
+	u0.setStrokeThr(-1.0)
+	u0.setType(nsvgShaderSIMPLE)
+	// Fill shader
+	u1 := &uniforms[1]
+	u1.reset()
+	c.convertPaint(u1, paint, scissor, fringe, fringe, -1.0)
+}
+
+// renderConvexFill stores a single convex path as one triangle list instead of a fan and
+// a strip, so that consecutive fills with the same paint can be merged into one draw call.
+func (p *glParams) renderConvexFill(paint *Paint, scissor *vgScissor, fringe float32, path *vgPath) {
+	c := p.context
+	fills := path.fills
+	var strokes []vgVertex
+	if c.flags&AntiAlias != 0 {
+		strokes = path.strokes
+	}
+	vertexCount := trianglesFromFan(len(fills)) + trianglesFromStrip(len(strokes))
+	vertexOffset := c.allocVertexMemory(vertexCount)
+	callIndex := len(c.calls)
+
+	c.calls = append(c.calls, glCall{
+		callType:       glvgCONVEXFILL,
+		image:          paint.image,
+		triangleOffset: vertexOffset / 4,
+		triangleCount:  vertexCount,
+	})
+	call := &c.calls[callIndex]
+
+	for i := 2; i < len(fills); i++ {
+		vertexOffset = c.setVertex(vertexOffset, &fills[0])
+		vertexOffset = c.setVertex(vertexOffset, &fills[i-1])
+		vertexOffset = c.setVertex(vertexOffset, &fills[i])
+	}
+	for i := 2; i < len(strokes); i++ {
+		// Keep the winding of the strip, every second triangle is flipped.
+		if i%2 == 0 {
+			vertexOffset = c.setVertex(vertexOffset, &strokes[i-2])
+			vertexOffset = c.setVertex(vertexOffset, &strokes[i-1])
+		} else {
+			vertexOffset = c.setVertex(vertexOffset, &strokes[i-1])
+			vertexOffset = c.setVertex(vertexOffset, &strokes[i-2])
+		}
+		vertexOffset = c.setVertex(vertexOffset, &strokes[i])
 	}
+
 	// Fill shader
-	paintFrag.reset()
-	c.convertPaint(paintFrag, paint, scissor, fringe, fringe, -1.0)
+	var frags []glFragUniforms
+	frags, call.uniformOffset = c.allocFragUniforms(1)
+	f0 := &frags[0]
+	f0.reset()
+	c.convertPaint(f0, paint, scissor, fringe, fringe, -1.0)
 }
 
 func (p *glParams) renderStroke(paint *Paint, scissor *vgScissor, fringe float32, strokeWidth float32, paths []vgPath) {
@@ -818,6 +904,23 @@ func (p *glParams) renderTriangles(paint *Paint, scissor *vgScissor, vertexes []
 	f0.setType(nsvgShaderIMG)
 }
 
+func (p *glParams) renderSDFTriangles(paint *Paint, scissor *vgScissor, vertexes []vgVertex, sdf *vgSDFText) {
+	c := p.context
+	p.renderTriangles(paint, scissor, vertexes)
+
+	f0 := &c.uniforms[c.calls[len(c.calls)-1].uniformOffset]
+	f0.setType(nsvgShaderSDF)
+	f0.setOutlineColor(sdf.outlineColor.PreMultiply())
+	f0.setGlowColor(sdf.glowColor.PreMultiply())
+	f0.setSDF(sdf.scale, sdf.outlineWidth, sdf.glowWidth)
+}
+
+func (p *glParams) renderChannelTriangles(paint *Paint, scissor *vgScissor, vertexes []vgVertex, channel int) {
+	c := p.context
+	p.renderTriangles(paint, scissor, vertexes)
+	c.calls[len(c.calls)-1].channel = channel
+}
+
 func (p *glParams) renderTriangleStrip(paint *Paint, scissor *vgScissor, vertexes []vgVertex) {
 	c := p.context
 
@@ -851,12 +954,14 @@ func (p *glParams) renderTriangleStrip(paint *Paint, scissor *vgScissor, vertexe
 	f0.setType(nsvgShaderIMG)
 }
 
+func (p *glParams) renderStats() RenderStats {
+	return p.context.stats
+}
+
 func (p *glParams) renderDelete() {
 	c := p.context
 	c.shader.deleteShader()
-	if c.vertexBuffer.Valid() {
-		gl.DeleteBuffer(c.vertexBuffer)
-	}
+	c.buffers.delete()
 	for _, texture := range c.textures {
 		if texture.tex.Valid() && (texture.flags&ImageNoDelete) == 0 {
 			gl.DeleteTexture(texture.tex)
@@ -889,6 +994,25 @@ func checkError(p *glContext, str string) {
 	}
 }
 
+func (c *glContext) setVertex(offset int, vertex *vgVertex) int {
+	c.vertexes[offset] = vertex.x
+	c.vertexes[offset+1] = vertex.y
+	c.vertexes[offset+2] = vertex.u
+	c.vertexes[offset+3] = vertex.v
+	return offset + 4
+}
+
+func trianglesFromFan(count int) int {
+	if count < 3 {
+		return 0
+	}
+	return (count - 2) * 3
+}
+
+func trianglesFromStrip(count int) int {
+	return trianglesFromFan(count)
+}
+
 func maxVertexCount(paths []vgPath) int {
 	count := 0
 	for i := range paths {
@@ -899,6 +1023,13 @@ func maxVertexCount(paths []vgPath) int {
 	return count
 }
 
+// coreShaderHeader is the shader header of the OpenGL 3.3 core profile backend in gl_core.go.
+const coreShaderHeader = `#version 330 core
+#define DAVINCI_GL3 1
+#define USE_UNIFORMBUFFER 1
+#define UNIFORMARRAY_SIZE 14
+`
+
 var fillVertexShader = `
 #ifdef DAVINCI_GL3
    uniform vec2 viewSize;
@@ -941,9 +1072,15 @@ var fillFragmentShader = `
                float feather;
                float strokeMult;
                float strokeThr;
-               int texType;
-               int type;
+               float fragTexType;
+               float fragType;
+               vec4 outlineCol;
+               vec4 glowCol;
+               vec4 sdfParams;
        };
+       // glFragUniforms stores every member as float.
+       #define texType int(fragTexType)
+       #define type int(fragType)
 #else
        // DAVINCI_GL3 && !USE_UNIFORMBUF
        uniform vec4 frag[UNIFORMARRAY_SIZE];
@@ -973,6 +1110,9 @@ var fillFragmentShader = `
        #define strokeThr frag[10].y
        #define texType int(frag[10].z)
        #define type int(frag[10].w)
+       #define outlineCol frag[11]
+       #define glowCol frag[12]
+       #define sdfParams frag[13]
 #endif
 
 float sdroundrect(vec2 pt, vec2 ext, float rad) {
@@ -1037,6 +1177,23 @@ void main(void) {
                if (texType == 2) color = vec4(color.x);
                color *= scissor;
                result = color * innerCol;
+       } else if (type == 4) {         // Signed distance field text
+#ifdef DAVINCI_GL3
+               float dist = texture(tex, ftcoord).x;
+#else
+               float dist = texture2D(tex, ftcoord).x;
+#endif
+               // Distance to the outline in pixels, positive inside.
+               float d = (dist - 0.5) * sdfParams.x;
+               float fill = clamp(d + 0.5, 0.0, 1.0);
+               float outline = clamp(d + sdfParams.y + 0.5, 0.0, 1.0);
+               float glow = 0.0;
+               if (sdfParams.z > 0.0) glow = clamp(1.0 + (d + sdfParams.y) / sdfParams.z, 0.0, 1.0);
+               // Fill over outline over glow.
+               vec4 color = glowCol * glow * glow;
+               color = outlineCol * outline + color * (1.0 - outlineCol.w * outline);
+               color = innerCol * fill + color * (1.0 - innerCol.w * fill);
+               result = color * scissor;
        }
 #ifdef EDGE_AA
        if (strokeAlpha < strokeThr) discard;
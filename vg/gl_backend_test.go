@@ -0,0 +1,314 @@
+package vg
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMergeCalls(t *testing.T) {
+	c := &glContext{}
+	for i := 0; i < 4; i++ {
+		frags, offset := c.allocFragUniforms(1)
+		frags[0].setInnerColor(RGBA(255, 0, 0, 255))
+		if i == 2 {
+			frags[0].setInnerColor(RGBA(0, 0, 255, 255))
+		}
+		c.calls = append(c.calls, glCall{
+			callType:       glvgCONVEXFILL,
+			triangleOffset: i * 6,
+			triangleCount:  6,
+			uniformOffset:  offset,
+		})
+	}
+	c.calls = append(c.calls, glCall{callType: glvgFILL, triangleOffset: 24, triangleCount: 6})
+	c.mergeCalls()
+	if len(c.calls) != 4 {
+		t.Fatalf("4 calls are expected after merge, but %d", len(c.calls))
+	}
+	if c.calls[0].triangleCount != 12 {
+		t.Errorf("first two calls should be merged, but count is %d", c.calls[0].triangleCount)
+	}
+	if c.stats.MergedCalls != 1 {
+		t.Errorf("1 merged call is expected, but %d", c.stats.MergedCalls)
+	}
+}
+
+func TestMergeChannelCalls(t *testing.T) {
+	c := &glContext{}
+	frags, offset := c.allocFragUniforms(1)
+	frags[0].setInnerColor(RGBA(0, 0, 0, 255))
+	for channel := 1; channel <= 3; channel++ {
+		c.calls = append(c.calls, glCall{
+			callType:       glvgTRIANGLES,
+			triangleOffset: channel * 6,
+			triangleCount:  6,
+			uniformOffset:  offset,
+			channel:        channel,
+		})
+	}
+	c.mergeCalls()
+	if len(c.calls) != 3 {
+		t.Errorf("calls of different channels shouldn't be merged, but %d calls", len(c.calls))
+	}
+}
+
+func TestSubImageFillUniforms(t *testing.T) {
+	c := &glContext{textures: []*glTexture{{id: 1, width: 64, height: 64, texType: vgTextureRGBA}}}
+	p := &glParams{context: c}
+	scissor := &vgScissor{extent: [2]float32{-1, -1}}
+	for i := 0; i < 2; i++ {
+		x := float32(i * 20)
+		path := vgPath{
+			convex: true,
+			fills:  []vgVertex{{x, 0, 0.5, 1}, {x, 16, 0.5, 1}, {x + 16, 16, 0.5, 1}, {x + 16, 0, 0.5, 1}},
+		}
+		// each quad shows another 16x16 part of the texture, like sub-images of an atlas
+		paint := ImagePattern(x, 0, 16, 16, 0, 1, 1)
+		paint.mapToSubImage(float32(i*16), 0, 16, 16, 64, 64)
+		p.renderConvexFill(&paint, scissor, 1, &path)
+	}
+	if c.calls[0].image != c.calls[1].image {
+		t.Error("sub-images of one page should share the texture")
+	}
+	// the bottom-left corner of the second quad is mapped to its part of the texture like the shader does
+	u := &c.uniforms[1]
+	x, y := float32(20), float32(16)
+	s := (u[12]*x + u[16]*y + u[20]) / u[36]
+	v := (u[13]*x + u[17]*y + u[21]) / u[37]
+	if absF(s-0.25) > 1e-5 || absF(v-0.25) > 1e-5 {
+		t.Errorf("texture coordinate should be (0.25,0.25), but (%v,%v)", s, v)
+	}
+}
+
+// preprocessShader resolves the conditional blocks of a shader source like the GLSL preprocessor
+// with the given macros defined. Only the directives used by the shaders of the backend are known.
+func preprocessShader(t *testing.T, src string, defines map[string]bool) []string {
+	var lines []string
+	var stack []bool
+	active := func() bool {
+		for _, a := range stack {
+			if !a {
+				return false
+			}
+		}
+		return true
+	}
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "#ifdef "):
+			stack = append(stack, defines[fields[1]])
+		case strings.HasPrefix(line, "#ifndef "):
+			stack = append(stack, !defines[fields[1]])
+		case strings.HasPrefix(line, "#if "):
+			value := false
+			for _, term := range strings.Split(strings.TrimPrefix(line, "#if "), "||") {
+				term = strings.TrimSpace(term)
+				if !strings.HasPrefix(term, "defined(") || !strings.HasSuffix(term, ")") {
+					t.Fatalf("unknown condition %q", line)
+				}
+				value = value || defines[term[len("defined("):len(term)-1]]
+			}
+			stack = append(stack, value)
+		case line == "#else":
+			stack[len(stack)-1] = !stack[len(stack)-1]
+		case line == "#endif":
+			stack = stack[:len(stack)-1]
+		case !active():
+		case strings.HasPrefix(line, "#define "):
+			defines[fields[1]] = true
+			lines = append(lines, line)
+		case line != "":
+			lines = append(lines, line)
+		}
+	}
+	if len(stack) != 0 {
+		t.Fatalf("%d conditional blocks aren't closed", len(stack))
+	}
+	return lines
+}
+
+func shaderSources(t *testing.T, header string) (vertex, fragment []string) {
+	defines := map[string]bool{"EDGE_AA": true}
+	preprocessShader(t, header, defines)
+	vertex = preprocessShader(t, fillVertexShader, defines)
+	fragment = preprocessShader(t, fillFragmentShader, defines)
+	return vertex, fragment
+}
+
+func TestCoreShaderSources(t *testing.T) {
+	if !strings.HasPrefix(coreShaderHeader, "#version 330 core\n") {
+		t.Errorf("core shader header should require GLSL 3.30 core, but %q", strings.SplitN(coreShaderHeader, "\n", 2)[0])
+	}
+	vertex, fragment := shaderSources(t, coreShaderHeader)
+	for _, line := range append(vertex, fragment...) {
+		for _, removed := range []string{"attribute ", "varying ", "texture2D(", "gl_FragColor", "precision "} {
+			if strings.Contains(line, removed) {
+				t.Errorf("%q isn't available in the core profile: %s", removed, line)
+			}
+		}
+	}
+	// Both backends upload 4 floats per vertex, the position and the texture coordinate.
+	attributes := []string{}
+	for _, line := range vertex {
+		if strings.HasPrefix(line, "in ") {
+			attributes = append(attributes, line)
+		}
+	}
+	if want := []string{"in vec2 vertex;", "in vec2 tcoord;"}; !reflect.DeepEqual(attributes, want) {
+		t.Errorf("vertex attributes should be %v, but %v", want, attributes)
+	}
+	if !containsLine(fragment, "uniform sampler2D tex;") || !containsLine(fragment, "out vec4 outColor;") {
+		t.Errorf("fragment shader should declare the texture and the output color")
+	}
+
+	_, es2 := shaderSources(t, shaderHeader)
+	for _, line := range es2 {
+		if strings.Contains(line, "layout(") {
+			t.Errorf("uniform buffer used without DAVINCI_GL3: %s", line)
+		}
+	}
+}
+
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+// std140Offsets returns the offsets in floats of the members of the frag uniform block.
+func std140Offsets(t *testing.T, fragment []string) (map[string]int, int) {
+	offsets := map[string]int{}
+	offset := -1
+	for _, line := range fragment {
+		if line == "layout(std140) uniform frag {" {
+			offset = 0
+			continue
+		}
+		if offset < 0 {
+			continue
+		}
+		if line == "};" {
+			return offsets, offset
+		}
+		fields := strings.Fields(strings.TrimSuffix(line, ";"))
+		var align, size int
+		switch fields[0] {
+		case "mat3":
+			// std140 stores every column as vec4
+			align, size = 4, 12
+		case "vec4":
+			align, size = 4, 4
+		case "vec2":
+			align, size = 2, 2
+		case "float":
+			align, size = 1, 1
+		default:
+			t.Fatalf("unknown member type %q", line)
+		}
+		offset = (offset + align - 1) / align * align
+		offsets[fields[1]] = offset
+		offset += size
+	}
+	t.Fatal("frag uniform block not found")
+	return nil, 0
+}
+
+// arrayOffsets returns the offsets in floats of the uniforms mapped into the frag uniform array.
+func arrayOffsets(t *testing.T, fragment []string) map[string]int {
+	pattern := regexp.MustCompile(`frag\[(\d+)\](\.[xyzw]+)?`)
+	offsets := map[string]int{}
+	for _, line := range fragment {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "#define" {
+			continue
+		}
+		match := pattern.FindStringSubmatch(fields[2])
+		if match == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(match[1])
+		component := 0
+		if match[2] != "" {
+			component = strings.IndexByte("xyzw", match[2][1])
+		}
+		offsets[fields[1]] = index*4 + component
+	}
+	return offsets
+}
+
+func TestFragUniformLayout(t *testing.T) {
+	ones := make([]float32, 12)
+	for i := range ones {
+		ones[i] = 1
+	}
+	white := RGBA(255, 255, 255, 255)
+	setters := map[string]func(u *glFragUniforms){
+		"scissorMat":   func(u *glFragUniforms) { u.setScissorMat(ones) },
+		"paintMat":     func(u *glFragUniforms) { u.setPaintMat(ones) },
+		"innerCol":     func(u *glFragUniforms) { u.setInnerColor(white) },
+		"outerCol":     func(u *glFragUniforms) { u.setOuterColor(white) },
+		"scissorExt":   func(u *glFragUniforms) { u.setScissorExt(1, 1) },
+		"scissorScale": func(u *glFragUniforms) { u.setScissorScale(1, 1) },
+		"extent":       func(u *glFragUniforms) { u.setExtent([2]float32{1, 1}) },
+		"radius":       func(u *glFragUniforms) { u.setRadius(1) },
+		"feather":      func(u *glFragUniforms) { u.setFeather(1) },
+		"strokeMult":   func(u *glFragUniforms) { u.setStrokeMult(1) },
+		"strokeThr":    func(u *glFragUniforms) { u.setStrokeThr(1) },
+		"fragTexType":  func(u *glFragUniforms) { u.setTexType(1) },
+		"fragType":     func(u *glFragUniforms) { u.setType(1) },
+		"outlineCol":   func(u *glFragUniforms) { u.setOutlineColor(white) },
+		"glowCol":      func(u *glFragUniforms) { u.setGlowColor(white) },
+		"sdfParams":    func(u *glFragUniforms) { u.setSDF(1, 1, 1) },
+	}
+
+	_, fragment := shaderSources(t, coreShaderHeader)
+	block, size := std140Offsets(t, fragment)
+	if size != len(glFragUniforms{}) {
+		t.Errorf("frag uniform block is %d floats, but glFragUniforms %d", size, len(glFragUniforms{}))
+	}
+	if len(block) != len(setters) {
+		t.Errorf("frag uniform block has %d members, but %d are set", len(block), len(setters))
+	}
+	for name, set := range setters {
+		var u glFragUniforms
+		set(&u)
+		index := 0
+		for index < len(u) && u[index] == 0 {
+			index++
+		}
+		offset, ok := block[name]
+		if !ok {
+			t.Errorf("%s isn't a member of the frag uniform block", name)
+		} else if offset != index {
+			t.Errorf("%s is at %d in the frag uniform block, but set at %d", name, offset, index)
+		}
+	}
+
+	// The uniform array of the default backend uploads the same floats.
+	if len(glFragUniforms{}) != 14*4 {
+		t.Errorf("glFragUniforms should fill UNIFORMARRAY_SIZE vec4s")
+	}
+	_, es2 := shaderSources(t, shaderHeader)
+	array := arrayOffsets(t, es2)
+	names := map[string]string{"texType": "fragTexType", "type": "fragType"}
+	for name, offset := range array {
+		member := name
+		if n, ok := names[name]; ok {
+			member = n
+		}
+		if block[member] != offset {
+			t.Errorf("%s is at %d in the uniform array, but at %d in the uniform block", name, offset, block[member])
+		}
+	}
+	if len(array) != len(block) {
+		t.Errorf("uniform array maps %d members, but the uniform block has %d", len(array), len(block))
+	}
+}
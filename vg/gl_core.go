@@ -0,0 +1,91 @@
+// +build gl33
+
+package vg
+
+import (
+	"github.com/jxo/davinci/vg/internal/gl"
+)
+
+// The gl33 build tag selects the OpenGL 3.3 core profile backend. Vertexes are drawn through a
+// vertex array object and the uniforms of all calls are uploaded into one uniform buffer, each call
+// binds its own range of the buffer. Drawing needs a 3.3 core (or forward compatible) context.
+
+var glAlphaFormat gl.Enum = gl.RED
+
+const glFragBinding = 0
+
+func glShaderHeader() string {
+	return coreShaderHeader
+}
+
+// glBuffers keeps the vertex array, the vertex buffer and the uniform buffer.
+type glBuffers struct {
+	vertexArray  gl.VertexArray
+	vertexBuffer gl.Buffer
+	fragBuffer   gl.Buffer
+	fragSize     int
+	fragData     []byte
+}
+
+func (b *glBuffers) create(shader *glShader) error {
+	index := gl.GetUniformBlockIndex(shader.program, "frag")
+	gl.UniformBlockBinding(shader.program, index, glFragBinding)
+
+	b.vertexArray = gl.CreateVertexArray()
+	b.vertexBuffer = gl.CreateBuffer()
+	b.fragBuffer = gl.CreateBuffer()
+
+	align := gl.GetInteger(gl.UNIFORM_BUFFER_OFFSET_ALIGNMENT)
+	size := len(glFragUniforms{}) * 4
+	if align > 0 {
+		size = (size + align - 1) / align * align
+	}
+	b.fragSize = size
+	return nil
+}
+
+func (b *glBuffers) upload(vertexes []float32, uniforms []glFragUniforms) {
+	if len(uniforms) > 0 {
+		size := len(uniforms) * b.fragSize
+		if cap(b.fragData) < size {
+			b.fragData = make([]byte, size)
+		}
+		b.fragData = b.fragData[:size]
+		for i := range uniforms {
+			copy(b.fragData[i*b.fragSize:], castFloat32ToByte(uniforms[i][:]))
+		}
+		gl.BindBuffer(gl.UNIFORM_BUFFER, b.fragBuffer)
+		// Orphan the previous storage so the driver doesn't wait for the last frame.
+		gl.BufferInit(gl.UNIFORM_BUFFER, size, gl.STREAM_DRAW)
+		gl.BufferSubData(gl.UNIFORM_BUFFER, 0, b.fragData)
+	}
+
+	gl.BindVertexArray(b.vertexArray)
+	gl.BindBuffer(gl.ARRAY_BUFFER, b.vertexBuffer)
+	if len(vertexes) > 0 {
+		data := castFloat32ToByte(vertexes)
+		gl.BufferInit(gl.ARRAY_BUFFER, len(data), gl.STREAM_DRAW)
+		gl.BufferSubData(gl.ARRAY_BUFFER, 0, data)
+	}
+}
+
+func (b *glBuffers) setFragUniforms(shader *glShader, frag *glFragUniforms, uniformOffset int) {
+	gl.BindBufferRange(gl.UNIFORM_BUFFER, glFragBinding, b.fragBuffer, uniformOffset*b.fragSize, len(frag)*4)
+}
+
+func (b *glBuffers) unbind() {
+	gl.BindBuffer(gl.ARRAY_BUFFER, gl.Buffer{})
+	gl.BindVertexArray(gl.VertexArray{})
+}
+
+func (b *glBuffers) delete() {
+	if b.vertexArray.Valid() {
+		gl.DeleteVertexArray(b.vertexArray)
+	}
+	if b.vertexBuffer.Valid() {
+		gl.DeleteBuffer(b.vertexBuffer)
+	}
+	if b.fragBuffer.Valid() {
+		gl.DeleteBuffer(b.fragBuffer)
+	}
+}
@@ -0,0 +1,45 @@
+// +build !gl33
+
+package vg
+
+import (
+	"github.com/jxo/davinci/vg/internal/gl"
+)
+
+// The default backend uses GL ES 2 (WebGL) compatible calls, the shader header comes from the platform.
+// Build with the gl33 tag to use the core profile backend in gl_core.go instead.
+
+var glAlphaFormat gl.Enum = gl.LUMINANCE
+
+func glShaderHeader() string {
+	return shaderHeader
+}
+
+// glBuffers keeps the vertex buffer. Uniforms are uploaded as a uniform array per call.
+type glBuffers struct {
+	vertexBuffer gl.Buffer
+}
+
+func (b *glBuffers) create(shader *glShader) error {
+	b.vertexBuffer = gl.CreateBuffer()
+	return nil
+}
+
+func (b *glBuffers) upload(vertexes []float32, uniforms []glFragUniforms) {
+	gl.BindBuffer(gl.ARRAY_BUFFER, b.vertexBuffer)
+	gl.BufferData(gl.ARRAY_BUFFER, castFloat32ToByte(vertexes), gl.STREAM_DRAW)
+}
+
+func (b *glBuffers) setFragUniforms(shader *glShader, frag *glFragUniforms, uniformOffset int) {
+	gl.Uniform4fv(shader.locations[glvgLocFRAG], frag[:])
+}
+
+func (b *glBuffers) unbind() {
+	gl.BindBuffer(gl.ARRAY_BUFFER, gl.Buffer{})
+}
+
+func (b *glBuffers) delete() {
+	if b.vertexBuffer.Valid() {
+		gl.DeleteBuffer(b.vertexBuffer)
+	}
+}
@@ -1,7 +1,7 @@
 package vg
 
 import (
-	"github.com/goxjs/gl"
+	"github.com/jxo/davinci/vg/internal/gl"
 )
 
 const (
@@ -9,6 +9,7 @@ const (
 	nsvgShaderFILLIMG
 	nsvgShaderSIMPLE
 	nsvgShaderIMG
+	nsvgShaderSDF
 )
 
 type glvgCallType int
@@ -30,6 +31,19 @@ type glCall struct {
 	triangleOffset int
 	triangleCount  int
 	uniformOffset  int
+	channel        int // only the red (1), green (2) or blue (3) channel of triangles is drawn, all if 0
+}
+
+// isTriangleList returns true if the call is drawn with one uniform set by one gl.TRIANGLES draw call.
+func (c *glCall) isTriangleList() bool {
+	return c.callType == glvgCONVEXFILL || c.callType == glvgTRIANGLES
+}
+
+// canMerge returns true if next can be appended to the call without changing the texture or
+// the vertex range. Uniforms have to be compared separately.
+func (c *glCall) canMerge(next *glCall) bool {
+	return c.isTriangleList() && next.isTriangleList() && c.image == next.image &&
+		c.channel == next.channel && c.triangleOffset+c.triangleCount == next.triangleOffset
 }
 
 type glPath struct {
@@ -39,10 +53,10 @@ type glPath struct {
 	strokeCount  int
 }
 
-type glFragUniforms [44]float32
+type glFragUniforms [56]float32
 
 func (u *glFragUniforms) reset() {
-	for i := 0; i < 44; i++ {
+	for i := 0; i < 56; i++ {
 		u[i] = 0
 	}
 }
@@ -107,6 +121,20 @@ func (u *glFragUniforms) setType(typeCode float32) {
 	u[43] = typeCode
 }
 
+func (u *glFragUniforms) setOutlineColor(color Color) {
+	copy(u[44:48], color.List())
+}
+
+func (u *glFragUniforms) setGlowColor(color Color) {
+	copy(u[48:52], color.List())
+}
+
+func (u *glFragUniforms) setSDF(scale, outlineWidth, glowWidth float32) {
+	u[52] = scale
+	u[53] = outlineWidth
+	u[54] = glowWidth
+}
+
 type glTexture struct {
 	id            int
 	tex           gl.Texture
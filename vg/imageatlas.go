@@ -0,0 +1,207 @@
+package vg
+
+import (
+	"bytes"
+	"errors"
+	"github.com/jxo/davinci/font"
+	"image"
+	"image/draw"
+)
+
+// ImageAtlas packs many small images into shared texture pages. Each image added to the atlas
+// gets its own handle which can be used everywhere a normal image handle is accepted
+// (ImagePattern(), Context.ImageSize(), Context.DeleteImage() and so on). The paint is remapped
+// to the right part of the page when it is set, so all images of one page share a texture
+// and drawing them one after another doesn't rebind it.
+//
+// Sub-images can't be repeated (ImageRepeatX/ImageRepeatY) and space of deleted images
+// is not reused until the atlas is deleted.
+type ImageAtlas struct {
+	context    *Context
+	flags      ImageFlags
+	pageWidth  int
+	pageHeight int
+	pages      []*imageAtlasPage
+	handles    []int
+}
+
+type imageAtlasPage struct {
+	image  int
+	packer *font.Atlas
+	pixels *image.RGBA
+}
+
+type subImage struct {
+	page       *imageAtlasPage
+	x, y, w, h int
+}
+
+// CreateImageAtlas creates an image atlas whose texture pages have the specified size.
+// Repeat flags are ignored because sub-images can't wrap.
+func (c *Context) CreateImageAtlas(pageWidth, pageHeight int, flags ImageFlags) *ImageAtlas {
+	return &ImageAtlas{
+		context:    c,
+		flags:      flags &^ (ImageRepeatX | ImageRepeatY),
+		pageWidth:  pageWidth,
+		pageHeight: pageHeight,
+	}
+}
+
+// AddImage packs the specified image.Image object into the atlas.
+// Returns handle to the image.
+func (a *ImageAtlas) AddImage(img image.Image) int {
+	bounds := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+	return a.add(rgba)
+}
+
+// AddImageFromMemory packs an image loaded from the specified chunk of memory into the atlas.
+// Returns handle to the image.
+func (a *ImageAtlas) AddImageFromMemory(data []byte) int {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	return a.AddImage(img)
+}
+
+// AddImageRGBA packs the specified image data into the atlas.
+// Returns handle to the image, 0 if data is shorter than w*h*4 bytes.
+func (a *ImageAtlas) AddImageRGBA(w, h int, data []byte) int {
+	if w <= 0 || h <= 0 || len(data) < w*h*4 {
+		return 0
+	}
+	rgba := &image.RGBA{
+		Pix:    data,
+		Stride: w * 4,
+		Rect:   image.Rect(0, 0, w, h),
+	}
+	return a.add(rgba)
+}
+
+// Pages returns handles of the textures which are used by the atlas.
+func (a *ImageAtlas) Pages() []int {
+	pages := make([]int, len(a.pages))
+	for i, page := range a.pages {
+		pages[i] = page.image
+	}
+	return pages
+}
+
+// Delete deletes all pages and images of the atlas.
+func (a *ImageAtlas) Delete() {
+	for _, handle := range a.handles {
+		a.context.DeleteImage(handle)
+	}
+	for _, page := range a.pages {
+		a.context.DeleteImage(page.image)
+	}
+	a.handles = nil
+	a.pages = nil
+}
+
+func (a *ImageAtlas) add(img *image.RGBA) int {
+	w := img.Rect.Dx()
+	h := img.Rect.Dy()
+	pw := w + imagePadding*2
+	ph := h + imagePadding*2
+	if pw > a.pageWidth || ph > a.pageHeight {
+		// Too large to share a page, fall back to a dedicated texture which needs tightly packed pixels.
+		if img.Stride != w*4 || img.Rect.Min != (image.Point{}) {
+			tight := image.NewRGBA(image.Rect(0, 0, w, h))
+			draw.Draw(tight, tight.Bounds(), img, img.Rect.Min, draw.Src)
+			img = tight
+		}
+		handle := a.context.CreateImageRGBA(w, h, a.flags, img.Pix)
+		if handle != 0 {
+			a.handles = append(a.handles, handle)
+		}
+		return handle
+	}
+	var page *imageAtlasPage
+	var x, y int
+	for _, p := range a.pages {
+		var err error
+		x, y, err = p.packer.AddRect(pw, ph)
+		if err == nil {
+			page = p
+			break
+		}
+	}
+	if page == nil {
+		page = a.newPage()
+		if page == nil {
+			return 0
+		}
+		var err error
+		x, y, err = page.packer.AddRect(pw, ph)
+		if err != nil {
+			return 0
+		}
+	}
+	x += imagePadding
+	y += imagePadding
+	blitWithBorder(page.pixels, img, x, y)
+	a.context.params.renderUpdateTexture(page.image, 0, y-imagePadding, a.pageWidth, ph, page.pixels.Pix)
+
+	handle := a.context.addSubImage(&subImage{page: page, x: x, y: y, w: w, h: h})
+	a.handles = append(a.handles, handle)
+	return handle
+}
+
+func (a *ImageAtlas) newPage() *imageAtlasPage {
+	pixels := image.NewRGBA(image.Rect(0, 0, a.pageWidth, a.pageHeight))
+	img := a.context.CreateImageRGBA(a.pageWidth, a.pageHeight, a.flags, pixels.Pix)
+	if img == 0 {
+		return nil
+	}
+	page := &imageAtlasPage{
+		image:  img,
+		packer: font.NewAtlas(a.pageWidth, a.pageHeight, font.FONS_INIT_ATLAS_NODES),
+		pixels: pixels,
+	}
+	a.pages = append(a.pages, page)
+	return page
+}
+
+// addSubImage registers sub-image and returns its handle.
+// Sub-image handles are negative to never collide with texture handles of the backend,
+// and start at -2 as widgets use -1 for no image.
+func (c *Context) addSubImage(sub *subImage) int {
+	if c.subImages == nil {
+		c.subImages = make(map[int]*subImage)
+		c.lastSubImage = -1
+	}
+	c.lastSubImage--
+	c.subImages[c.lastSubImage] = sub
+	return c.lastSubImage
+}
+
+// resolveSubImage replaces a sub-image in the paint with its page texture.
+func (c *Context) resolveSubImage(paint *Paint) {
+	sub, ok := c.subImages[paint.image]
+	if !ok {
+		return
+	}
+	paint.image = sub.page.image
+	w, h := sub.page.pixels.Rect.Dx(), sub.page.pixels.Rect.Dy()
+	paint.mapToSubImage(float32(sub.x), float32(sub.y), float32(sub.w), float32(sub.h), float32(w), float32(h))
+}
+
+func (c *Context) updateSubImage(sub *subImage, data []byte) error {
+	if len(data) < sub.w*sub.h*4 {
+		return errors.New("image data is shorter than the sub-image")
+	}
+	src := &image.RGBA{
+		Pix:    data,
+		Stride: sub.w * 4,
+		Rect:   image.Rect(0, 0, sub.w, sub.h),
+	}
+	blitWithBorder(sub.page.pixels, src, sub.x, sub.y)
+	w := sub.page.pixels.Rect.Dx()
+	return c.params.renderUpdateTexture(sub.page.image, 0, sub.y-imagePadding, w, sub.h+imagePadding*2, sub.page.pixels.Pix)
+}
@@ -0,0 +1,65 @@
+package vg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestImageAtlasDelete(t *testing.T) {
+	c, params := createStubContext(t)
+	textures := len(params.textures)
+	atlas := c.CreateImageAtlas(64, 64, 0)
+	small := atlas.AddImageRGBA(8, 8, make([]byte, 8*8*4))
+	large := atlas.AddImageRGBA(100, 10, make([]byte, 100*10*4))
+	if small >= 0 {
+		t.Errorf("small image should get a sub-image handle, but %d", small)
+	}
+	if large <= 0 {
+		t.Errorf("large image should get its own texture, but %d", large)
+	}
+	if w, h, _ := c.ImageSize(small); w != 8 || h != 8 {
+		t.Errorf("sub-image size should be 8x8, but %dx%d", w, h)
+	}
+	atlas.Delete()
+	if len(params.textures) != textures {
+		t.Errorf("Delete should free all textures of the atlas, but %d are left", len(params.textures)-textures)
+	}
+	if _, ok := c.subImages[small]; ok {
+		t.Error("sub-image should be deleted")
+	}
+}
+
+func TestImageAtlasShortData(t *testing.T) {
+	c, _ := createStubContext(t)
+	atlas := c.CreateImageAtlas(64, 64, 0)
+	if handle := atlas.AddImageRGBA(8, 8, make([]byte, 8*8*4-1)); handle != 0 {
+		t.Errorf("short data should be rejected, but handle %d", handle)
+	}
+	handle := atlas.AddImageRGBA(8, 8, make([]byte, 8*8*4))
+	if err := c.UpdateImage(handle, make([]byte, 10)); err == nil {
+		t.Error("short data of an update should be rejected")
+	}
+	if err := c.UpdateImage(handle, make([]byte, 8*8*4)); err != nil {
+		t.Errorf("update should succeed, but %v", err)
+	}
+}
+
+func TestImageAtlasLargeSubImage(t *testing.T) {
+	c, params := createStubContext(t)
+	atlas := c.CreateImageAtlas(64, 64, 0)
+	src := image.NewRGBA(image.Rect(0, 0, 120, 20))
+	src.Set(0, 1, color.RGBA{255, 0, 0, 255})
+	// the rows of the sub-image are longer than its width
+	handle := atlas.AddImage(src.SubImage(image.Rect(0, 0, 100, 10)))
+	if handle <= 0 {
+		t.Fatalf("large image should get its own texture, but %d", handle)
+	}
+	uploaded := params.lastData
+	if len(uploaded) != 100*10*4 {
+		t.Fatalf("uploaded data should be tightly packed, but %d bytes", len(uploaded))
+	}
+	if uploaded[100*4] != 255 {
+		t.Error("second row should start right after the first one")
+	}
+}
@@ -0,0 +1,8 @@
+// Package gl is the part of the goxjs/gl API which the vg backend uses.
+//
+// By default it forwards to goxjs/gl, so the backend runs on GL ES 2, WebGL and
+// desktop GL 2.1. With the gl33 build tag it is implemented on the OpenGL 3.3
+// core profile functions of go-gl instead, and adds the vertex array and
+// uniform buffer functions of the core profile. Only one binding is loaded in
+// either build.
+package gl
@@ -0,0 +1,371 @@
+// +build gl33
+
+package gl
+
+import (
+	"unsafe"
+
+	core "github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// Enum is equivalent to GLenum.
+type Enum uint32
+
+// Attrib identifies the location of a vertex attribute.
+type Attrib struct {
+	Value uint
+}
+
+// Program identifies a linked shader program.
+type Program struct {
+	Value uint32
+}
+
+// Shader identifies a GLSL shader.
+type Shader struct {
+	Value uint32
+}
+
+// Buffer identifies a buffer object.
+type Buffer struct {
+	Value uint32
+}
+
+// Texture identifies a texture object.
+type Texture struct {
+	Value uint32
+}
+
+// Uniform identifies the location of a uniform variable.
+type Uniform struct {
+	Value int32
+}
+
+// VertexArray identifies a vertex array object.
+type VertexArray struct {
+	Value uint32
+}
+
+func (v Attrib) Valid() bool      { return v.Value != 0 }
+func (v Program) Valid() bool     { return v.Value != 0 }
+func (v Shader) Valid() bool      { return v.Value != 0 }
+func (v Buffer) Valid() bool      { return v.Value != 0 }
+func (v Texture) Valid() bool     { return v.Value != 0 }
+func (v Uniform) Valid() bool     { return v.Value != 0 }
+func (v VertexArray) Valid() bool { return v.Value != 0 }
+
+const (
+	ALWAYS                          = core.ALWAYS
+	ARRAY_BUFFER                    = core.ARRAY_BUFFER
+	BACK                            = core.BACK
+	BLEND                           = core.BLEND
+	CCW                             = core.CCW
+	CLAMP_TO_EDGE                   = core.CLAMP_TO_EDGE
+	COMPILE_STATUS                  = core.COMPILE_STATUS
+	CULL_FACE                       = core.CULL_FACE
+	DECR_WRAP                       = core.DECR_WRAP
+	DEPTH_TEST                      = core.DEPTH_TEST
+	EQUAL                           = core.EQUAL
+	FLOAT                           = core.FLOAT
+	FRAGMENT_SHADER                 = core.FRAGMENT_SHADER
+	FRONT                           = core.FRONT
+	INCR                            = core.INCR
+	INCR_WRAP                       = core.INCR_WRAP
+	KEEP                            = core.KEEP
+	LINEAR                          = core.LINEAR
+	LINEAR_MIPMAP_LINEAR            = core.LINEAR_MIPMAP_LINEAR
+	LINK_STATUS                     = core.LINK_STATUS
+	NOTEQUAL                        = core.NOTEQUAL
+	NO_ERROR                        = core.NO_ERROR
+	ONE                             = core.ONE
+	ONE_MINUS_SRC_ALPHA             = core.ONE_MINUS_SRC_ALPHA
+	RED                             = core.RED
+	REPEAT                          = core.REPEAT
+	RGBA                            = core.RGBA
+	SCISSOR_TEST                    = core.SCISSOR_TEST
+	STENCIL_TEST                    = core.STENCIL_TEST
+	STREAM_DRAW                     = core.STREAM_DRAW
+	TEXTURE0                        = core.TEXTURE0
+	TEXTURE_2D                      = core.TEXTURE_2D
+	TEXTURE_MAG_FILTER              = core.TEXTURE_MAG_FILTER
+	TEXTURE_MIN_FILTER              = core.TEXTURE_MIN_FILTER
+	TEXTURE_WRAP_S                  = core.TEXTURE_WRAP_S
+	TEXTURE_WRAP_T                  = core.TEXTURE_WRAP_T
+	TRIANGLES                       = core.TRIANGLES
+	TRIANGLE_FAN                    = core.TRIANGLE_FAN
+	TRIANGLE_STRIP                  = core.TRIANGLE_STRIP
+	TRUE                            = core.TRUE
+	UNIFORM_BUFFER                  = core.UNIFORM_BUFFER
+	UNIFORM_BUFFER_OFFSET_ALIGNMENT = core.UNIFORM_BUFFER_OFFSET_ALIGNMENT
+	UNPACK_ALIGNMENT                = core.UNPACK_ALIGNMENT
+	UNSIGNED_BYTE                   = core.UNSIGNED_BYTE
+	VERTEX_SHADER                   = core.VERTEX_SHADER
+	ZERO                            = core.ZERO
+)
+
+// Init loads the core profile functions of the current context.
+func Init() error {
+	return core.Init()
+}
+
+func ActiveTexture(texture Enum) {
+	core.ActiveTexture(uint32(texture))
+}
+
+func AttachShader(p Program, s Shader) {
+	core.AttachShader(p.Value, s.Value)
+}
+
+func BindBuffer(target Enum, b Buffer) {
+	core.BindBuffer(uint32(target), b.Value)
+}
+
+// BindBufferRange binds size bytes from offset of the buffer to the binding point of the target.
+func BindBufferRange(target Enum, index uint32, b Buffer, offset, size int) {
+	core.BindBufferRange(uint32(target), index, b.Value, offset, size)
+}
+
+func BindTexture(target Enum, t Texture) {
+	core.BindTexture(uint32(target), t.Value)
+}
+
+func BindVertexArray(v VertexArray) {
+	core.BindVertexArray(v.Value)
+}
+
+func BlendFunc(sfactor, dfactor Enum) {
+	core.BlendFunc(uint32(sfactor), uint32(dfactor))
+}
+
+func BufferData(target Enum, src []byte, usage Enum) {
+	core.BufferData(uint32(target), len(src), core.Ptr(&src[0]), uint32(usage))
+}
+
+// BufferInit allocates size bytes of uninitialized storage for the buffer bound to the target,
+// which orphans the previous storage.
+func BufferInit(target Enum, size int, usage Enum) {
+	core.BufferData(uint32(target), size, nil, uint32(usage))
+}
+
+// BufferSubData replaces the bytes from offset of the buffer bound to the target.
+func BufferSubData(target Enum, offset int, data []byte) {
+	core.BufferSubData(uint32(target), offset, len(data), core.Ptr(&data[0]))
+}
+
+func ColorMask(red, green, blue, alpha bool) {
+	core.ColorMask(red, green, blue, alpha)
+}
+
+func CompileShader(s Shader) {
+	core.CompileShader(s.Value)
+}
+
+func CreateBuffer() Buffer {
+	var b Buffer
+	core.GenBuffers(1, &b.Value)
+	return b
+}
+
+func CreateProgram() Program {
+	return Program{Value: core.CreateProgram()}
+}
+
+func CreateShader(ty Enum) Shader {
+	return Shader{Value: core.CreateShader(uint32(ty))}
+}
+
+func CreateTexture() Texture {
+	var t Texture
+	core.GenTextures(1, &t.Value)
+	return t
+}
+
+func CreateVertexArray() VertexArray {
+	var v VertexArray
+	core.GenVertexArrays(1, &v.Value)
+	return v
+}
+
+func CullFace(mode Enum) {
+	core.CullFace(uint32(mode))
+}
+
+func DeleteBuffer(b Buffer) {
+	core.DeleteBuffers(1, &b.Value)
+}
+
+func DeleteProgram(p Program) {
+	core.DeleteProgram(p.Value)
+}
+
+func DeleteShader(s Shader) {
+	core.DeleteShader(s.Value)
+}
+
+func DeleteTexture(t Texture) {
+	core.DeleteTextures(1, &t.Value)
+}
+
+func DeleteVertexArray(v VertexArray) {
+	core.DeleteVertexArrays(1, &v.Value)
+}
+
+func Disable(cap Enum) {
+	core.Disable(uint32(cap))
+}
+
+func DisableVertexAttribArray(a Attrib) {
+	core.DisableVertexAttribArray(uint32(a.Value))
+}
+
+func DrawArrays(mode Enum, first, count int) {
+	core.DrawArrays(uint32(mode), int32(first), int32(count))
+}
+
+func Enable(cap Enum) {
+	core.Enable(uint32(cap))
+}
+
+func EnableVertexAttribArray(a Attrib) {
+	core.EnableVertexAttribArray(uint32(a.Value))
+}
+
+func Finish() {
+	core.Finish()
+}
+
+func FrontFace(mode Enum) {
+	core.FrontFace(uint32(mode))
+}
+
+func GenerateMipmap(target Enum) {
+	core.GenerateMipmap(uint32(target))
+}
+
+func GetAttribLocation(p Program, name string) Attrib {
+	return Attrib{Value: uint(core.GetAttribLocation(p.Value, core.Str(name+"\x00")))}
+}
+
+func GetError() Enum {
+	return Enum(core.GetError())
+}
+
+func GetInteger(pname Enum) int {
+	var result int32
+	core.GetIntegerv(uint32(pname), &result)
+	return int(result)
+}
+
+func GetProgramInfoLog(p Program) string {
+	var logLength int32
+	core.GetProgramiv(p.Value, core.INFO_LOG_LENGTH, &logLength)
+	if logLength == 0 {
+		return ""
+	}
+	logBuffer := make([]uint8, logLength)
+	core.GetProgramInfoLog(p.Value, logLength, nil, &logBuffer[0])
+	return core.GoStr(&logBuffer[0])
+}
+
+func GetProgrami(p Program, pname Enum) int {
+	var result int32
+	core.GetProgramiv(p.Value, uint32(pname), &result)
+	return int(result)
+}
+
+func GetShaderInfoLog(s Shader) string {
+	var logLength int32
+	core.GetShaderiv(s.Value, core.INFO_LOG_LENGTH, &logLength)
+	if logLength == 0 {
+		return ""
+	}
+	logBuffer := make([]uint8, logLength)
+	core.GetShaderInfoLog(s.Value, logLength, nil, &logBuffer[0])
+	return core.GoStr(&logBuffer[0])
+}
+
+func GetShaderi(s Shader, pname Enum) int {
+	var result int32
+	core.GetShaderiv(s.Value, uint32(pname), &result)
+	return int(result)
+}
+
+// GetUniformBlockIndex returns the index of the named uniform block of the program.
+func GetUniformBlockIndex(p Program, name string) uint32 {
+	return core.GetUniformBlockIndex(p.Value, core.Str(name+"\x00"))
+}
+
+func GetUniformLocation(p Program, name string) Uniform {
+	return Uniform{Value: core.GetUniformLocation(p.Value, core.Str(name+"\x00"))}
+}
+
+func LinkProgram(p Program) {
+	core.LinkProgram(p.Value)
+}
+
+func PixelStorei(pname Enum, param int32) {
+	core.PixelStorei(uint32(pname), param)
+}
+
+func ShaderSource(s Shader, src string) {
+	source, free := core.Strs(src + "\x00")
+	core.ShaderSource(s.Value, 1, source, nil)
+	free()
+}
+
+func StencilFunc(fn Enum, ref int, mask uint32) {
+	core.StencilFunc(uint32(fn), int32(ref), mask)
+}
+
+func StencilMask(mask uint32) {
+	core.StencilMask(mask)
+}
+
+func StencilOp(fail, zfail, zpass Enum) {
+	core.StencilOp(uint32(fail), uint32(zfail), uint32(zpass))
+}
+
+func StencilOpSeparate(face, sfail, dpfail, dppass Enum) {
+	core.StencilOpSeparate(uint32(face), uint32(sfail), uint32(dpfail), uint32(dppass))
+}
+
+func TexImage2D(target Enum, level int, width, height int, format Enum, ty Enum, data []byte) {
+	p := unsafe.Pointer(nil)
+	if len(data) > 0 {
+		p = core.Ptr(&data[0])
+	}
+	core.TexImage2D(uint32(target), int32(level), int32(format), int32(width), int32(height), 0, uint32(format), uint32(ty), p)
+}
+
+func TexParameteri(target, pname Enum, param int) {
+	core.TexParameteri(uint32(target), uint32(pname), int32(param))
+}
+
+func TexSubImage2D(target Enum, level int, x, y, width, height int, format, ty Enum, data []byte) {
+	core.TexSubImage2D(uint32(target), int32(level), int32(x), int32(y), int32(width), int32(height), uint32(format), uint32(ty), core.Ptr(&data[0]))
+}
+
+func Uniform1i(dst Uniform, v int) {
+	core.Uniform1i(dst.Value, int32(v))
+}
+
+func Uniform2fv(dst Uniform, src []float32) {
+	core.Uniform2fv(dst.Value, int32(len(src)/2), &src[0])
+}
+
+func Uniform4fv(dst Uniform, src []float32) {
+	core.Uniform4fv(dst.Value, int32(len(src)/4), &src[0])
+}
+
+// UniformBlockBinding assigns the uniform block of the program to a binding point.
+func UniformBlockBinding(p Program, index, binding uint32) {
+	core.UniformBlockBinding(p.Value, index, binding)
+}
+
+func UseProgram(p Program) {
+	core.UseProgram(p.Value)
+}
+
+func VertexAttribPointer(dst Attrib, size int, ty Enum, normalized bool, stride, offset int) {
+	core.VertexAttribPointer(uint32(dst.Value), int32(size), uint32(ty), normalized, int32(stride), core.PtrOffset(offset))
+}
@@ -0,0 +1,119 @@
+// +build !gl33
+
+package gl
+
+import (
+	"github.com/goxjs/gl"
+)
+
+type (
+	Enum    = gl.Enum
+	Attrib  = gl.Attrib
+	Program = gl.Program
+	Shader  = gl.Shader
+	Buffer  = gl.Buffer
+	Texture = gl.Texture
+	Uniform = gl.Uniform
+)
+
+const (
+	ALWAYS               = gl.ALWAYS
+	ARRAY_BUFFER         = gl.ARRAY_BUFFER
+	BACK                 = gl.BACK
+	BLEND                = gl.BLEND
+	CCW                  = gl.CCW
+	CLAMP_TO_EDGE        = gl.CLAMP_TO_EDGE
+	COMPILE_STATUS       = gl.COMPILE_STATUS
+	CULL_FACE            = gl.CULL_FACE
+	DECR_WRAP            = gl.DECR_WRAP
+	DEPTH_TEST           = gl.DEPTH_TEST
+	EQUAL                = gl.EQUAL
+	FLOAT                = gl.FLOAT
+	FRAGMENT_SHADER      = gl.FRAGMENT_SHADER
+	FRONT                = gl.FRONT
+	INCR                 = gl.INCR
+	INCR_WRAP            = gl.INCR_WRAP
+	KEEP                 = gl.KEEP
+	LINEAR               = gl.LINEAR
+	LINEAR_MIPMAP_LINEAR = gl.LINEAR_MIPMAP_LINEAR
+	LINK_STATUS          = gl.LINK_STATUS
+	LUMINANCE            = gl.LUMINANCE
+	NOTEQUAL             = gl.NOTEQUAL
+	NO_ERROR             = gl.NO_ERROR
+	ONE                  = gl.ONE
+	ONE_MINUS_SRC_ALPHA  = gl.ONE_MINUS_SRC_ALPHA
+	REPEAT               = gl.REPEAT
+	RGBA                 = gl.RGBA
+	SCISSOR_TEST         = gl.SCISSOR_TEST
+	STENCIL_TEST         = gl.STENCIL_TEST
+	STREAM_DRAW          = gl.STREAM_DRAW
+	TEXTURE0             = gl.TEXTURE0
+	TEXTURE_2D           = gl.TEXTURE_2D
+	TEXTURE_MAG_FILTER   = gl.TEXTURE_MAG_FILTER
+	TEXTURE_MIN_FILTER   = gl.TEXTURE_MIN_FILTER
+	TEXTURE_WRAP_S       = gl.TEXTURE_WRAP_S
+	TEXTURE_WRAP_T       = gl.TEXTURE_WRAP_T
+	TRIANGLES            = gl.TRIANGLES
+	TRIANGLE_FAN         = gl.TRIANGLE_FAN
+	TRIANGLE_STRIP       = gl.TRIANGLE_STRIP
+	TRUE                 = gl.TRUE
+	UNPACK_ALIGNMENT     = gl.UNPACK_ALIGNMENT
+	UNSIGNED_BYTE        = gl.UNSIGNED_BYTE
+	VERTEX_SHADER        = gl.VERTEX_SHADER
+	ZERO                 = gl.ZERO
+)
+
+// Init does nothing, goxjs/gl is initialized by its ContextWatcher.
+func Init() error {
+	return nil
+}
+
+var (
+	ActiveTexture            = gl.ActiveTexture
+	AttachShader             = gl.AttachShader
+	BindBuffer               = gl.BindBuffer
+	BindTexture              = gl.BindTexture
+	BlendFunc                = gl.BlendFunc
+	BufferData               = gl.BufferData
+	ColorMask                = gl.ColorMask
+	CompileShader            = gl.CompileShader
+	CreateBuffer             = gl.CreateBuffer
+	CreateProgram            = gl.CreateProgram
+	CreateShader             = gl.CreateShader
+	CreateTexture            = gl.CreateTexture
+	CullFace                 = gl.CullFace
+	DeleteBuffer             = gl.DeleteBuffer
+	DeleteProgram            = gl.DeleteProgram
+	DeleteShader             = gl.DeleteShader
+	DeleteTexture            = gl.DeleteTexture
+	Disable                  = gl.Disable
+	DisableVertexAttribArray = gl.DisableVertexAttribArray
+	DrawArrays               = gl.DrawArrays
+	Enable                   = gl.Enable
+	EnableVertexAttribArray  = gl.EnableVertexAttribArray
+	Finish                   = gl.Finish
+	FrontFace                = gl.FrontFace
+	GenerateMipmap           = gl.GenerateMipmap
+	GetAttribLocation        = gl.GetAttribLocation
+	GetError                 = gl.GetError
+	GetProgramInfoLog        = gl.GetProgramInfoLog
+	GetProgrami              = gl.GetProgrami
+	GetShaderInfoLog         = gl.GetShaderInfoLog
+	GetShaderi               = gl.GetShaderi
+	GetUniformLocation       = gl.GetUniformLocation
+	LinkProgram              = gl.LinkProgram
+	PixelStorei              = gl.PixelStorei
+	ShaderSource             = gl.ShaderSource
+	StencilFunc              = gl.StencilFunc
+	StencilMask              = gl.StencilMask
+	StencilOp                = gl.StencilOp
+	StencilOpSeparate        = gl.StencilOpSeparate
+	TexImage2D               = gl.TexImage2D
+	TexParameteri            = gl.TexParameteri
+	TexSubImage2D            = gl.TexSubImage2D
+	Uniform1i                = gl.Uniform1i
+	Uniform2fv               = gl.Uniform2fv
+	Uniform4fv               = gl.Uniform4fv
+	UseProgram               = gl.UseProgram
+	VertexAttribPointer      = gl.VertexAttribPointer
+)
@@ -102,3 +102,12 @@ func ImagePattern(cx, cy, w, h, angle float32, img int, alpha float32) Paint {
 		outerColor: color,
 	}
 }
+
+// mapToSubImage changes the image pattern to show only the rectangle (sx,sy,sw,sh) of its texture
+// (tw x th pixels) in the area which the whole image used to cover.
+func (p *Paint) mapToSubImage(sx, sy, sw, sh, tw, th float32) {
+	scaleX := p.extent[0] / sw
+	scaleY := p.extent[1] / sh
+	p.xform = TranslateMatrix(-sx*scaleX, -sy*scaleY).Multiply(p.xform)
+	p.extent = [2]float32{tw * scaleX, th * scaleY}
+}
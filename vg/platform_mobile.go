@@ -12,7 +12,7 @@ type Float float32
 
 var shaderHeader string = `
 #define DAVINCI_GL2 1
-#define UNIFORMARRAY_SIZE 11
+#define UNIFORMARRAY_SIZE 14
 `
 //var shaderHeader = `
 //#define DAVINCI_GL3 1
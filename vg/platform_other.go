@@ -14,7 +14,7 @@ type Float float32
 
 var shaderHeader = `
 #define DAVINCI_GL2 1
-#define UNIFORMARRAY_SIZE 11
+#define UNIFORMARRAY_SIZE 14
 `
 
 func prepareTextureBuffer(data []byte, w, h, bpp int) []byte {
@@ -11,7 +11,7 @@ import (
 var shaderHeader string = `
 #version 100
 #define DAVINCI_GL2 1
-#define UNIFORMARRAY_SIZE 11
+#define UNIFORMARRAY_SIZE 14
 `
 
 func prepareTextureBuffer(data []byte, w, h, bpp int) []byte {
@@ -0,0 +1,240 @@
+package vg
+
+import (
+	"github.com/jxo/davinci/font"
+	"unicode"
+)
+
+// TextSpan is a run of text with its own style in a RichText.
+// The zero values of the style fields keep the current style of the context.
+type TextSpan struct {
+	Text          string
+	FontFace      string  // Font face of the span, the current font face if empty or unknown.
+	FontSize      float32 // Font size of the span, the current font size if zero.
+	Color         Color   // Text color of the span, the current fill style if transparent.
+	LetterSpacing float32 // Added to the current letter spacing.
+	Underline     bool    // Underlines the span, in addition to the current text decoration.
+	Background    Color   // Fills the rows of the span behind the text if not transparent.
+}
+
+// RichText is a paragraph of styled spans.
+type RichText struct {
+	Spans []TextSpan
+}
+
+// RichTextFragment is the part of a span in a row of a rich text.
+type RichTextFragment struct {
+	Span       int             // Index of the span.
+	StartIndex int             // Index to the runes of the span where the fragment starts.
+	EndIndex   int             // Index to the runes of the span where the fragment ends (one past the last character).
+	X, Width   float32         // Position and logical width of the fragment.
+	Glyphs     []GlyphPosition // Positions of the runes of the fragment, their indexes refer to the runes of the span.
+}
+
+// RichTextRow keeps the geometry of a row of a rich text.
+type RichTextRow struct {
+	Top       float32 // Top of the row.
+	Y         float32 // Baseline of the row.
+	Height    float32 // Line height of the row, the largest one of its spans.
+	Ascender  float32 // The largest ascender of the spans of the row.
+	Descender float32 // The lowest descender of the spans of the row, negative below the baseline.
+	Width     float32 // Logical width of the row without trailing white space.
+	Fragments []RichTextFragment
+}
+
+// RichTextRows lays out the rich text in rows from the top at y. The rows are split at the line break
+// opportunities of the whole text, across the spans, or when new-line characters are encountered,
+// and aligned horizontally in breakRowWidth with the current text align. Rows aren't wrapped if breakRowWidth is 0.
+// White space is stripped at the beginning and the end of the rows. Spans follow each other from left to right,
+// the runes of a span are laid out in the current text direction.
+// Measured values are returned in local coordinate space.
+func (c *Context) RichTextRows(x, y, breakRowWidth float32, text *RichText) []RichTextRow {
+	base := *c.getState()
+	if base.fontID == font.INVALID {
+		return nil
+	}
+	c.Save()
+	defer c.Restore()
+
+	spanRunes := make([][]rune, len(text.Spans))
+	var runes []rune
+	var spans, offsets []int
+	var advances []float32
+	var clusters []bool
+	for i := range text.Spans {
+		spanRunes[i] = []rune(text.Spans[i].Text)
+		c.setSpanStyle(&base, &text.Spans[i])
+		positions := c.TextGlyphPositionsRune(0, 0, spanRunes[i])
+		for j := range spanRunes[i] {
+			var advance float32
+			cluster := true
+			if positions != nil {
+				advance = positions[j].Advance
+				cluster = positions[j].Cluster == j
+			}
+			spans = append(spans, i)
+			offsets = append(offsets, j)
+			advances = append(advances, advance)
+			clusters = append(clusters, cluster)
+		}
+		runes = append(runes, spanRunes[i]...)
+	}
+	breaks := font.LineBreaks(runes)
+
+	var rows []RichTextRow
+	top := y
+	for start := 0; start < len(runes); {
+		for start < len(runes) && unicode.IsSpace(runes[start]) && !isNewline(runes[start]) {
+			start++
+		}
+		if start == len(runes) {
+			break
+		}
+		end := start
+		breakEnd := -1
+		var width float32
+		for ; end < len(runes); end++ {
+			if end > start && breaks[end] == font.BREAK_MANDATORY {
+				break
+			}
+			if end > start && breaks[end] == font.BREAK_ALLOWED {
+				breakEnd = end
+			}
+			if breakRowWidth > 0 && end > start && clusters[end] && !unicode.IsSpace(runes[end]) && width+advances[end] > breakRowWidth {
+				if breakEnd > start {
+					end = breakEnd
+				}
+				break
+			}
+			width += advances[end]
+		}
+		next := end
+		for end > start && unicode.IsSpace(runes[end-1]) {
+			end--
+		}
+
+		// the metrics of the spans in the row, or of the new line of an empty row
+		row := RichTextRow{Top: top}
+		lineSpans := spans[start:end]
+		if end == start {
+			lineSpans = spans[start : start+1]
+		}
+		for i, span := range lineSpans {
+			if i > 0 && span == lineSpans[i-1] {
+				continue
+			}
+			c.setSpanStyle(&base, &text.Spans[span])
+			ascender, descender, lineH := c.TextMetrics()
+			row.Ascender = maxF(row.Ascender, ascender)
+			row.Descender = minF(row.Descender, descender)
+			row.Height = maxF(row.Height, lineH*base.lineHeight)
+		}
+		row.Y = top + row.Ascender
+		for i := start; i < end; i++ {
+			row.Width += advances[i]
+		}
+
+		fragmentX := x
+		if base.textAlign&AlignCenter != 0 {
+			fragmentX += (breakRowWidth - row.Width) * 0.5
+		} else if base.textAlign&AlignRight != 0 {
+			fragmentX += breakRowWidth - row.Width
+		}
+		for i := start; i < end; {
+			span := spans[i]
+			fragment := RichTextFragment{Span: span, StartIndex: offsets[i], X: fragmentX}
+			for ; i < end && spans[i] == span; i++ {
+				fragment.Width += advances[i]
+			}
+			fragment.EndIndex = offsets[i-1] + 1
+			c.setSpanStyle(&base, &text.Spans[span])
+			fragment.Glyphs = c.TextGlyphPositionsRune(fragment.X, row.Y, spanRunes[span][fragment.StartIndex:fragment.EndIndex])
+			for j := range fragment.Glyphs {
+				glyph := &fragment.Glyphs[j]
+				glyph.Index += fragment.StartIndex
+				glyph.Cluster += fragment.StartIndex
+				glyph.Runes = spanRunes[span]
+			}
+			row.Fragments = append(row.Fragments, fragment)
+			fragmentX += fragment.Width
+		}
+		rows = append(rows, row)
+		top += row.Height
+		start = next
+	}
+	return rows
+}
+
+// RichTextBox draws the rich text laid out by RichTextRows with the top at y, and returns its rows.
+// The backgrounds of the spans are drawn first, then their text and decorations.
+func (c *Context) RichTextBox(x, y, breakRowWidth float32, text *RichText) []RichTextRow {
+	rows := c.RichTextRows(x, y, breakRowWidth, text)
+	c.DrawRichTextRows(text, rows)
+	return rows
+}
+
+// DrawRichTextRows draws the rows of the rich text laid out by RichTextRows, so text laid out once
+// can be drawn without breaking its rows again.
+// The backgrounds of the spans are drawn first, then their text and decorations.
+func (c *Context) DrawRichTextRows(text *RichText, rows []RichTextRow) {
+	if len(rows) == 0 {
+		return
+	}
+	base := *c.getState()
+	c.Save()
+	defer c.Restore()
+
+	for _, row := range rows {
+		for _, fragment := range row.Fragments {
+			if background := text.Spans[fragment.Span].Background; background.A > 0 {
+				c.BeginPath()
+				c.Rect(fragment.X, row.Top, fragment.Width, row.Height)
+				c.SetFillColor(background)
+				c.Fill()
+			}
+		}
+	}
+	for _, row := range rows {
+		for _, fragment := range row.Fragments {
+			span := &text.Spans[fragment.Span]
+			state := c.setSpanStyle(&base, span)
+			if span.Color.A > 0 {
+				c.SetFillColor(span.Color)
+			} else {
+				state.fill = base.fill
+			}
+			state.decoration = base.decoration
+			if span.Underline {
+				state.decoration |= Underline
+			}
+			c.TextRune(fragment.X, row.Y, []rune(span.Text)[fragment.StartIndex:fragment.EndIndex])
+		}
+	}
+}
+
+// setSpanStyle sets the text style of the span over the base state, and returns the current state.
+func (c *Context) setSpanStyle(base *vgState, span *TextSpan) *vgState {
+	state := c.getState()
+	state.fontID = base.fontID
+	if span.FontFace != "" {
+		if fontID := c.fs.GetFontByName(span.FontFace); fontID != font.INVALID {
+			state.fontID = fontID
+		}
+	}
+	state.fontSize = base.fontSize
+	if span.FontSize > 0 {
+		state.fontSize = span.FontSize
+	}
+	state.letterSpacing = base.letterSpacing + span.LetterSpacing
+	state.textAlign = AlignLeft | AlignBaseline
+	return state
+}
+
+// isNewline returns whether the rune is a mandatory line break.
+func isNewline(r rune) bool {
+	switch r {
+	case '\n', '\r', '\v', '\f', 0x85, 0x2028, 0x2029:
+		return true
+	}
+	return false
+}
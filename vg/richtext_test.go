@@ -0,0 +1,107 @@
+package vg
+
+import (
+	"testing"
+)
+
+// fragmentText returns the text of the fragments of the rows, a row per string.
+func fragmentText(text *RichText, rows []RichTextRow) [][]string {
+	result := make([][]string, len(rows))
+	for i, row := range rows {
+		result[i] = []string{}
+		for _, fragment := range row.Fragments {
+			result[i] = append(result[i], string([]rune(text.Spans[fragment.Span].Text)[fragment.StartIndex:fragment.EndIndex]))
+		}
+	}
+	return result
+}
+
+func checkRows(t *testing.T, name string, text *RichText, rows []RichTextRow, want [][]string) {
+	got := fragmentText(text, rows)
+	if len(got) != len(want) {
+		t.Errorf("%s: %d rows are expected, but %q", name, len(want), got)
+		return
+	}
+	for i := range want {
+		if len(got[i]) != len(want[i]) {
+			t.Errorf("%s: row %d should be %q, but %q", name, i, want[i], got[i])
+			continue
+		}
+		for j := range want[i] {
+			if got[i][j] != want[i][j] {
+				t.Errorf("%s: row %d should be %q, but %q", name, i, want[i], got[i])
+				break
+			}
+		}
+	}
+	for i, row := range rows {
+		if i > 0 && row.Top != rows[i-1].Top+rows[i-1].Height {
+			t.Errorf("%s: row %d should follow the previous row at %f, but %f", name, i, rows[i-1].Top+rows[i-1].Height, row.Top)
+		}
+		for j := 1; j < len(row.Fragments); j++ {
+			if prev := row.Fragments[j-1]; row.Fragments[j].X != prev.X+prev.Width {
+				t.Errorf("%s: fragment %d of row %d should follow the previous one", name, j, i)
+			}
+		}
+	}
+}
+
+func TestRichTextRowsSpanBoundaries(t *testing.T) {
+	c := createTextContext(t)
+	text := &RichText{Spans: []TextSpan{{Text: "Hello wor"}, {Text: "ld again", FontSize: 30}}}
+	// a word split across spans is kept in one row
+	width, _ := c.TextBounds(0, 0, "Hello world")
+	rows := c.RichTextRows(0, 0, width+10, text)
+	checkRows(t, "span boundary", text, rows, [][]string{{"Hello wor", "ld"}, {"again"}})
+
+	rows = c.RichTextRows(0, 0, 0, text)
+	checkRows(t, "no wrap", text, rows, [][]string{{"Hello wor", "ld again"}})
+}
+
+func TestRichTextRowsNewlines(t *testing.T) {
+	c := createTextContext(t)
+	text := &RichText{Spans: []TextSpan{{Text: "one\ntw"}, {Text: "o\n\nthree"}}}
+	rows := c.RichTextRows(0, 0, 0, text)
+	checkRows(t, "newlines", text, rows, [][]string{{"one"}, {"tw", "o"}, {}, {"three"}})
+	if len(rows) == 4 && (rows[2].Height != rows[0].Height || rows[2].Width != 0) {
+		t.Errorf("empty row should have the line height and no width, but %+v", rows[2])
+	}
+}
+
+func TestRichTextRowsStyleInWord(t *testing.T) {
+	c := createTextContext(t)
+	text := &RichText{Spans: []TextSpan{{Text: "Big", FontSize: 40}, {Text: "ger text"}}}
+	big := c.RichTextRows(0, 0, 0, &RichText{Spans: text.Spans[:1]})
+	small := c.RichTextRows(0, 0, 0, &RichText{Spans: []TextSpan{{Text: "text"}}})
+	width := big[0].Width + small[0].Width
+	rows := c.RichTextRows(0, 0, width, text)
+	checkRows(t, "style in word", text, rows, [][]string{{"Big", "ger"}, {"text"}})
+	if len(rows) != 2 {
+		return
+	}
+	// the row takes the metrics of its largest span
+	if rows[0].Height != big[0].Height || rows[0].Ascender != big[0].Ascender || rows[0].Y != rows[0].Top+big[0].Ascender {
+		t.Errorf("first row should have the metrics of the large span %+v, but %+v", big[0], rows[0])
+	}
+	if rows[1].Height != small[0].Height {
+		t.Errorf("second row should have the height %f of the small span, but %f", small[0].Height, rows[1].Height)
+	}
+	if fragment := rows[0].Fragments[1]; fragment.X != big[0].Width {
+		t.Errorf("second span should start at %f, but %f", big[0].Width, fragment.X)
+	}
+}
+
+func TestRichTextRowsEmptySpans(t *testing.T) {
+	c := createTextContext(t)
+	text := &RichText{Spans: []TextSpan{{Text: ""}, {Text: "a"}, {Text: "", FontSize: 80}, {Text: "b"}, {Text: ""}}}
+	rows := c.RichTextRows(0, 0, 0, text)
+	checkRows(t, "empty spans", text, rows, [][]string{{"a", "b"}})
+	if len(rows) == 1 && (rows[0].Fragments[0].Span != 1 || rows[0].Fragments[1].Span != 3) {
+		t.Errorf("fragments should refer to the spans 1 and 3, but %+v", rows[0].Fragments)
+	}
+
+	empty := &RichText{Spans: []TextSpan{{}, {}}}
+	if rows := c.RichTextRows(0, 0, 100, empty); len(rows) != 0 {
+		t.Errorf("empty spans shouldn't have rows, but %+v", rows)
+	}
+}
@@ -17,10 +17,22 @@ type vgParams interface {
 	renderFill(paint *Paint, scissor *vgScissor, fringe float32, bounds [4]float32, paths []vgPath)
 	renderStroke(paint *Paint, scissor *vgScissor, fringe float32, strokeWidth float32, paths []vgPath)
 	renderTriangles(paint *Paint, scissor *vgScissor, vertexes []vgVertex)
+	renderSDFTriangles(paint *Paint, scissor *vgScissor, vertexes []vgVertex, sdf *vgSDFText)
+	renderChannelTriangles(paint *Paint, scissor *vgScissor, vertexes []vgVertex, channel int)
 	renderTriangleStrip(paint *Paint, scissor *vgScissor, vertexes []vgVertex)
+	renderStats() RenderStats
 	renderDelete()
 }
 
+// vgSDFText keeps the parameters of signed distance field text in screen pixels.
+type vgSDFText struct {
+	scale        float32 // pixels per unit of the field
+	outlineWidth float32
+	outlineColor Color
+	glowWidth    float32
+	glowColor    Color
+}
+
 type vgPoint struct {
 	x, y     float32
 	dx, dy   float32
@@ -71,6 +83,18 @@ type vgState struct {
 	fontBlur      float32
 	textAlign     Align
 	fontID        int
+	fontFeatures  FontFeature
+	textDirection TextDirection
+	hyphenate     HyphenateFunc
+	renderMode    TextRenderMode
+	decoration    TextDecoration
+	writingMode   WritingMode
+	variations    []font.Variation // shared by saved states, replaced instead of modified
+	tabStops      []float32        // shared by saved states, replaced instead of modified
+	outlineWidth  float32
+	outlineColor  Color
+	glowWidth     float32
+	glowColor     Color
 }
 
 func (s *vgState) reset() {
@@ -94,12 +118,51 @@ func (s *vgState) reset() {
 	s.fontBlur = 0.0
 	s.textAlign = AlignLeft | AlignBaseline
 	s.fontID = font.INVALID
+	s.fontFeatures = FeatureKerning | FeatureLigatures
+	s.textDirection = TextDirectionAuto
+	s.hyphenate = nil
+	s.renderMode = TextRenderBitmap
+	s.decoration = 0
+	s.writingMode = WritingHorizontal
+	s.variations = nil
+	s.tabStops = nil
+	s.outlineWidth = 0.0
+	s.outlineColor = RGBA(0, 0, 0, 255)
+	s.glowWidth = 0.0
+	s.glowColor = RGBA(0, 0, 0, 255)
 }
 
 func (s *vgState) getFontScale() float32 {
 	return minF(quantize(s.xform.getAverageScale(), 0.01), 4.0)
 }
 
+func (s *vgState) scaledTabStops(scale float32) []float32 {
+	if s.tabStops == nil {
+		return nil
+	}
+	stops := make([]float32, len(s.tabStops))
+	for i, stop := range s.tabStops {
+		stops[i] = stop * scale
+	}
+	return stops
+}
+
+// firstColumn returns the center of the first column of vertical text next to x,
+// and the distance to the next column for columns of pitch.
+func (s *vgState) firstColumn(x, pitch float32) (float32, float32) {
+	if s.writingMode == WritingVerticalRL {
+		return x - pitch*0.5, -pitch
+	}
+	return x + pitch*0.5, pitch
+}
+
+func (s *vgState) fontWritingMode() font.FONSWritingMode {
+	if s.writingMode == WritingHorizontal {
+		return font.WRITING_HORIZONTAL
+	}
+	return font.WRITING_VERTICAL
+}
+
 type vgPathCache struct {
 	points   []vgPoint
 	paths    []vgPath
@@ -509,10 +572,33 @@ func (c *vgPathCache) expandFill(w float32, lineJoin LineCap, miterLimit, fringe
 type GlyphPosition struct {
 	Index      int // Position of the glyph in the input string.
 	Runes      []rune
-	X          float32 // The x-coordinate of the logical glyph position.
+	X          float32 // The x-coordinate of the logical glyph position, the right edge of right to left glyphs.
 	MinX, MaxX float32 // The bounds of the glyph shape.
+	MinY, MaxY float32 // The vertical bounds of the glyph shape.
+	Cluster    int     // Index of the first rune of the shaped cluster, the cursor only stops at cluster starts.
+	Visual     int     // Visual position of the glyph from the left, positions are in logical order.
+	RTL        bool    // The glyph is laid out right to left.
+	Advance    float32 // The share of the glyph of the advance of its cluster.
 }
 
+// FontMetrics keeps the metrics of a font of a text style.
+// Positions and heights are above the baseline, negative below it.
+type FontMetrics struct {
+	Ascender           float32 // Height of the font above the baseline.
+	Descender          float32 // Depth of the font below the baseline, negative.
+	LineHeight         float32 // Distance between the baselines of rows.
+	XHeight            float32 // Height of the lowercase letters.
+	CapHeight          float32 // Height of the uppercase letters.
+	UnderlinePosition  float32 // Top of the underline.
+	UnderlineThickness float32
+	StrikeoutPosition  float32 // Top of the strikeout line.
+	StrikeoutThickness float32
+	UnitsPerEm         int // Size of the em square in font units.
+}
+
+// HyphenateFunc returns the indexes of the runes of a word before which it can be hyphenated.
+type HyphenateFunc func(word []rune) []int
+
 // TextRow keeps row geometry information
 type TextRow struct {
 	Runes      []rune  // The input string.
@@ -521,4 +607,11 @@ type TextRow struct {
 	NextIndex  int     // Index to the beginning of the next row.
 	Width      float32 // Logical width of the row.
 	MinX, MaxX float32 // Actual bounds of the row. Logical with and bounds can differ because of kerning and some parts over extending.
+	RTL        bool    // The paragraph of the row is right to left.
+	Hyphen     bool    // The row ends inside of a word, which is continued after a hyphen.
+	// VisualToLogical and LogicalToVisual map the indexes relative to StartIndex
+	// between the logical and the visual order of the row, nil if the row is
+	// only left to right.
+	VisualToLogical []int
+	LogicalToVisual []int
 }
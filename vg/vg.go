@@ -3,11 +3,16 @@ package vg
 import (
 	"bytes"
 	"github.com/jxo/davinci/font"
+	"github.com/jxo/davinci/font/truetype"
 	"image"
 	_ "image/jpeg" // to read jpeg
 	_ "image/png"  // to read png
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"unicode"
 )
 
 // DaVinci Vector Graphics
@@ -120,10 +125,15 @@ type Context struct {
 	fs             *font.FontStash
 	fontImages     []int
 	fontImageIdx   int
+	colorFontImage int // RGBA image of the color glyphs, created with the first one
+	subImages      map[int]*subImage
+	lastSubImage   int
 	drawCallCount  int
 	fillTriCount   int
 	strokeTriCount int
 	textTriCount   int
+	saveCount      int
+	restoreCount   int
 }
 
 // Delete is called when tearing down DaVinci VG context
@@ -135,6 +145,10 @@ func (c *Context) Delete() {
 			c.fontImages[i] = 0
 		}
 	}
+	if c.colorFontImage != 0 {
+		c.DeleteImage(c.colorFontImage)
+		c.colorFontImage = 0
+	}
 	c.params.renderDelete()
 }
 
@@ -158,6 +172,9 @@ func (c *Context) BeginFrame(windowWidth, windowHeight int, devicePixelRatio flo
 	c.fillTriCount = 0
 	c.strokeTriCount = 0
 	c.textTriCount = 0
+	c.saveCount = 0
+	c.restoreCount = 0
+	c.fs.NextFrame()
 }
 
 // CancelFrame cancels drawing the current frame.
@@ -165,6 +182,63 @@ func (c *Context) CancelFrame() {
 	c.params.renderCancel()
 }
 
+// RenderStats reports how the backend submitted a frame.
+type RenderStats struct {
+	Calls          int // Render calls recorded during the frame.
+	DrawCalls      int // Draw calls issued to the GPU.
+	MergedCalls    int // Calls saved by merging adjacent calls with the same paint, scissor and texture.
+	UniformUploads int // Uniform uploads, repeated uniforms are not uploaded again.
+	TextureBinds   int // Texture binds, repeated textures are not bound again.
+	TextureUploads int // Texture creations with data and texture updates.
+	VertexBytes    int // Bytes of vertex data uploaded.
+}
+
+// RenderStats returns statistics of the backend since Context.BeginFrame().
+// Draw calls are counted when the frame is submitted by Context.EndFrame().
+func (c *Context) RenderStats() RenderStats {
+	return c.params.renderStats()
+}
+
+// FrameStats reports the drawing cost of a frame.
+type FrameStats struct {
+	Calls           int     // Draw calls requested by Fill(), Stroke() and text functions.
+	FillTriangles   int     // Triangles of fills.
+	StrokeTriangles int     // Triangles of strokes and fill fringes.
+	TextTriangles   int     // Triangles of text.
+	SaveCalls       int     // Calls of Save().
+	RestoreCalls    int     // Calls of Restore().
+	FontAtlasUsage  float32 // Used area of the current font atlas, from 0 to 1.
+	FontAtlasImages int     // Number of font atlas textures.
+	FontGlyphs      int     // Glyphs cached in the current font atlas.
+	FontEvictions   int     // Glyphs evicted from the font atlas since the context was created.
+	Render          RenderStats
+}
+
+// FrameStats returns statistics of the frame since Context.BeginFrame().
+// Call it after Context.EndFrame() to get the complete frame.
+func (c *Context) FrameStats() FrameStats {
+	atlas := c.fs.AtlasStats()
+	return FrameStats{
+		Calls:           c.drawCallCount,
+		FillTriangles:   c.fillTriCount,
+		StrokeTriangles: c.strokeTriCount,
+		TextTriangles:   c.textTriCount,
+		SaveCalls:       c.saveCount,
+		RestoreCalls:    c.restoreCount,
+		FontAtlasUsage:  atlas.Usage,
+		FontAtlasImages: c.fontImageIdx + 1,
+		FontGlyphs:      atlas.Glyphs,
+		FontEvictions:   atlas.Evicted,
+		Render:          c.params.renderStats(),
+	}
+}
+
+// WriteTextAtlasPNG writes the current font atlas as a PNG image, which shows the glyphs
+// cached for text drawn so far. Glyphs of atlases replaced when they were full aren't included.
+func (c *Context) WriteTextAtlasPNG(w io.Writer) error {
+	return c.fs.WriteAtlasPNG(w)
+}
+
 // EndFrame ends drawing flushing remaining render state.
 func (c *Context) EndFrame() {
 	c.params.renderFlush()
@@ -199,6 +273,7 @@ func (c *Context) EndFrame() {
 // Save pushes and saves the current render state into a state stack.
 // A matching Restore() must be used to restore the state.
 func (c *Context) Save() {
+	c.saveCount++
 	if len(c.states) >= vgMaxStates {
 		return
 	}
@@ -211,6 +286,7 @@ func (c *Context) Save() {
 
 // Restore pops and restores current render state.
 func (c *Context) Restore() {
+	c.restoreCount++
 	nStates := len(c.states)
 	if nStates > 1 {
 		c.states = c.states[:nStates-1]
@@ -355,6 +431,7 @@ func (c *Context) SetStrokePaint(paint Paint) {
 	state := c.getState()
 	state.stroke = paint
 	state.stroke.xform = state.stroke.xform.Multiply(state.xform)
+	c.resolveSubImage(&state.stroke)
 }
 
 // SetFillColor sets current fill style to a solid color.
@@ -367,6 +444,7 @@ func (c *Context) SetFillPaint(paint Paint) {
 	state := c.getState()
 	state.fill = paint
 	state.fill.xform = state.fill.xform.Multiply(state.xform)
+	c.resolveSubImage(&state.fill)
 }
 
 // CreateImage creates image by loading it from the disk from specified file name.
@@ -421,6 +499,9 @@ func (c *Context) CreateImageRGBA(w, h int, imageFlags ImageFlags, data []byte)
 
 // UpdateImage updates image data specified by image handle.
 func (c *Context) UpdateImage(img int, data []byte) error {
+	if sub, ok := c.subImages[img]; ok {
+		return c.updateSubImage(sub, data)
+	}
 	w, h, err := c.params.renderGetTextureSize(img)
 	if err != nil {
 		return err
@@ -430,11 +511,18 @@ func (c *Context) UpdateImage(img int, data []byte) error {
 
 // ImageSize returns the dimensions of a created image.
 func (c *Context) ImageSize(img int) (int, int, error) {
+	if sub, ok := c.subImages[img]; ok {
+		return sub.w, sub.h, nil
+	}
 	return c.params.renderGetTextureSize(img)
 }
 
 // DeleteImage deletes created image.
 func (c *Context) DeleteImage(img int) {
+	if _, ok := c.subImages[img]; ok {
+		delete(c.subImages, img)
+		return
+	}
 	c.params.renderDeleteTexture(img)
 }
 
@@ -786,11 +874,31 @@ func (c *Context) CreateFontFromMemory(name string, data []byte, freeData uint8)
 	return c.fs.AddFontFromMemory(name, data, freeData)
 }
 
+// CreateFontFromCollection creates font from the face at faceIndex of a TrueType collection (.ttc)
+// in the specified memory chunk. font.ListFaces() returns the faces in the collection.
+// Returns handle to the font.
+func (c *Context) CreateFontFromCollection(name string, data []byte, faceIndex int) int {
+	return c.fs.AddFontFromCollection(name, data, faceIndex)
+}
+
 // FindFont finds a loaded font of specified name, and returns handle to it, or -1 if the font is not found.
 func (c *Context) FindFont(name string) int {
 	return c.fs.GetFontByName(name)
 }
 
+// AddFallbackFont adds a fallback font by name. Characters missing in the base font are drawn
+// and measured with its fallback fonts, which are searched in the order they were added.
+// Returns false if either font is not found.
+func (c *Context) AddFallbackFont(base, fallback string) bool {
+	return c.AddFallbackFontID(c.fs.GetFontByName(base), c.fs.GetFontByName(fallback))
+}
+
+// AddFallbackFontID adds a fallback font by handle.
+// Returns false if either handle is invalid.
+func (c *Context) AddFallbackFontID(base, fallback int) bool {
+	return c.fs.AddFallbackFont(base, fallback)
+}
+
 // SetFontSize sets the font size of current text style.
 func (c *Context) SetFontSize(size float32) {
 	if size < 0 {
@@ -864,6 +972,138 @@ func (c *Context) FontFace() string {
 	return c.fs.GetFontName()
 }
 
+// SetFontFeatures sets the OpenType features applied to the text of current text style.
+// Kerning and ligatures are enabled by default.
+func (c *Context) SetFontFeatures(features FontFeature) {
+	c.getState().fontFeatures = features
+}
+
+// FontFeatures gets the OpenType features applied to the text of current text style.
+func (c *Context) FontFeatures() FontFeature {
+	return c.getState().fontFeatures
+}
+
+// SetTextDirection sets the base direction of the paragraphs of current text style.
+// Right to left and mixed direction text is reordered with the Unicode bidirectional algorithm.
+func (c *Context) SetTextDirection(direction TextDirection) {
+	c.getState().textDirection = direction
+}
+
+// TextDirection gets the base direction of the paragraphs of current text style.
+func (c *Context) TextDirection() TextDirection {
+	return c.getState().textDirection
+}
+
+// SetHyphenateFunc sets the function which finds the hyphenation points of words of current text style,
+// which are used by TextBreakLines when a word does not fit in a row. Hyphenation is disabled with nil.
+func (c *Context) SetHyphenateFunc(hyphenate HyphenateFunc) {
+	c.getState().hyphenate = hyphenate
+}
+
+// SetTextRenderMode sets how the glyphs of current text style are rasterized.
+func (c *Context) SetTextRenderMode(mode TextRenderMode) {
+	c.getState().renderMode = mode
+}
+
+// TextRenderMode gets how the glyphs of current text style are rasterized.
+func (c *Context) TextRenderMode() TextRenderMode {
+	return c.getState().renderMode
+}
+
+// SetTextHinting sets whether glyphs of TextRenderBitmap, TextRenderSubpixel and TextRenderLCD modes
+// up to 32 pixels have their horizontal edges fitted to the pixel grid, which makes small text crisper
+// at low pixel densities. Unlike the text style it isn't saved with the state, it applies to the
+// whole context. Hinting is disabled by default, and should stay so for scaled text.
+func (c *Context) SetTextHinting(enabled bool) {
+	c.fs.SetHinting(enabled)
+}
+
+// TextHinting gets whether glyphs are fitted to the pixel grid.
+func (c *Context) TextHinting() bool {
+	return c.fs.Hinting()
+}
+
+// SetTextDecoration sets the lines drawn with the text of current text style, which can be combined
+// like Underline|Overline. The lines are placed with the metrics of the font and have the fill style.
+// Decorations are disabled with zero.
+func (c *Context) SetTextDecoration(decoration TextDecoration) {
+	c.getState().decoration = decoration
+}
+
+// TextDecoration gets the lines drawn with the text of current text style.
+func (c *Context) TextDecoration() TextDecoration {
+	return c.getState().decoration
+}
+
+// SetTextWritingMode sets whether text of current text style runs in rows or in columns. Vertical text
+// runs down columns, with the glyphs of CJK scripts upright and the others, like Latin words, rotated
+// clockwise. A column is centered on x with AlignCenter, and has its left or right edge at x with
+// AlignLeft and AlignRight. It starts at y with AlignTop and AlignBaseline, and ends at y with AlignBottom.
+// Text returns the vertical advance, TextBounds measures the height of the column, and TextBreakLines
+// and TextBox break text into columns of the given height. Decorations and text paths stay horizontal.
+func (c *Context) SetTextWritingMode(mode WritingMode) {
+	c.getState().writingMode = mode
+}
+
+// TextWritingMode gets whether text of current text style runs in rows or in columns.
+func (c *Context) TextWritingMode() WritingMode {
+	return c.getState().writingMode
+}
+
+// SetFontVariation sets the value of a variation axis of variable fonts of current text style,
+// like SetFontVariation("wght", 700). The value is clamped to the range of the axis,
+// fonts without the axis ignore it.
+func (c *Context) SetFontVariation(tag string, value float32) {
+	state := c.getState()
+	variations := make([]font.Variation, 0, len(state.variations)+1)
+	for _, v := range state.variations {
+		if v.Tag != tag {
+			variations = append(variations, v)
+		}
+	}
+	state.variations = append(variations, font.Variation{Tag: tag, Value: value})
+}
+
+// SetTabStops sets the positions tabs advance to in the text of current text style, from the left
+// edge of the text. A single position repeats, like SetTabStops(40) for every 40 units. After the
+// last of several positions, the distance between the last two repeats. Without positions, tabs
+// advance to every 8 spaces of the font, which is the default.
+func (c *Context) SetTabStops(stops ...float32) {
+	c.getState().tabStops = append([]float32(nil), stops...)
+}
+
+// TabStops gets the positions of the tab stops of current text style, nil for every 8 spaces.
+func (c *Context) TabStops() []float32 {
+	return c.getState().tabStops
+}
+
+// FontVariation gets the value of a variation axis of current text style, and whether it was set.
+func (c *Context) FontVariation(tag string) (float32, bool) {
+	for _, v := range c.getState().variations {
+		if v.Tag == tag {
+			return v.Value, true
+		}
+	}
+	return 0, false
+}
+
+// SetTextOutline sets the width and the color of the outline drawn around text of current text style.
+// Outlines are only drawn in TextRenderSDF mode, and together with glows they reach at most
+// an eighth of the font size. Outlines are disabled with zero width.
+func (c *Context) SetTextOutline(width float32, color Color) {
+	state := c.getState()
+	state.outlineWidth = width
+	state.outlineColor = color
+}
+
+// SetTextGlow sets the width and the color of the glow which fades out around text of current text style.
+// Glows are only drawn in TextRenderSDF mode, outside of the outline. Glows are disabled with zero width.
+func (c *Context) SetTextGlow(width float32, color Color) {
+	state := c.getState()
+	state.glowWidth = width
+	state.glowColor = color
+}
+
 // Text draws text string at specified location. If end is specified only the sub-string up to the end is drawn.
 func (c *Context) Text(x, y float32, str string) float32 {
 	return c.TextRune(x, y, []rune(str))
@@ -883,61 +1123,226 @@ func (c *Context) TextRune(x, y float32, runes []rune) float32 {
 	c.fs.SetBlur(state.fontBlur * scale)
 	c.fs.SetAlign(font.FONSAlign(state.textAlign))
 	c.fs.SetFont(state.fontID)
-
-	vertexCount := maxI(2, len(runes)) * 4 // conservative estimate.
-	vertexes := c.cache.allocVertexes(vertexCount)
+	c.fs.SetFeatures(font.FONSFeature(state.fontFeatures))
+	c.fs.SetDirection(font.FONSDirection(state.textDirection))
+	c.fs.SetRenderMode(font.FONSRenderMode(state.renderMode))
+	c.fs.SetVariations(state.variations)
+	c.fs.SetTabStops(state.scaledTabStops(scale))
+	c.fs.SetWritingMode(state.fontWritingMode())
 
 	iter := c.fs.TextIterForRunes(x*scale, y*scale, runes)
-	prevIter := iter
+	prevIter := *iter
+	startX := iter.X
 	index := 0
 
+	vertexCount := maxI(2, iter.GlyphCount()) * 6
+	vertexes := c.cache.allocVertexes(vertexCount)
+	var colorVertexes []vgVertex
+	colorIndex := 0
+
 	for {
 		quad, ok := iter.Next()
 		if !ok {
 			break
 		}
 		if iter.PrevGlyph == nil || iter.PrevGlyph.Index == -1 {
-			if !c.allocTextAtlas() {
-				break // no memory :(
-			}
-			if index != 0 {
-				c.renderText(vertexes[:index])
-				index = 0
+			if c.fs.ColorAtlasFull() {
+				// the color glyphs so far refer to the current color atlas
+				if colorIndex != 0 {
+					c.flushTextTexture()
+					c.renderColorText(colorVertexes[:colorIndex])
+					colorIndex = 0
+				}
+				c.resetColorAtlas()
+			} else {
+				// the glyphs so far refer to the current atlas
+				if index != 0 {
+					c.flushTextTexture()
+					c.renderText(vertexes[:index])
+					index = 0
+				}
+				if !c.allocTextAtlas() {
+					break // no memory :(
+				}
 			}
-			iter = prevIter
+			*iter = prevIter
 			quad, _ = iter.Next() // try again
 			if iter.PrevGlyph == nil || iter.PrevGlyph.Index == -1 {
 				// still can not find glyph?
 				break
 			}
 		}
-		prevIter = iter
+		prevIter = *iter
 		// Transform corners.
 		c0, c1 := state.xform.TransformPoint(quad.X0*invScale, quad.Y0*invScale)
 		c2, c3 := state.xform.TransformPoint(quad.X1*invScale, quad.Y0*invScale)
 		c4, c5 := state.xform.TransformPoint(quad.X1*invScale, quad.Y1*invScale)
 		c6, c7 := state.xform.TransformPoint(quad.X0*invScale, quad.Y1*invScale)
 		//log.Printf("quad(%c) x0=%d, x1=%d, y0=%d, y1=%d, s0=%d, s1=%d, t0=%d, t1=%d\n", iter.CodePoint, int(quad.X0), int(quad.X1), int(quad.Y0), int(quad.Y1), int(1024*quad.S0), int(quad.S1*1024), int(quad.T0*1024), int(quad.T1*1024))
-		// Create triangles
-		if index+4 <= vertexCount {
-			(&vertexes[index]).set(c2, c3, quad.S1, quad.T0)
-			(&vertexes[index+1]).set(c0, c1, quad.S0, quad.T0)
-			(&vertexes[index+2]).set(c4, c5, quad.S1, quad.T1)
-			(&vertexes[index+3]).set(c6, c7, quad.S0, quad.T1)
-			index += 4
+		// Create triangles, color glyphs are drawn from their own atlas
+		dst, n := vertexes, &index
+		if iter.PrevGlyph.Color {
+			if colorVertexes == nil {
+				colorVertexes = c.cache.allocVertexes(vertexCount)
+			}
+			dst, n = colorVertexes, &colorIndex
+		}
+		// texture coordinates of the corners, turned with the glyphs rotated in vertical text
+		s0, t0, s1, t1, s2, t2, s3, t3 := quad.S0, quad.T0, quad.S1, quad.T0, quad.S1, quad.T1, quad.S0, quad.T1
+		if quad.Rotated {
+			s0, t0, s1, t1, s2, t2, s3, t3 = quad.S0, quad.T1, quad.S0, quad.T0, quad.S1, quad.T0, quad.S1, quad.T1
+		}
+		if *n+6 <= vertexCount {
+			(&dst[*n]).set(c0, c1, s0, t0)
+			(&dst[*n+1]).set(c4, c5, s2, t2)
+			(&dst[*n+2]).set(c2, c3, s1, t1)
+			(&dst[*n+3]).set(c0, c1, s0, t0)
+			(&dst[*n+4]).set(c6, c7, s3, t3)
+			(&dst[*n+5]).set(c4, c5, s2, t2)
+			*n += 6
 		}
 	}
 	c.flushTextTexture()
 	c.renderText(vertexes[:index])
+	if colorIndex != 0 {
+		c.renderColorText(colorVertexes[:colorIndex])
+	}
+	if state.writingMode != WritingHorizontal {
+		return iter.Y
+	}
+	if state.decoration != 0 {
+		c.textDecoration(startX*invScale, iter.NextX*invScale, y)
+	}
 	return iter.X
 }
 
+// textDecoration draws the decoration lines of current text style from x0 to x1
+// under text drawn at y. The current path is kept.
+func (c *Context) textDecoration(x0, x1, y float32) {
+	state := c.getState()
+	metrics := c.FontMetrics()
+	if state.textAlign&AlignTop != 0 {
+		y += metrics.Ascender
+	} else if state.textAlign&AlignMiddle != 0 {
+		y += (metrics.Ascender + metrics.Descender) * 0.5
+	} else if state.textAlign&AlignBottom != 0 {
+		y += metrics.Descender
+	}
+
+	commands, commandX, commandY := c.commands, c.commandX, c.commandY
+	c.commands = nil
+	c.cache.clearPathCache()
+	if state.decoration&Underline != 0 {
+		c.Rect(x0, y-metrics.UnderlinePosition, x1-x0, metrics.UnderlineThickness)
+	}
+	if state.decoration&Strikethrough != 0 {
+		c.Rect(x0, y-metrics.StrikeoutPosition, x1-x0, metrics.StrikeoutThickness)
+	}
+	if state.decoration&Overline != 0 {
+		c.Rect(x0, y-metrics.Ascender, x1-x0, metrics.UnderlineThickness)
+	}
+	c.Fill()
+	c.commands, c.commandX, c.commandY = commands, commandX, commandY
+	c.cache.clearPathCache()
+}
+
+// TextPath adds the outlines of the text string at the specified location to the current path,
+// with the font, size, letter spacing, alignment and direction of the current text style.
+// Unlike Text, the outlines aren't rasterized or snapped to pixels, so they can be filled with
+// any paint, stroked, used for hit testing or exported at any scale. Returns the horizontal advance.
+func (c *Context) TextPath(x, y float32, str string) float32 {
+	return c.TextPathRune(x, y, []rune(str))
+}
+
+// TextPathRune is an alternate version of TextPath that accepts rune slice.
+func (c *Context) TextPathRune(x, y float32, runes []rune) float32 {
+	state := c.getState()
+	if state.fontID == font.INVALID {
+		return x
+	}
+
+	c.fs.SetSize(state.fontSize)
+	c.fs.SetSpacing(state.letterSpacing)
+	c.fs.SetBlur(0)
+	c.fs.SetAlign(font.FONSAlign(state.textAlign))
+	c.fs.SetFont(state.fontID)
+	c.fs.SetFeatures(font.FONSFeature(state.fontFeatures))
+	c.fs.SetDirection(font.FONSDirection(state.textDirection))
+	c.fs.SetRenderMode(font.FONSRenderMode(state.renderMode))
+	c.fs.SetVariations(state.variations)
+	c.fs.SetTabStops(state.tabStops)
+	c.fs.SetWritingMode(font.WRITING_HORIZONTAL)
+
+	advance, outlines := c.fs.TextOutlines(x, y, runes)
+	for i := range outlines {
+		c.glyphPath(&outlines[i])
+	}
+	if state.textAlign&AlignRight != 0 {
+		return x
+	} else if state.textAlign&AlignCenter != 0 {
+		return x + advance*0.5
+	}
+	return x + advance
+}
+
+// glyphPath adds the contours of the glyph outline to the current path. Contours
+// winding like the largest one are solid, the others are holes, which fills
+// TrueType and CFF outlines alike.
+func (c *Context) glyphPath(outline *font.GlyphOutline) {
+	vertices := outline.Vertices
+	var contours [][]truetype.Vertex
+	for i, v := range vertices {
+		if v.Type == truetype.VertexMove || i == 0 {
+			contours = append(contours, nil)
+		}
+		contours[len(contours)-1] = append(contours[len(contours)-1], v)
+	}
+	areas := make([]float32, len(contours))
+	largest := 0
+	for i, contour := range contours {
+		// the control points approximate the curves well enough for the direction
+		var area float32
+		for j, v := range contour {
+			p := contour[(j+1)%len(contour)]
+			area += float32(v.X*p.Y - p.X*v.Y)
+		}
+		areas[i] = area
+		if absF(area) > absF(areas[largest]) {
+			largest = i
+		}
+	}
+	px := func(x int) float32 { return outline.X + float32(x)*outline.Scale }
+	py := func(y int) float32 { return outline.Y - float32(y)*outline.Scale }
+	for i, contour := range contours {
+		for _, v := range contour {
+			switch v.Type {
+			case truetype.VertexMove:
+				c.MoveTo(px(v.X), py(v.Y))
+			case truetype.VertexLine:
+				c.LineTo(px(v.X), py(v.Y))
+			case truetype.VertexCurve:
+				c.QuadTo(px(v.CX), py(v.CY), px(v.X), py(v.Y))
+			case truetype.VertexCubic:
+				c.BezierTo(px(v.CX), py(v.CY), px(v.CX1), py(v.CY1), px(v.X), py(v.Y))
+			}
+		}
+		c.ClosePath()
+		if (areas[i] < 0) != (areas[largest] < 0) {
+			c.PathWinding(Hole)
+		} else {
+			c.PathWinding(Solid)
+		}
+	}
+}
+
 // TextBox draws multi-line text string at specified location wrapped at the specified width.
 // If end is specified only the sub-string up to the end is drawn.
 // White space is stripped at the beginning of the rows,
-// the text is split at word boundaries or when new-line characters are encountered.
-// Words longer than the max width are slit at nearest character (i.e. no hyphenation).
+// the text is split at line break opportunities or when new-line characters are encountered.
+// Words longer than the max width are hyphenated with the function set with SetHyphenateFunc or split at nearest character.
 // Draws text string at specified location. If end is specified only the sub-string up to the end is drawn.
+// Vertical text is split into columns of the max width high, one line height wide, which progress from x
+// to the left or to the right. Horizontal align places the text of a column at its top, middle or bottom.
 func (c *Context) TextBox(x, y, breakRowWidth float32, str string) {
 	state := c.getState()
 	if state.fontID == font.INVALID {
@@ -962,8 +1367,40 @@ func (c *Context) TextBox(x, y, breakRowWidth float32, str string) {
 
 	state.textAlign = oldAlign
 
+	vertical := state.writingMode != WritingHorizontal
+	pitch := lineH * state.lineHeight
+	if vertical {
+		// columns are drawn from their top, centered in their pitch
+		state.textAlign = AlignCenter | AlignTop
+		x, pitch = state.firstColumn(x, pitch)
+	}
+
+	oldDirection := state.textDirection
 	for _, row := range c.TextBreakLinesRune(runes, breakRowWidth) {
 		text := string(runes[row.StartIndex:row.EndIndex])
+		if row.Hyphen {
+			text += "-"
+		}
+		// a row keeps the direction of its paragraph
+		if oldDirection == TextDirectionAuto {
+			if row.RTL {
+				state.textDirection = TextDirectionRTL
+			} else {
+				state.textDirection = TextDirectionLTR
+			}
+		}
+		if vertical {
+			switch hAlign {
+			case AlignLeft:
+				c.Text(x, y, text)
+			case AlignCenter:
+				c.Text(x, y+breakRowWidth*0.5-row.Width*0.5, text)
+			case AlignRight:
+				c.Text(x, y+breakRowWidth-row.Width, text)
+			}
+			x += pitch
+			continue
+		}
 		switch hAlign {
 		case AlignLeft:
 			c.Text(x, y, text)
@@ -972,13 +1409,75 @@ func (c *Context) TextBox(x, y, breakRowWidth float32, str string) {
 		case AlignRight:
 			c.Text(x+breakRowWidth-row.Width, y, text)
 		}
-		y += lineH * state.lineHeight
+		y += pitch
+	}
+	state.textDirection = oldDirection
+	state.textAlign = oldAlign
+}
+
+// TextEllipsize draws text string at specified location, shortened with Ellipsize to fit in maxWidth.
+// Returns the horizontal advance of the drawn text.
+func (c *Context) TextEllipsize(x, y, maxWidth float32, str string, mode Ellipsis) float32 {
+	return c.Text(x, y, c.Ellipsize(str, maxWidth, mode))
+}
+
+// Ellipsize returns the text string shortened to fit in maxWidth with current text style, by replacing
+// its end, middle or start with an ellipsis (…). White space next to the ellipsis is removed.
+// The string is returned as is if it fits or mode is EllipsisNone, and "" if not even the ellipsis fits.
+func (c *Context) Ellipsize(str string, maxWidth float32, mode Ellipsis) string {
+	width := func(s string) float32 {
+		w, _ := c.TextBounds(0, 0, s)
+		return w
+	}
+	if mode == EllipsisNone || width(str) <= maxWidth {
+		return str
+	}
+	const ellipsis = "\u2026"
+	runes := []rune(str)
+	// the text is only cut between clusters, marks stay with their base
+	positions := c.TextGlyphPositionsRune(0, 0, runes)
+	bounds := []int{0}
+	for i := 1; i < len(runes); i++ {
+		if isEllipsisBreak(runes, positions, i) {
+			bounds = append(bounds, i)
+		}
+	}
+	bounds = append(bounds, len(runes))
+	clusters := len(bounds) - 1
+	shorten := func(keep int) string {
+		head, tail := runes[:bounds[keep]], runes[len(runes):]
+		switch mode {
+		case EllipsisMiddle:
+			head, tail = runes[:bounds[(keep+1)/2]], runes[bounds[clusters-keep/2]:]
+		case EllipsisStart:
+			head, tail = runes[:0], runes[bounds[clusters-keep]:]
+		}
+		return strings.TrimRightFunc(string(head), unicode.IsSpace) + ellipsis + strings.TrimLeftFunc(string(tail), unicode.IsSpace)
 	}
+	// the most clusters which fit, the text only gets wider with more of them
+	keep := sort.Search(clusters, func(keep int) bool {
+		return width(shorten(keep+1)) > maxWidth
+	})
+	if keep == 0 && width(ellipsis) > maxWidth {
+		return ""
+	}
+	return shorten(keep)
+}
+
+// isEllipsisBreak returns true if Ellipsize may cut the text before the rune at i. The rune has to
+// start a shaped cluster, and neither be a mark nor be joined to the previous rune.
+func isEllipsisBreak(runes []rune, positions []GlyphPosition, i int) bool {
+	if len(positions) == len(runes) && positions[i].Cluster != i {
+		return false
+	}
+	r := runes[i]
+	return !unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) && r != '\u200d' && runes[i-1] != '\u200d'
 }
 
 // TextBounds measures the specified text string. Parameter bounds should be a pointer to float[4],
 // if the bounding box of the text should be returned. The bounds value are [xmin,ymin, xmax,ymax]
-// Returns the horizontal advance of the measured text (i.e. where the next character should drawn).
+// Returns the horizontal advance of the measured text (i.e. where the next character should drawn),
+// or the vertical advance of vertical text.
 // Measured values are returned in local coordinate space.
 func (c *Context) TextBounds(x, y float32, str string) (float32, []float32) {
 	state := c.getState()
@@ -993,10 +1492,18 @@ func (c *Context) TextBounds(x, y float32, str string) (float32, []float32) {
 	c.fs.SetBlur(state.fontBlur * scale)
 	c.fs.SetAlign(font.FONSAlign(state.textAlign))
 	c.fs.SetFont(state.fontID)
+	c.fs.SetFeatures(font.FONSFeature(state.fontFeatures))
+	c.fs.SetDirection(font.FONSDirection(state.textDirection))
+	c.fs.SetRenderMode(font.FONSRenderMode(state.renderMode))
+	c.fs.SetVariations(state.variations)
+	c.fs.SetTabStops(state.scaledTabStops(scale))
+	c.fs.SetWritingMode(state.fontWritingMode())
 
 	width, bounds := c.fs.TextBounds(x*scale, y*scale, str)
 	if bounds != nil {
-		bounds[1], bounds[3] = c.fs.LineBounds(y * scale)
+		if state.writingMode == WritingHorizontal {
+			bounds[1], bounds[3] = c.fs.LineBounds(y * scale)
+		}
 		bounds[0] *= invScale
 		bounds[1] *= invScale
 		bounds[2] *= invScale
@@ -1036,6 +1543,27 @@ func (c *Context) TextBoxBounds(x, y, breakRowWidth float32, str string) [4]floa
 	maxY := y
 
 	_, _, lineH := c.TextMetrics()
+	if state.writingMode != WritingHorizontal {
+		state.textAlign = oldAlign
+		// columns as in TextBox, one pitch wide
+		pitch := lineH * state.lineHeight
+		x, pitch = state.firstColumn(x, pitch)
+		for _, row := range c.TextBreakLinesRune(runes, breakRowWidth) {
+			var dy float32
+			switch hAlign {
+			case AlignCenter:
+				dy = breakRowWidth*0.5 - row.Width*0.5
+			case AlignRight:
+				dy = breakRowWidth - row.Width
+			}
+			minX = minF(minX, x-absF(pitch)*0.5)
+			maxX = maxF(maxX, x+absF(pitch)*0.5)
+			minY = minF(minY, y+row.MinX+dy)
+			maxY = maxF(maxY, y+row.MaxX+dy)
+			x += pitch
+		}
+		return [4]float32{minX, minY, maxX, maxY}
+	}
 	/*c.fs.SetSize(state.fontSize * scale)
 	c.fs.SetSpacing(state.letterSpacing * scale)
 	c.fs.SetBlur(state.fontBlur * scale)
@@ -1093,33 +1621,98 @@ func (c *Context) TextGlyphPositionsRune(x, y float32, runes []rune) []GlyphPosi
 	c.fs.SetBlur(state.fontBlur * scale)
 	c.fs.SetAlign(font.FONSAlign(state.textAlign))
 	c.fs.SetFont(state.fontID)
-
-	positions := make([]GlyphPosition, 0, len(runes))
+	c.fs.SetFeatures(font.FONSFeature(state.fontFeatures))
+	c.fs.SetDirection(font.FONSDirection(state.textDirection))
+	c.fs.SetRenderMode(font.FONSRenderMode(state.renderMode))
+	c.fs.SetVariations(state.variations)
+	c.fs.SetTabStops(state.scaledTabStops(scale))
+	c.fs.SetWritingMode(state.fontWritingMode())
+
+	positions := make([]GlyphPosition, len(runes))
+	for i := range positions {
+		positions[i] = GlyphPosition{Index: i, Runes: runes, X: x, MinX: x, MaxX: x, MinY: y, MaxY: y, Cluster: i, Visual: i}
+	}
 
 	iter := c.fs.TextIterForRunes(x*scale, y*scale, runes)
-	prevIter := iter
+	prevIter := *iter
+	// glyphs of a cluster are collected before their runes get positions
+	var clusterStart, clusterEnd, visual int
+	var clusterX, clusterNextX, clusterMinX, clusterMaxX, clusterMinY, clusterMaxY float32
+	var clusterRTL bool
 
 	for {
 		quad, ok := iter.Next()
 		if !ok {
 			break
 		}
-		if iter.PrevGlyph.Index == -1 && !c.allocTextAtlas() {
-			iter = prevIter
-			quad, _ = iter.Next() // try again
+		if iter.PrevGlyph == nil {
+			// the atlas is full, try again when there is room
+			if !c.allocGlyphAtlas() {
+				break
+			}
+			*iter = prevIter
+			if quad, ok = iter.Next(); !ok || iter.PrevGlyph == nil {
+				break
+			}
 		}
-		prevIter = iter
-		positions = append(positions, GlyphPosition{
-			Index: iter.CurrentIndex,
-			Runes: runes,
-			X:     iter.X * invScale,
-			MinX:  minF(iter.X, quad.X0) * invScale,
-			MaxX:  minF(iter.NextX, quad.X1) * invScale,
-		})
+		prevIter = *iter
+		if iter.CurrentIndex == clusterStart && clusterEnd > clusterStart {
+			clusterMinX = minF(clusterMinX, quad.X0)
+			clusterMaxX = maxF(clusterMaxX, quad.X1)
+			clusterMinY = minF(clusterMinY, quad.Y0)
+			clusterMaxY = maxF(clusterMaxY, quad.Y1)
+			clusterNextX = iter.NextX
+			continue
+		}
+		visual = setCluster(positions, clusterStart, clusterEnd, visual, clusterRTL, clusterX, clusterNextX, clusterMinX, clusterMaxX, clusterMinY, clusterMaxY, invScale)
+		clusterStart, clusterEnd, clusterRTL = iter.CurrentIndex, iter.NextIndex, iter.RTL
+		clusterX, clusterNextX = iter.X, iter.NextX
+		clusterMinX, clusterMaxX = minF(iter.X, quad.X0), quad.X1
+		clusterMinY, clusterMaxY = quad.Y0, quad.Y1
 	}
+	setCluster(positions, clusterStart, clusterEnd, visual, clusterRTL, clusterX, clusterNextX, clusterMinX, clusterMaxX, clusterMinY, clusterMaxY, invScale)
 	return positions
 }
 
+// setCluster sets the positions of the runes [start, end) of a shaped cluster,
+// which divide the advance of the cluster evenly, from the right in right to
+// left clusters. It returns the visual position after the cluster.
+func setCluster(positions []GlyphPosition, start, end, visual int, rtl bool, x, nextX, minX, maxX, minY, maxY, invScale float32) int {
+	count := end - start
+	if count <= 0 {
+		return visual
+	}
+	width := (nextX - x) / float32(count)
+	for i := 0; i < count; i++ {
+		k := i
+		if rtl {
+			k = count - 1 - i
+		}
+		x0 := x + width*float32(k)
+		x1 := x0 + width
+		if k == 0 {
+			x0 = minX
+		}
+		if k == count-1 {
+			x1 = minF(nextX, maxX)
+		}
+		position := &positions[start+i]
+		position.X = (x + width*float32(k)) * invScale
+		if rtl {
+			position.X = (nextX - width*float32(i)) * invScale
+		}
+		position.MinX = x0 * invScale
+		position.MaxX = x1 * invScale
+		position.MinY = minY * invScale
+		position.MaxY = maxY * invScale
+		position.Cluster = start
+		position.Visual = visual + k
+		position.RTL = rtl
+		position.Advance = width * invScale
+	}
+	return visual + count
+}
+
 // TextMetrics returns the vertical metrics based on the current text style.
 // Measured values are returned in local coordinate space.
 func (c *Context) TextMetrics() (float32, float32, float32) {
@@ -1135,16 +1728,63 @@ func (c *Context) TextMetrics() (float32, float32, float32) {
 	c.fs.SetBlur(state.fontBlur * scale)
 	c.fs.SetAlign(font.FONSAlign(state.textAlign))
 	c.fs.SetFont(state.fontID)
+	c.fs.SetFeatures(font.FONSFeature(state.fontFeatures))
+	c.fs.SetDirection(font.FONSDirection(state.textDirection))
+	c.fs.SetRenderMode(font.FONSRenderMode(state.renderMode))
+	c.fs.SetVariations(state.variations)
+	c.fs.SetTabStops(state.scaledTabStops(scale))
+	c.fs.SetWritingMode(state.fontWritingMode())
 
 	ascender, descender, lineH := c.fs.VerticalMetrics()
 	return ascender * invScale, descender * invScale, lineH * invScale
 }
 
+// FontMetrics returns the metrics of the font of current text style.
+// Positions and heights are above the baseline, negative below it.
+// Measured values are returned in local coordinate space.
+func (c *Context) FontMetrics() FontMetrics {
+	state := c.getState()
+	scale := state.getFontScale() * c.devicePxRatio
+	invScale := 1.0 / scale
+	if state.fontID == font.INVALID {
+		return FontMetrics{}
+	}
+
+	c.fs.SetSize(state.fontSize * scale)
+	c.fs.SetSpacing(state.letterSpacing * scale)
+	c.fs.SetBlur(state.fontBlur * scale)
+	c.fs.SetAlign(font.FONSAlign(state.textAlign))
+	c.fs.SetFont(state.fontID)
+	c.fs.SetFeatures(font.FONSFeature(state.fontFeatures))
+	c.fs.SetDirection(font.FONSDirection(state.textDirection))
+	c.fs.SetRenderMode(font.FONSRenderMode(state.renderMode))
+	c.fs.SetVariations(state.variations)
+	c.fs.SetTabStops(state.scaledTabStops(scale))
+	c.fs.SetWritingMode(state.fontWritingMode())
+
+	metrics := c.fs.FontMetrics()
+	return FontMetrics{
+		Ascender:           metrics.Ascender * invScale,
+		Descender:          metrics.Descender * invScale,
+		LineHeight:         metrics.LineHeight * invScale,
+		XHeight:            metrics.XHeight * invScale,
+		CapHeight:          metrics.CapHeight * invScale,
+		UnderlinePosition:  metrics.UnderlinePosition * invScale,
+		UnderlineThickness: metrics.UnderlineThickness * invScale,
+		StrikeoutPosition:  metrics.StrikeoutPosition * invScale,
+		StrikeoutThickness: metrics.StrikeoutThickness * invScale,
+		UnitsPerEm:         metrics.UnitsPerEm,
+	}
+}
+
 // TextBreakLines breaks the specified text into lines.
 // If end is specified only the sub-string will be used.
 // White space is stripped at the beginning of the rows,
-// the text is split at word boundaries or when new-line characters are encountered.
-// Words longer than the max width are slit at nearest character (i.e. no hyphenation).
+// the text is split at the line break opportunities of the Unicode line breaking algorithm
+// or when new-line characters are encountered.
+// Words longer than the max width are hyphenated with the function set with SetHyphenateFunc,
+// or slit at nearest character.
+// Vertical text is broken into columns of the max width high, whose Width, MinX and MaxX are measured down the column.
 func (c *Context) TextBreakLines(str string, breakRowWidth float32) []TextRow {
 	return c.TextBreakLinesRune([]rune(str), breakRowWidth)
 }
@@ -1158,20 +1798,35 @@ func (c *Context) TextBreakLinesRune(runes []rune, breakRowWidth float32) []Text
 		return nil
 	}
 
-	currentType := vgSPACE
-	prevType := vgCHAR
-
 	c.fs.SetSize(state.fontSize * scale)
 	c.fs.SetSpacing(state.letterSpacing * scale)
 	c.fs.SetBlur(state.fontBlur * scale)
 	c.fs.SetAlign(font.FONSAlign(state.textAlign))
 	c.fs.SetFont(state.fontID)
+	c.fs.SetFeatures(font.FONSFeature(state.fontFeatures))
+	c.fs.SetDirection(font.FONSDirection(state.textDirection))
+	c.fs.SetRenderMode(font.FONSRenderMode(state.renderMode))
+	c.fs.SetVariations(state.variations)
+	c.fs.SetTabStops(state.scaledTabStops(scale))
+	c.fs.SetWritingMode(state.fontWritingMode())
 
 	breakRowWidth *= scale
+	vertical := state.writingMode != WritingHorizontal
+
+	breaks := font.LineBreaks(runes)
+	// pen positions of the cluster starts, to break words at hyphenation points
+	var clusterX []float32
+	var hyphenWidth float32
+	if state.hyphenate != nil {
+		clusterX = make([]float32, len(runes))
+		for i := range clusterX {
+			clusterX[i] = -1
+		}
+		hyphenWidth, _ = c.fs.TextBounds(0, 0, "-")
+	}
 
-	iter := c.fs.TextIterForRunes(0, 0, runes)
-	prevIter := iter
-	var prevCodePoint rune
+	iter := c.fs.LogicalTextIterForRunes(0, 0, runes)
+	prevIter := *iter
 	var rows []TextRow
 
 	var rowStartX, rowWidth, rowMinX, rowMaxX, wordStartX, wordMinX, breakWidth, breakMaxX float32
@@ -1179,161 +1834,151 @@ func (c *Context) TextBreakLinesRune(runes []rune, breakRowWidth float32) []Text
 	rowEnd := -1
 	wordStart := -1
 	breakEnd := -1
+	lastIndex := -1
 
 	for {
 		quad, ok := iter.Next()
 		if !ok {
 			break
 		}
-		if iter.PrevGlyph == nil || iter.PrevGlyph.Index == -1 && !c.allocTextAtlas() {
-			iter = prevIter
-			quad, _ = iter.Next() // try again
-		}
-		prevIter = iter
-		switch iter.CodePoint {
-		case 9: // \t
-			currentType = vgSPACE
-		case 11: // \v
-			currentType = vgSPACE
-		case 12: // \f
-			currentType = vgSPACE
-		case 0x00a0: // NBSP
-			currentType = vgSPACE
-		case 10: // \n
-			if prevCodePoint == 13 {
-				currentType = vgNEWLINE
-			} else {
-				currentType = vgSPACE
+		if iter.PrevGlyph == nil {
+			// the atlas is full, try again when there is room
+			if !c.allocGlyphAtlas() {
+				break
 			}
-		case 13: // \r
-			if prevCodePoint == 13 {
-				currentType = vgNEWLINE
-			} else {
-				currentType = vgSPACE
+			*iter = prevIter
+			if quad, ok = iter.Next(); !ok || iter.PrevGlyph == nil {
+				break
 			}
-		case 0x0085: // NEL
-			currentType = vgNEWLINE
-		default:
-			currentType = vgCHAR
 		}
-		if currentType == vgNEWLINE {
-			// Always handle new lines.
-			tmpRowStart := rowStart
-			if rowStart == -1 {
-				tmpRowStart = iter.CurrentIndex
+		prevIter = *iter
+		// rows of vertical text are measured down the column
+		penX, nextX := iter.X, iter.NextX
+		if vertical {
+			penX, nextX = iter.Y, iter.NextY
+			quad.X0, quad.X1 = quad.Y0, quad.Y1
+		}
+		index := iter.CurrentIndex
+		if index != lastIndex {
+			// first glyph of a cluster
+			if clusterX != nil {
+				clusterX[index] = penX
 			}
-			if rowEnd == -1 {
-				rowEnd = iter.CurrentIndex
+			switch breaks[index] {
+			case font.BREAK_MANDATORY:
+				if rowStart == -1 {
+					rowStart = lastIndex
+					rowEnd = lastIndex
+				}
+				rows = append(rows, TextRow{
+					Runes:      runes,
+					StartIndex: rowStart,
+					EndIndex:   rowEnd,
+					Width:      rowWidth * invScale,
+					MinX:       rowMinX * invScale,
+					MaxX:       rowMaxX * invScale,
+					NextIndex:  index,
+				})
+				rowStart = -1
+				rowEnd = -1
+				rowWidth = 0
+				rowMinX = 0
+				rowMaxX = 0
+			case font.BREAK_ALLOWED:
+				if rowStart != -1 {
+					breakEnd = rowEnd
+					breakWidth = rowWidth
+					breakMaxX = rowMaxX
+					wordStart = index
+					wordStartX = penX
+					wordMinX = quad.X0
+				}
 			}
-			rows = append(rows, TextRow{
-				Runes:      runes,
-				StartIndex: tmpRowStart,
-				EndIndex:   rowEnd,
-				Width:      rowWidth * invScale,
-				MinX:       rowMinX * invScale,
-				MaxX:       rowMaxX * invScale,
-				NextIndex:  iter.NextIndex,
-			})
+			lastIndex = index
+		}
+		if unicode.IsSpace(iter.CodePoint) {
+			// White space at the end of the row hangs over the break width.
+			continue
+		}
+		if rowStart == -1 {
+			// The current char is the row so far
+			rowStartX = penX
+			rowStart = index
+			rowEnd = iter.NextIndex
+			rowWidth = nextX - rowStartX
+			rowMinX = quad.X0 - rowStartX
+			rowMaxX = quad.X1 - rowStartX
+			wordStart = index
+			wordStartX = penX
+			wordMinX = quad.X0
 			// Set null break point
 			breakEnd = rowStart
 			breakWidth = 0.0
 			breakMaxX = 0.0
-			rowStart = -1
-			rowEnd = -1
-			rowMinX = 0
-			rowMaxX = 0
-			// Indicate to skip the white space at the beginning of the row.
-
-		} else {
-			if rowStart == -1 {
-				if currentType == vgCHAR {
-					// The current char is the row so far
-					rowStartX = iter.X
-					rowStart = iter.CurrentIndex
-					rowEnd = iter.NextIndex
-					rowWidth = iter.NextX - rowStartX // q.x1 - rowStartX;
-					rowMinX = quad.X0 - rowStartX
-					rowMaxX = quad.X1 - rowStartX
-					wordStart = iter.CurrentIndex
-					wordStartX = iter.X
-					wordMinX = quad.X0 - rowStartX
-					// Set null break point
-					breakEnd = rowStart
-					breakWidth = 0.0
-					breakMaxX = 0.0
-				}
+			continue
+		}
+		// Break to new line when a character is beyond break width.
+		if nextX-rowStartX > breakRowWidth && index != rowStart {
+			if hyphen := c.hyphenationPoint(runes, breaks, clusterX, wordStart, index, rowStartX+breakRowWidth-hyphenWidth); hyphen != -1 {
+				// Hyphenate the word which does not fit.
+				rows = append(rows, TextRow{
+					Runes:      runes,
+					StartIndex: rowStart,
+					EndIndex:   hyphen,
+					Width:      (clusterX[hyphen] - rowStartX + hyphenWidth) * invScale,
+					MinX:       rowMinX * invScale,
+					MaxX:       (clusterX[hyphen] - rowStartX + hyphenWidth) * invScale,
+					NextIndex:  hyphen,
+					Hyphen:     true,
+				})
+				rowStartX = clusterX[hyphen]
+				rowStart = hyphen
+				rowMinX = 0
+				wordStart = hyphen
+				wordStartX = rowStartX
+				wordMinX = rowStartX
+			} else if breakEnd == rowStart {
+				// The current word is longer than the row length, just break it from here.
+				rows = append(rows, TextRow{
+					Runes:      runes,
+					StartIndex: rowStart,
+					EndIndex:   index,
+					Width:      rowWidth * invScale,
+					MinX:       rowMinX * invScale,
+					MaxX:       rowMaxX * invScale,
+					NextIndex:  index,
+				})
+				rowStartX = penX
+				rowStart = index
+				rowMinX = quad.X0 - rowStartX
+				wordStart = index
+				wordStartX = penX
+				wordMinX = quad.X0
 			} else {
-				nextWidth := iter.NextX - rowStartX
-				// track last non-white space character
-				if currentType == vgCHAR {
-					rowEnd = iter.NextIndex
-					rowWidth = iter.NextX - rowStartX
-					rowMaxX = quad.X1 - rowStartX
-				}
-				// track last end of a word
-				if prevType == vgCHAR && currentType == vgSPACE {
-					breakEnd = iter.CurrentIndex
-					breakWidth = rowWidth
-					breakMaxX = rowMaxX
-				}
-				// track last beginning of a word
-				if prevType == vgSPACE && currentType == vgCHAR {
-					wordStart = iter.CurrentIndex
-					wordStartX = iter.X
-					wordMinX = quad.X0 - rowStartX
-				}
-				// Break to new line when a character is beyond break width.
-				if currentType == vgCHAR && nextWidth > breakRowWidth {
-					// The run length is too long, need to break to new line.
-					if breakEnd == rowStart {
-						// The current word is longer than the row length, just break it from here.
-						rows = append(rows, TextRow{
-							Runes:      runes,
-							StartIndex: rowStart,
-							EndIndex:   iter.CurrentIndex,
-							Width:      rowWidth * invScale,
-							MinX:       rowMinX * invScale,
-							MaxX:       rowMaxX * invScale,
-							NextIndex:  iter.CurrentIndex,
-						})
-						rowStartX = iter.X
-						rowStart = iter.CurrentIndex
-						rowEnd = iter.NextIndex
-						rowWidth = iter.NextX - rowStartX
-						rowMinX = quad.X0 - rowStartX
-						rowMaxX = quad.X1 - rowStartX
-						wordStart = iter.CurrentIndex
-						wordStartX = iter.X
-						wordMinX = quad.X0 - rowStartX
-					} else {
-						// Break the line from the end of the last word, and start new line from the beginning of the new.
-						rows = append(rows, TextRow{
-							Runes:      runes,
-							StartIndex: rowStart,
-							EndIndex:   breakEnd,
-							Width:      breakWidth * invScale,
-							MinX:       rowMinX * invScale,
-							MaxX:       breakMaxX * invScale,
-							NextIndex:  wordStart,
-						})
-						rowStartX = wordStartX
-						rowStart = wordStart
-						rowEnd = iter.NextIndex
-						rowWidth = iter.NextX - rowStartX
-						rowMinX = wordMinX
-						rowMaxX = quad.X1 - rowStartX
-						// No change to the word start
-					}
-					// Set null break point
-					breakEnd = rowStart
-					breakWidth = 0.0
-					breakMaxX = 0.0
-				}
+				// Break the line from the end of the last word, and start new line from the beginning of the new.
+				rows = append(rows, TextRow{
+					Runes:      runes,
+					StartIndex: rowStart,
+					EndIndex:   breakEnd,
+					Width:      breakWidth * invScale,
+					MinX:       rowMinX * invScale,
+					MaxX:       breakMaxX * invScale,
+					NextIndex:  wordStart,
+				})
+				rowStartX = wordStartX
+				rowStart = wordStart
+				rowMinX = wordMinX - rowStartX
+				// No change to the word start
 			}
+			// Set null break point
+			breakEnd = rowStart
+			breakWidth = 0.0
+			breakMaxX = 0.0
 		}
-
-		prevCodePoint = iter.CodePoint
-		prevType = currentType
+		// track last non-white space character
+		rowEnd = iter.NextIndex
+		rowWidth = nextX - rowStartX
+		rowMaxX = quad.X1 - rowStartX
 	}
 	if rowStart != -1 {
 		rows = append(rows, TextRow{
@@ -1346,9 +1991,52 @@ func (c *Context) TextBreakLinesRune(runes []rune, breakRowWidth float32) []Text
 			NextIndex:  len(runes),
 		})
 	}
+	bidi := font.NewBidi(runes, font.FONSDirection(state.textDirection))
+	for i := range rows {
+		setRowOrder(&rows[i], bidi)
+	}
 	return rows
 }
 
+// hyphenationPoint returns the last hyphenation point of the word from
+// start, which has been measured up to end, where a row ending with a hyphen
+// fits before maxX. It returns -1 if there is none.
+func (c *Context) hyphenationPoint(runes []rune, breaks []font.FONSBreak, clusterX []float32, start, end int, maxX float32) int {
+	hyphenate := c.getState().hyphenate
+	if hyphenate == nil {
+		return -1
+	}
+	wordEnd := start + 1
+	for wordEnd < len(runes) && breaks[wordEnd] == font.BREAK_NONE {
+		wordEnd++
+	}
+	point := -1
+	for _, i := range hyphenate(runes[start:wordEnd]) {
+		i += start
+		if i > start && i <= end && i > point && clusterX[i] >= 0 && clusterX[i] <= maxX {
+			point = i
+		}
+	}
+	return point
+}
+
+// setRowOrder sets the direction of the row and, if some of its runes are
+// right to left, the mappings between its logical and visual order.
+func setRowOrder(row *TextRow, bidi *font.Bidi) {
+	row.RTL = bidi.ParagraphLevel(row.StartIndex)&1 == 1
+	levels := bidi.LineLevels(row.StartIndex, row.EndIndex)
+	for _, level := range levels {
+		if level&1 == 1 {
+			row.VisualToLogical = bidi.VisualOrder(row.StartIndex, row.EndIndex)
+			row.LogicalToVisual = make([]int, len(row.VisualToLogical))
+			for visual, logical := range row.VisualToLogical {
+				row.LogicalToVisual[logical] = visual
+			}
+			return
+		}
+	}
+}
+
 func createInternal(params vgParams) (*Context, error) {
 	context := &Context{
 		params:     params,
@@ -1513,12 +2201,19 @@ func (c *Context) flushTextTexture() {
 			c.params.renderUpdateTexture(fontImage, x, y, w, h, data)
 		}
 	}
+	if dirty := c.fs.ValidateColorTexture(); dirty != nil {
+		data, iw, ih := c.fs.GetColorTextureData()
+		if c.colorFontImage == 0 {
+			c.colorFontImage = c.params.renderCreateTexture(vgTextureRGBA, iw, ih, ImagePreMultiplied, nil)
+		}
+		c.params.renderUpdateTexture(c.colorFontImage, dirty[0], dirty[1], dirty[2]-dirty[0], dirty[3]-dirty[1], data)
+	}
 }
 
 func (c *Context) allocTextAtlas() bool {
 	c.flushTextTexture()
 	if c.fontImageIdx >= vgMaxFontImages-1 {
-		return false
+		return c.evictTextAtlas()
 	}
 	var iw, ih int
 	// if next fontImage already have a texture
@@ -1542,6 +2237,53 @@ func (c *Context) allocTextAtlas() bool {
 	return true
 }
 
+// evictTextAtlas makes room in the last font image by evicting the least
+// recently used glyphs. The calls queued so far are rendered first, as the
+// glyphs kept in the atlas move. Compacting the atlas may make room even if
+// no glyph is evicted.
+func (c *Context) evictTextAtlas() bool {
+	c.params.renderFlush()
+	usage := c.fs.AtlasUsage()
+	if c.fs.EvictGlyphs() == 0 && c.fs.AtlasUsage() >= usage {
+		return false
+	}
+	c.flushTextTexture()
+	return true
+}
+
+// allocGlyphAtlas makes room for a glyph which didn't fit, in the color atlas
+// if it is a color glyph and in the text atlas otherwise.
+func (c *Context) allocGlyphAtlas() bool {
+	if c.fs.ColorAtlasFull() {
+		c.resetColorAtlas()
+		return true
+	}
+	return c.allocTextAtlas()
+}
+
+// resetColorAtlas removes all color glyphs when the color atlas is full. The calls
+// queued so far are rendered first, as the atlas is drawn over.
+func (c *Context) resetColorAtlas() {
+	c.params.renderFlush()
+	c.fs.ResetColorAtlas()
+	c.flushTextTexture()
+}
+
+// renderColorText draws the triangles of color glyphs with their own colors.
+// Only the alpha of the fill style and the global alpha apply.
+func (c *Context) renderColorText(vertexes []vgVertex) {
+	state := c.getState()
+	paint := state.fill
+	paint.image = c.colorFontImage
+	alpha := paint.innerColor.A * state.alpha
+	paint.innerColor = RGBAf(1, 1, 1, alpha)
+	paint.outerColor = RGBAf(1, 1, 1, alpha)
+	c.params.renderTriangles(&paint, &state.scissor, vertexes)
+
+	c.drawCallCount++
+	c.textTriCount += len(vertexes) / 3
+}
+
 func (c *Context) renderText(vertexes []vgVertex) {
 	state := c.getState()
 	paint := state.fill
@@ -1553,7 +2295,37 @@ func (c *Context) renderText(vertexes []vgVertex) {
 	paint.innerColor.A *= state.alpha
 	paint.outerColor.A *= state.alpha
 
-	c.params.renderTriangleStrip(&paint, &state.scissor, vertexes)
+	if state.renderMode == TextRenderSDF {
+		// signed distance field glyphs are scaled to the size on the screen
+		scale := state.xform.getAverageScale() * c.devicePxRatio
+		sdf := vgSDFText{
+			scale:        2 * font.FONS_SDF_SPREAD * state.fontSize * scale / font.FONS_SDF_SIZE,
+			outlineWidth: state.outlineWidth * scale,
+			outlineColor: state.outlineColor,
+			glowWidth:    state.glowWidth * scale,
+			glowColor:    state.glowColor,
+		}
+		sdf.outlineColor.A *= state.alpha
+		sdf.glowColor.A *= state.alpha
+		c.params.renderSDFTriangles(&paint, &state.scissor, vertexes, &sdf)
+	} else if state.renderMode == TextRenderLCD && state.writingMode == WritingHorizontal {
+		// every pixel of LCD glyphs is three texels, the red and blue ones are beside the green one,
+		// vertical text has subpixel glyphs instead
+		_, width, _ := c.fs.GetTextureData()
+		shifted := c.cache.allocVertexes(len(vertexes))
+		for channel := 1; channel <= 3; channel++ {
+			shift := float32(channel-2) / float32(width)
+			for i := range vertexes {
+				shifted[i] = vertexes[i]
+				shifted[i].u += shift
+			}
+			c.params.renderChannelTriangles(&paint, &state.scissor, shifted[:len(vertexes)], channel)
+		}
+		c.drawCallCount += 2
+		c.textTriCount += len(vertexes) / 3 * 2
+	} else {
+		c.params.renderTriangles(&paint, &state.scissor, vertexes)
+	}
 
 	c.drawCallCount++
 	c.textTriCount += len(vertexes) / 3